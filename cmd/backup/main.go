@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/referendumApp/statusphere-example-app-go/internal/backup"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const usage = `Usage: backup [-db path] [-dir dir] [-keep n] <command> [args]
+
+Commands:
+  snapshot           Back up the database while it is in use, check the copy,
+                     and delete snapshots beyond the newest -keep
+  list               List the snapshots in -dir, newest first
+  verify file        Run SQLite's integrity check on a snapshot
+  restore file       Replace the database with a snapshot; refuses to run
+                     while the server has the database open
+
+Flags:
+`
+
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Debug().Msg("No .env file found, using environment variables")
+	}
+
+	keep, err := strconv.Atoi(getEnv("BACKUP_KEEP", strconv.Itoa(backup.DefaultKeep)))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid BACKUP_KEEP")
+	}
+
+	dsn := flag.String("db", getEnv("DATABASE_URL", getEnv("DB_PATH", "./statusphere.db")), "SQLite database path")
+	dir := flag.String("dir", getEnv("BACKUP_DIR", "./backups"), "Directory holding the snapshots")
+	flag.IntVar(&keep, "keep", keep, "Newest snapshots to keep; 0 keeps all")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 || keep < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	backups := backup.New(nil, *dir, keep)
+
+	switch {
+	case args[0] == "snapshot" && len(args) == 1:
+		snapshot(*dsn, *dir, keep)
+	case args[0] == "list" && len(args) == 1:
+		list(backups)
+	case args[0] == "verify" && len(args) == 2:
+		if err := backup.Verify(args[1]); err != nil {
+			log.Fatal().Err(err).Msg("Snapshot is not usable")
+		}
+		fmt.Println(args[1], "is ok")
+	case args[0] == "restore" && len(args) == 2:
+		restore(*dsn, args[1])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// snapshot backs up the database once
+func snapshot(dsn, dir string, keep int) {
+	if _, ok := db.SQLitePath(dsn); !ok {
+		log.Fatal().Err(db.ErrBackupUnsupported).Msg("Cannot back up this database")
+	}
+
+	database, err := db.Open(dsn)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open database")
+	}
+	defer database.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	snapshot, err := backup.New(database, dir, keep).Snapshot(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to back up database")
+	}
+	fmt.Printf("Wrote %s (%d bytes)\n", snapshot.Path, snapshot.Size)
+}
+
+// list prints the snapshots, newest first
+func list(backups *backup.Backups) {
+	snapshots, err := backups.List()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to list snapshots")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TAKEN\tBYTES\tPATH")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", s.Time.Format(time.RFC3339), s.Size, s.Path)
+	}
+	w.Flush()
+}
+
+// restore puts a snapshot in place of the database
+func restore(dsn, snapshot string) {
+	path, ok := db.SQLitePath(dsn)
+	if !ok {
+		log.Fatal().Str("db", dsn).Msg("Only SQLite database files can be restored")
+	}
+
+	aside, err := backup.Restore(snapshot, path)
+	if errors.Is(err, backup.ErrDatabaseInUse) {
+		log.Fatal().Err(err).Msg("Stop the server before restoring")
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to restore database")
+	}
+
+	fmt.Println("Restored", path, "from", snapshot)
+	if aside != "" {
+		fmt.Println("The previous database was kept at", aside)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/migrate"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const usage = `Usage: migrate [-db dsn] <command> [args]
+
+Commands:
+  status             List migrations and whether they have been applied
+  up [version]       Apply pending migrations, up to version if given
+  down [steps]       Roll back the latest migration, or the given number of them
+  create [-go] [-backend sqlite|postgres] name
+                     Add a new SQL migration, or a Go one with -go, for every
+                     backend unless one is given
+`
+
+// backends are the schemas kept under the migrations directory
+var backends = []db.Backend{db.SQLite, db.Postgres}
+
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Debug().Msg("No .env file found, using environment variables")
+	}
+
+	dsn := flag.String("db", getEnv("DATABASE_URL", getEnv("DB_PATH", "./statusphere.db")), "postgres:// URL or SQLite database path")
+	dir := flag.String("dir", "internal/db/migrations", "Directory holding each backend's migrations")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		create(*dir, args[1:])
+		return
+	}
+
+	database, err := db.Open(*dsn)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open database")
+	}
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load migrations")
+	}
+
+	switch args[0] {
+	case "status":
+		status(migrator)
+	case "up":
+		applied, err := migrator.Up(intArg(args, 0))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to migrate")
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+	case "down":
+		rolledBack, err := migrator.Down(intArg(args, 1))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to roll back")
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", rolledBack)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// status prints every migration and its state
+func status(migrator *migrate.Migrator) {
+	states, err := migrator.Status()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read migration status")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE")
+	for _, state := range states {
+		label := "pending"
+		switch {
+		case state.Drifted:
+			label = "CHANGED since applied at " + state.AppliedAt
+		case state.Unknown:
+			label = "UNKNOWN, applied at " + state.AppliedAt
+		case state.AppliedAt != "":
+			label = "applied at " + state.AppliedAt
+		}
+		if state.ByHand {
+			label += " (Go: checked by Revision only)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", state.Version, state.Name, label)
+	}
+	w.Flush()
+}
+
+// create adds the files for a new migration, numbered the same for every backend
+func create(dir string, args []string) {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	goMigration := flags.Bool("go", false, "Create a Go migration instead of SQL files")
+	backend := flags.String("backend", "", "Only create the migration for this backend")
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*backend != "" && *backend != string(db.SQLite) && *backend != string(db.Postgres)) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var dirs []string
+	for _, b := range backends {
+		dirs = append(dirs, filepath.Join(dir, string(b)))
+	}
+	version, err := migrate.NextVersion(dirs...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to number migration")
+	}
+
+	for i, b := range backends {
+		if *backend != "" && *backend != string(b) {
+			continue
+		}
+		paths, err := migrate.Create(dirs[i], version, flags.Arg(0), *goMigration)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create migration")
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+	}
+}
+
+// intArg parses the optional numeric argument after the command
+func intArg(args []string, fallback int) int {
+	if len(args) < 2 {
+		return fallback
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		log.Fatal().Str("arg", args[1]).Msg("Expected a non-negative number")
+	}
+	return n
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
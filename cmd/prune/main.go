@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/referendumApp/statusphere-example-app-go/internal/backup"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/retention"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const usage = `Usage: prune [flags]
+
+Applies the retention policy once: deletes statuses beyond the newest -keep of
+each author or indexed more than -max-age ago, always keeping each author's
+current status. Flags default to the RETENTION_* environment variables.
+
+The server's feed cache does not see statuses deleted by this tool, so stop
+the server before pruning; it refuses to prune a SQLite database a server has
+open. A -dry-run changes nothing and may run at any time.
+
+Flags:
+`
+
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Debug().Msg("No .env file found, using environment variables")
+	}
+
+	keep, err := strconv.Atoi(getEnv("RETENTION_KEEP_PER_AUTHOR", "0"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid RETENTION_KEEP_PER_AUTHOR")
+	}
+	maxAge, err := time.ParseDuration(getEnv("RETENTION_MAX_AGE", "0"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid RETENTION_MAX_AGE")
+	}
+
+	dsn := flag.String("db", getEnv("DATABASE_URL", getEnv("DB_PATH", "./statusphere.db")), "postgres:// URL or SQLite database path")
+	flag.IntVar(&keep, "keep", keep, "Newest statuses to keep per author; 0 for no limit")
+	flag.DurationVar(&maxAge, "max-age", maxAge, "Delete statuses indexed longer ago than this, e.g. 720h; 0 for no limit")
+	vacuum := flag.String("vacuum", getEnv("RETENTION_VACUUM", ""), "Reclaim space afterwards: incremental or full")
+	dryRun := flag.Bool("dry-run", false, "Only report what would be deleted")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	policy := retention.Policy{KeepPerAuthor: keep, MaxAge: maxAge, Vacuum: db.VacuumMode(*vacuum), DryRun: *dryRun}
+	if !policy.Enabled() || keep < 0 || maxAge < 0 || (*vacuum != "" && *vacuum != "incremental" && *vacuum != "full") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Deleting behind a running server would leave its feed cache showing
+	// statuses that are gone
+	if path, ok := db.SQLitePath(*dsn); ok && !policy.DryRun {
+		lock, err := backup.HoldExclusive(path)
+		if errors.Is(err, backup.ErrDatabaseInUse) {
+			log.Fatal().Msg("The database is in use; stop the server before pruning")
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to lock database")
+		}
+		defer lock.Release()
+	}
+
+	database, err := db.Open(*dsn)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open database")
+	}
+	defer database.Close()
+
+	// Batches already deleted stay deleted if interrupted
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	pruner := retention.New(database, policy)
+
+	report, err := pruner.Report(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to count prunable statuses")
+	}
+	fmt.Printf("%d status(es) from %d author(s) to prune: %d beyond the per-author limit, %d too old\n",
+		report.Statuses, report.Authors, report.OverLimit, report.TooOld)
+	if policy.DryRun || report.Statuses == 0 {
+		return
+	}
+
+	deleted, err := pruner.Prune(ctx)
+	fmt.Printf("Deleted %d status(es)\n", deleted)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to prune")
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
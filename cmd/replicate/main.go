@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/referendumApp/statusphere-example-app-go/internal/backup"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/replicate"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const usage = `Usage: replicate [-db path] [-replica url] <command> [args]
+
+The server replicates the database continuously when REPLICA_URL is set; this
+command inspects and restores from the replica.
+
+Commands:
+  generations              List the generations in the replica and the times
+                           each can restore to
+  restore [-at time] [-o file]
+                           Rebuild the database as it was at a time (RFC 3339,
+                           default latest) and put it in place of -db, which
+                           refuses to run while the server has it open; or
+                           write it to a new file with -o
+
+Flags:
+`
+
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Debug().Msg("No .env file found, using environment variables")
+	}
+
+	dsn := flag.String("db", getEnv("DATABASE_URL", getEnv("DB_PATH", "./statusphere.db")), "SQLite database path")
+	replicaURL := flag.String("replica", getEnv("REPLICA_URL", ""), "Directory or s3://bucket/prefix URL of the replica")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 || *replicaURL == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	target, err := replicate.OpenTarget(*replicaURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open replica")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	switch args[0] {
+	case "generations":
+		generations(ctx, target)
+	case "restore":
+		restore(ctx, target, *dsn, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// generations prints the generations in the replica
+func generations(ctx context.Context, target replicate.Target) {
+	gens, err := replicate.Generations(ctx, target)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to list generations")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GENERATION\tSEGMENTS\tFROM\tTO")
+	for _, g := range gens {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", g.Name, len(g.Segments), g.Start.Format(time.RFC3339), g.End.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// restore rebuilds the database from the replica
+func restore(ctx context.Context, target replicate.Target, dsn string, args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	atFlag := flags.String("at", "", "Restore to this time, e.g. 2025-03-07T12:00:00Z; default latest")
+	output := flags.String("o", "", "Write the restored database to this new file instead of replacing -db")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var at time.Time
+	if *atFlag != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, *atFlag); err != nil {
+			log.Fatal().Err(err).Msg("Invalid -at time")
+		}
+	}
+
+	dest := *output
+	path, ok := db.SQLitePath(dsn)
+	if dest == "" {
+		if !ok {
+			log.Fatal().Str("db", dsn).Msg("Only SQLite database files can be restored")
+		}
+		dest = path + ".replica-restore"
+		// Left behind if an earlier restore failed
+		os.Remove(dest)
+		defer os.Remove(dest)
+	}
+
+	restoredTo, err := replicate.Restore(ctx, target, at, dest)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to restore from replica")
+	}
+	if err := backup.Verify(dest); err != nil {
+		log.Fatal().Err(err).Msg("Restored database is not usable")
+	}
+
+	if *output != "" {
+		fmt.Printf("Restored to %s, current to %s\n", dest, restoredTo.Format(time.RFC3339Nano))
+		return
+	}
+
+	aside, err := backup.Restore(dest, path)
+	if errors.Is(err, backup.ErrDatabaseInUse) {
+		log.Fatal().Err(err).Msg("Stop the server before restoring")
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to restore database")
+	}
+
+	fmt.Printf("Restored %s, current to %s\n", path, restoredTo.Format(time.RFC3339Nano))
+	if aside != "" {
+		fmt.Println("The previous database was kept at", aside)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/referendumApp/statusphere-example-app-go/internal/backup"
 	"github.com/referendumApp/statusphere-example-app-go/internal/config"
 	"github.com/referendumApp/statusphere-example-app-go/internal/db"
 	"github.com/referendumApp/statusphere-example-app-go/internal/server"
@@ -39,11 +40,22 @@ func main() {
 	}
 	zerolog.SetGlobalLevel(logLevel)
 
+	// Hold the SQLite database so it cannot be restored from a backup while we run
+	if path, ok := db.SQLitePath(cfg.DatabaseURL); ok {
+		lock, err := backup.Hold(path)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to lock database")
+		}
+		defer lock.Release()
+	}
+
 	// Initialize database
-	database, err := db.New(cfg.DBPath)
+	database, err := db.Open(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize database")
 	}
+	database.QueryTimeout = cfg.DBQueryTimeout
+	database.SlowQuery = cfg.DBSlowQuery
 
 	// Run migrations
 	if err := database.Migrate(); err != nil {
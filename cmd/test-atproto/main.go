@@ -53,10 +53,17 @@ func main() {
 
 			fmt.Printf("Profile for %s:\n", handle)
 			fmt.Printf("  DID: %s\n", profile.Did)
-			fmt.Printf("  Display Name: %s\n", profile.DisplayName)
-			fmt.Printf("  Description: %s\n", profile.Description)
+			fmt.Printf("  Display Name: %s\n", derefString(profile.DisplayName))
+			fmt.Printf("  Description: %s\n", derefString(profile.Description))
 			fmt.Printf("  Followers: %d\n", profile.FollowersCount)
 			fmt.Printf("  Following: %d\n", profile.FollowsCount)
 		}
 	}
-}
\ No newline at end of file
+}
+// derefString returns the value of an optional string, or "" if unset
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
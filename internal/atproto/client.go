@@ -11,6 +11,11 @@ import (
 	"github.com/bluesky-social/indigo/xrpc"
 )
 
+// Lexicon collection NSIDs used by the app
+const (
+	StatusCollection = "xyz.statusphere.status"
+)
+
 // Client represents an AT Protocol client
 type Client struct {
 	xrpcClient *xrpc.Client
@@ -0,0 +1,191 @@
+// internal/atproto/dpop.go
+package atproto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newDPoPKey generates the P-256 key a session's tokens are bound to
+func newDPoPKey() (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate DPoP key: %w", err)
+	}
+	return key, nil
+}
+
+// encodeDPoPKey serializes a DPoP key for storage
+func encodeDPoPKey(key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode DPoP key: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(der), nil
+}
+
+// decodeDPoPKey parses a key encoded with encodeDPoPKey
+func decodeDPoPKey(encoded string) (*ecdsa.PrivateKey, error) {
+	der, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode DPoP key: %w", err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode DPoP key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, errors.New("failed to decode DPoP key: not a P-256 key")
+	}
+	return key, nil
+}
+
+// dpopProof builds the DPoP proof JWT (RFC 9449) for one request. The access
+// token is hashed into the proof when calling a resource server.
+func dpopProof(key *ecdsa.PrivateKey, method, target, nonce, accessToken string, now time.Time) (string, error) {
+	// The proof covers the URL without its query or fragment
+	htu := target
+	if i := strings.IndexAny(htu, "?#"); i >= 0 {
+		htu = htu[:i]
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	pub := key.PublicKey
+	header := map[string]interface{}{
+		"typ": "dpop+jwt",
+		"alg": "ES256",
+		"jwk": map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		},
+	}
+	claims := map[string]interface{}{
+		"jti": base64.RawURLEncoding.EncodeToString(jti),
+		"htm": method,
+		"htu": htu,
+		"iat": now.Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if accessToken != "" {
+		ath := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(ath[:])
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign DPoP proof: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// dpopTransport authenticates requests to a PDS with a DPoP-bound access token
+type dpopTransport struct {
+	base        http.RoundTripper
+	key         *ecdsa.PrivateKey
+	accessToken string
+
+	// nonce is the latest DPoP nonce the PDS handed out
+	mu    sync.Mutex
+	nonce string
+}
+
+// RoundTrip sends the request with a fresh proof, retrying once if the PDS
+// asks for a newer nonce
+func (t *dpopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	nonce := t.nonce
+	t.mu.Unlock()
+
+	resp, err := t.send(req, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	fresh := t.saveNonce(resp)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(resp.Header.Get("WWW-Authenticate"), "use_dpop_nonce") {
+		return resp, nil
+	}
+	if fresh == "" || fresh == nonce || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	resp, err = t.send(retry, fresh)
+	if err != nil {
+		return nil, err
+	}
+	t.saveNonce(resp)
+	return resp, nil
+}
+
+// send makes one attempt at the request with a proof using the given nonce
+func (t *dpopTransport) send(req *http.Request, nonce string) (*http.Response, error) {
+	proof, err := dpopProof(t.key, req.Method, req.URL.String(), nonce, t.accessToken, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	authed := req.Clone(req.Context())
+	authed.Header.Set("Authorization", "DPoP "+t.accessToken)
+	authed.Header.Set("DPoP", proof)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(authed)
+}
+
+// saveNonce remembers the nonce a response carries, returning it
+func (t *dpopTransport) saveNonce(resp *http.Response) string {
+	nonce := resp.Header.Get("DPoP-Nonce")
+	if nonce != "" {
+		t.mu.Lock()
+		t.nonce = nonce
+		t.mu.Unlock()
+	}
+	return nonce
+}
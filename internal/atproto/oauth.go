@@ -0,0 +1,399 @@
+// internal/atproto/oauth.go
+package atproto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// oauthTimeout bounds each request to an authorization server or its metadata
+	oauthTimeout = 10 * time.Second
+
+	// maxMetadataSize bounds the metadata and token documents we read
+	maxMetadataSize = 64 << 10
+)
+
+// ErrAuthDenied is returned when the user declined the authorization request
+var ErrAuthDenied = errors.New("authorization denied")
+
+// OAuthClient logs users in with atproto OAuth: a public client using pushed
+// authorization requests, PKCE and DPoP-bound tokens
+type OAuthClient struct {
+	ClientID    string
+	RedirectURI string
+	Scopes      Scopes
+
+	// HTTPClient is used for every request; nil means a client with oauthTimeout
+	HTTPClient *http.Client
+
+	now func() time.Time
+}
+
+// AuthServerMetadata is the part of an authorization server's RFC 8414 metadata the flow uses
+type AuthServerMetadata struct {
+	Issuer                             string `json:"issuer"`
+	AuthorizationEndpoint              string `json:"authorization_endpoint"`
+	TokenEndpoint                      string `json:"token_endpoint"`
+	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint"`
+}
+
+// AuthRequest is an authorization in progress. It is stored under its State
+// between the redirect to the authorization server and the callback.
+type AuthRequest struct {
+	State         string `json:"state"`
+	Issuer        string `json:"issuer"`
+	TokenEndpoint string `json:"tokenEndpoint"`
+	Verifier      string `json:"verifier"` // PKCE code verifier
+	DPoPKey       string `json:"dpopKey"`
+	DPoPNonce     string `json:"dpopNonce,omitempty"`
+	DID           string `json:"did"`
+	Handle        string `json:"handle"`
+	PdsHost       string `json:"pdsHost"`
+}
+
+// ParseAuthRequest decodes an auth request previously encoded with Encode
+func ParseAuthRequest(data string) (*AuthRequest, error) {
+	var req AuthRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		return nil, fmt.Errorf("failed to decode auth request: %w", err)
+	}
+	return &req, nil
+}
+
+// Encode serializes the auth request for storage
+func (r *AuthRequest) Encode() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode auth request: %w", err)
+	}
+	return string(data), nil
+}
+
+// tokenResponse is a successful response from the token endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	Sub          string `json:"sub"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// oauthError is an error response from an authorization server
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	StatusCode  int    `json:"-"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth error %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oauth error %s (status %d)", e.Code, e.StatusCode)
+}
+
+// Authorize starts logging in the given account: it finds the authorization
+// server of their PDS and pushes an authorization request to it. The caller
+// stores the returned request and redirects the user to the returned URL.
+func (c *OAuthClient) Authorize(ctx context.Context, did, handle, pdsHost string) (*AuthRequest, string, error) {
+	meta, err := c.resolveAuthServer(ctx, pdsHost)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := newDPoPKey()
+	if err != nil {
+		return nil, "", err
+	}
+	encodedKey, err := encodeDPoPKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req := &AuthRequest{
+		State:         randomToken(),
+		Issuer:        meta.Issuer,
+		TokenEndpoint: meta.TokenEndpoint,
+		Verifier:      randomToken() + randomToken(),
+		DPoPKey:       encodedKey,
+		DID:           did,
+		Handle:        handle,
+		PdsHost:       pdsHost,
+	}
+
+	challenge := sha256.Sum256([]byte(req.Verifier))
+	form := url.Values{}
+	form.Set("client_id", c.ClientID)
+	form.Set("response_type", "code")
+	form.Set("redirect_uri", c.RedirectURI)
+	form.Set("scope", c.Scopes.String())
+	form.Set("state", req.State)
+	form.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	form.Set("code_challenge_method", "S256")
+	if handle != "" {
+		form.Set("login_hint", handle)
+	} else {
+		form.Set("login_hint", did)
+	}
+
+	var par struct {
+		RequestURI string `json:"request_uri"`
+	}
+	if err := c.post(ctx, meta.PushedAuthorizationRequestEndpoint, form, key, &req.DPoPNonce, &par); err != nil {
+		return nil, "", fmt.Errorf("failed to push authorization request: %w", err)
+	}
+	if par.RequestURI == "" {
+		return nil, "", errors.New("authorization server returned no request_uri")
+	}
+
+	query := url.Values{}
+	query.Set("client_id", c.ClientID)
+	query.Set("request_uri", par.RequestURI)
+	return req, meta.AuthorizationEndpoint + "?" + query.Encode(), nil
+}
+
+// Callback completes an authorization from the parameters the authorization
+// server redirected back with, exchanging the code for a session
+func (c *OAuthClient) Callback(ctx context.Context, req *AuthRequest, params url.Values) (*Session, error) {
+	if params.Get("state") != req.State {
+		return nil, errors.New("state does not match the authorization request")
+	}
+	if code := params.Get("error"); code != "" {
+		if code == "access_denied" {
+			return nil, ErrAuthDenied
+		}
+		return nil, &oauthError{Code: code, Description: params.Get("error_description")}
+	}
+	// Guards against a different server answering for the one we asked (RFC 9207)
+	if params.Get("iss") != req.Issuer {
+		return nil, errors.New("issuer does not match the authorization request")
+	}
+	code := params.Get("code")
+	if code == "" {
+		return nil, errors.New("authorization response has no code")
+	}
+
+	key, err := decodeDPoPKey(req.DPoPKey)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("client_id", c.ClientID)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.RedirectURI)
+	form.Set("code_verifier", req.Verifier)
+
+	nonce := req.DPoPNonce
+	var token tokenResponse
+	if err := c.post(ctx, req.TokenEndpoint, form, key, &nonce, &token); err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	// The authorization server was found through this account's PDS, so it is
+	// only trusted to speak for this account
+	if token.Sub != req.DID {
+		return nil, fmt.Errorf("token is for %q, not %q", token.Sub, req.DID)
+	}
+
+	sess := &Session{
+		DID:           req.DID,
+		Handle:        req.Handle,
+		PdsHost:       req.PdsHost,
+		DPoPKey:       req.DPoPKey,
+		AuthServer:    req.Issuer,
+		TokenEndpoint: req.TokenEndpoint,
+		DPoPNonce:     nonce,
+	}
+	if err := c.applyToken(sess, &token); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Refresh exchanges the session's refresh token for new tokens, updating the
+// session in place. Refresh tokens are single-use, so the caller must persist
+// the session before anything else refreshes it.
+func (c *OAuthClient) Refresh(ctx context.Context, sess *Session) error {
+	if sess.RefreshJwt == "" || sess.TokenEndpoint == "" {
+		return errors.New("session cannot be refreshed")
+	}
+	key, err := decodeDPoPKey(sess.DPoPKey)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("client_id", c.ClientID)
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", sess.RefreshJwt)
+
+	var token tokenResponse
+	if err := c.post(ctx, sess.TokenEndpoint, form, key, &sess.DPoPNonce, &token); err != nil {
+		return fmt.Errorf("failed to refresh session: %w", err)
+	}
+	if token.Sub != sess.DID {
+		return fmt.Errorf("refreshed token is for %q, not %q", token.Sub, sess.DID)
+	}
+
+	return c.applyToken(sess, &token)
+}
+
+// applyToken stores a token response in the session
+func (c *OAuthClient) applyToken(sess *Session, token *tokenResponse) error {
+	if !strings.EqualFold(token.TokenType, "DPoP") {
+		return fmt.Errorf("unexpected token type %q", token.TokenType)
+	}
+	scopes, err := ParseScopes(token.Scope)
+	if err != nil {
+		return fmt.Errorf("invalid granted scope: %w", err)
+	}
+	if !scopes.Has(ScopeAtproto) {
+		return errors.New("authorization server did not grant the atproto scope")
+	}
+
+	sess.AccessJwt = token.AccessToken
+	sess.Scope = token.Scope
+	// Some servers only rotate the refresh token occasionally
+	if token.RefreshToken != "" {
+		sess.RefreshJwt = token.RefreshToken
+	}
+	sess.ExpiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		sess.ExpiresAt = c.clock().Add(time.Duration(token.ExpiresIn) * time.Second).UTC()
+	}
+	return nil
+}
+
+// resolveAuthServer finds the authorization server that issues tokens for a PDS
+func (c *OAuthClient) resolveAuthServer(ctx context.Context, pdsHost string) (*AuthServerMetadata, error) {
+	var resource struct {
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	if err := c.getJSON(ctx, strings.TrimSuffix(pdsHost, "/")+"/.well-known/oauth-protected-resource", &resource); err != nil {
+		return nil, fmt.Errorf("failed to get protected resource metadata: %w", err)
+	}
+	if len(resource.AuthorizationServers) == 0 {
+		return nil, errors.New("PDS names no authorization server")
+	}
+
+	issuer := resource.AuthorizationServers[0]
+	var meta AuthServerMetadata
+	if err := c.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/oauth-authorization-server", &meta); err != nil {
+		return nil, fmt.Errorf("failed to get authorization server metadata: %w", err)
+	}
+	if meta.Issuer != issuer {
+		return nil, fmt.Errorf("authorization server metadata is for %q, not %q", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.PushedAuthorizationRequestEndpoint == "" {
+		return nil, errors.New("authorization server metadata is incomplete")
+	}
+
+	return &meta, nil
+}
+
+// getJSON fetches and decodes a metadata document
+func (c *OAuthClient) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxMetadataSize)).Decode(out)
+}
+
+// post sends a DPoP-signed form to an authorization server endpoint. The
+// server may demand a nonce first; nonce holds the latest one it sent.
+func (c *OAuthClient) post(ctx context.Context, endpoint string, form url.Values, key *ecdsa.PrivateKey, nonce *string, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		err := c.postOnce(ctx, endpoint, form, key, nonce, out)
+
+		var oe *oauthError
+		if attempt == 0 && errors.As(err, &oe) && oe.Code == "use_dpop_nonce" {
+			continue
+		}
+		return err
+	}
+}
+
+func (c *OAuthClient) postOnce(ctx context.Context, endpoint string, form url.Values, key *ecdsa.PrivateKey, nonce *string, out interface{}) error {
+	proof, err := dpopProof(key, http.MethodPost, endpoint, *nonce, "", c.clock())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("DPoP", proof)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if fresh := resp.Header.Get("DPoP-Nonce"); fresh != "" {
+		*nonce = fresh
+	}
+
+	body := io.LimitReader(resp.Body, maxMetadataSize)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		oe := &oauthError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(body).Decode(oe); err != nil || oe.Code == "" {
+			oe.Code = "server_error"
+		}
+		return oe
+	}
+	return json.NewDecoder(body).Decode(out)
+}
+
+func (c *OAuthClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: oauthTimeout}
+}
+
+func (c *OAuthClient) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
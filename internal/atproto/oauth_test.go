@@ -0,0 +1,273 @@
+// internal/atproto/oauth_test.go
+package atproto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAuthServer is a PDS that is its own authorization server. It demands a
+// DPoP nonce and checks PKCE and the proof signature on every token request.
+type fakeAuthServer struct {
+	t         *testing.T
+	srv       *httptest.Server
+	sub       string
+	challenge string
+	jwk       string // Key the authorization request was bound to
+	refreshes int
+}
+
+func newFakeAuthServer(t *testing.T, sub string) *fakeAuthServer {
+	f := &fakeAuthServer{t: t, sub: sub}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-protected-resource", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"authorization_servers": []string{f.srv.URL}})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AuthServerMetadata{
+			Issuer:                             f.srv.URL,
+			AuthorizationEndpoint:              f.srv.URL + "/oauth/authorize",
+			TokenEndpoint:                      f.srv.URL + "/oauth/token",
+			PushedAuthorizationRequestEndpoint: f.srv.URL + "/oauth/par",
+		})
+	})
+	mux.HandleFunc("/oauth/par", func(w http.ResponseWriter, r *http.Request) {
+		jwk, ok := f.checkProof(w, r)
+		if !ok {
+			return
+		}
+		f.jwk = jwk
+		f.challenge = r.FormValue("code_challenge")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"request_uri": "urn:request:1"})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		jwk, ok := f.checkProof(w, r)
+		if !ok {
+			return
+		}
+		if jwk != f.jwk {
+			t.Errorf("token request signed with a different key than the authorization request")
+		}
+		switch r.FormValue("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+		case "refresh_token":
+			f.refreshes++
+		}
+		json.NewEncoder(w).Encode(tokenResponse{
+			AccessToken:  "access",
+			TokenType:    "DPoP",
+			RefreshToken: "refresh",
+			Scope:        "atproto repo:xyz.statusphere.status",
+			Sub:          f.sub,
+			ExpiresIn:    3600,
+		})
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// checkProof verifies the DPoP proof on a request, answering use_dpop_nonce
+// until the client sends the server's nonce. It returns the proof's key.
+func (f *fakeAuthServer) checkProof(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Set("DPoP-Nonce", "nonce-1")
+
+	parts := strings.Split(r.Header.Get("DPoP"), ".")
+	if len(parts) != 3 {
+		f.t.Errorf("malformed DPoP proof")
+		w.WriteHeader(http.StatusBadRequest)
+		return "", false
+	}
+	var header struct {
+		JWK struct{ X, Y string } `json:"jwk"`
+	}
+	var claims struct {
+		HTM   string `json:"htm"`
+		HTU   string `json:"htu"`
+		Nonce string `json:"nonce"`
+	}
+	decodeSegment(f.t, parts[0], &header)
+	decodeSegment(f.t, parts[1], &claims)
+
+	x, _ := base64.RawURLEncoding.DecodeString(header.JWK.X)
+	y, _ := base64.RawURLEncoding.DecodeString(header.JWK.Y)
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(sig) != 64 || !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		f.t.Errorf("DPoP proof signature does not verify")
+	}
+	if claims.HTM != r.Method || claims.HTU != f.srv.URL+r.URL.Path {
+		f.t.Errorf("DPoP proof is for %s %s, not %s %s", claims.HTM, claims.HTU, r.Method, r.URL.Path)
+	}
+
+	if claims.Nonce != "nonce-1" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "use_dpop_nonce"})
+		return "", false
+	}
+	return header.JWK.X + header.JWK.Y, true
+}
+
+func decodeSegment(t *testing.T, segment string, out interface{}) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatalf("decode JWT segment: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("decode JWT segment: %v", err)
+	}
+}
+
+func newTestOAuthClient() *OAuthClient {
+	return &OAuthClient{
+		ClientID:    "http://localhost",
+		RedirectURI: "http://127.0.0.1:8080/oauth/callback",
+		Scopes:      Scopes{{Resource: ScopeAtproto}, RepoScope(StatusCollection)},
+	}
+}
+
+func TestOAuthLoginAndRefresh(t *testing.T) {
+	const did = "did:plc:alice"
+	as := newFakeAuthServer(t, did)
+	client := newTestOAuthClient()
+	ctx := context.Background()
+
+	req, redirect, err := client.Authorize(ctx, did, "alice.test", as.srv.URL)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if !strings.HasPrefix(redirect, as.srv.URL+"/oauth/authorize?") || !strings.Contains(redirect, "request_uri=urn%3Arequest%3A1") {
+		t.Errorf("Authorize() redirect = %q", redirect)
+	}
+
+	// The request survives being stored between the redirect and the callback
+	data, err := req.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, err = ParseAuthRequest(data); err != nil {
+		t.Fatal(err)
+	}
+
+	params := url.Values{"state": {req.State}, "iss": {as.srv.URL}, "code": {"code-1"}}
+	sess, err := client.Callback(ctx, req, params)
+	if err != nil {
+		t.Fatalf("Callback() error = %v", err)
+	}
+	if sess.DID != did || sess.AccessJwt != "access" || sess.RefreshJwt != "refresh" || sess.ExpiresAt.IsZero() {
+		t.Errorf("Callback() session = %+v", sess)
+	}
+	if err := sess.RequireRepoWrite(StatusCollection, ActionCreate); err != nil {
+		t.Errorf("granted scope not recorded: %v", err)
+	}
+
+	if err := client.Refresh(ctx, sess); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if as.refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", as.refreshes)
+	}
+}
+
+func TestOAuthCallbackRejects(t *testing.T) {
+	as := newFakeAuthServer(t, "did:plc:mallory")
+	client := newTestOAuthClient()
+	ctx := context.Background()
+
+	req, _, err := client.Authorize(ctx, "did:plc:alice", "alice.test", as.srv.URL)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		params url.Values
+	}{
+		{name: "wrong state", params: url.Values{"state": {"other"}, "iss": {as.srv.URL}, "code": {"c"}}},
+		{name: "wrong issuer", params: url.Values{"state": {req.State}, "iss": {"https://evil.test"}, "code": {"c"}}},
+		{name: "denied", params: url.Values{"state": {req.State}, "error": {"access_denied"}}},
+		// The server answers for a different account than the one logging in
+		{name: "wrong subject", params: url.Values{"state": {req.State}, "iss": {as.srv.URL}, "code": {"c"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.Callback(ctx, req, tt.params); err == nil {
+				t.Errorf("Callback() succeeded, want error")
+			}
+		})
+	}
+
+	_, err = client.Callback(ctx, req, url.Values{"state": {req.State}, "error": {"access_denied"}})
+	if !errors.Is(err, ErrAuthDenied) {
+		t.Errorf("Callback(denied) error = %v, want ErrAuthDenied", err)
+	}
+}
+
+func TestDPoPTransportRetriesWithNonce(t *testing.T) {
+	var calls int
+	pds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "DPoP ") {
+			t.Errorf("Authorization = %q, want a DPoP token", r.Header.Get("Authorization"))
+		}
+		var claims struct {
+			Nonce string `json:"nonce"`
+			ATH   string `json:"ath"`
+		}
+		decodeSegment(t, strings.Split(r.Header.Get("DPoP"), ".")[1], &claims)
+		if claims.ATH == "" {
+			t.Errorf("proof is not bound to the access token")
+		}
+
+		w.Header().Set("DPoP-Nonce", "pds-nonce")
+		if claims.Nonce != "pds-nonce" {
+			w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer pds.Close()
+
+	key, err := newDPoPKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := encodeDPoPKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClientFromSession(&Session{DID: "did:plc:alice", PdsHost: pds.URL, AccessJwt: "access", DPoPKey: encoded})
+	if err != nil {
+		t.Fatalf("NewClientFromSession() error = %v", err)
+	}
+	if _, err := client.CreateRecord(context.Background(), StatusCollection, "3k", NewStatusRecord("👍", time.Now())); err != nil {
+		t.Fatalf("CreateRecord() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2 (one rejected for its nonce, one retried)", calls)
+	}
+}
@@ -0,0 +1,189 @@
+// internal/atproto/records.go
+package atproto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// ProfileCollection is the NSID of Bluesky profile records
+const ProfileCollection = "app.bsky.actor.profile"
+
+// Record is a record as returned by com.atproto.repo.getRecord
+type Record struct {
+	URI   string          `json:"uri"`
+	CID   string          `json:"cid"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Blob is a reference to a blob, as embedded in records
+type Blob struct {
+	Type     string  `json:"$type"`
+	Ref      BlobRef `json:"ref"`
+	MimeType string  `json:"mimeType"`
+	Size     int64   `json:"size"`
+}
+
+// BlobRef is the CID link of a blob
+type BlobRef struct {
+	Link string `json:"$link"`
+}
+
+// ProfileRecord is an app.bsky.actor.profile record
+type ProfileRecord struct {
+	DisplayName string `json:"displayName,omitempty"`
+	Description string `json:"description,omitempty"`
+	Avatar      *Blob  `json:"avatar,omitempty"`
+}
+
+// GetRecord fetches a single record from a repo on this client's PDS.
+// Records are public, so this does not require a session.
+func (c *Client) GetRecord(ctx context.Context, repo, collection, rkey string) (*Record, error) {
+	params := map[string]interface{}{
+		"repo":       repo,
+		"collection": collection,
+		"rkey":       rkey,
+	}
+
+	var out Record
+	if err := c.xrpcClient.Do(ctx, xrpc.Query, "", "com.atproto.repo.getRecord", params, nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to get record: %w", err)
+	}
+
+	return &out, nil
+}
+
+// RecordPage is a page of records as returned by com.atproto.repo.listRecords
+type RecordPage struct {
+	Records []Record `json:"records"`
+	Cursor  string   `json:"cursor,omitempty"` // Empty on the last page
+}
+
+// ListRecords fetches a page of records in a collection from a repo on this
+// client's PDS. Pass the previous page's cursor to continue; limit is at most 100.
+func (c *Client) ListRecords(ctx context.Context, repo, collection, cursor string, limit int) (*RecordPage, error) {
+	params := map[string]interface{}{
+		"repo":       repo,
+		"collection": collection,
+		"limit":      limit,
+	}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+
+	var out RecordPage
+	if err := c.xrpcClient.Do(ctx, xrpc.Query, "", "com.atproto.repo.listRecords", params, nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+
+	return &out, nil
+}
+
+// GetLatestCommit fetches the current commit of a repo on this client's PDS.
+// Records read afterwards are at least as new as its rev.
+func (c *Client) GetLatestCommit(ctx context.Context, did string) (*CommitMeta, error) {
+	params := map[string]interface{}{
+		"did": did,
+	}
+
+	var out CommitMeta
+	if err := c.xrpcClient.Do(ctx, xrpc.Query, "", "com.atproto.sync.getLatestCommit", params, nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to get latest commit: %w", err)
+	}
+
+	return &out, nil
+}
+
+// GetProfileRecord fetches and decodes a user's profile record
+func (c *Client) GetProfileRecord(ctx context.Context, did string) (*ProfileRecord, error) {
+	record, err := c.GetRecord(ctx, did, ProfileCollection, "self")
+	if err != nil {
+		return nil, err
+	}
+
+	var profile ProfileRecord
+	if err := json.Unmarshal(record.Value, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile record: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// ErrBlobTooLarge is returned when a blob exceeds the requested size limit
+var ErrBlobTooLarge = errors.New("blob too large")
+
+// blobTimeout bounds a whole blob download, however slowly the PDS sends it
+const blobTimeout = 20 * time.Second
+
+var blobClient = &http.Client{Timeout: blobTimeout}
+
+// GetBlob downloads a blob from a repo on this client's PDS, refusing blobs
+// larger than maxSize. It returns the blob and its declared content type.
+func (c *Client) GetBlob(ctx context.Context, did, cid string, maxSize int64) ([]byte, string, error) {
+	query := url.Values{}
+	query.Set("did", did)
+	query.Set("cid", cid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.pdsHost+"/xrpc/com.atproto.sync.getBlob?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get blob: %w", err)
+	}
+
+	resp, err := blobClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get blob: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to get blob: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, "", ErrBlobTooLarge
+	}
+
+	// Read one byte past the limit to detect oversized bodies without a length
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get blob: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, "", ErrBlobTooLarge
+	}
+
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// IsInvalidSwap reports whether err means a swapRecord or swapCommit check failed,
+// i.e. the record changed since it was last read
+func IsInvalidSwap(err error) bool {
+	var xe *xrpc.XRPCError
+	return errors.As(err, &xe) && xe.ErrStr == "InvalidSwap"
+}
+
+// IsRecordNotFound reports whether err means the requested record does not exist
+func IsRecordNotFound(err error) bool {
+	var xe *xrpc.XRPCError
+	return errors.As(err, &xe) && xe.ErrStr == "RecordNotFound"
+}
+
+// RateLimitReset reports whether err is a rate limit response from the PDS,
+// and if so when the limit resets. The reset time is zero if the PDS did not say.
+func RateLimitReset(err error) (time.Time, bool) {
+	var xe *xrpc.Error
+	if !errors.As(err, &xe) || xe.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+	if xe.Ratelimit == nil {
+		return time.Time{}, true
+	}
+	return xe.Ratelimit.Reset, true
+}
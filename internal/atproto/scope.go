@@ -0,0 +1,184 @@
+// internal/atproto/scope.go
+package atproto
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Well-known OAuth scope values
+const (
+	// ScopeAtproto is required for every atproto OAuth session
+	ScopeAtproto = "atproto"
+	// ScopeTransitionGeneric is the legacy catch-all scope, equivalent to an app password
+	ScopeTransitionGeneric = "transition:generic"
+)
+
+// RepoAction is a write action that a repo scope can grant
+type RepoAction string
+
+// Repo write actions
+const (
+	ActionCreate RepoAction = "create"
+	ActionUpdate RepoAction = "update"
+	ActionDelete RepoAction = "delete"
+)
+
+// allRepoActions are granted by a repo scope that does not list any actions
+var allRepoActions = []RepoAction{ActionCreate, ActionUpdate, ActionDelete}
+
+// Scope is a single parsed OAuth permission scope, e.g. "repo:xyz.statusphere.status?action=create"
+type Scope struct {
+	Resource   string     // Resource name, e.g. "repo", "blob" or "atproto"
+	Positional string     // Value after the colon, e.g. a collection NSID
+	Params     url.Values // Query parameters, e.g. action=create
+}
+
+// ParseScope parses a single scope string
+func ParseScope(raw string) (Scope, error) {
+	if raw == "" || strings.ContainsAny(raw, " \t\n") {
+		return Scope{}, fmt.Errorf("invalid scope %q", raw)
+	}
+
+	rest, query, _ := strings.Cut(raw, "?")
+	resource, positional, _ := strings.Cut(rest, ":")
+	if resource == "" {
+		return Scope{}, fmt.Errorf("invalid scope %q: missing resource", raw)
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return Scope{}, fmt.Errorf("invalid scope %q: %w", raw, err)
+	}
+
+	positional, err = url.PathUnescape(positional)
+	if err != nil {
+		return Scope{}, fmt.Errorf("invalid scope %q: %w", raw, err)
+	}
+
+	return Scope{Resource: resource, Positional: positional, Params: params}, nil
+}
+
+// RepoScope builds a repo scope for a collection; no actions means all actions
+func RepoScope(collection string, actions ...RepoAction) Scope {
+	params := url.Values{}
+	for _, action := range actions {
+		params.Add("action", string(action))
+	}
+	return Scope{Resource: "repo", Positional: collection, Params: params}
+}
+
+// String returns the scope in its canonical string form
+func (s Scope) String() string {
+	var b strings.Builder
+	b.WriteString(s.Resource)
+	if s.Positional != "" {
+		b.WriteString(":")
+		b.WriteString(s.Positional)
+	}
+	if len(s.Params) > 0 {
+		b.WriteString("?")
+		b.WriteString(s.Params.Encode())
+	}
+	return b.String()
+}
+
+// allowsRepoWrite reports whether this scope alone grants the given repo write
+func (s Scope) allowsRepoWrite(collection string, action RepoAction) bool {
+	if s.Resource == "transition" && s.Positional == "generic" {
+		return true
+	}
+	if s.Resource != "repo" {
+		return false
+	}
+
+	collections := s.Params["collection"]
+	if s.Positional != "" {
+		collections = append([]string{s.Positional}, collections...)
+	}
+	if !containsMatch(collections, collection) {
+		return false
+	}
+
+	actions := s.Params["action"]
+	if len(actions) == 0 {
+		for _, a := range allRepoActions {
+			actions = append(actions, string(a))
+		}
+	}
+	for _, a := range actions {
+		if a == string(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsMatch reports whether value is in patterns, where "*" matches anything
+func containsMatch(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes is a set of OAuth scopes, as requested by a client or granted to a session
+type Scopes []Scope
+
+// ParseScopes parses a space-separated scope string, as found in OAuth token responses
+func ParseScopes(raw string) (Scopes, error) {
+	var scopes Scopes
+	for _, field := range strings.Fields(raw) {
+		scope, err := ParseScope(field)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// String returns the scopes as a space-separated string, without duplicates
+func (ss Scopes) String() string {
+	seen := make(map[string]bool, len(ss))
+	parts := make([]string, 0, len(ss))
+	for _, s := range ss {
+		str := s.String()
+		if seen[str] {
+			continue
+		}
+		seen[str] = true
+		parts = append(parts, str)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Has reports whether the set contains the exact scope
+func (ss Scopes) Has(scope string) bool {
+	for _, s := range ss {
+		if s.String() == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRepoWrite reports whether any scope in the set grants the given repo write
+func (ss Scopes) AllowsRepoWrite(collection string, action RepoAction) bool {
+	if !ss.Has(ScopeAtproto) {
+		return false
+	}
+	for _, s := range ss {
+		if s.allowsRepoWrite(collection, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrMissingScope is returned when a session lacks the scope needed for an operation
+var ErrMissingScope = errors.New("missing OAuth scope")
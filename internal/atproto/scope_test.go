@@ -0,0 +1,81 @@
+// internal/atproto/scope_test.go
+package atproto
+
+import (
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{name: "atproto", raw: "atproto", want: "atproto"},
+		{name: "transition", raw: "transition:generic", want: "transition:generic"},
+		{name: "repo collection", raw: "repo:xyz.statusphere.status", want: "repo:xyz.statusphere.status"},
+		{name: "repo with action", raw: "repo:xyz.statusphere.status?action=create", want: "repo:xyz.statusphere.status?action=create"},
+		{name: "empty", raw: "", wantErr: true},
+		{name: "whitespace", raw: "repo: x", wantErr: true},
+		{name: "missing resource", raw: ":generic", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := ParseScope(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseScope() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && scope.String() != tt.want {
+				t.Errorf("ParseScope().String() = %v, want %v", scope.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestScopesAllowsRepoWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes string
+		action RepoAction
+		want   bool
+	}{
+		{name: "legacy generic", scopes: "atproto transition:generic", action: ActionCreate, want: true},
+		{name: "all actions", scopes: "atproto repo:xyz.statusphere.status", action: ActionDelete, want: true},
+		{name: "listed action", scopes: "atproto repo:xyz.statusphere.status?action=create", action: ActionCreate, want: true},
+		{name: "unlisted action", scopes: "atproto repo:xyz.statusphere.status?action=create", action: ActionDelete, want: false},
+		{name: "wildcard", scopes: "atproto repo:*?action=update", action: ActionUpdate, want: true},
+		{name: "collection param", scopes: "atproto repo?collection=xyz.statusphere.status", action: ActionCreate, want: true},
+		{name: "other collection", scopes: "atproto repo:app.bsky.feed.post", action: ActionCreate, want: false},
+		{name: "missing atproto", scopes: "repo:xyz.statusphere.status", action: ActionCreate, want: false},
+		{name: "empty", scopes: "", action: ActionCreate, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, err := ParseScopes(tt.scopes)
+			if err != nil {
+				t.Fatalf("ParseScopes() error = %v", err)
+			}
+			if got := scopes.AllowsRepoWrite(StatusCollection, tt.action); got != tt.want {
+				t.Errorf("AllowsRepoWrite() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopesString(t *testing.T) {
+	scopes := Scopes{
+		{Resource: ScopeAtproto},
+		RepoScope(StatusCollection),
+		RepoScope(StatusCollection),
+		RepoScope(StatusCollection, ActionCreate, ActionDelete),
+	}
+
+	want := "atproto repo:xyz.statusphere.status repo:xyz.statusphere.status?action=create&action=delete"
+	if got := scopes.String(); got != want {
+		t.Errorf("String() = %v, want %v", got, want)
+	}
+}
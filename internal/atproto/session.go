@@ -0,0 +1,98 @@
+// internal/atproto/session.go
+package atproto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// Session is a user's authenticated session with their PDS, as persisted in auth_session
+type Session struct {
+	DID        string `json:"did"`
+	Handle     string `json:"handle"`
+	PdsHost    string `json:"pdsHost"`
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+	Scope      string `json:"scope"` // Space-separated scopes granted by the authorization server
+
+	// OAuth sessions hold DPoP-bound tokens; sessions without a DPoP key use bearer tokens
+	DPoPKey       string    `json:"dpopKey,omitempty"`
+	DPoPNonce     string    `json:"dpopNonce,omitempty"` // Latest nonce from the authorization server
+	AuthServer    string    `json:"authServer,omitempty"`
+	TokenEndpoint string    `json:"tokenEndpoint,omitempty"`
+	ExpiresAt     time.Time `json:"expiresAt,omitempty"` // Zero if the access token's lifetime is unknown
+}
+
+// ParseSession decodes a session previously encoded with Encode
+func ParseSession(data string) (*Session, error) {
+	var sess Session
+	if err := json.Unmarshal([]byte(data), &sess); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	if _, err := ParseScopes(sess.Scope); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &sess, nil
+}
+
+// Encode serializes the session for storage
+func (s *Session) Encode() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scopes returns the parsed scopes granted to the session
+func (s *Session) Scopes() Scopes {
+	// The scope string is validated when the session is decoded
+	scopes, _ := ParseScopes(s.Scope)
+	return scopes
+}
+
+// RequireRepoWrite returns ErrMissingScope if the session may not perform the given repo write
+func (s *Session) RequireRepoWrite(collection string, action RepoAction) error {
+	if !s.Scopes().AllowsRepoWrite(collection, action) {
+		return fmt.Errorf("%w: %s on %s", ErrMissingScope, action, collection)
+	}
+	return nil
+}
+
+// NewClientFromSession creates a client authenticated as the session's user
+func NewClientFromSession(sess *Session) (*Client, error) {
+	if sess.AccessJwt == "" {
+		return nil, errors.New("session has no access token")
+	}
+
+	client, err := NewClient(Config{PdsHost: sess.PdsHost})
+	if err != nil {
+		return nil, err
+	}
+
+	client.xrpcClient.Auth = &xrpc.AuthInfo{
+		AccessJwt:  sess.AccessJwt,
+		RefreshJwt: sess.RefreshJwt,
+		Handle:     sess.Handle,
+		Did:        sess.DID,
+	}
+	client.loggedIn = true
+
+	// The Authorization header xrpc sets is replaced by the transport
+	if sess.DPoPKey != "" {
+		key, err := decodeDPoPKey(sess.DPoPKey)
+		if err != nil {
+			return nil, err
+		}
+		client.xrpcClient.Client = &http.Client{
+			Transport: &dpopTransport{key: key, accessToken: sess.AccessJwt},
+		}
+	}
+
+	return client, nil
+}
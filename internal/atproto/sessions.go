@@ -0,0 +1,108 @@
+// internal/atproto/sessions.go
+package atproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// refreshMargin is how long before expiry an access token is refreshed, so
+	// it does not run out partway through a write
+	refreshMargin = 5 * time.Minute
+
+	// refreshTimeout bounds a token refresh, independent of the caller's context
+	refreshTimeout = 15 * time.Second
+)
+
+// SessionStore persists users' sessions; *db.DB implements it
+type SessionStore interface {
+	GetAuthSession(ctx context.Context, key string) (string, error)
+	SaveAuthSession(ctx context.Context, key, sessionData string) error
+}
+
+// Sessions loads users' stored sessions, refreshing OAuth tokens that are
+// about to expire. Requests and background jobs share one Sessions, so a
+// single-use refresh token is never spent twice.
+type Sessions struct {
+	store SessionStore
+	oauth *OAuthClient
+	group singleflight.Group
+	now   func() time.Time
+}
+
+// NewSessions creates a session loader that refreshes tokens with the given client
+func NewSessions(store SessionStore, oauth *OAuthClient) *Sessions {
+	return &Sessions{
+		store: store,
+		oauth: oauth,
+		now:   time.Now,
+	}
+}
+
+// Load returns a user's session with an access token that is good for at
+// least refreshMargin, refreshing and storing it first if needed
+func (s *Sessions) Load(ctx context.Context, did string) (*Session, error) {
+	sess, err := s.get(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if !s.needsRefresh(sess) {
+		return sess, nil
+	}
+
+	v, err, _ := s.group.Do(did, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+
+		// A refresh that finished just before this one started has already
+		// spent the refresh token we read
+		sess, err := s.get(ctx, did)
+		if err != nil || !s.needsRefresh(sess) {
+			return sess, err
+		}
+
+		if s.oauth == nil {
+			return nil, errors.New("session expired and no OAuth client can refresh it")
+		}
+		if err := s.oauth.Refresh(ctx, sess); err != nil {
+			return nil, err
+		}
+		data, err := sess.Encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.SaveAuthSession(ctx, did, data); err != nil {
+			return nil, fmt.Errorf("failed to save refreshed session: %w", err)
+		}
+		return sess, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Callers may modify their session, so each gets its own copy
+	refreshed := *v.(*Session)
+	return &refreshed, nil
+}
+
+// get reads and decodes a stored session
+func (s *Sessions) get(ctx context.Context, did string) (*Session, error) {
+	data, err := s.store.GetAuthSession(ctx, did)
+	if err != nil {
+		return nil, fmt.Errorf("no auth session: %w", err)
+	}
+	return ParseSession(data)
+}
+
+// needsRefresh reports whether an OAuth session's access token expires soon
+func (s *Sessions) needsRefresh(sess *Session) bool {
+	if sess.DPoPKey == "" || sess.ExpiresAt.IsZero() {
+		return false
+	}
+	return !s.now().Add(refreshMargin).Before(sess.ExpiresAt)
+}
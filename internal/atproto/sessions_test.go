@@ -0,0 +1,88 @@
+// internal/atproto/sessions_test.go
+package atproto
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memSessionStore is an in-memory SessionStore
+type memSessionStore struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (m *memSessionStore) GetAuthSession(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[key], nil
+}
+
+func (m *memSessionStore) SaveAuthSession(ctx context.Context, key, sessionData string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = sessionData
+	return nil
+}
+
+func TestSessionsRefreshExpiringTokens(t *testing.T) {
+	const did = "did:plc:alice"
+	as := newFakeAuthServer(t, did)
+	client := newTestOAuthClient()
+	now := time.Now()
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	req, _, err := client.Authorize(ctx, did, "alice.test", as.srv.URL)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	sess, err := client.Callback(ctx, req, url.Values{"state": {req.State}, "iss": {as.srv.URL}, "code": {"c"}})
+	if err != nil {
+		t.Fatalf("Callback() error = %v", err)
+	}
+	data, err := sess.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memSessionStore{data: map[string]string{did: data}}
+	sessions := NewSessions(store, client)
+	sessions.now = func() time.Time { return now }
+
+	// A token with plenty of life left is used as is
+	if _, err := sessions.Load(ctx, did); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if as.refreshes != 0 {
+		t.Errorf("refreshes = %d, want 0 while the token is fresh", as.refreshes)
+	}
+
+	// Near expiry, concurrent loads share one refresh and the result is stored
+	now = sess.ExpiresAt.Add(-time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := sessions.Load(ctx, did); err != nil {
+				t.Errorf("Load() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if as.refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", as.refreshes)
+	}
+	stored, err := ParseSession(store.data[did])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.ExpiresAt.After(now.Add(refreshMargin)) {
+		t.Errorf("stored ExpiresAt = %v, want a refreshed expiry after %v", stored.ExpiresAt, now)
+	}
+}
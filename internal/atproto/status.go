@@ -0,0 +1,197 @@
+// internal/atproto/status.go
+package atproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/rivo/uniseg"
+)
+
+// MaxWritesPerCall is the most operations a PDS accepts in one applyWrites call
+const MaxWritesPerCall = 200
+
+// Write is one operation in a com.atproto.repo.applyWrites call
+type Write struct {
+	Type       string      `json:"$type"`
+	Collection string      `json:"collection"`
+	Rkey       string      `json:"rkey"`
+	Value      interface{} `json:"value,omitempty"`
+}
+
+// DeleteOp returns an applyWrites operation deleting a record
+func DeleteOp(collection, rkey string) Write {
+	return Write{
+		Type:       "com.atproto.repo.applyWrites#delete",
+		Collection: collection,
+		Rkey:       rkey,
+	}
+}
+
+// StatusRecord is an xyz.statusphere.status record
+type StatusRecord struct {
+	Type      string `json:"$type"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// StrongRef identifies a specific version of a record (com.atproto.repo.strongRef)
+type StrongRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+// CommitMeta identifies the repo commit a write landed in. Revs are TIDs,
+// so they increase with every commit and compare as strings.
+type CommitMeta struct {
+	CID string `json:"cid"`
+	Rev string `json:"rev"`
+}
+
+// WriteResult is the output of createRecord and putRecord
+type WriteResult struct {
+	URI    string      `json:"uri"`
+	CID    string      `json:"cid"`
+	Commit *CommitMeta `json:"commit,omitempty"`
+}
+
+// Ref returns a strong reference to the version of the record that was written
+func (r *WriteResult) Ref() StrongRef {
+	return StrongRef{URI: r.URI, CID: r.CID}
+}
+
+// Rev returns the repo revision of the write, or "" if the PDS did not report it
+func (r *WriteResult) Rev() string {
+	if r.Commit == nil {
+		return ""
+	}
+	return r.Commit.Rev
+}
+
+// NewStatusRecord creates a status record stamped with the given time
+func NewStatusRecord(status string, createdAt time.Time) *StatusRecord {
+	return &StatusRecord{
+		Type:      StatusCollection,
+		Status:    status,
+		CreatedAt: createdAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+	}
+}
+
+// Validate checks the record against the xyz.statusphere.status lexicon
+func (r *StatusRecord) Validate() error {
+	if r.Type != StatusCollection {
+		return fmt.Errorf("invalid status record: $type must be %s", StatusCollection)
+	}
+	if len(r.Status) < 1 || len(r.Status) > 32 {
+		return fmt.Errorf("invalid status record: status must be 1 to 32 bytes")
+	}
+	if uniseg.GraphemeClusterCount(r.Status) > 1 {
+		return fmt.Errorf("invalid status record: status must be a single grapheme")
+	}
+	if _, err := time.Parse(time.RFC3339Nano, r.CreatedAt); err != nil {
+		return fmt.Errorf("invalid status record: createdAt must be a datetime: %w", err)
+	}
+	return nil
+}
+
+// CreateRecord writes a new record to the authenticated user's repo
+func (c *Client) CreateRecord(ctx context.Context, collection, rkey string, record interface{}) (*WriteResult, error) {
+	if !c.loggedIn {
+		return nil, errors.New("client not authenticated")
+	}
+
+	input := map[string]interface{}{
+		"repo":       c.xrpcClient.Auth.Did,
+		"collection": collection,
+		"rkey":       rkey,
+		"record":     record,
+	}
+
+	var out WriteResult
+	if err := c.xrpcClient.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.createRecord", nil, input, &out); err != nil {
+		return nil, fmt.Errorf("failed to create record: %w", err)
+	}
+
+	return &out, nil
+}
+
+// PutRecord writes a record to the authenticated user's repo, replacing any
+// existing record. If swapRecord is set, the write only succeeds if the
+// current record has that CID.
+func (c *Client) PutRecord(ctx context.Context, collection, rkey string, record interface{}, swapRecord string) (*WriteResult, error) {
+	if !c.loggedIn {
+		return nil, errors.New("client not authenticated")
+	}
+
+	input := map[string]interface{}{
+		"repo":       c.xrpcClient.Auth.Did,
+		"collection": collection,
+		"rkey":       rkey,
+		"record":     record,
+	}
+	if swapRecord != "" {
+		input["swapRecord"] = swapRecord
+	}
+
+	var out WriteResult
+	if err := c.xrpcClient.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.putRecord", nil, input, &out); err != nil {
+		return nil, fmt.Errorf("failed to put record: %w", err)
+	}
+
+	return &out, nil
+}
+
+// DeleteRecord deletes a record from the authenticated user's repo and returns
+// the commit it was deleted in, if the PDS reports it. If swapRecord is set, the
+// delete only succeeds if the current record has that CID.
+func (c *Client) DeleteRecord(ctx context.Context, collection, rkey string, swapRecord string) (*CommitMeta, error) {
+	if !c.loggedIn {
+		return nil, errors.New("client not authenticated")
+	}
+
+	input := map[string]interface{}{
+		"repo":       c.xrpcClient.Auth.Did,
+		"collection": collection,
+		"rkey":       rkey,
+	}
+	if swapRecord != "" {
+		input["swapRecord"] = swapRecord
+	}
+
+	var out struct {
+		Commit *CommitMeta `json:"commit,omitempty"`
+	}
+	if err := c.xrpcClient.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.deleteRecord", nil, input, &out); err != nil {
+		return nil, fmt.Errorf("failed to delete record: %w", err)
+	}
+
+	if out.Commit == nil {
+		return &CommitMeta{}, nil
+	}
+	return out.Commit, nil
+}
+
+// ApplyWrites applies a batch of operations to the authenticated user's repo
+// in a single commit: either all of them take effect or none do
+func (c *Client) ApplyWrites(ctx context.Context, writes []Write) error {
+	if !c.loggedIn {
+		return errors.New("client not authenticated")
+	}
+	if len(writes) > MaxWritesPerCall {
+		return fmt.Errorf("too many writes: %d > %d", len(writes), MaxWritesPerCall)
+	}
+
+	input := map[string]interface{}{
+		"repo":   c.xrpcClient.Auth.Did,
+		"writes": writes,
+	}
+
+	if err := c.xrpcClient.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.applyWrites", nil, input, nil); err != nil {
+		return fmt.Errorf("failed to apply writes: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+// internal/atproto/status_test.go
+package atproto
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusRecordValidate(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		record  *StatusRecord
+		wantErr bool
+	}{
+		{name: "simple emoji", record: NewStatusRecord("👍", now)},
+		{name: "skin tone modifier", record: NewStatusRecord("👍🏽", now)},
+		{name: "zwj sequence", record: NewStatusRecord("👩‍💻", now)},
+		{name: "flag", record: NewStatusRecord("🇳🇿", now)},
+		{name: "empty", record: NewStatusRecord("", now), wantErr: true},
+		{name: "two graphemes", record: NewStatusRecord("👍👎", now), wantErr: true},
+		{name: "text", record: NewStatusRecord("ok", now), wantErr: true},
+		{name: "bad datetime", record: &StatusRecord{Type: StatusCollection, Status: "👍", CreatedAt: "yesterday"}, wantErr: true},
+		{name: "wrong type", record: &StatusRecord{Type: "app.bsky.feed.post", Status: "👍", CreatedAt: "2025-03-01T12:00:00Z"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.record.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
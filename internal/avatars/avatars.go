@@ -0,0 +1,160 @@
+// Package avatars serves resized copies of profile avatars, fetched from each
+// author's PDS, so viewers never load images from third parties
+package avatars
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // Register the PNG decoder
+	"net/http"
+	"strconv"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/identity"
+	"github.com/referendumApp/statusphere-example-app-go/internal/profiles"
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/singleflight"
+)
+
+// Limits from the avatar field of the app.bsky.actor.profile lexicon
+const MaxBlobSize = 1000000
+
+// acceptedTypes are the avatar MIME types allowed by the lexicon
+var acceptedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+}
+
+// ThumbnailSize is the width and height of served avatars, in pixels
+const ThumbnailSize = 128
+
+// maxDimension guards against images that decode to huge bitmaps
+const maxDimension = 4096
+
+// ErrNoAvatar is returned when a user has no (acceptable) avatar
+var ErrNoAvatar = errors.New("no avatar")
+
+// FetchFunc downloads a blob from a PDS
+type FetchFunc func(ctx context.Context, pdsHost, did, cid string, maxSize int64) ([]byte, string, error)
+
+// Proxy fetches, validates, resizes and caches avatars
+type Proxy struct {
+	profiles *profiles.Service
+	identity identity.Directory
+	cache    *DiskCache
+	fetch    FetchFunc
+	group    singleflight.Group
+}
+
+// NewProxy creates an avatar proxy that caches thumbnails in cache
+func NewProxy(profileService *profiles.Service, directory identity.Directory, cache *DiskCache) *Proxy {
+	return &Proxy{
+		profiles: profileService,
+		identity: directory,
+		cache:    cache,
+		fetch:    fetchBlob,
+	}
+}
+
+// Current returns the CID of a user's current avatar
+func (p *Proxy) Current(ctx context.Context, did string) (string, error) {
+	profile := p.profiles.Get(ctx, did)
+	if profile == nil || profile.AvatarCID == "" || !acceptedTypes[profile.AvatarMime] {
+		return "", ErrNoAvatar
+	}
+	return profile.AvatarCID, nil
+}
+
+// ETag returns the entity tag for the thumbnail of an avatar blob
+func ETag(cid string) string {
+	return `"` + cid + "-" + strconv.Itoa(ThumbnailSize) + `"`
+}
+
+// Thumbnail returns the resized avatar for a blob as a JPEG, from the cache where possible
+func (p *Proxy) Thumbnail(ctx context.Context, did, cid string) ([]byte, error) {
+	key := did + "/" + cid + "/" + strconv.Itoa(ThumbnailSize)
+	if data, ok := p.cache.Get(key); ok {
+		return data, nil
+	}
+
+	v, err, _ := p.group.Do(key, func() (interface{}, error) {
+		ident, err := p.identity.LookupDID(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+		pds := ident.Doc.PDSEndpoint()
+		if pds == "" {
+			return nil, fmt.Errorf("no PDS for %s", did)
+		}
+
+		blob, _, err := p.fetch(ctx, pds, did, cid, MaxBlobSize)
+		if err != nil {
+			return nil, err
+		}
+
+		thumb, err := resize(blob, ThumbnailSize)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.cache.Put(key, thumb); err != nil {
+			return nil, err
+		}
+		return thumb, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// resize checks an avatar blob and scales it to a square JPEG thumbnail
+func resize(blob []byte, size int) ([]byte, error) {
+	// Trust the bytes, not the declared type
+	if mime := http.DetectContentType(blob); !acceptedTypes[mime] {
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrNoAvatar, mime)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoAvatar, err)
+	}
+	if cfg.Width > maxDimension || cfg.Height > maxDimension {
+		return nil, fmt.Errorf("%w: image is %dx%d", ErrNoAvatar, cfg.Width, cfg.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoAvatar, err)
+	}
+
+	// Crop the largest centered square
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+
+	// JPEG has no alpha, so flatten transparent avatars onto white
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fetchBlob downloads a blob with com.atproto.sync.getBlob
+func fetchBlob(ctx context.Context, pdsHost, did, cid string, maxSize int64) ([]byte, string, error) {
+	client, err := atproto.NewClient(atproto.Config{PdsHost: pdsHost})
+	if err != nil {
+		return nil, "", err
+	}
+	return client.GetBlob(ctx, did, cid, maxSize)
+}
@@ -0,0 +1,108 @@
+package avatars
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name    string
+		blob    []byte
+		wantErr bool
+	}{
+		{name: "landscape png", blob: encodePNG(t, 300, 200)},
+		{name: "tiny png", blob: encodePNG(t, 16, 16)},
+		{name: "not an image", blob: []byte("<html>hello</html>"), wantErr: true},
+		{name: "gif", blob: []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), wantErr: true},
+		{name: "oversized dimensions", blob: encodePNG(t, maxDimension+1, 1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := resize(tt.blob, ThumbnailSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoAvatar) {
+					t.Errorf("resize() error = %v, want ErrNoAvatar", err)
+				}
+				return
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("thumbnail is not a JPEG: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != ThumbnailSize || b.Dy() != ThumbnailSize {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", b.Dx(), b.Dy(), ThumbnailSize, ThumbnailSize)
+			}
+		})
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Put("a", []byte(strings.Repeat("a", 10))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put("b", []byte(strings.Repeat("b", 10))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make "a" the least recently used entry, then touch it again through Get
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(cache.path("a"), old, old)
+	os.Chtimes(cache.path("b"), old.Add(time.Minute), old.Add(time.Minute))
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("Get(a) missed")
+	}
+
+	if err := cache.Put("c", []byte(strings.Repeat("c", 10))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("least recently used entry b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Get(%s) missed", key)
+		}
+	}
+
+	// No temporary files are left behind
+	if tmp, _ := filepath.Glob(filepath.Join(dir, ".tmp-*")); len(tmp) != 0 {
+		t.Errorf("leftover temporary files: %v", tmp)
+	}
+}
@@ -0,0 +1,210 @@
+// Package backup takes online snapshots of the SQLite database, keeps the
+// newest few, and restores them while the server is stopped
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultKeep is the number of snapshots kept when rotating
+	DefaultKeep = 7
+
+	snapshotPrefix = "statusphere-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102T150405Z"
+)
+
+// Store writes a snapshot of the database to a file; *db.DB implements it
+type Store interface {
+	Backup(ctx context.Context, dest string) error
+}
+
+// Snapshot is a backup file in the backup directory
+type Snapshot struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// Backups takes snapshots into a directory and rotates them
+type Backups struct {
+	store Store
+
+	// Dir is the directory snapshots are written to
+	Dir string
+
+	// Keep is the number of newest snapshots kept; 0 keeps them all
+	Keep int
+
+	now func() time.Time
+}
+
+// New creates a snapshot taker writing to dir
+func New(store Store, dir string, keep int) *Backups {
+	return &Backups{
+		store: store,
+		Dir:   dir,
+		Keep:  keep,
+		now:   time.Now,
+	}
+}
+
+// Snapshot backs the database up to a new file, checks the copy's integrity,
+// and then deletes snapshots beyond the newest Keep. A snapshot that fails
+// its check is never left in the directory.
+func (b *Backups) Snapshot(ctx context.Context) (*Snapshot, error) {
+	if err := os.MkdirAll(b.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	taken := b.now().UTC().Truncate(time.Second)
+	name := snapshotPrefix + taken.Format(snapshotLayout) + snapshotSuffix
+	path := filepath.Join(b.Dir, name)
+
+	// Written under a name List ignores, and renamed once it is known to be good
+	tmp := filepath.Join(b.Dir, "."+name+".tmp")
+	defer removeSQLiteFiles(tmp)
+
+	if err := b.store.Backup(ctx, tmp); err != nil {
+		return nil, err
+	}
+	if err := Verify(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	snapshot := &Snapshot{Path: path, Time: taken, Size: info.Size()}
+
+	if err := b.rotate(); err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, nil
+}
+
+// List returns the snapshots in the backup directory, newest first
+func (b *Backups) List() ([]Snapshot, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		taken, err := time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		snapshots = append(snapshots, Snapshot{Path: filepath.Join(b.Dir, name), Time: taken, Size: info.Size()})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// rotate deletes the snapshots beyond the newest Keep
+func (b *Backups) rotate() error {
+	if b.Keep <= 0 {
+		return nil
+	}
+
+	snapshots, err := b.List()
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots[min(b.Keep, len(snapshots)):] {
+		if err := os.Remove(snapshot.Path); err != nil {
+			return fmt.Errorf("failed to rotate snapshots: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Verify checks that a snapshot is a SQLite database that passes SQLite's integrity check
+func Verify(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	return db.CheckSQLiteFile(path)
+}
+
+// Run takes a snapshot on every interval until the context is cancelled,
+// starting right away. A zero interval disables periodic backups.
+func (b *Backups) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.runOnce(ctx); errors.Is(err, db.ErrBackupUnsupported) {
+			log.Warn().Err(err).Msg("Periodic backups disabled")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce takes a snapshot and logs the outcome
+func (b *Backups) runOnce(ctx context.Context) error {
+	start := b.now()
+	snapshot, err := b.Snapshot(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed to back up database")
+		}
+		return err
+	}
+
+	log.Info().
+		Str("path", snapshot.Path).
+		Int64("bytes", snapshot.Size).
+		Dur("took", b.now().Sub(start)).
+		Msg("Backed up database")
+	return nil
+}
+
+// removeSQLiteFiles deletes a database file along with its journals, if they exist
+func removeSQLiteFiles(path string) {
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		os.Remove(path + suffix)
+	}
+}
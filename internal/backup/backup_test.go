@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+func openDB(t *testing.T) (*db.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "statusphere.db")
+	database, err := db.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return database, path
+}
+
+func saveStatus(t *testing.T, database *db.DB, rkey string) {
+	t.Helper()
+	at, _ := db.ParseTimestamp("2025-03-07T12:00:00.000Z")
+	err := database.SaveStatus(context.Background(), &db.Status{
+		URI:       syntax.ATURI("at://did:plc:alice/xyz.statusphere.status/" + rkey),
+		AuthorDID: "did:plc:alice",
+		Status:    "👍",
+		CreatedAt: at,
+		IndexedAt: at,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clock returns a now func advancing a second per call
+func clock() func() time.Time {
+	at := time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		at = at.Add(time.Second)
+		return at
+	}
+}
+
+func TestSnapshotRotates(t *testing.T) {
+	database, _ := openDB(t)
+	saveStatus(t, database, "3lbqsq6rwgc2a")
+
+	b := New(database, filepath.Join(t.TempDir(), "backups"), 2)
+	b.now = clock()
+
+	var taken []string
+	for i := 0; i < 4; i++ {
+		snapshot, err := b.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		taken = append(taken, snapshot.Path)
+	}
+
+	snapshots, err := b.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Path != taken[3] || snapshots[1].Path != taken[2] {
+		t.Fatalf("List() = %+v, want the newest two of %v", snapshots, taken)
+	}
+	for _, snapshot := range snapshots {
+		if err := Verify(snapshot.Path); err != nil {
+			t.Error(err)
+		}
+	}
+
+	entries, _ := os.ReadDir(b.Dir)
+	if len(entries) != 2 {
+		t.Errorf("%d files in the backup directory, want only the 2 snapshots", len(entries))
+	}
+}
+
+// corruptStore writes a file that is not a database
+type corruptStore struct{}
+
+func (corruptStore) Backup(ctx context.Context, dest string) error {
+	return os.WriteFile(dest, []byte("not a database, but long enough to look like it might be one"), 0o644)
+}
+
+func TestSnapshotRejectsBadCopy(t *testing.T) {
+	b := New(corruptStore{}, t.TempDir(), 2)
+
+	if _, err := b.Snapshot(context.Background()); err == nil {
+		t.Fatal("Snapshot() succeeded with a corrupt copy")
+	}
+	if entries, _ := os.ReadDir(b.Dir); len(entries) != 0 {
+		t.Errorf("%d files left behind, want none", len(entries))
+	}
+}
+
+func TestRestore(t *testing.T) {
+	database, path := openDB(t)
+	saveStatus(t, database, "3lbqsq6rwgc2a")
+
+	b := New(database, filepath.Join(t.TempDir(), "backups"), 0)
+	snapshot, err := b.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveStatus(t, database, "3lbqsq6rwgc2b")
+
+	lock, err := Hold(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(snapshot.Path, path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Errorf("Restore() while held = %v, want ErrDatabaseInUse", err)
+	}
+	if _, err := HoldExclusive(path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Errorf("HoldExclusive() while held = %v, want ErrDatabaseInUse", err)
+	}
+	lock.Release()
+	database.Close()
+
+	aside, err := Restore(snapshot.Path, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := db.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	page, err := restored.GetRecentStatuses(context.Background(), db.ByIndexedAt, "", 10)
+	if err != nil || len(page.Statuses) != 1 {
+		t.Errorf("restored database has %+v, %v, want the one status in the snapshot", page, err)
+	}
+
+	previous, err := db.OpenSQLite(aside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer previous.Close()
+	page, err = previous.GetRecentStatuses(context.Background(), db.ByIndexedAt, "", 10)
+	if err != nil || len(page.Statuses) != 2 {
+		t.Errorf("previous database has %+v, %v, want both statuses", page, err)
+	}
+}
@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrDatabaseInUse is returned when a restore is attempted while a server has
+// the database open, or a server starts while a restore is running
+var ErrDatabaseInUse = errors.New("database is in use by another process")
+
+// Lock is held on a database by every process using it, and exclusively while
+// restoring it or changing it behind the server's back
+type Lock struct {
+	f *os.File
+}
+
+// Hold takes a shared lock on a SQLite database file, stopping it from being
+// restored until the lock is released. Any number of processes may hold it.
+func Hold(dbPath string) (*Lock, error) {
+	f, err := lockFile(dbPath+".lock", false)
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// HoldExclusive takes the lock on a SQLite database file alone. It fails with
+// ErrDatabaseInUse while any other process, such as a running server, holds it.
+func HoldExclusive(dbPath string) (*Lock, error) {
+	f, err := lockFile(dbPath+".lock", true)
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release lets go of the lock
+func (l *Lock) Release() error {
+	return l.f.Close()
+}
+
+// Restore replaces a SQLite database with a snapshot, after checking the
+// snapshot's integrity. It fails with ErrDatabaseInUse while any process
+// holds the database. The database being replaced, with its WAL, is kept
+// next to it under a .pre-restore name, whose path is returned.
+func Restore(snapshot, dbPath string) (string, error) {
+	f, err := lockFile(dbPath+".lock", true)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := Verify(snapshot); err != nil {
+		return "", err
+	}
+
+	tmp := dbPath + ".restoring"
+	defer os.Remove(tmp)
+	if err := copyFile(snapshot, tmp); err != nil {
+		return "", fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+
+	var aside string
+	if _, err := os.Stat(dbPath); err == nil {
+		aside = dbPath + ".pre-restore-" + time.Now().UTC().Format(snapshotLayout)
+		if err := os.Rename(dbPath, aside); err != nil {
+			return "", fmt.Errorf("failed to move database aside: %w", err)
+		}
+		// The WAL may hold commits not yet checkpointed into the database, so
+		// it goes with it; the shared-memory index is rebuilt from it on open
+		if err := os.Rename(dbPath+"-wal", aside+"-wal"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return aside, fmt.Errorf("failed to move database aside: %w", err)
+		}
+		if err := os.Remove(dbPath + "-shm"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return aside, fmt.Errorf("failed to move database aside: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return aside, fmt.Errorf("failed to put snapshot in place: %w", err)
+	}
+
+	return aside, nil
+}
+
+// copyFile copies src to a new file at dst and syncs it to disk
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -2,7 +2,10 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
 )
@@ -14,6 +17,42 @@ func GetATProtoConfig() atproto.Config {
 	}
 }
 
+// OAuthScopes returns the OAuth scopes the app asks for at login
+func (c *Config) OAuthScopes() atproto.Scopes {
+	scopes := atproto.Scopes{
+		{Resource: atproto.ScopeAtproto},
+		atproto.RepoScope(atproto.StatusCollection),
+	}
+
+	// Validated when the configuration is loaded
+	extra, _ := atproto.ParseScopes(c.OAuthExtraScopes)
+	return append(scopes, extra...)
+}
+
+// OAuthClient returns the client users log in with. Without a PUBLIC_URL the
+// app is a loopback client, which authorization servers accept for local
+// development without fetching any client metadata.
+func (c *Config) OAuthClient() *atproto.OAuthClient {
+	scopes := c.OAuthScopes()
+	if c.PublicURL != "" {
+		return &atproto.OAuthClient{
+			ClientID:    c.PublicURL + "/client-metadata.json",
+			RedirectURI: c.PublicURL + "/oauth/callback",
+			Scopes:      scopes,
+		}
+	}
+
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/oauth/callback", c.Port)
+	query := url.Values{}
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", scopes.String())
+	return &atproto.OAuthClient{
+		ClientID:    "http://localhost?" + strings.ReplaceAll(query.Encode(), "+", "%20"),
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+	}
+}
+
 // getEnvWithDefault gets an environment variable or returns the default if not set
 func getEnvWithDefault(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -21,4 +60,4 @@ func getEnvWithDefault(key, defaultValue string) string {
 		return defaultValue
 	}
 	return value
-}
\ No newline at end of file
+}
@@ -4,21 +4,59 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
 )
 
 // Config holds all configuration for the application
 type Config struct {
 	// Server settings
-	Host        string
-	Port        int
-	Debug       bool
-	PublicURL   string
+	Host      string
+	Port      int
+	Debug     bool
+	DebugAddr string // Address of a separate listener serving /debug/vars; empty disables it
+	PublicURL string
 
 	// Database
-	DBPath      string
+	DatabaseURL    string        // postgres:// URL, or a SQLite file path
+	DBQueryTimeout time.Duration // Queries and transactions running longer are cancelled; 0 for no limit
+	DBSlowQuery    time.Duration // Queries and transactions running at least this long are logged; 0 disables
 
 	// Auth
-	CookieSecret string
+	CookieSecret     string
+	OAuthExtraScopes string // Space-separated scopes requested in addition to the app's own
+
+	// Identity
+	PLCURL string
+
+	// Avatar proxy
+	AvatarCacheDir      string
+	AvatarCacheMaxBytes int64
+
+	// Scheduled statuses
+	ScheduleCatchUpWindow time.Duration // How late a status missed during downtime may still be published
+
+	// Retention
+	RetentionKeepPerAuthor int           // Newest statuses kept per author; 0 for no limit
+	RetentionMaxAge        time.Duration // Statuses indexed longer ago are pruned; 0 for no limit
+	RetentionInterval      time.Duration // How often the retention policy is applied
+	RetentionVacuum        string        // "", "incremental" or "full"
+	RetentionDryRun        bool          // Only log what the policy would prune
+
+	// Backups
+	BackupInterval time.Duration // How often the SQLite database is snapshotted; 0 disables
+	BackupDir      string        // Where snapshots are written
+	BackupKeep     int           // Newest snapshots kept; 0 keeps all
+
+	// Feed cache
+	FeedCacheSize int // Newest statuses kept in memory for the homepage; 0 disables
+
+	// Replication
+	ReplicaURL              string        // Directory or s3:// URL the SQLite WAL is streamed to; empty disables
+	ReplicaSyncInterval     time.Duration // How often new WAL frames are shipped
+	ReplicaSnapshotInterval time.Duration // How often a new generation starts with a full snapshot
+	ReplicaRetention        time.Duration // How far back point-in-time restores can go
 
 	// Environment
 	Environment string
@@ -32,20 +70,114 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid PORT value: %w", err)
 	}
 
+	dbQueryTimeout, err := time.ParseDuration(getEnv("DB_QUERY_TIMEOUT", "5s"))
+	if err != nil || dbQueryTimeout < 0 {
+		return nil, fmt.Errorf("invalid DB_QUERY_TIMEOUT value: must be a non-negative duration")
+	}
+
+	dbSlowQuery, err := time.ParseDuration(getEnv("DB_SLOW_QUERY", "250ms"))
+	if err != nil || dbSlowQuery < 0 {
+		return nil, fmt.Errorf("invalid DB_SLOW_QUERY value: must be a non-negative duration")
+	}
+
+	avatarCacheMaxBytes, err := strconv.ParseInt(getEnv("AVATAR_CACHE_MAX_BYTES", "67108864"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AVATAR_CACHE_MAX_BYTES value: %w", err)
+	}
+
+	scheduleCatchUpWindow, err := time.ParseDuration(getEnv("SCHEDULE_CATCHUP_WINDOW", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCHEDULE_CATCHUP_WINDOW value: %w", err)
+	}
+
+	retentionKeepPerAuthor, err := strconv.Atoi(getEnv("RETENTION_KEEP_PER_AUTHOR", "0"))
+	if err != nil || retentionKeepPerAuthor < 0 {
+		return nil, fmt.Errorf("invalid RETENTION_KEEP_PER_AUTHOR value: must be a non-negative number")
+	}
+
+	retentionMaxAge, err := time.ParseDuration(getEnv("RETENTION_MAX_AGE", "0"))
+	if err != nil || retentionMaxAge < 0 {
+		return nil, fmt.Errorf("invalid RETENTION_MAX_AGE value: must be a non-negative duration")
+	}
+
+	retentionInterval, err := time.ParseDuration(getEnv("RETENTION_INTERVAL", "1h"))
+	if err != nil || retentionInterval <= 0 {
+		return nil, fmt.Errorf("invalid RETENTION_INTERVAL value: must be a positive duration")
+	}
+
+	backupInterval, err := time.ParseDuration(getEnv("BACKUP_INTERVAL", "0"))
+	if err != nil || backupInterval < 0 {
+		return nil, fmt.Errorf("invalid BACKUP_INTERVAL value: must be a non-negative duration")
+	}
+
+	backupKeep, err := strconv.Atoi(getEnv("BACKUP_KEEP", "7"))
+	if err != nil || backupKeep < 0 {
+		return nil, fmt.Errorf("invalid BACKUP_KEEP value: must be a non-negative number")
+	}
+
+	feedCacheSize, err := strconv.Atoi(getEnv("FEED_CACHE_SIZE", "1000"))
+	if err != nil || feedCacheSize < 0 {
+		return nil, fmt.Errorf("invalid FEED_CACHE_SIZE value: must be a non-negative number")
+	}
+
+	replicaSyncInterval, err := time.ParseDuration(getEnv("REPLICA_SYNC_INTERVAL", "1s"))
+	if err != nil || replicaSyncInterval <= 0 {
+		return nil, fmt.Errorf("invalid REPLICA_SYNC_INTERVAL value: must be a positive duration")
+	}
+
+	replicaSnapshotInterval, err := time.ParseDuration(getEnv("REPLICA_SNAPSHOT_INTERVAL", "24h"))
+	if err != nil || replicaSnapshotInterval <= 0 {
+		return nil, fmt.Errorf("invalid REPLICA_SNAPSHOT_INTERVAL value: must be a positive duration")
+	}
+
+	replicaRetention, err := time.ParseDuration(getEnv("REPLICA_RETENTION", "24h"))
+	if err != nil || replicaRetention < 0 {
+		return nil, fmt.Errorf("invalid REPLICA_RETENTION value: must be a non-negative duration")
+	}
+
 	cfg := &Config{
-		Host:         getEnv("HOST", "127.0.0.1"),
-		Port:         port,
-		Debug:        getEnv("DEBUG", "false") == "true",
-		PublicURL:    getEnv("PUBLIC_URL", ""),
-		DBPath:       getEnv("DB_PATH", "./statusphere.db"),
-		CookieSecret: getEnv("COOKIE_SECRET", ""),
-		Environment:  getEnv("NODE_ENV", "development"),
+		Host:                    getEnv("HOST", "127.0.0.1"),
+		Port:                    port,
+		Debug:                   getEnv("DEBUG", "false") == "true",
+		DebugAddr:               getEnv("DEBUG_ADDR", ""),
+		PublicURL:               getEnv("PUBLIC_URL", ""),
+		DatabaseURL:             getEnv("DATABASE_URL", getEnv("DB_PATH", "./statusphere.db")),
+		DBQueryTimeout:          dbQueryTimeout,
+		DBSlowQuery:             dbSlowQuery,
+		CookieSecret:            getEnv("COOKIE_SECRET", ""),
+		OAuthExtraScopes:        getEnv("OAUTH_EXTRA_SCOPES", ""),
+		PLCURL:                  getEnv("PLC_URL", "https://plc.directory"),
+		AvatarCacheDir:          getEnv("AVATAR_CACHE_DIR", "./avatar-cache"),
+		AvatarCacheMaxBytes:     avatarCacheMaxBytes,
+		ScheduleCatchUpWindow:   scheduleCatchUpWindow,
+		RetentionKeepPerAuthor:  retentionKeepPerAuthor,
+		RetentionMaxAge:         retentionMaxAge,
+		RetentionInterval:       retentionInterval,
+		RetentionVacuum:         getEnv("RETENTION_VACUUM", ""),
+		RetentionDryRun:         getEnv("RETENTION_DRY_RUN", "false") == "true",
+		BackupInterval:          backupInterval,
+		BackupDir:               getEnv("BACKUP_DIR", "./backups"),
+		BackupKeep:              backupKeep,
+		FeedCacheSize:           feedCacheSize,
+		ReplicaURL:              getEnv("REPLICA_URL", ""),
+		ReplicaSyncInterval:     replicaSyncInterval,
+		ReplicaSnapshotInterval: replicaSnapshotInterval,
+		ReplicaRetention:        replicaRetention,
+		Environment:             getEnv("NODE_ENV", "development"),
 	}
 
 	// Validate required configuration
 	if cfg.CookieSecret == "" {
 		return nil, fmt.Errorf("COOKIE_SECRET environment variable is required")
 	}
+	if _, err := atproto.ParseScopes(cfg.OAuthExtraScopes); err != nil {
+		return nil, fmt.Errorf("invalid OAUTH_EXTRA_SCOPES value: %w", err)
+	}
+	switch cfg.RetentionVacuum {
+	case "", "incremental", "full":
+	default:
+		return nil, fmt.Errorf("invalid RETENTION_VACUUM value: must be incremental or full")
+	}
 
 	return cfg, nil
 }
@@ -57,4 +189,4 @@ func getEnv(key, defaultValue string) string {
 		return defaultValue
 	}
 	return value
-}
\ No newline at end of file
+}
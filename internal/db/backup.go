@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// ErrBackupUnsupported is returned when backing up a database that is not SQLite
+var ErrBackupUnsupported = errors.New("backups are only supported for SQLite; use pg_dump for PostgreSQL")
+
+// SQLitePath returns the file a SQLite DSN points at, or false for
+// PostgreSQL and in-memory databases
+func SQLitePath(dsn string) (string, bool) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return "", false
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite://"), "file:")
+	path, params, _ := strings.Cut(path, "?")
+	if path == "" || path == ":memory:" || strings.Contains(params, "mode=memory") {
+		return "", false
+	}
+	return path, true
+}
+
+// Backup writes a consistent snapshot of the database to a new SQLite file
+// with SQLite's online backup API. Writes carry on while it runs; the
+// snapshot is of the moment it started. The snapshot uses a rollback
+// journal, so it is a single self-contained file.
+func (db *DB) Backup(ctx context.Context, dest string) error {
+	if db.backend != SQLite {
+		return ErrBackupUnsupported
+	}
+
+	destDB, err := sql.Open("sqlite3", sqliteDSN(dest))
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := db.reader.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	defer srcConn.Close()
+
+	err = destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			// Copying every page in one step reads a single snapshot; in WAL
+			// mode that does not hold up the writer
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+
+	if _, err := destConn.ExecContext(ctx, `PRAGMA journal_mode = DELETE`); err != nil {
+		return fmt.Errorf("failed to finish backup file: %w", err)
+	}
+
+	return nil
+}
+
+// CheckSQLiteFile opens a SQLite file read-only and runs SQLite's integrity check on it
+func CheckSQLiteFile(path string) error {
+	conn, err := sqlx.Connect("sqlite3", sqliteDSN(path, "mode=ro"))
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	var problems []string
+	if err := conn.Select(&problems, `PRAGMA integrity_check`); err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("%s failed its integrity check: %s", path, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
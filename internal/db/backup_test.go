@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+func TestSQLitePath(t *testing.T) {
+	tests := []struct {
+		dsn    string
+		want   string
+		wantOK bool
+	}{
+		{"./statusphere.db", "./statusphere.db", true},
+		{"sqlite:///var/lib/statusphere.db", "/var/lib/statusphere.db", true},
+		{"file:data.db?_busy_timeout=1000", "data.db", true},
+		{":memory:", "", false},
+		{"file:test?mode=memory&cache=shared", "", false},
+		{"postgres://localhost/statusphere", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := SQLitePath(tt.dsn)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("SQLitePath(%q) = %q, %v, want %q, %v", tt.dsn, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestBackupDuringWrites(t *testing.T) {
+	db := openSQLite(t)
+
+	at := NewTimestamp(time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC))
+	save := func(i int) error {
+		return db.SaveStatus(context.Background(), &Status{
+			URI:       syntax.ATURI(fmt.Sprintf("at://did:plc:alice/xyz.statusphere.status/%04d", i)),
+			AuthorDID: "did:plc:alice",
+			Status:    "👍",
+			CreatedAt: at,
+			IndexedAt: at,
+		})
+	}
+	for i := 0; i < 100; i++ {
+		if err := save(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Writes keep going while the backup runs, and must not fail or be lost
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 100; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := save(i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	dest := filepath.Join(t.TempDir(), "backup.db")
+	err := db.Backup(context.Background(), dest)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSQLiteFile(dest); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := sqlx.Connect("sqlite3", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+
+	var count int
+	var mode string
+	if err := snapshot.Get(&count, `SELECT COUNT(*) FROM status`); err != nil || count < 100 {
+		t.Errorf("backup has %d statuses, %v, want at least 100", count, err)
+	}
+	if err := snapshot.Get(&mode, `PRAGMA journal_mode`); err != nil || mode != "delete" {
+		t.Errorf("backup journal_mode = %q, %v, want delete", mode, err)
+	}
+}
@@ -1,27 +1,73 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	postgresmigrations "github.com/referendumApp/statusphere-example-app-go/internal/db/migrations/postgres"
+	sqlitemigrations "github.com/referendumApp/statusphere-example-app-go/internal/db/migrations/sqlite"
+	"github.com/referendumApp/statusphere-example-app-go/internal/migrate"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
 	"github.com/rs/zerolog/log"
 )
 
-// DB is a wrapper around sqlx.DB that provides additional functionality
+// Backend identifies the database engine a DB runs on
+type Backend string
+
+// Supported backends
+const (
+	SQLite   Backend = "sqlite"
+	Postgres Backend = "postgres"
+)
+
+// DB is a wrapper around sqlx.DB that provides additional functionality.
+// Queries are written with ? placeholders and rebound for the backend.
 type DB struct {
 	*sqlx.DB
+	reader  *sqlx.DB // Serves GetContext and SelectContext; the same as DB unless the backend needs a separate pool
+	backend Backend
+
+	// QueryTimeout cancels a query or transaction that runs longer; 0 for no limit
+	QueryTimeout time.Duration
+	// SlowQuery logs a query or transaction that runs at least this long; 0 disables
+	SlowQuery time.Duration
 }
 
 // Status represents a user status in the database
 type Status struct {
-	URI       string `db:"uri"`
-	AuthorDID string `db:"authorDid"`
-	Status    string `db:"status"`
-	CreatedAt string `db:"createdAt"`
-	IndexedAt string `db:"indexedAt"`
+	URI       syntax.ATURI `db:"uri"`
+	AuthorDID syntax.DID   `db:"authorDid"`
+	Status    string       `db:"status"`
+	CreatedAt Timestamp    `db:"createdAt"` // As claimed by the author's client
+	IndexedAt Timestamp    `db:"indexedAt"`
+	// CreatedAt if it is plausible, IndexedAt if not; see EffectiveTime.
+	// Set when the status is saved.
+	EffectiveAt Timestamp `db:"effectiveAt"`
+	CID         string    `db:"cid"`
+	Rev         string    `db:"rev"` // Repo revision at which this version was known to be current
+}
+
+// ClockSkewed reports whether the status's createdAt was implausible, so its
+// effective time is when it was indexed instead
+func (s *Status) ClockSkewed() bool {
+	return !s.EffectiveAt.Equal(s.CreatedAt.Time)
 }
 
+// StrongRef returns a reference to the version of the record this row mirrors
+func (s *Status) StrongRef() atproto.StrongRef {
+	return atproto.StrongRef{URI: s.URI.String(), CID: s.CID}
+}
+
+// ErrStaleStatus is returned when a status write is older than the row it would replace
+var ErrStaleStatus = errors.New("status is older than the stored version")
+
 // AuthSession represents an authentication session in the database
 type AuthSession struct {
 	Key     string `db:"key"`
@@ -34,84 +80,327 @@ type AuthState struct {
 	State string `db:"state"`
 }
 
-// New creates a new database connection
-func New(dbPath string) (*DB, error) {
-	// Connect to the SQLite database
-	db, err := sqlx.Connect("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+// DidCache is a cached DID document and the handle verified for it
+type DidCache struct {
+	DID       string `db:"did"`
+	Doc       string `db:"doc"`
+	Handle    string `db:"handle"`
+	UpdatedAt string `db:"updatedAt"`
+}
+
+// HandleCache is a cached handle to DID resolution
+type HandleCache struct {
+	Handle    string `db:"handle"`
+	DID       string `db:"did"`
+	UpdatedAt string `db:"updatedAt"`
+}
+
+// Profile is a cached app.bsky.actor.profile record
+type Profile struct {
+	DID         string `db:"did"`
+	DisplayName string `db:"displayName"`
+	AvatarCID   string `db:"avatarCid"`
+	AvatarMime  string `db:"avatarMime"`
+	UpdatedAt   string `db:"updatedAt"`
+}
+
+// Outbox entry states
+const (
+	OutboxPending = "pending"
+	OutboxFailed  = "failed"
+)
+
+// OutboxEntry is a status record write that has not yet been confirmed by the user's PDS
+type OutboxEntry struct {
+	URI           syntax.ATURI `db:"uri"`
+	AuthorDID     syntax.DID   `db:"authorDid"`
+	Status        string       `db:"status"`
+	CreatedAt     string       `db:"createdAt"`
+	State         string       `db:"state"`
+	Attempts      int          `db:"attempts"`
+	LastError     string       `db:"lastError"`
+	NextAttemptAt Timestamp    `db:"nextAttemptAt"`
+}
+
+// Scheduled status states
+const (
+	ScheduledPending = "pending"
+	ScheduledMissed  = "missed"
+)
+
+// ScheduledStatus is a status a user has asked to publish at a later time
+type ScheduledStatus struct {
+	URI         syntax.ATURI `db:"uri"` // Where the record will be written
+	AuthorDID   syntax.DID   `db:"authorDid"`
+	Status      string       `db:"status"`
+	ScheduledAt Timestamp    `db:"scheduledAt"`
+	Timezone    string       `db:"timezone"` // IANA zone the user scheduled in, for display
+	State       string       `db:"state"`
+	CreatedAt   Timestamp    `db:"createdAt"`
+}
+
+// Purge job states
+const (
+	PurgeRunning = "running"
+	PurgeDone    = "done"
+	PurgeFailed  = "failed"
+)
+
+// PurgeJob tracks the deletion of a user's status history from their repo
+type PurgeJob struct {
+	DID       syntax.DID `db:"did"`
+	State     string     `db:"state"`
+	Cursor    string     `db:"cursor"` // listRecords cursor to resume from
+	Deleted   int        `db:"deleted"`
+	Total     int        `db:"total"` // Statuses indexed locally when the job started
+	StartedAt Timestamp  `db:"startedAt"`
+	UpdatedAt Timestamp  `db:"updatedAt"`
+	LastError string     `db:"lastError"`
+}
+
+// Open connects to the database named by dsn: a postgres:// URL for
+// PostgreSQL, or a file path, optionally prefixed with sqlite://, for SQLite
+func Open(dsn string) (*DB, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return OpenPostgres(dsn)
+	}
+	return OpenSQLite(strings.TrimPrefix(dsn, "sqlite://"))
+}
+
+// newDB wraps connection pools with the default query limits
+func newDB(writer, reader *sqlx.DB, backend Backend) *DB {
+	return &DB{
+		DB:           writer,
+		reader:       reader,
+		backend:      backend,
+		QueryTimeout: DefaultQueryTimeout,
+		SlowQuery:    DefaultSlowQuery,
 	}
+}
 
-	// Configure the connection
-	db.SetMaxOpenConns(1) // SQLite supports only one writer at a time
+// Backend returns the engine the database runs on
+func (db *DB) Backend() Backend {
+	return db.backend
+}
 
-	return &DB{DB: db}, nil
+// Close closes the database, including the reader pool
+func (db *DB) Close() error {
+	err := db.DB.Close()
+	if db.reader != db.DB {
+		if readerErr := db.reader.Close(); err == nil {
+			err = readerErr
+		}
+	}
+	return err
 }
 
-// Migrate runs database migrations
+// Migrate applies any pending schema migrations
 func (db *DB) Migrate() error {
 	log.Info().Msg("Running database migrations...")
 
-	// Create tables if they don't exist
-	schema := `
-	CREATE TABLE IF NOT EXISTS status (
-		uri TEXT PRIMARY KEY,
-		authorDid TEXT NOT NULL,
-		status TEXT NOT NULL,
-		createdAt TEXT NOT NULL,
-		indexedAt TEXT NOT NULL
-	);
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(0)
+	if err != nil {
+		return err
+	}
 
-	CREATE TABLE IF NOT EXISTS auth_session (
-		key TEXT PRIMARY KEY,
-		session TEXT NOT NULL
-	);
+	log.Info().Int("applied", applied).Msg("Database migrations completed successfully")
+	return nil
+}
 
-	CREATE TABLE IF NOT EXISTS auth_state (
-		key TEXT PRIMARY KEY,
-		state TEXT NOT NULL
-	);
-	`
+// Migrator returns a migrator for the database's schema
+func (db *DB) Migrator() (*migrate.Migrator, error) {
+	load := sqlitemigrations.All
+	if db.backend == Postgres {
+		load = postgresmigrations.All
+	}
 
-	_, err := db.Exec(schema)
+	all, err := load()
 	if err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
+		return nil, err
 	}
+	return migrate.New(db.DB, all), nil
+}
 
-	log.Info().Msg("Database migrations completed successfully")
-	return nil
+// FeedOrder is the order the feed lists statuses in, newest first
+type FeedOrder string
+
+// Feed orders
+const (
+	ByIndexedAt FeedOrder = "indexed" // When statuses reached this app
+	ByCreatedAt FeedOrder = "created" // When their authors created them, by EffectiveAt
+)
+
+// column returns the column a feed order sorts by
+func (o FeedOrder) column() (string, error) {
+	switch o {
+	case ByIndexedAt:
+		return "indexedAt", nil
+	case ByCreatedAt:
+		return "effectiveAt", nil
+	default:
+		return "", fmt.Errorf("unknown feed order %q", o)
+	}
 }
 
-// GetRecentStatuses retrieves recent statuses from the database
-func (db *DB) GetRecentStatuses(limit int) ([]Status, error) {
+// Key returns the time a status is sorted by in a feed order
+func (o FeedOrder) Key(s *Status) Timestamp {
+	if o == ByCreatedAt {
+		return s.EffectiveAt
+	}
+	return s.IndexedAt
+}
+
+// StatusPage is a page of the feed, newest first
+type StatusPage struct {
+	Statuses []Status
+	Cursor   string // Fetches the next, older page; empty on the last one
+}
+
+// ErrInvalidCursor is returned for a feed cursor that was not issued by
+// GetRecentStatuses for the same order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor builds the opaque cursor for the page after a status. The
+// feed is ordered by (time, uri), so the pair marks a position that stays put
+// as new statuses arrive.
+func EncodeCursor(order FeedOrder, s *Status) string {
+	raw := string(order) + " " + order.Key(s).String() + " " + s.URI.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor splits a cursor back into the time and URI it was built from
+func DecodeCursor(order FeedOrder, cursor string) (Timestamp, syntax.ATURI, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Timestamp{}, "", ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), " ", 3)
+	if len(parts) != 3 || parts[0] != string(order) {
+		return Timestamp{}, "", ErrInvalidCursor
+	}
+	at, err := ParseTimestamp(parts[1])
+	if err != nil {
+		return Timestamp{}, "", ErrInvalidCursor
+	}
+	uri, err := syntax.ParseATURI(parts[2])
+	if err != nil {
+		return Timestamp{}, "", ErrInvalidCursor
+	}
+	return at, uri, nil
+}
+
+// GetRecentStatuses retrieves a page of statuses in the given order, starting
+// after the cursor if one is given
+func (db *DB) GetRecentStatuses(ctx context.Context, order FeedOrder, cursor string, limit int) (*StatusPage, error) {
+	page, err := db.getStatusPage(ctx, order, "", cursor, limit)
+	if err != nil && !errors.Is(err, ErrInvalidCursor) {
+		return nil, fmt.Errorf("failed to get recent statuses: %w", err)
+	}
+	return page, err
+}
+
+// GetUserStatuses retrieves a page of a user's statuses, newest first,
+// starting after the cursor if one is given
+func (db *DB) GetUserStatuses(ctx context.Context, authorDID syntax.DID, cursor string, limit int) (*StatusPage, error) {
+	page, err := db.getStatusPage(ctx, ByIndexedAt, authorDID, cursor, limit)
+	if err != nil && !errors.Is(err, ErrInvalidCursor) {
+		return nil, fmt.Errorf("failed to get user statuses: %w", err)
+	}
+	return page, err
+}
+
+// getStatusPage retrieves a page of statuses in the given order, by one
+// author if authorDID is set
+func (db *DB) getStatusPage(ctx context.Context, order FeedOrder, authorDID syntax.DID, cursor string, limit int) (*StatusPage, error) {
 	var statuses []Status
 
+	column, err := order.column()
+	if err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []interface{}
+	if authorDID != "" {
+		where = append(where, "authorDid = ?")
+		args = append(args, authorDID)
+	}
+	if cursor != "" {
+		at, uri, err := DecodeCursor(order, cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf("(%s, uri) < (?, ?)", column))
+		args = append(args, at, uri)
+	}
+
+	query := `SELECT * FROM status`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// One extra row tells whether there is a page after this one
+	query += fmt.Sprintf(` ORDER BY %s DESC, uri DESC LIMIT ?`, column)
+	args = append(args, limit+1)
+
+	if err := db.SelectContext(ctx, &statuses, query, args...); err != nil {
+		return nil, err
+	}
+
+	page := &StatusPage{Statuses: statuses}
+	if len(statuses) > limit {
+		page.Statuses = statuses[:limit]
+		page.Cursor = EncodeCursor(order, &page.Statuses[limit-1])
+	}
+
+	return page, nil
+}
+
+// StatusDay counts the statuses a user set to one emoji on one day
+type StatusDay struct {
+	Day    string `db:"day"` // UTC date, as YYYY-MM-DD
+	Status string `db:"status"`
+	Count  int    `db:"count"`
+}
+
+// GetUserStatusDays counts a user's statuses per day and emoji since a time,
+// by when they were posted. Days are in order, and within a day the most
+// used emoji come first.
+func (db *DB) GetUserStatusDays(ctx context.Context, authorDID syntax.DID, since Timestamp) ([]StatusDay, error) {
+	var days []StatusDay
+
+	// Timestamps are stored in a fixed-width format starting with the date
 	query := `
-	SELECT * FROM status
-	ORDER BY indexedAt DESC
-	LIMIT ?
+	SELECT substr(effectiveAt, 1, 10) AS day, status, COUNT(*) AS count
+	FROM status
+	WHERE authorDid = ? AND effectiveAt >= ?
+	GROUP BY substr(effectiveAt, 1, 10), status
+	ORDER BY day, count DESC, status
 	`
 
-	err := db.Select(&statuses, query, limit)
+	err := db.SelectContext(ctx, &days, query, authorDID, since)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent statuses: %w", err)
+		return nil, fmt.Errorf("failed to get user status days: %w", err)
 	}
 
-	return statuses, nil
+	return days, nil
 }
 
 // GetUserStatus retrieves the latest status for a user
-func (db *DB) GetUserStatus(authorDID string) (*Status, error) {
+func (db *DB) GetUserStatus(ctx context.Context, authorDID syntax.DID) (*Status, error) {
 	var status Status
 
 	query := `
 	SELECT * FROM status
 	WHERE authorDid = ?
-	ORDER BY indexedAt DESC
+	ORDER BY indexedAt DESC, uri DESC
 	LIMIT 1
 	`
 
-	err := db.Get(&status, query, authorDID)
+	err := db.GetContext(ctx, &status, query, authorDID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user status: %w", err)
 	}
@@ -119,53 +408,235 @@ func (db *DB) GetUserStatus(authorDID string) (*Status, error) {
 	return &status, nil
 }
 
-// SaveStatus stores a status in the database
-func (db *DB) SaveStatus(status *Status) error {
-	query := `
-	INSERT INTO status (uri, authorDid, status, createdAt, indexedAt)
-	VALUES (?, ?, ?, ?, ?)
+// GetStatus retrieves a single status by URI
+func (db *DB) GetStatus(ctx context.Context, uri syntax.ATURI) (*Status, error) {
+	var status Status
+
+	query := `SELECT * FROM status WHERE uri = ?`
+
+	err := db.GetContext(ctx, &status, query, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	return &status, nil
+}
+
+// upsertStatus writes a status unless the stored row has a newer rev. A row
+// without a rev can be replaced by anything; a write without a rev can only
+// replace a row without one.
+const upsertStatus = `
+	INSERT INTO status (uri, authorDid, status, createdAt, indexedAt, effectiveAt, cid, rev)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT (uri) DO UPDATE SET
+		authorDid = excluded.authorDid,
 		status = excluded.status,
-		indexedAt = excluded.indexedAt
+		createdAt = excluded.createdAt,
+		indexedAt = excluded.indexedAt,
+		effectiveAt = excluded.effectiveAt,
+		cid = excluded.cid,
+		rev = excluded.rev
+	WHERE status.rev = '' OR excluded.rev >= status.rev
 	`
 
-	_, err := db.Exec(
-		query,
+// insertStatus stores a status that is not stored yet, doing nothing if it is
+const insertStatus = `
+	INSERT INTO status (uri, authorDid, status, createdAt, indexedAt, effectiveAt, cid, rev)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (uri) DO NOTHING
+	`
+
+// writeStatus stores a status in a transaction, counting it in the emoji
+// rollups if it is new and otherwise replacing the stored row with upsert.
+// Replacing a row never touches the rollups, so an edit to another emoji is
+// not counted. It returns ErrStaleStatus if upsert changed nothing.
+func writeStatus(tx *Tx, upsert string, status *Status) error {
+	status.EffectiveAt = EffectiveTime(status.CreatedAt, status.IndexedAt)
+	args := []interface{}{
 		status.URI,
 		status.AuthorDID,
 		status.Status,
 		status.CreatedAt,
 		status.IndexedAt,
-	)
+		status.EffectiveAt,
+		status.CID,
+		status.Rev,
+	}
 
+	// Inserting first, rather than checking whether the row exists, counts
+	// each status once even when two writes of it race
+	result, err := tx.Exec(insertStatus, args...)
 	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return countStatus(tx, status)
+	}
+
+	result, err = tx.Exec(upsert, args...)
+	if err != nil {
+		return err
+	}
+	return checkApplied(result)
+}
+
+// SaveStatus stores a status in the database. It returns ErrStaleStatus,
+// leaving the row alone, if the stored version has a newer rev.
+func (db *DB) SaveStatus(ctx context.Context, status *Status) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save status: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := writeStatus(tx, upsertStatus, status); errors.Is(err, ErrStaleStatus) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to save status: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to save status: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteStatus removes a status from the database
-func (db *DB) DeleteStatus(uri string) error {
-	query := `DELETE FROM status WHERE uri = ?`
+// DeleteStatus removes a status deleted from its repo at the given rev. It
+// returns ErrStaleStatus if the stored version is newer than the delete. An
+// empty rev deletes unconditionally.
+func (db *DB) DeleteStatus(ctx context.Context, uri syntax.ATURI, rev string) error {
+	query := `DELETE FROM status WHERE uri = ? AND (? = '' OR rev <= ?)`
 
-	_, err := db.Exec(query, uri)
+	result, err := db.ExecContext(ctx, query, uri, rev, rev)
 	if err != nil {
 		return fmt.Errorf("failed to delete status: %w", err)
 	}
 
+	if n, err := result.RowsAffected(); err == nil && n == 0 && rev != "" {
+		// Either already gone or newer; only the latter is stale
+		var count int
+		if err := db.GetContext(ctx, &count, `SELECT COUNT(*) FROM status WHERE uri = ?`, uri); err == nil && count > 0 {
+			return ErrStaleStatus
+		}
+	}
+
+	return nil
+}
+
+// checkApplied returns ErrStaleStatus if an upsert changed no rows
+func checkApplied(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save status: %w", err)
+	}
+	if n == 0 {
+		return ErrStaleStatus
+	}
+	return nil
+}
+
+// importStatus replaces a stored status with one backfilled from its repo,
+// keeping its indexedAt
+const importStatus = `
+	INSERT INTO status (uri, authorDid, status, createdAt, indexedAt, effectiveAt, cid, rev)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (uri) DO UPDATE SET
+		authorDid = excluded.authorDid,
+		status = excluded.status,
+		createdAt = excluded.createdAt,
+		effectiveAt = CASE WHEN excluded.effectiveAt = excluded.createdAt THEN excluded.effectiveAt ELSE status.indexedAt END,
+		cid = excluded.cid,
+		rev = excluded.rev
+	WHERE status.rev = '' OR excluded.rev >= status.rev
+	`
+
+// ImportStatus stores a status backfilled from the author's repo. Unlike
+// SaveStatus it leaves the indexedAt of a row that already exists alone, so
+// importing does not move old statuses to the top of the feed; an implausible
+// createdAt then falls back to the kept indexedAt too. Like SaveStatus it
+// returns ErrStaleStatus if the stored version is newer.
+func (db *DB) ImportStatus(ctx context.Context, status *Status) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to import status: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := writeStatus(tx, importStatus, status); errors.Is(err, ErrStaleStatus) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to import status: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to import status: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserStatusURIs retrieves the URIs of a user's statuses indexed before the given time
+func (db *DB) GetUserStatusURIs(ctx context.Context, authorDID syntax.DID, indexedBefore Timestamp) ([]syntax.ATURI, error) {
+	var uris []syntax.ATURI
+
+	query := `
+	SELECT uri FROM status
+	WHERE authorDid = ? AND indexedAt < ?
+	`
+
+	err := db.SelectContext(ctx, &uris, query, authorDID, indexedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status URIs: %w", err)
+	}
+
+	return uris, nil
+}
+
+// CountUserStatuses counts a user's statuses
+func (db *DB) CountUserStatuses(ctx context.Context, authorDID syntax.DID) (int, error) {
+	var count int
+
+	err := db.GetContext(ctx, &count, `SELECT COUNT(*) FROM status WHERE authorDid = ?`, authorDID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count statuses: %w", err)
+	}
+
+	return count, nil
+}
+
+// DeleteStatuses removes a set of statuses in one transaction
+func (db *DB) DeleteStatuses(ctx context.Context, uris []syntax.ATURI) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete statuses: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, uri := range uris {
+		if _, err := tx.Exec(`DELETE FROM status WHERE uri = ?`, uri); err != nil {
+			return fmt.Errorf("failed to delete statuses: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete statuses: %w", err)
+	}
+
 	return nil
 }
 
 // The following methods are for auth session storage
 
 // GetAuthSession retrieves an auth session from the database
-func (db *DB) GetAuthSession(key string) (string, error) {
+func (db *DB) GetAuthSession(ctx context.Context, key string) (string, error) {
 	var session AuthSession
 
 	query := `SELECT * FROM auth_session WHERE key = ?`
 
-	err := db.Get(&session, query, key)
+	err := db.GetContext(ctx, &session, query, key)
 	if err != nil {
 		return "", fmt.Errorf("failed to get auth session: %w", err)
 	}
@@ -174,7 +645,7 @@ func (db *DB) GetAuthSession(key string) (string, error) {
 }
 
 // SaveAuthSession stores an auth session in the database
-func (db *DB) SaveAuthSession(key, sessionData string) error {
+func (db *DB) SaveAuthSession(ctx context.Context, key, sessionData string) error {
 	query := `
 	INSERT INTO auth_session (key, session)
 	VALUES (?, ?)
@@ -182,7 +653,7 @@ func (db *DB) SaveAuthSession(key, sessionData string) error {
 		session = excluded.session
 	`
 
-	_, err := db.Exec(query, key, sessionData)
+	_, err := db.ExecContext(ctx, query, key, sessionData)
 	if err != nil {
 		return fmt.Errorf("failed to save auth session: %w", err)
 	}
@@ -191,10 +662,10 @@ func (db *DB) SaveAuthSession(key, sessionData string) error {
 }
 
 // DeleteAuthSession removes an auth session from the database
-func (db *DB) DeleteAuthSession(key string) error {
+func (db *DB) DeleteAuthSession(ctx context.Context, key string) error {
 	query := `DELETE FROM auth_session WHERE key = ?`
 
-	_, err := db.Exec(query, key)
+	_, err := db.ExecContext(ctx, query, key)
 	if err != nil {
 		return fmt.Errorf("failed to delete auth session: %w", err)
 	}
@@ -205,12 +676,12 @@ func (db *DB) DeleteAuthSession(key string) error {
 // The following methods are for auth state storage
 
 // GetAuthState retrieves an auth state from the database
-func (db *DB) GetAuthState(key string) (string, error) {
+func (db *DB) GetAuthState(ctx context.Context, key string) (string, error) {
 	var state AuthState
 
 	query := `SELECT * FROM auth_state WHERE key = ?`
 
-	err := db.Get(&state, query, key)
+	err := db.GetContext(ctx, &state, query, key)
 	if err != nil {
 		return "", fmt.Errorf("failed to get auth state: %w", err)
 	}
@@ -219,7 +690,7 @@ func (db *DB) GetAuthState(key string) (string, error) {
 }
 
 // SaveAuthState stores an auth state in the database
-func (db *DB) SaveAuthState(key, stateData string) error {
+func (db *DB) SaveAuthState(ctx context.Context, key, stateData string) error {
 	query := `
 	INSERT INTO auth_state (key, state)
 	VALUES (?, ?)
@@ -227,7 +698,7 @@ func (db *DB) SaveAuthState(key, stateData string) error {
 		state = excluded.state
 	`
 
-	_, err := db.Exec(query, key, stateData)
+	_, err := db.ExecContext(ctx, query, key, stateData)
 	if err != nil {
 		return fmt.Errorf("failed to save auth state: %w", err)
 	}
@@ -236,13 +707,447 @@ func (db *DB) SaveAuthState(key, stateData string) error {
 }
 
 // DeleteAuthState removes an auth state from the database
-func (db *DB) DeleteAuthState(key string) error {
+func (db *DB) DeleteAuthState(ctx context.Context, key string) error {
 	query := `DELETE FROM auth_state WHERE key = ?`
 
-	_, err := db.Exec(query, key)
+	_, err := db.ExecContext(ctx, query, key)
 	if err != nil {
 		return fmt.Errorf("failed to delete auth state: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// The following methods are for the identity cache
+
+// GetDidCache retrieves a cached DID document
+func (db *DB) GetDidCache(ctx context.Context, did string) (*DidCache, error) {
+	var entry DidCache
+
+	query := `SELECT * FROM did_cache WHERE did = ?`
+
+	err := db.GetContext(ctx, &entry, query, did)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get did cache: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// SaveDidCache stores a DID document in the cache
+func (db *DB) SaveDidCache(ctx context.Context, entry *DidCache) error {
+	query := `
+	INSERT INTO did_cache (did, doc, handle, updatedAt)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (did) DO UPDATE SET
+		doc = excluded.doc,
+		handle = excluded.handle,
+		updatedAt = excluded.updatedAt
+	`
+
+	_, err := db.ExecContext(ctx, query, entry.DID, entry.Doc, entry.Handle, entry.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save did cache: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDidCache removes a DID and any handles resolving to it from the cache
+func (db *DB) DeleteDidCache(ctx context.Context, did string) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete did cache: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM did_cache WHERE did = ?`, did); err != nil {
+		return fmt.Errorf("failed to delete did cache: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM handle_cache WHERE did = ?`, did); err != nil {
+		return fmt.Errorf("failed to delete did cache: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete did cache: %w", err)
+	}
+
+	return nil
+}
+
+// GetHandleCache retrieves a cached handle resolution
+func (db *DB) GetHandleCache(ctx context.Context, handle string) (*HandleCache, error) {
+	var entry HandleCache
+
+	query := `SELECT * FROM handle_cache WHERE handle = ?`
+
+	err := db.GetContext(ctx, &entry, query, handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get handle cache: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// SaveHandleCache stores a handle resolution in the cache
+func (db *DB) SaveHandleCache(ctx context.Context, entry *HandleCache) error {
+	query := `
+	INSERT INTO handle_cache (handle, did, updatedAt)
+	VALUES (?, ?, ?)
+	ON CONFLICT (handle) DO UPDATE SET
+		did = excluded.did,
+		updatedAt = excluded.updatedAt
+	`
+
+	_, err := db.ExecContext(ctx, query, entry.Handle, entry.DID, entry.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save handle cache: %w", err)
+	}
+
+	return nil
+}
+
+// The following methods are for the profile cache
+
+// GetProfiles retrieves the cached profiles for a set of DIDs
+func (db *DB) GetProfiles(ctx context.Context, dids []string) ([]Profile, error) {
+	if len(dids) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT * FROM profile WHERE did IN (?)`, dids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profiles: %w", err)
+	}
+
+	var profiles []Profile
+	err = db.SelectContext(ctx, &profiles, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profiles: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// SaveProfile stores a profile in the cache
+func (db *DB) SaveProfile(ctx context.Context, profile *Profile) error {
+	query := `
+	INSERT INTO profile (did, displayName, avatarCid, avatarMime, updatedAt)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (did) DO UPDATE SET
+		displayName = excluded.displayName,
+		avatarCid = excluded.avatarCid,
+		avatarMime = excluded.avatarMime,
+		updatedAt = excluded.updatedAt
+	`
+
+	_, err := db.ExecContext(ctx,
+		query,
+		profile.DID,
+		profile.DisplayName,
+		profile.AvatarCID,
+		profile.AvatarMime,
+		profile.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+
+	return nil
+}
+
+// The following methods are for the outbox of pending record writes
+
+// SaveOutboxEntry stores an outbox entry, replacing any with the same URI
+func (db *DB) SaveOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	query := `
+	INSERT INTO outbox (uri, authorDid, status, createdAt, state, attempts, lastError, nextAttemptAt)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (uri) DO UPDATE SET
+		state = excluded.state,
+		attempts = excluded.attempts,
+		lastError = excluded.lastError,
+		nextAttemptAt = excluded.nextAttemptAt
+	`
+
+	_, err := db.ExecContext(ctx,
+		query,
+		entry.URI,
+		entry.AuthorDID,
+		entry.Status,
+		entry.CreatedAt,
+		entry.State,
+		entry.Attempts,
+		entry.LastError,
+		entry.NextAttemptAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueOutboxEntries retrieves pending entries whose next attempt is due
+func (db *DB) GetDueOutboxEntries(ctx context.Context, now Timestamp, limit int) ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+
+	query := `
+	SELECT * FROM outbox
+	WHERE state = ? AND nextAttemptAt <= ?
+	ORDER BY nextAttemptAt
+	LIMIT ?
+	`
+
+	err := db.SelectContext(ctx, &entries, query, OutboxPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due outbox entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// GetUserOutboxEntries retrieves a user's unconfirmed writes, newest first
+func (db *DB) GetUserOutboxEntries(ctx context.Context, authorDID syntax.DID) ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+
+	query := `
+	SELECT * FROM outbox
+	WHERE authorDid = ?
+	ORDER BY createdAt DESC
+	`
+
+	err := db.SelectContext(ctx, &entries, query, authorDID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// DeleteOutboxEntry removes an outbox entry
+func (db *DB) DeleteOutboxEntry(ctx context.Context, uri syntax.ATURI) error {
+	query := `DELETE FROM outbox WHERE uri = ?`
+
+	_, err := db.ExecContext(ctx, query, uri)
+	if err != nil {
+		return fmt.Errorf("failed to delete outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFailedOutboxEntry removes an outbox entry if it has been marked failed
+func (db *DB) DeleteFailedOutboxEntry(ctx context.Context, uri syntax.ATURI) error {
+	query := `DELETE FROM outbox WHERE uri = ? AND state = ?`
+
+	_, err := db.ExecContext(ctx, query, uri, OutboxFailed)
+	if err != nil {
+		return fmt.Errorf("failed to delete outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmOutboxEntry saves a confirmed status and removes its outbox entry in
+// one transaction. If a newer version of the status is already stored, it is kept.
+func (db *DB) ConfirmOutboxEntry(ctx context.Context, status *Status) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to confirm outbox entry: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := writeStatus(tx, upsertStatus, status); err != nil && !errors.Is(err, ErrStaleStatus) {
+		return fmt.Errorf("failed to confirm outbox entry: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM outbox WHERE uri = ?`, status.URI); err != nil {
+		return fmt.Errorf("failed to confirm outbox entry: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to confirm outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// The following methods are for scheduled statuses
+
+// SaveScheduledStatus stores a new scheduled status
+func (db *DB) SaveScheduledStatus(ctx context.Context, scheduled *ScheduledStatus) error {
+	query := `
+	INSERT INTO scheduled_status (uri, authorDid, status, scheduledAt, timezone, state, createdAt)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := db.ExecContext(ctx,
+		query,
+		scheduled.URI,
+		scheduled.AuthorDID,
+		scheduled.Status,
+		scheduled.ScheduledAt,
+		scheduled.Timezone,
+		scheduled.State,
+		scheduled.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save scheduled status: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueScheduledStatuses retrieves pending scheduled statuses whose time has come, oldest first
+func (db *DB) GetDueScheduledStatuses(ctx context.Context, now Timestamp, limit int) ([]ScheduledStatus, error) {
+	var scheduled []ScheduledStatus
+
+	query := `
+	SELECT * FROM scheduled_status
+	WHERE state = ? AND scheduledAt <= ?
+	ORDER BY scheduledAt
+	LIMIT ?
+	`
+
+	err := db.SelectContext(ctx, &scheduled, query, ScheduledPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due scheduled statuses: %w", err)
+	}
+
+	return scheduled, nil
+}
+
+// GetUserScheduledStatuses retrieves a user's scheduled statuses, soonest first
+func (db *DB) GetUserScheduledStatuses(ctx context.Context, authorDID syntax.DID) ([]ScheduledStatus, error) {
+	var scheduled []ScheduledStatus
+
+	query := `
+	SELECT * FROM scheduled_status
+	WHERE authorDid = ?
+	ORDER BY scheduledAt
+	`
+
+	err := db.SelectContext(ctx, &scheduled, query, authorDID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled statuses: %w", err)
+	}
+
+	return scheduled, nil
+}
+
+// UpdateScheduledStatusState sets the state of a scheduled status
+func (db *DB) UpdateScheduledStatusState(ctx context.Context, uri syntax.ATURI, state string) error {
+	query := `UPDATE scheduled_status SET state = ? WHERE uri = ?`
+
+	_, err := db.ExecContext(ctx, query, state, uri)
+	if err != nil {
+		return fmt.Errorf("failed to update scheduled status: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteScheduledStatus removes a scheduled status
+func (db *DB) DeleteScheduledStatus(ctx context.Context, uri syntax.ATURI) error {
+	query := `DELETE FROM scheduled_status WHERE uri = ?`
+
+	_, err := db.ExecContext(ctx, query, uri)
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled status: %w", err)
+	}
+
+	return nil
+}
+
+// The following methods are for purge jobs
+
+// SavePurgeJob stores a purge job, replacing any earlier job for the same user
+func (db *DB) SavePurgeJob(ctx context.Context, job *PurgeJob) error {
+	query := `
+	INSERT INTO purge_job (did, state, cursor, deleted, total, startedAt, updatedAt, lastError)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (did) DO UPDATE SET
+		state = excluded.state,
+		cursor = excluded.cursor,
+		deleted = excluded.deleted,
+		total = excluded.total,
+		startedAt = excluded.startedAt,
+		updatedAt = excluded.updatedAt,
+		lastError = excluded.lastError
+	`
+
+	_, err := db.ExecContext(ctx,
+		query,
+		job.DID,
+		job.State,
+		job.Cursor,
+		job.Deleted,
+		job.Total,
+		job.StartedAt,
+		job.UpdatedAt,
+		job.LastError,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save purge job: %w", err)
+	}
+
+	return nil
+}
+
+// GetPurgeJob retrieves a user's purge job
+func (db *DB) GetPurgeJob(ctx context.Context, did syntax.DID) (*PurgeJob, error) {
+	var job PurgeJob
+
+	err := db.GetContext(ctx, &job, `SELECT * FROM purge_job WHERE did = ?`, did)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purge job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// GetRunningPurgeJobs retrieves every purge job that has not finished
+func (db *DB) GetRunningPurgeJobs(ctx context.Context) ([]PurgeJob, error) {
+	var jobs []PurgeJob
+
+	err := db.SelectContext(ctx, &jobs, `SELECT * FROM purge_job WHERE state = ?`, PurgeRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purge jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// SavePurgeBatch records a batch of statuses deleted from the user's repo,
+// removing them locally and advancing the job in one transaction
+func (db *DB) SavePurgeBatch(ctx context.Context, job *PurgeJob, uris []syntax.ATURI) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save purge batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, uri := range uris {
+		if _, err := tx.Exec(`DELETE FROM status WHERE uri = ?`, uri); err != nil {
+			return fmt.Errorf("failed to save purge batch: %w", err)
+		}
+	}
+
+	query := `
+	UPDATE purge_job
+	SET state = ?, cursor = ?, deleted = ?, updatedAt = ?, lastError = ?
+	WHERE did = ?
+	`
+
+	_, err = tx.Exec(query, job.State, job.Cursor, job.Deleted, job.UpdatedAt, job.LastError, job.DID)
+	if err != nil {
+		return fmt.Errorf("failed to save purge batch: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save purge batch: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+-- Matches the SQLite schema as of its migration 0002, which added the status
+-- cid and rev columns. Columns compared as strings use the C collation so they
+-- sort bytewise, as they do in SQLite.
+CREATE TABLE status (
+	uri TEXT COLLATE "C" PRIMARY KEY,
+	authorDid TEXT NOT NULL,
+	status TEXT NOT NULL,
+	createdAt TEXT COLLATE "C" NOT NULL,
+	indexedAt TEXT COLLATE "C" NOT NULL,
+	cid TEXT NOT NULL DEFAULT '',
+	rev TEXT COLLATE "C" NOT NULL DEFAULT ''
+);
+
+CREATE TABLE auth_session (
+	key TEXT PRIMARY KEY,
+	session TEXT NOT NULL
+);
+
+CREATE TABLE auth_state (
+	key TEXT PRIMARY KEY,
+	state TEXT NOT NULL
+);
+
+CREATE TABLE did_cache (
+	did TEXT PRIMARY KEY,
+	doc TEXT NOT NULL,
+	handle TEXT NOT NULL,
+	updatedAt TEXT COLLATE "C" NOT NULL
+);
+
+CREATE TABLE handle_cache (
+	handle TEXT PRIMARY KEY,
+	did TEXT NOT NULL,
+	updatedAt TEXT COLLATE "C" NOT NULL
+);
+
+CREATE TABLE outbox (
+	uri TEXT PRIMARY KEY,
+	authorDid TEXT NOT NULL,
+	status TEXT NOT NULL,
+	createdAt TEXT COLLATE "C" NOT NULL,
+	state TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	lastError TEXT NOT NULL DEFAULT '',
+	nextAttemptAt TEXT COLLATE "C" NOT NULL
+);
+
+CREATE TABLE scheduled_status (
+	uri TEXT PRIMARY KEY,
+	authorDid TEXT NOT NULL,
+	status TEXT NOT NULL,
+	scheduledAt TEXT COLLATE "C" NOT NULL,
+	timezone TEXT NOT NULL,
+	state TEXT NOT NULL,
+	createdAt TEXT COLLATE "C" NOT NULL
+);
+
+CREATE INDEX scheduled_status_due ON scheduled_status (state, scheduledAt);
+
+CREATE TABLE purge_job (
+	did TEXT PRIMARY KEY,
+	state TEXT NOT NULL,
+	cursor TEXT NOT NULL DEFAULT '',
+	deleted INTEGER NOT NULL DEFAULT 0,
+	total INTEGER NOT NULL DEFAULT 0,
+	startedAt TEXT COLLATE "C" NOT NULL,
+	updatedAt TEXT COLLATE "C" NOT NULL,
+	lastError TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE profile (
+	did TEXT PRIMARY KEY,
+	displayName TEXT NOT NULL,
+	avatarCid TEXT NOT NULL,
+	avatarMime TEXT NOT NULL,
+	updatedAt TEXT COLLATE "C" NOT NULL
+);
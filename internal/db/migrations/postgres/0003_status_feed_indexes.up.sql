@@ -0,0 +1,4 @@
+-- The feed pages through statuses newest first, by (indexedAt, uri); an
+-- author's statuses are looked up by authorDid and ordered the same way
+CREATE INDEX status_feed ON status (indexedAt DESC, uri DESC);
+CREATE INDEX status_author ON status (authorDid, indexedAt DESC, uri DESC);
@@ -0,0 +1,3 @@
+-- Times stay normalized; they are still valid RFC 3339
+DROP INDEX status_created;
+ALTER TABLE status DROP COLUMN effectiveAt;
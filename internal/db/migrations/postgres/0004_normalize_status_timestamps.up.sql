@@ -0,0 +1,21 @@
+-- Status times become fixed-width UTC with millisecond precision, so they sort
+-- correctly as strings whatever zone or precision they were written in. A
+-- createdAt that cannot be parsed falls back to indexedAt.
+UPDATE status SET indexedAt = to_char(indexedAt::timestamptz AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"')
+WHERE indexedAt ~ '^\d{4}-\d\d-\d\d[Tt ]\d\d:\d\d:\d\d(\.\d+)?([Zz]|[+-]\d\d:\d\d)$';
+UPDATE status SET createdAt = CASE
+	WHEN createdAt ~ '^\d{4}-\d\d-\d\d[Tt ]\d\d:\d\d:\d\d(\.\d+)?([Zz]|[+-]\d\d:\d\d)$'
+		THEN to_char(createdAt::timestamptz AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"')
+	ELSE indexedAt
+END;
+
+-- effectiveAt is createdAt unless it is before 2022 or more than five minutes
+-- after indexedAt, as db.EffectiveTime decides for new rows
+ALTER TABLE status ADD COLUMN effectiveAt TEXT COLLATE "C" NOT NULL DEFAULT '';
+UPDATE status SET effectiveAt = CASE
+	WHEN createdAt < '2022-01-01T00:00:00.000Z'
+		OR createdAt > to_char((indexedAt::timestamptz + interval '5 minutes') AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"') THEN indexedAt
+	ELSE createdAt
+END;
+
+CREATE INDEX status_created ON status (effectiveAt DESC, uri DESC);
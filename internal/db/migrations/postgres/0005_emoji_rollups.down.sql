@@ -0,0 +1,3 @@
+DROP TABLE emoji_weekly;
+DROP TABLE emoji_daily;
+DROP TABLE emoji_hourly;
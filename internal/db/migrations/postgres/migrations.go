@@ -0,0 +1,25 @@
+// Package postgres holds the history of the PostgreSQL schema. SQL migrations are
+// embedded from this directory; Go migrations register themselves from their
+// own files. Run `go run ./cmd/migrate create <name>` to add one.
+package postgres
+
+import (
+	"embed"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/migrate"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+var goMigrations []migrate.Migration
+
+// register adds a Go migration
+func register(m migrate.Migration) {
+	goMigrations = append(goMigrations, m)
+}
+
+// All returns every migration in version order
+func All() ([]migrate.Migration, error) {
+	return migrate.Load(files, goMigrations...)
+}
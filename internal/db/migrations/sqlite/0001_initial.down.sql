@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS profile;
+DROP TABLE IF EXISTS purge_job;
+DROP TABLE IF EXISTS scheduled_status;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS handle_cache;
+DROP TABLE IF EXISTS did_cache;
+DROP TABLE IF EXISTS auth_state;
+DROP TABLE IF EXISTS auth_session;
+DROP TABLE IF EXISTS status;
@@ -0,0 +1,74 @@
+-- Tables may already exist in databases created before migrations were
+-- versioned, so everything here is conditional
+CREATE TABLE IF NOT EXISTS status (
+	uri TEXT PRIMARY KEY,
+	authorDid TEXT NOT NULL,
+	status TEXT NOT NULL,
+	createdAt TEXT NOT NULL,
+	indexedAt TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS auth_session (
+	key TEXT PRIMARY KEY,
+	session TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS auth_state (
+	key TEXT PRIMARY KEY,
+	state TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS did_cache (
+	did TEXT PRIMARY KEY,
+	doc TEXT NOT NULL,
+	handle TEXT NOT NULL,
+	updatedAt TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS handle_cache (
+	handle TEXT PRIMARY KEY,
+	did TEXT NOT NULL,
+	updatedAt TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+	uri TEXT PRIMARY KEY,
+	authorDid TEXT NOT NULL,
+	status TEXT NOT NULL,
+	createdAt TEXT NOT NULL,
+	state TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	lastError TEXT NOT NULL DEFAULT '',
+	nextAttemptAt TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_status (
+	uri TEXT PRIMARY KEY,
+	authorDid TEXT NOT NULL,
+	status TEXT NOT NULL,
+	scheduledAt TEXT NOT NULL,
+	timezone TEXT NOT NULL,
+	state TEXT NOT NULL,
+	createdAt TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_status_due ON scheduled_status (state, scheduledAt);
+
+CREATE TABLE IF NOT EXISTS purge_job (
+	did TEXT PRIMARY KEY,
+	state TEXT NOT NULL,
+	cursor TEXT NOT NULL DEFAULT '',
+	deleted INTEGER NOT NULL DEFAULT 0,
+	total INTEGER NOT NULL DEFAULT 0,
+	startedAt TEXT NOT NULL,
+	updatedAt TEXT NOT NULL,
+	lastError TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS profile (
+	did TEXT PRIMARY KEY,
+	displayName TEXT NOT NULL,
+	avatarCid TEXT NOT NULL,
+	avatarMime TEXT NOT NULL,
+	updatedAt TEXT NOT NULL
+);
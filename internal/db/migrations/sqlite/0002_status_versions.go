@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/referendumApp/statusphere-example-app-go/internal/migrate"
+)
+
+// Adds the CID and repo rev of each status. Databases from before migrations
+// were versioned may already have either column, so this checks first.
+func init() {
+	register(migrate.Migration{
+		Version: 2,
+		Name:    "status_versions",
+		UpFunc: func(tx *sqlx.Tx) error {
+			for _, column := range []string{"cid", "rev"} {
+				var count int
+				err := tx.Get(&count, `SELECT COUNT(*) FROM pragma_table_info('status') WHERE name = ?`, column)
+				if err != nil {
+					return fmt.Errorf("failed to inspect status table: %w", err)
+				}
+				if count > 0 {
+					continue
+				}
+				if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE status ADD COLUMN %s TEXT NOT NULL DEFAULT ''`, column)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		DownFunc: func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`
+			ALTER TABLE status DROP COLUMN rev;
+			ALTER TABLE status DROP COLUMN cid;
+			`)
+			return err
+		},
+	})
+}
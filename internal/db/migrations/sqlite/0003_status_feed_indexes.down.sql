@@ -0,0 +1,2 @@
+DROP INDEX status_author;
+DROP INDEX status_feed;
@@ -0,0 +1,16 @@
+-- Status times become fixed-width UTC with millisecond precision, so they sort
+-- correctly as strings whatever zone or precision they were written in. A
+-- createdAt that cannot be parsed falls back to indexedAt.
+UPDATE status SET indexedAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', indexedAt), indexedAt);
+UPDATE status SET createdAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', createdAt), indexedAt);
+
+-- effectiveAt is createdAt unless it is before 2022 or more than five minutes
+-- after indexedAt, as db.EffectiveTime decides for new rows
+ALTER TABLE status ADD COLUMN effectiveAt TEXT NOT NULL DEFAULT '';
+UPDATE status SET effectiveAt = CASE
+	WHEN createdAt < '2022-01-01T00:00:00.000Z'
+		OR createdAt > strftime('%Y-%m-%dT%H:%M:%fZ', indexedAt, '+5 minutes') THEN indexedAt
+	ELSE createdAt
+END;
+
+CREATE INDEX status_created ON status (effectiveAt DESC, uri DESC);
@@ -0,0 +1,33 @@
+-- Statuses posted per emoji in hourly, daily and weekly buckets, keyed by the
+-- bucket's start as a stored timestamp; weeks start on Monday. Each status is
+-- counted once, by its effectiveAt, when it is first stored, so the counts
+-- outlive edits, deletions and retention.
+CREATE TABLE emoji_hourly (
+	bucket TEXT NOT NULL,
+	status TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (bucket, status)
+);
+CREATE TABLE emoji_daily (
+	bucket TEXT NOT NULL,
+	status TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (bucket, status)
+);
+CREATE TABLE emoji_weekly (
+	bucket TEXT NOT NULL,
+	status TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (bucket, status)
+);
+
+-- Statuses already stored are counted once here
+INSERT INTO emoji_hourly (bucket, status, count)
+SELECT substr(effectiveAt, 1, 13) || ':00:00.000Z', status, COUNT(*)
+FROM status GROUP BY 1, 2;
+INSERT INTO emoji_daily (bucket, status, count)
+SELECT substr(effectiveAt, 1, 10) || 'T00:00:00.000Z', status, COUNT(*)
+FROM status GROUP BY 1, 2;
+INSERT INTO emoji_weekly (bucket, status, count)
+SELECT date(substr(effectiveAt, 1, 10), 'weekday 0', '-6 days') || 'T00:00:00.000Z', status, COUNT(*)
+FROM status GROUP BY 1, 2;
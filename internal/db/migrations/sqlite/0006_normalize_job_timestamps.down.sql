@@ -0,0 +1,8 @@
+-- Back to whole seconds, as these times were written before
+UPDATE outbox SET nextAttemptAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', nextAttemptAt), nextAttemptAt);
+UPDATE scheduled_status SET
+	scheduledAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', scheduledAt), scheduledAt),
+	createdAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', createdAt), createdAt);
+UPDATE purge_job SET
+	startedAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', startedAt), startedAt),
+	updatedAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', updatedAt), updatedAt);
@@ -0,0 +1,10 @@
+-- Outbox, scheduled status and purge job times become fixed-width UTC with
+-- millisecond precision, as status times already are, so they compare
+-- correctly as strings with the times db.Timestamp writes
+UPDATE outbox SET nextAttemptAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', nextAttemptAt), nextAttemptAt);
+UPDATE scheduled_status SET
+	scheduledAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', scheduledAt), scheduledAt),
+	createdAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', createdAt), createdAt);
+UPDATE purge_job SET
+	startedAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', startedAt), startedAt),
+	updatedAt = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', updatedAt), updatedAt);
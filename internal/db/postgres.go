@@ -0,0 +1,25 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// OpenPostgres connects to a PostgreSQL database by URL
+func OpenPostgres(dsn string) (*DB, error) {
+	db, err := sqlx.Connect("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// PostgreSQL folds the unquoted camelCase column names used throughout
+	// to lower case, so match struct tags the same way
+	db.Mapper = reflectx.NewMapperTagFunc("db", strings.ToLower, strings.ToLower)
+
+	// PostgreSQL handles concurrent readers and writers itself
+	return newDB(db, db, Postgres), nil
+}
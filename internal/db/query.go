@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultQueryTimeout is how long a query or transaction may run before it is cancelled
+	DefaultQueryTimeout = 5 * time.Second
+
+	// DefaultSlowQuery is how long a query or transaction may run before it is logged as slow
+	DefaultSlowQuery = 250 * time.Millisecond
+)
+
+// GetContext runs a query returning one row on the reader pool, rebinding its placeholders for the backend
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, done := db.begin(ctx)
+	defer done()
+	return db.reader.GetContext(ctx, dest, db.Rebind(query), args...)
+}
+
+// SelectContext runs a query returning rows on the reader pool, rebinding its placeholders for the backend
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, done := db.begin(ctx)
+	defer done()
+	return db.reader.SelectContext(ctx, dest, db.Rebind(query), args...)
+}
+
+// ExecContext runs a statement, rebinding its placeholders for the backend
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := db.begin(ctx)
+	defer done()
+	return db.DB.ExecContext(ctx, db.Rebind(query), args...)
+}
+
+// Tx is a transaction on the writer, timed as one query from BeginContext
+// until it is committed or rolled back
+type Tx struct {
+	*sqlx.Tx
+	ctx  context.Context
+	done func()
+}
+
+// BeginContext starts a transaction
+func (db *DB) BeginContext(ctx context.Context) (*Tx, error) {
+	ctx, done := db.begin(ctx)
+	tx, err := db.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	return &Tx{Tx: tx, ctx: ctx, done: done}, nil
+}
+
+// Exec runs a statement in the transaction, under the context it was begun
+// with, rebinding its placeholders for the backend
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(tx.ctx, tx.Rebind(query), args...)
+}
+
+// Commit commits the transaction
+func (tx *Tx) Commit() error {
+	defer tx.finish()
+	return tx.Tx.Commit()
+}
+
+// Rollback aborts the transaction; after Commit it does nothing
+func (tx *Tx) Rollback() error {
+	defer tx.finish()
+	return tx.Tx.Rollback()
+}
+
+// finish stops timing the transaction the first time it ends
+func (tx *Tx) finish() {
+	if tx.done != nil {
+		tx.done()
+		tx.done = nil
+	}
+}
+
+// begin applies the query timeout to a context. The returned function
+// releases it and logs the query if it was slow, naming it after the DB
+// method that ran it.
+func (db *DB) begin(ctx context.Context) (context.Context, func()) {
+	start := time.Now()
+	cancel := context.CancelFunc(func() {})
+	if db.QueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, db.QueryTimeout)
+	}
+	return ctx, func() {
+		cancel()
+		if elapsed := time.Since(start); db.SlowQuery > 0 && elapsed >= db.SlowQuery {
+			log.Warn().Str("query", queryName()).Dur("duration", elapsed).Msg("Slow query")
+		}
+	}
+}
+
+// queryName names the query being timed after the exported DB method
+// running it, looking past the query helpers and the unexported methods they
+// share. Queries run from outside the package are named after their caller.
+func queryName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		method, inPackage := dbMethod(frame.Function)
+		switch {
+		case method != "":
+			return method
+		case !inPackage:
+			return frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+		case !more:
+			return "unknown"
+		}
+	}
+}
+
+// dbMethod reports whether a function is in this package, and its name if
+// it is an exported method of DB, other than the query helpers, or an
+// exported function
+func dbMethod(function string) (string, bool) {
+	const pkg = "/internal/db."
+	i := strings.LastIndex(function, pkg)
+	if i < 0 {
+		return "", false
+	}
+	name := function[i+len(pkg):]
+	if method, ok := strings.CutPrefix(name, "(*DB)."); ok {
+		name = method
+	} else if strings.HasPrefix(name, "(") {
+		// Methods of other types, such as Tx
+		return "", true
+	}
+	// Closures are named after the function they are in
+	name, _, _ = strings.Cut(name, ".")
+	switch name {
+	case "GetContext", "SelectContext", "ExecContext", "BeginContext":
+		return "", true
+	}
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		return "", true
+	}
+	return name, true
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Counts forever, until it is interrupted
+const endlessQuery = `
+WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n)
+SELECT COUNT(*) FROM n
+`
+
+func TestQueryTimeout(t *testing.T) {
+	db := openSQLite(t)
+	db.QueryTimeout = 50 * time.Millisecond
+
+	var count int
+	start := time.Now()
+	err := db.GetContext(context.Background(), &count, endlessQuery)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("endless query error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("endless query took %v to stop", elapsed)
+	}
+
+	// The timeout applies to each query, not to the connection
+	if _, err := db.GetUserStatus(context.Background(), "did:plc:alice"); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetUserStatus() after a timeout error = %v, want no rows", err)
+	}
+}
+
+func TestQueryCancelled(t *testing.T) {
+	db := openSQLite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.GetUserStatus(ctx, "did:plc:alice"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetUserStatus(cancelled) error = %v, want context.Canceled", err)
+	}
+	if err := db.SaveStatus(ctx, benchStatus(1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("SaveStatus(cancelled) error = %v, want context.Canceled", err)
+	}
+	if n, err := db.CountUserStatuses(context.Background(), "did:plc:bench"); err != nil || n != 0 {
+		t.Errorf("CountUserStatuses() = %d, %v, want nothing saved", n, err)
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	db := openSQLite(t)
+	db.SlowQuery = time.Nanosecond
+
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = logger })
+
+	ctx := context.Background()
+	if err := db.SaveStatus(ctx, benchStatus(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRecentStatuses(ctx, ByIndexedAt, "", 10); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.GetContext(ctx, &count, `SELECT COUNT(*) FROM status`); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry struct {
+			Message  string  `json:"message"`
+			Query    string  `json:"query"`
+			Duration float64 `json:"duration"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Message != "Slow query" || entry.Duration <= 0 {
+			t.Errorf("log entry = %s, want a slow query with its duration", line)
+		}
+		names = append(names, entry.Query)
+	}
+	// A transaction is logged once, under the method that ran it; a shared
+	// helper's query under the method that called it
+	want := []string{"SaveStatus", "GetRecentStatuses", "TestSlowQueryLog"}
+	if len(names) != len(want) {
+		t.Fatalf("slow queries = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("slow queries = %v, want %v", names, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+// PruneReport counts the statuses a retention policy would delete
+type PruneReport struct {
+	Statuses  int `db:"statuses"`  // Statuses to delete
+	OverLimit int `db:"overLimit"` // Of those, how many are beyond the per-author limit
+	TooOld    int `db:"tooOld"`    // Of those, how many were indexed before the cutoff
+	Authors   int `db:"authors"`   // Authors losing at least one status
+}
+
+// VacuumMode says how to reclaim the space freed by deleting rows
+type VacuumMode string
+
+// Vacuum modes
+const (
+	VacuumNone        VacuumMode = ""
+	VacuumIncremental VacuumMode = "incremental" // Return free pages without rewriting the database
+	VacuumFull        VacuumMode = "full"        // Rewrite the database; blocks writes while it runs
+)
+
+// prunableStatuses selects an author's statuses outside a retention policy:
+// those beyond their newest keepPerAuthor, or indexed before the cutoff. Their
+// newest status, their current one, is always kept. A zero keepPerAuthor or
+// cutoff disables that rule. Ranking one author's statuses reads only their
+// rows, through the status_author index.
+func prunableStatuses(author syntax.DID, keepPerAuthor int, indexedBefore Timestamp) (string, []interface{}) {
+	args := []interface{}{author}
+	var rules []string
+	if keepPerAuthor > 0 {
+		rules = append(rules, "authorRank > ?")
+		args = append(args, keepPerAuthor)
+	}
+	if !indexedBefore.IsZero() {
+		rules = append(rules, "indexedAt < ?")
+		args = append(args, indexedBefore)
+	}
+	if len(rules) == 0 {
+		rules = append(rules, "1 = 0")
+	}
+
+	query := fmt.Sprintf(`
+	SELECT uri, authorDid, indexedAt, authorRank FROM (
+		SELECT uri, authorDid, indexedAt,
+			ROW_NUMBER() OVER (ORDER BY indexedAt DESC, uri DESC) AS authorRank
+		FROM status
+		WHERE authorDid = ?
+	) ranked
+	WHERE authorRank > 1 AND (%s)
+	`, strings.Join(rules, " OR "))
+	return query, args
+}
+
+// GetStatusAuthors retrieves up to limit authors with statuses, in DID order
+// after the given one, so retention can walk them a page at a time
+func (db *DB) GetStatusAuthors(ctx context.Context, after syntax.DID, limit int) ([]syntax.DID, error) {
+	var authors []syntax.DID
+
+	query := `
+	SELECT DISTINCT authorDid FROM status
+	WHERE authorDid > ?
+	ORDER BY authorDid
+	LIMIT ?
+	`
+
+	err := db.SelectContext(ctx, &authors, query, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status authors: %w", err)
+	}
+
+	return authors, nil
+}
+
+// GetPrunableStatusURIs retrieves an author's statuses outside a retention policy
+func (db *DB) GetPrunableStatusURIs(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore Timestamp) ([]syntax.ATURI, error) {
+	var uris []syntax.ATURI
+
+	query, args := prunableStatuses(author, keepPerAuthor, indexedBefore)
+	query = `SELECT uri FROM (` + query + `) prunable`
+
+	err := db.SelectContext(ctx, &uris, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prunable statuses: %w", err)
+	}
+
+	return uris, nil
+}
+
+// CountPrunableStatuses reports what a retention policy would delete of an author's statuses
+func (db *DB) CountPrunableStatuses(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore Timestamp) (*PruneReport, error) {
+	var report PruneReport
+
+	query, args := prunableStatuses(author, keepPerAuthor, indexedBefore)
+	query = `
+	SELECT
+		COUNT(*) AS statuses,
+		COALESCE(SUM(CASE WHEN ? > 0 AND authorRank > ? THEN 1 ELSE 0 END), 0) AS overLimit,
+		COALESCE(SUM(CASE WHEN indexedAt < ? THEN 1 ELSE 0 END), 0) AS tooOld,
+		COUNT(DISTINCT authorDid) AS authors
+	FROM (` + query + `) prunable`
+
+	err := db.GetContext(ctx, &report, query, append([]interface{}{keepPerAuthor, keepPerAuthor, indexedBefore}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count prunable statuses: %w", err)
+	}
+
+	return &report, nil
+}
+
+// Add adds another author's counts to the report
+func (r *PruneReport) Add(other *PruneReport) {
+	r.Statuses += other.Statuses
+	r.OverLimit += other.OverLimit
+	r.TooOld += other.TooOld
+	r.Authors += other.Authors
+}
+
+// Vacuum returns space freed by deleted rows to the filesystem. Incremental
+// vacuuming needs SQLite's auto_vacuum to be incremental, which is switched
+// on with a one-off full vacuum the first time. Rewriting a large database
+// can take far longer than the query timeout, so only ctx limits it.
+func (db *DB) Vacuum(ctx context.Context, mode VacuumMode) error {
+	switch {
+	case mode == VacuumNone:
+		return nil
+	case db.backend == Postgres && mode == VacuumFull:
+		_, err := db.DB.ExecContext(ctx, `VACUUM FULL status`)
+		return wrapVacuumError(err)
+	case db.backend == Postgres:
+		// Plain VACUUM makes dead rows' space reusable without locking the table
+		_, err := db.DB.ExecContext(ctx, `VACUUM status`)
+		return wrapVacuumError(err)
+	case mode == VacuumFull:
+		_, err := db.DB.ExecContext(ctx, `VACUUM`)
+		return wrapVacuumError(err)
+	}
+
+	var autoVacuum int
+	if err := db.DB.GetContext(ctx, &autoVacuum, `PRAGMA auto_vacuum`); err != nil {
+		return wrapVacuumError(err)
+	}
+	if autoVacuum != 2 {
+		if _, err := db.DB.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+			return wrapVacuumError(err)
+		}
+		_, err := db.DB.ExecContext(ctx, `VACUUM`)
+		return wrapVacuumError(err)
+	}
+
+	// Each row the pragma returns is a page freed, so read them all
+	rows, err := db.DB.QueryContext(ctx, `PRAGMA incremental_vacuum`)
+	if err != nil {
+		return wrapVacuumError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return wrapVacuumError(rows.Err())
+}
+
+func wrapVacuumError(err error) error {
+	if err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
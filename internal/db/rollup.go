@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Granularity is the size of the buckets an emoji rollup counts statuses in
+type Granularity string
+
+// Rollup granularities
+const (
+	Hourly Granularity = "hour"
+	Daily  Granularity = "day"
+	Weekly Granularity = "week"
+)
+
+// granularities are the rollups every new status is counted in
+var granularities = []Granularity{Hourly, Daily, Weekly}
+
+// table returns the rollup table for a granularity
+func (g Granularity) table() (string, error) {
+	switch g {
+	case Hourly:
+		return "emoji_hourly", nil
+	case Daily:
+		return "emoji_daily", nil
+	case Weekly:
+		return "emoji_weekly", nil
+	default:
+		return "", fmt.Errorf("unknown rollup granularity %q", g)
+	}
+}
+
+// Truncate returns the start of the bucket a time falls in, in UTC. Weeks
+// start on Monday.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch g {
+	case Hourly:
+		return day.Add(time.Duration(t.Hour()) * time.Hour)
+	case Weekly:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return day
+	}
+}
+
+// Length returns how long a bucket is
+func (g Granularity) Length() time.Duration {
+	switch g {
+	case Hourly:
+		return time.Hour
+	case Weekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// EmojiCount is how many statuses used an emoji in one rollup bucket
+type EmojiCount struct {
+	Bucket Timestamp `db:"bucket"` // Start of the bucket
+	Status string    `db:"status"`
+	Count  int       `db:"count"`
+}
+
+// countStatus adds a newly stored status to every rollup, in its transaction
+func countStatus(tx *Tx, status *Status) error {
+	for _, g := range granularities {
+		table, err := g.table()
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf(`
+		INSERT INTO %[1]s (bucket, status, count) VALUES (?, ?, 1)
+		ON CONFLICT (bucket, status) DO UPDATE SET count = %[1]s.count + 1
+		`, table)
+		bucket := NewTimestamp(g.Truncate(status.EffectiveAt.Time))
+		if _, err := tx.Exec(query, bucket, status.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEmojiCounts retrieves a rollup's counts for the buckets starting at or
+// after since, oldest bucket first
+func (db *DB) GetEmojiCounts(ctx context.Context, g Granularity, since Timestamp) ([]EmojiCount, error) {
+	var counts []EmojiCount
+
+	table, err := g.table()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+	SELECT bucket, status, count FROM %s
+	WHERE bucket >= ?
+	ORDER BY bucket, status
+	`, table)
+
+	if err := db.SelectContext(ctx, &counts, query, since); err != nil {
+		return nil, fmt.Errorf("failed to get emoji counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// PruneEmojiCounts deletes a rollup's buckets starting before a time and
+// returns how many rows were deleted
+func (db *DB) PruneEmojiCounts(ctx context.Context, g Granularity, before Timestamp) (int64, error) {
+	table, err := g.table()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE bucket < ?`, table), before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune emoji counts: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Connection settings shared by the writer and the readers. In WAL mode
+// readers never block the writer or each other, and synchronous=NORMAL is
+// durable across application crashes; busy_timeout makes a connection wait
+// for a lock held by another process, such as the migrate command, rather
+// than fail at once.
+var sqlitePragmas = []string{
+	"_journal_mode=WAL",
+	"_synchronous=NORMAL",
+	"_busy_timeout=5000",
+	"_cache_size=-16000", // 16 MB per connection
+}
+
+// OpenSQLite opens a SQLite database file, creating it if needed. Writes go
+// through a single connection, since SQLite allows one writer at a time,
+// while reads are served by a separate pool of query-only connections.
+func OpenSQLite(path string) (*DB, error) {
+	// Transactions take the write lock up front, so they wait on busy_timeout
+	// instead of failing when they try to upgrade from reading to writing
+	writer, err := sqlx.Connect("sqlite3", sqliteDSN(path, append(sqlitePragmas, "_txlock=immediate")...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	writer.SetMaxOpenConns(1)
+
+	// Each connection to an in-memory database gets a database of its own
+	if path == ":memory:" || strings.Contains(path, "mode=memory") {
+		return newDB(writer, writer, SQLite), nil
+	}
+
+	reader, err := sqlx.Connect("sqlite3", sqliteDSN(path, append(sqlitePragmas, "_query_only=true")...))
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	reader.SetMaxOpenConns(max(4, runtime.NumCPU()))
+	reader.SetMaxIdleConns(max(4, runtime.NumCPU()))
+
+	return newDB(writer, reader, SQLite), nil
+}
+
+// sqliteDSN adds connection parameters to a database path, which may already have some
+func sqliteDSN(path string, params ...string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+	return path + sep + strings.Join(params, "&")
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+func openSQLite(tb testing.TB) *DB {
+	tb.Helper()
+	db, err := OpenSQLite(filepath.Join(tb.TempDir(), "test.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+func TestSQLitePools(t *testing.T) {
+	db := openSQLite(t)
+
+	var mode string
+	if err := db.DB.Get(&mode, `PRAGMA journal_mode`); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q, %v, want wal", mode, err)
+	}
+	var timeout int
+	if err := db.reader.Get(&timeout, `PRAGMA busy_timeout`); err != nil || timeout != 5000 {
+		t.Errorf("reader busy_timeout = %d, %v, want 5000", timeout, err)
+	}
+
+	if _, err := db.reader.Exec(`DELETE FROM status`); err == nil {
+		t.Error("reader pool accepted a write")
+	}
+
+	// Readers see writes as soon as they commit
+	status := &Status{URI: "at://did:plc:alice/xyz.statusphere.status/3lbqsq6rwgc2a", AuthorDID: "did:plc:alice", Status: "👍", CreatedAt: NewTimestamp(time.Now()), IndexedAt: NewTimestamp(time.Now())}
+	if err := db.SaveStatus(context.Background(), status); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetStatus(context.Background(), status.URI); err != nil {
+		t.Errorf("reader does not see a committed write: %v", err)
+	}
+}
+
+func TestSQLiteInMemory(t *testing.T) {
+	db, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRecentStatuses(context.Background(), ByIndexedAt, "", 10); err != nil {
+		t.Errorf("reads do not see the in-memory schema: %v", err)
+	}
+}
+
+// openSharedConnection opens the database the way it was opened before the
+// reader pool: one connection in the default journal mode for everything
+func openSharedConnection(b *testing.B) *DB {
+	b.Helper()
+	conn, err := sqlx.Connect("sqlite3", filepath.Join(b.TempDir(), "test.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn.SetMaxOpenConns(1)
+	b.Cleanup(func() { conn.Close() })
+
+	db := newDB(conn, conn, SQLite)
+	if err := db.Migrate(); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// BenchmarkReadsDuringWrites measures feed reads while statuses are being
+// ingested in the background, e.g.
+//
+//	go test -run x -bench ReadsDuringWrites ./internal/db
+//
+// With a shared connection every read queues
+// behind writes; with the reader pool reads run alongside them.
+func BenchmarkReadsDuringWrites(b *testing.B) {
+	setups := []struct {
+		name string
+		open func(b *testing.B) *DB
+	}{
+		{"shared connection", openSharedConnection},
+		{"reader pool", func(b *testing.B) *DB { return openSQLite(b) }},
+	}
+
+	for _, setup := range setups {
+		b.Run(setup.name, func(b *testing.B) {
+			db := setup.open(b)
+			for i := 0; i < 1000; i++ {
+				if err := db.SaveStatus(context.Background(), benchStatus(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			var writes atomic.Int64
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// A steady stream of writes, so both setups read a table of about the same size
+				ticker := time.NewTicker(time.Millisecond)
+				defer ticker.Stop()
+				for i := 1000; ; i++ {
+					select {
+					case <-stop:
+						return
+					case <-ticker.C:
+					}
+					if err := db.SaveStatus(context.Background(), benchStatus(i)); err != nil {
+						b.Error(err)
+						return
+					}
+					writes.Add(1)
+				}
+			}()
+
+			start := time.Now()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := db.GetRecentStatuses(context.Background(), ByIndexedAt, "", 50); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+
+			b.ReportMetric(float64(writes.Load())/time.Since(start).Seconds(), "writes/s")
+		})
+	}
+}
+
+func benchStatus(i int) *Status {
+	indexedAt := NewTimestamp(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i) * time.Second))
+	return &Status{
+		URI:       syntax.ATURI(fmt.Sprintf("at://did:plc:bench/xyz.statusphere.status/%d", i)),
+		AuthorDID: "did:plc:bench",
+		Status:    "👍",
+		CreatedAt: indexedAt,
+		IndexedAt: indexedAt,
+	}
+}
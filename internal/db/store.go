@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+// StatusStore holds the statuses indexed from users' repos
+type StatusStore interface {
+	GetRecentStatuses(ctx context.Context, order FeedOrder, cursor string, limit int) (*StatusPage, error)
+	GetUserStatus(ctx context.Context, authorDID syntax.DID) (*Status, error)
+	GetUserStatuses(ctx context.Context, authorDID syntax.DID, cursor string, limit int) (*StatusPage, error)
+	GetUserStatusDays(ctx context.Context, authorDID syntax.DID, since Timestamp) ([]StatusDay, error)
+	GetStatus(ctx context.Context, uri syntax.ATURI) (*Status, error)
+	SaveStatus(ctx context.Context, status *Status) error
+	ImportStatus(ctx context.Context, status *Status) error
+	DeleteStatus(ctx context.Context, uri syntax.ATURI, rev string) error
+	DeleteStatuses(ctx context.Context, uris []syntax.ATURI) error
+	GetUserStatusURIs(ctx context.Context, authorDID syntax.DID, indexedBefore Timestamp) ([]syntax.ATURI, error)
+	CountUserStatuses(ctx context.Context, authorDID syntax.DID) (int, error)
+}
+
+// AuthSessionStore holds users' PDS sessions
+type AuthSessionStore interface {
+	GetAuthSession(ctx context.Context, key string) (string, error)
+	SaveAuthSession(ctx context.Context, key, sessionData string) error
+	DeleteAuthSession(ctx context.Context, key string) error
+}
+
+// AuthStateStore holds the state of OAuth flows in progress
+type AuthStateStore interface {
+	GetAuthState(ctx context.Context, key string) (string, error)
+	SaveAuthState(ctx context.Context, key, stateData string) error
+	DeleteAuthState(ctx context.Context, key string) error
+}
+
+// Store is everything the app keeps in its database. *DB implements it for
+// both SQLite and PostgreSQL.
+type Store interface {
+	StatusStore
+	AuthSessionStore
+	AuthStateStore
+
+	// Identity and profile caches
+	GetDidCache(ctx context.Context, did string) (*DidCache, error)
+	SaveDidCache(ctx context.Context, entry *DidCache) error
+	DeleteDidCache(ctx context.Context, did string) error
+	GetHandleCache(ctx context.Context, handle string) (*HandleCache, error)
+	SaveHandleCache(ctx context.Context, entry *HandleCache) error
+	GetProfiles(ctx context.Context, dids []string) ([]Profile, error)
+	SaveProfile(ctx context.Context, profile *Profile) error
+
+	// Outbox
+	SaveOutboxEntry(ctx context.Context, entry *OutboxEntry) error
+	GetDueOutboxEntries(ctx context.Context, now Timestamp, limit int) ([]OutboxEntry, error)
+	GetUserOutboxEntries(ctx context.Context, authorDID syntax.DID) ([]OutboxEntry, error)
+	DeleteOutboxEntry(ctx context.Context, uri syntax.ATURI) error
+	DeleteFailedOutboxEntry(ctx context.Context, uri syntax.ATURI) error
+	ConfirmOutboxEntry(ctx context.Context, status *Status) error
+
+	// Scheduled statuses
+	SaveScheduledStatus(ctx context.Context, scheduled *ScheduledStatus) error
+	GetDueScheduledStatuses(ctx context.Context, now Timestamp, limit int) ([]ScheduledStatus, error)
+	GetUserScheduledStatuses(ctx context.Context, authorDID syntax.DID) ([]ScheduledStatus, error)
+	UpdateScheduledStatusState(ctx context.Context, uri syntax.ATURI, state string) error
+	DeleteScheduledStatus(ctx context.Context, uri syntax.ATURI) error
+
+	// Purge jobs
+	SavePurgeJob(ctx context.Context, job *PurgeJob) error
+	GetPurgeJob(ctx context.Context, did syntax.DID) (*PurgeJob, error)
+	GetRunningPurgeJobs(ctx context.Context) ([]PurgeJob, error)
+	SavePurgeBatch(ctx context.Context, job *PurgeJob, uris []syntax.ATURI) error
+
+	// Retention
+	GetStatusAuthors(ctx context.Context, after syntax.DID, limit int) ([]syntax.DID, error)
+	GetPrunableStatusURIs(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore Timestamp) ([]syntax.ATURI, error)
+	CountPrunableStatuses(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore Timestamp) (*PruneReport, error)
+	Vacuum(ctx context.Context, mode VacuumMode) error
+
+	// Emoji statistics
+	GetEmojiCounts(ctx context.Context, g Granularity, since Timestamp) ([]EmojiCount, error)
+	PruneEmojiCounts(ctx context.Context, g Granularity, before Timestamp) (int64, error)
+
+	// Backups
+	Backup(ctx context.Context, dest string) error
+
+	Migrate() error
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
@@ -0,0 +1,764 @@
+// Package storetest is a conformance suite for db.Store implementations, so
+// every backend behaves the same way
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+// ctx is passed to every store call; none of them are cancelled
+var ctx = context.Background()
+
+// OpenFunc returns an empty, migrated store that is closed when the test ends
+type OpenFunc func(t *testing.T) db.Store
+
+// Run runs the whole suite against the stores returned by open
+func Run(t *testing.T, open OpenFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store db.Store)
+	}{
+		{"Statuses", testStatuses},
+		{"StatusPages", testStatusPages},
+		{"CreatedOrder", testCreatedOrder},
+		{"UserHistory", testUserHistory},
+		{"StaleStatuses", testStaleStatuses},
+		{"ImportStatus", testImportStatus},
+		{"DeleteStatuses", testDeleteStatuses},
+		{"AuthSessions", testAuthSessions},
+		{"AuthState", testAuthState},
+		{"Caches", testCaches},
+		{"Outbox", testOutbox},
+		{"ScheduledStatuses", testScheduledStatuses},
+		{"PurgeJobs", testPurgeJobs},
+		{"Retention", testRetention},
+		{"EmojiRollups", testEmojiRollups},
+		{"MigrateTwice", testMigrateTwice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+const (
+	alice = syntax.DID("did:plc:alice")
+	bob   = syntax.DID("did:plc:bob")
+)
+
+func statusURI(did syntax.DID, rkey string) syntax.ATURI {
+	return syntax.NewRecordURI(did, "xyz.statusphere.status", syntax.RecordKey(rkey))
+}
+
+func status(did syntax.DID, rkey, emoji, indexedAt string) *db.Status {
+	return &db.Status{
+		URI:       statusURI(did, rkey),
+		AuthorDID: did,
+		Status:    emoji,
+		CreatedAt: mustTimestamp(indexedAt),
+		IndexedAt: mustTimestamp(indexedAt),
+		CID:       "bafy" + rkey,
+	}
+}
+
+func mustTimestamp(s string) db.Timestamp {
+	t, err := db.ParseTimestamp(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func mustSave(t *testing.T, store db.Store, statuses ...*db.Status) {
+	t.Helper()
+	for _, s := range statuses {
+		if err := store.SaveStatus(ctx, s); err != nil {
+			t.Fatalf("SaveStatus(%s): %v", s.URI, err)
+		}
+	}
+}
+
+func testStatuses(t *testing.T, store db.Store) {
+	mustSave(t, store,
+		status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:00Z"),
+		status(bob, "3lbqsq6rwgc2b", "💙", "2025-01-02T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2c", "🥹", "2025-01-03T10:00:00Z"),
+	)
+
+	recent, err := store.GetRecentStatuses(ctx, db.ByIndexedAt, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent.Statuses) != 2 || recent.Statuses[0].Status != "🥹" || recent.Statuses[1].Status != "💙" {
+		t.Errorf("GetRecentStatuses(2) = %+v, want the two newest", recent.Statuses)
+	}
+
+	latest, err := store.GetUserStatus(ctx, alice)
+	if err != nil || latest.Status != "🥹" || latest.AuthorDID != alice {
+		t.Errorf("GetUserStatus() = %+v, %v, want alice's newest", latest, err)
+	}
+
+	got, err := store.GetStatus(ctx, statusURI(bob, "3lbqsq6rwgc2b"))
+	if err != nil || got.CID != "bafy3lbqsq6rwgc2b" || got.CreatedAt.String() != "2025-01-02T10:00:00.000Z" {
+		t.Errorf("GetStatus() = %+v, %v", got, err)
+	}
+	if _, err := store.GetStatus(ctx, statusURI(bob, "3lbqsq6rwgc2z")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetStatus(missing) error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Saving again replaces the row, including its author and creation time
+	edited := status(alice, "3lbqsq6rwgc2a", "👎", "2025-01-04T10:00:00Z")
+	edited.CreatedAt = mustTimestamp("2025-01-01T09:00:00Z")
+	mustSave(t, store, edited)
+	if got, _ := store.GetStatus(ctx, edited.URI); got.Status != "👎" || got.CreatedAt.String() != "2025-01-01T09:00:00.000Z" {
+		t.Errorf("edited status = %+v", got)
+	}
+
+	if n, err := store.CountUserStatuses(ctx, alice); err != nil || n != 2 {
+		t.Errorf("CountUserStatuses() = %d, %v, want 2", n, err)
+	}
+	uris, err := store.GetUserStatusURIs(ctx, alice, mustTimestamp("2025-01-04T00:00:00Z"))
+	if err != nil || len(uris) != 1 || uris[0] != statusURI(alice, "3lbqsq6rwgc2c") {
+		t.Errorf("GetUserStatusURIs() = %v, %v, want the status indexed before the cutoff", uris, err)
+	}
+
+	if err := store.DeleteStatus(ctx, edited.URI, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetStatus(ctx, edited.URI); err == nil {
+		t.Error("status still exists after DeleteStatus")
+	}
+}
+
+func testStatusPages(t *testing.T, store db.Store) {
+	// Statuses indexed at the same time are ordered by URI, so none is
+	// skipped or repeated across a page boundary
+	mustSave(t, store,
+		status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:00Z"),
+		status(bob, "3lbqsq6rwgc2a", "💙", "2025-01-02T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2b", "🥹", "2025-01-02T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2c", "😤", "2025-01-02T10:00:00Z"),
+		status(bob, "3lbqsq6rwgc2b", "🙃", "2025-01-03T10:00:00Z"),
+	)
+	want := []syntax.ATURI{
+		statusURI(bob, "3lbqsq6rwgc2b"),
+		statusURI(bob, "3lbqsq6rwgc2a"),
+		statusURI(alice, "3lbqsq6rwgc2c"),
+		statusURI(alice, "3lbqsq6rwgc2b"),
+		statusURI(alice, "3lbqsq6rwgc2a"),
+	}
+
+	var got []syntax.ATURI
+	var pages int
+	cursor := ""
+	for {
+		page, err := store.GetRecentStatuses(ctx, db.ByIndexedAt, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, s := range page.Statuses {
+			got = append(got, s.URI)
+		}
+		if page.Cursor == "" {
+			break
+		}
+		cursor = page.Cursor
+
+		// A status arriving while paging lands on the first page, not this one
+		mustSave(t, store, status(bob, fmt.Sprintf("3lbqsq6rwgc3%d", pages), "🎉", "2025-02-01T10:00:00Z"))
+	}
+
+	if pages != 3 || !slices.Equal(got, want) {
+		t.Errorf("paged through %d pages, got %v, want 3 pages of %v", pages, got, want)
+	}
+
+	exact, err := store.GetRecentStatuses(ctx, db.ByIndexedAt, "", 7)
+	if err != nil || len(exact.Statuses) != 7 || exact.Cursor != "" {
+		t.Errorf("GetRecentStatuses(7) of 7 = %+v, %v, want every status and no cursor", exact, err)
+	}
+
+	for _, cursor := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("indexed 2025-01-01T10:00:00.000Z")),
+		base64.RawURLEncoding.EncodeToString([]byte("indexed 2025-01-01 " + statusURI(alice, "3lbqsq6rwgc2a").String())),
+		base64.RawURLEncoding.EncodeToString([]byte("indexed 2025-01-01T10:00:00.000Z not-a-uri")),
+		// A cursor for the other order
+		base64.RawURLEncoding.EncodeToString([]byte("created 2025-01-01T10:00:00.000Z " + statusURI(alice, "3lbqsq6rwgc2a").String())),
+	} {
+		if _, err := store.GetRecentStatuses(ctx, db.ByIndexedAt, cursor, 2); !errors.Is(err, db.ErrInvalidCursor) {
+			t.Errorf("GetRecentStatuses(%q) error = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func testUserHistory(t *testing.T, store db.Store) {
+	mustSave(t, store,
+		status(alice, "3lbqsq6rwgc2a", "👍", "2024-12-31T23:59:59Z"),
+		status(alice, "3lbqsq6rwgc2b", "👍", "2025-01-01T08:00:00Z"),
+		status(bob, "3lbqsq6rwgc2a", "💙", "2025-01-01T09:00:00Z"),
+		status(alice, "3lbqsq6rwgc2c", "🥹", "2025-01-01T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2d", "👍", "2025-01-01T11:00:00Z"),
+		status(alice, "3lbqsq6rwgc2e", "😤", "2025-01-03T10:00:00Z"),
+	)
+
+	want := []syntax.ATURI{
+		statusURI(alice, "3lbqsq6rwgc2e"),
+		statusURI(alice, "3lbqsq6rwgc2d"),
+		statusURI(alice, "3lbqsq6rwgc2c"),
+		statusURI(alice, "3lbqsq6rwgc2b"),
+		statusURI(alice, "3lbqsq6rwgc2a"),
+	}
+	var got []syntax.ATURI
+	cursor := ""
+	for {
+		page, err := store.GetUserStatuses(ctx, alice, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range page.Statuses {
+			got = append(got, s.URI)
+		}
+		if page.Cursor == "" {
+			break
+		}
+		cursor = page.Cursor
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged through %v, want only alice's statuses %v", got, want)
+	}
+	if _, err := store.GetUserStatuses(ctx, alice, "not base64!", 2); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("GetUserStatuses(bad cursor) error = %v, want ErrInvalidCursor", err)
+	}
+
+	days, err := store.GetUserStatusDays(ctx, alice, mustTimestamp("2025-01-01T00:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDays := []db.StatusDay{
+		{Day: "2025-01-01", Status: "👍", Count: 2},
+		{Day: "2025-01-01", Status: "🥹", Count: 1},
+		{Day: "2025-01-03", Status: "😤", Count: 1},
+	}
+	if !slices.Equal(days, wantDays) {
+		t.Errorf("GetUserStatusDays() = %+v, want %+v", days, wantDays)
+	}
+}
+
+func testCreatedOrder(t *testing.T, store db.Store) {
+	onTime := status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-02T10:00:00Z")
+	// Written at noon in UTC+2, just before onTime was indexed
+	otherZone := status(bob, "3lbqsq6rwgc2a", "💙", "2025-01-02T10:00:01Z")
+	otherZone.CreatedAt = mustTimestamp("2025-01-02T11:59:59.999999+02:00")
+	// A client clock a year ahead must not pin the status to the top
+	future := status(alice, "3lbqsq6rwgc2b", "🔮", "2025-01-01T10:00:00Z")
+	future.CreatedAt = mustTimestamp("2026-01-01T10:00:00Z")
+	// Nor can a nonsensical past date bury it
+	past := status(bob, "3lbqsq6rwgc2b", "🦕", "2025-01-03T10:00:00Z")
+	past.CreatedAt = mustTimestamp("0001-01-01T00:00:00Z")
+	// A little skew is tolerated
+	skewed := status(alice, "3lbqsq6rwgc2c", "🥹", "2025-01-01T12:00:00Z")
+	skewed.CreatedAt = mustTimestamp("2025-01-01T12:04:00Z")
+	mustSave(t, store, onTime, otherZone, future, past, skewed)
+
+	got, err := store.GetStatus(ctx, otherZone.URI)
+	if err != nil || got.CreatedAt.String() != "2025-01-02T09:59:59.999Z" || got.ClockSkewed() {
+		t.Errorf("GetStatus() = %+v, %v, want createdAt normalized to UTC milliseconds", got, err)
+	}
+	if got, _ := store.GetStatus(ctx, future.URI); !got.ClockSkewed() || !got.EffectiveAt.Equal(future.IndexedAt.Time) || got.CreatedAt.String() != "2026-01-01T10:00:00.000Z" {
+		t.Errorf("future status = %+v, want flagged, effective when indexed and createdAt kept", got)
+	}
+
+	want := []syntax.ATURI{past.URI, onTime.URI, otherZone.URI, skewed.URI, future.URI}
+	var uris []syntax.ATURI
+	cursor := ""
+	for {
+		page, err := store.GetRecentStatuses(ctx, db.ByCreatedAt, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range page.Statuses {
+			uris = append(uris, s.URI)
+		}
+		if page.Cursor == "" {
+			break
+		}
+		cursor = page.Cursor
+	}
+	if !slices.Equal(uris, want) {
+		t.Errorf("by created = %v, want %v", uris, want)
+	}
+
+	if _, err := store.GetRecentStatuses(ctx, db.ByIndexedAt, cursor, 2); cursor != "" && !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("cursor used with the other order: error = %v, want ErrInvalidCursor", err)
+	}
+
+	// Re-importing keeps the indexedAt, and an implausible createdAt falls back to it
+	imported := status(alice, "3lbqsq6rwgc2a", "👍", "2025-03-01T00:00:00Z")
+	imported.CreatedAt = mustTimestamp("2030-01-01T00:00:00Z")
+	if err := store.ImportStatus(ctx, imported); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetStatus(ctx, imported.URI); !got.EffectiveAt.Equal(onTime.IndexedAt.Time) {
+		t.Errorf("re-imported status effectiveAt = %s, want its kept indexedAt %s", got.EffectiveAt, onTime.IndexedAt)
+	}
+}
+
+func testStaleStatuses(t *testing.T, store db.Store) {
+	current := status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:00Z")
+	current.Rev = "3lbqsq6rwgc2m"
+	mustSave(t, store, current)
+
+	older := *current
+	older.Status, older.Rev = "👎", "3lbqsq6rwgc2k"
+	if err := store.SaveStatus(ctx, &older); !errors.Is(err, db.ErrStaleStatus) {
+		t.Errorf("SaveStatus(older rev) error = %v, want ErrStaleStatus", err)
+	}
+	unversioned := *current
+	unversioned.Status, unversioned.Rev = "👎", ""
+	if err := store.SaveStatus(ctx, &unversioned); !errors.Is(err, db.ErrStaleStatus) {
+		t.Errorf("SaveStatus(no rev) error = %v, want ErrStaleStatus", err)
+	}
+	if got, _ := store.GetStatus(ctx, current.URI); got.Status != "👍" {
+		t.Errorf("stale write replaced the status: %+v", got)
+	}
+
+	same := *current
+	same.Status = "💙"
+	mustSave(t, store, &same)
+
+	if err := store.DeleteStatus(ctx, current.URI, "3lbqsq6rwgc2k"); !errors.Is(err, db.ErrStaleStatus) {
+		t.Errorf("DeleteStatus(older rev) error = %v, want ErrStaleStatus", err)
+	}
+	if err := store.DeleteStatus(ctx, current.URI, "3lbqsq6rwgc2n"); err != nil {
+		t.Errorf("DeleteStatus(newer rev) error = %v", err)
+	}
+	if err := store.DeleteStatus(ctx, current.URI, "3lbqsq6rwgc2n"); err != nil {
+		t.Errorf("DeleteStatus(already deleted) error = %v", err)
+	}
+}
+
+func testImportStatus(t *testing.T, store db.Store) {
+	mustSave(t, store, status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:00Z"))
+
+	imported := status(alice, "3lbqsq6rwgc2a", "👎", "2025-03-01T00:00:00Z")
+	imported.Rev = "3lbqsq6rwgc2m"
+	if err := store.ImportStatus(ctx, imported); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.GetStatus(ctx, imported.URI)
+	if got.Status != "👎" || got.IndexedAt.String() != "2025-01-01T10:00:00.000Z" || got.Rev != "3lbqsq6rwgc2m" {
+		t.Errorf("imported status = %+v, want updated with its indexedAt kept", got)
+	}
+
+	imported.Rev = "3lbqsq6rwgc2k"
+	if err := store.ImportStatus(ctx, imported); !errors.Is(err, db.ErrStaleStatus) {
+		t.Errorf("ImportStatus(older rev) error = %v, want ErrStaleStatus", err)
+	}
+}
+
+func testDeleteStatuses(t *testing.T, store db.Store) {
+	mustSave(t, store,
+		status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2b", "👍", "2025-01-02T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2c", "👍", "2025-01-03T10:00:00Z"),
+	)
+
+	if err := store.DeleteStatuses(ctx, []syntax.ATURI{statusURI(alice, "3lbqsq6rwgc2a"), statusURI(alice, "3lbqsq6rwgc2c")}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := store.CountUserStatuses(ctx, alice); n != 1 {
+		t.Errorf("%d statuses left, want 1", n)
+	}
+}
+
+func testAuthSessions(t *testing.T, store db.Store) {
+	if err := store.SaveAuthSession(ctx, "did:plc:alice", `{"v":1}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveAuthSession(ctx, "did:plc:alice", `{"v":2}`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.GetAuthSession(ctx, "did:plc:alice"); err != nil || got != `{"v":2}` {
+		t.Errorf("GetAuthSession() = %q, %v, want the latest session", got, err)
+	}
+
+	if err := store.DeleteAuthSession(ctx, "did:plc:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetAuthSession(ctx, "did:plc:alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetAuthSession(deleted) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testAuthState(t *testing.T, store db.Store) {
+	if err := store.SaveAuthState(ctx, "state-1", "pkce"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveAuthState(ctx, "state-1", "pkce-2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.GetAuthState(ctx, "state-1"); err != nil || got != "pkce-2" {
+		t.Errorf("GetAuthState() = %q, %v", got, err)
+	}
+
+	if err := store.DeleteAuthState(ctx, "state-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetAuthState(ctx, "state-1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetAuthState(deleted) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testCaches(t *testing.T, store db.Store) {
+	if err := store.SaveDidCache(ctx, &db.DidCache{DID: "did:plc:alice", Doc: "{}", Handle: "alice.test", UpdatedAt: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveHandleCache(ctx, &db.HandleCache{Handle: "alice.test", DID: "did:plc:alice", UpdatedAt: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.GetDidCache(ctx, "did:plc:alice"); err != nil || got.Handle != "alice.test" || got.UpdatedAt != "2025-01-01T00:00:00Z" {
+		t.Errorf("GetDidCache() = %+v, %v", got, err)
+	}
+	if got, err := store.GetHandleCache(ctx, "alice.test"); err != nil || got.DID != "did:plc:alice" {
+		t.Errorf("GetHandleCache() = %+v, %v", got, err)
+	}
+
+	if err := store.DeleteDidCache(ctx, "did:plc:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetHandleCache(ctx, "alice.test"); err == nil {
+		t.Error("handle still cached after its DID was deleted")
+	}
+
+	for _, did := range []string{"did:plc:alice", "did:plc:bob", "did:plc:carol"} {
+		profile := &db.Profile{DID: did, DisplayName: did[8:], AvatarCID: "bafyavatar", AvatarMime: "image/jpeg", UpdatedAt: "2025-01-01T00:00:00Z"}
+		if err := store.SaveProfile(ctx, profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	profiles, err := store.GetProfiles(ctx, []string{"did:plc:alice", "did:plc:carol", "did:plc:nobody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.DisplayName)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "alice" || names[1] != "carol" {
+		t.Errorf("GetProfiles() names = %v, want alice and carol", names)
+	}
+}
+
+func testOutbox(t *testing.T, store db.Store) {
+	entries := []*db.OutboxEntry{
+		{URI: statusURI(alice, "3lbqsq6rwgc2a"), AuthorDID: alice, Status: "👍", CreatedAt: "2025-01-01T10:00:00.000Z", State: db.OutboxPending, NextAttemptAt: mustTimestamp("2025-01-01T10:00:10Z")},
+		{URI: statusURI(alice, "3lbqsq6rwgc2b"), AuthorDID: alice, Status: "👎", CreatedAt: "2025-01-01T10:01:00.000Z", State: db.OutboxPending, NextAttemptAt: mustTimestamp("2025-01-01T10:00:05Z")},
+		{URI: statusURI(bob, "3lbqsq6rwgc2c"), AuthorDID: bob, Status: "💙", CreatedAt: "2025-01-01T10:02:00.000Z", State: db.OutboxFailed, NextAttemptAt: mustTimestamp("2025-01-01T10:00:00Z")},
+	}
+	for _, e := range entries {
+		if err := store.SaveOutboxEntry(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := store.GetDueOutboxEntries(ctx, mustTimestamp("2025-01-01T10:00:30Z"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].URI != entries[1].URI || due[1].URI != entries[0].URI {
+		t.Errorf("GetDueOutboxEntries() = %+v, want alice's pending entries, soonest first", due)
+	}
+
+	entries[0].Attempts, entries[0].LastError = 1, "timeout"
+	if err := store.SaveOutboxEntry(ctx, entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	mine, err := store.GetUserOutboxEntries(ctx, alice)
+	if err != nil || len(mine) != 2 || mine[0].URI != entries[1].URI || mine[1].Attempts != 1 {
+		t.Errorf("GetUserOutboxEntries() = %+v, %v, want newest first with the retry recorded", mine, err)
+	}
+
+	// Only failed entries can be dismissed
+	if err := store.DeleteFailedOutboxEntry(ctx, entries[0].URI); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteFailedOutboxEntry(ctx, entries[2].URI); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := store.GetUserOutboxEntries(ctx, alice); len(left) != 2 {
+		t.Error("a pending entry was dismissed")
+	}
+	if left, _ := store.GetUserOutboxEntries(ctx, bob); len(left) != 0 {
+		t.Error("a failed entry was not dismissed")
+	}
+
+	confirmed := status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:20Z")
+	if err := store.ConfirmOutboxEntry(ctx, confirmed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetStatus(ctx, confirmed.URI); err != nil {
+		t.Error("confirmed status was not saved")
+	}
+
+	if err := store.DeleteOutboxEntry(ctx, entries[1].URI); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := store.GetUserOutboxEntries(ctx, alice); len(left) != 0 {
+		t.Errorf("%d entries left, want none", len(left))
+	}
+}
+
+func testScheduledStatuses(t *testing.T, store db.Store) {
+	scheduled := []*db.ScheduledStatus{
+		{URI: statusURI(alice, "3lbqsq6rwgc2b"), AuthorDID: alice, Status: "👍", ScheduledAt: mustTimestamp("2025-02-01T09:00:00Z"), Timezone: "Europe/Paris", State: db.ScheduledPending, CreatedAt: mustTimestamp("2025-01-01T00:00:00Z")},
+		{URI: statusURI(alice, "3lbqsq6rwgc2a"), AuthorDID: alice, Status: "👎", ScheduledAt: mustTimestamp("2025-01-15T09:00:00Z"), Timezone: "UTC", State: db.ScheduledPending, CreatedAt: mustTimestamp("2025-01-01T00:00:00Z")},
+		{URI: statusURI(bob, "3lbqsq6rwgc2c"), AuthorDID: bob, Status: "💙", ScheduledAt: mustTimestamp("2025-01-10T09:00:00Z"), Timezone: "UTC", State: db.ScheduledPending, CreatedAt: mustTimestamp("2025-01-01T00:00:00Z")},
+	}
+	for _, s := range scheduled {
+		if err := store.SaveScheduledStatus(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveScheduledStatus(ctx, scheduled[0]); err == nil {
+		t.Error("SaveScheduledStatus() replaced an existing schedule")
+	}
+
+	due, err := store.GetDueScheduledStatuses(ctx, mustTimestamp("2025-01-20T00:00:00Z"), 10)
+	if err != nil || len(due) != 2 || due[0].AuthorDID != bob {
+		t.Errorf("GetDueScheduledStatuses() = %+v, %v, want two, oldest first", due, err)
+	}
+
+	if err := store.UpdateScheduledStatusState(ctx, scheduled[2].URI, db.ScheduledMissed); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := store.GetDueScheduledStatuses(ctx, mustTimestamp("2025-01-20T00:00:00Z"), 10); len(due) != 1 {
+		t.Errorf("%d due after marking one missed, want 1", len(due))
+	}
+
+	mine, err := store.GetUserScheduledStatuses(ctx, alice)
+	if err != nil || len(mine) != 2 || mine[0].Status != "👎" || mine[1].Timezone != "Europe/Paris" {
+		t.Errorf("GetUserScheduledStatuses() = %+v, %v, want soonest first", mine, err)
+	}
+
+	if err := store.DeleteScheduledStatus(ctx, scheduled[1].URI); err != nil {
+		t.Fatal(err)
+	}
+	if mine, _ := store.GetUserScheduledStatuses(ctx, alice); len(mine) != 1 {
+		t.Errorf("%d scheduled left, want 1", len(mine))
+	}
+}
+
+func testPurgeJobs(t *testing.T, store db.Store) {
+	mustSave(t, store,
+		status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2b", "👍", "2025-01-02T10:00:00Z"),
+	)
+
+	job := &db.PurgeJob{DID: alice, State: db.PurgeRunning, Total: 2, StartedAt: mustTimestamp("2025-03-01T00:00:00Z"), UpdatedAt: mustTimestamp("2025-03-01T00:00:00Z")}
+	if err := store.SavePurgeJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if running, err := store.GetRunningPurgeJobs(ctx); err != nil || len(running) != 1 || running[0].DID != alice {
+		t.Errorf("GetRunningPurgeJobs() = %+v, %v", running, err)
+	}
+
+	job.Deleted, job.Cursor = 1, "3lbqsq6rwgc2b"
+	if err := store.SavePurgeBatch(ctx, job, []syntax.ATURI{statusURI(alice, "3lbqsq6rwgc2a")}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetPurgeJob(ctx, alice)
+	if err != nil || got.Deleted != 1 || got.Cursor != "3lbqsq6rwgc2b" || got.Total != 2 {
+		t.Errorf("GetPurgeJob() = %+v, %v", got, err)
+	}
+	if n, _ := store.CountUserStatuses(ctx, alice); n != 1 {
+		t.Errorf("%d statuses left after the batch, want 1", n)
+	}
+
+	job.State = db.PurgeDone
+	if err := store.SavePurgeJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if running, _ := store.GetRunningPurgeJobs(ctx); len(running) != 0 {
+		t.Errorf("finished job still running: %+v", running)
+	}
+}
+
+func testRetention(t *testing.T, store db.Store) {
+	mustSave(t, store,
+		status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-01T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2b", "👎", "2025-01-02T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2c", "🥹", "2025-02-01T10:00:00Z"),
+		status(alice, "3lbqsq6rwgc2d", "💙", "2025-02-02T10:00:00Z"),
+		// Bob's only status is old, but it is his current one
+		status(bob, "3lbqsq6rwgc2a", "🙃", "2025-01-01T10:00:00Z"),
+	)
+	cutoff := mustTimestamp("2025-01-15T00:00:00Z")
+
+	tests := []struct {
+		name   string
+		keep   int
+		cutoff db.Timestamp
+		want   []syntax.ATURI
+		report db.PruneReport
+	}{
+		{name: "no policy"},
+		{
+			name:   "keep per author",
+			keep:   3,
+			want:   []syntax.ATURI{statusURI(alice, "3lbqsq6rwgc2a")},
+			report: db.PruneReport{Statuses: 1, OverLimit: 1, Authors: 1},
+		},
+		{
+			name:   "max age",
+			cutoff: cutoff,
+			want:   []syntax.ATURI{statusURI(alice, "3lbqsq6rwgc2a"), statusURI(alice, "3lbqsq6rwgc2b")},
+			report: db.PruneReport{Statuses: 2, TooOld: 2, Authors: 1},
+		},
+		{
+			name:   "both",
+			keep:   1,
+			cutoff: cutoff,
+			want:   []syntax.ATURI{statusURI(alice, "3lbqsq6rwgc2a"), statusURI(alice, "3lbqsq6rwgc2b"), statusURI(alice, "3lbqsq6rwgc2c")},
+			report: db.PruneReport{Statuses: 3, OverLimit: 3, TooOld: 2, Authors: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uris, err := store.GetPrunableStatusURIs(ctx, alice, tt.keep, tt.cutoff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(uris)
+			if !slices.Equal(uris, tt.want) {
+				t.Errorf("GetPrunableStatusURIs(alice) = %v, want %v", uris, tt.want)
+			}
+
+			report, err := store.CountPrunableStatuses(ctx, alice, tt.keep, tt.cutoff)
+			if err != nil || *report != tt.report {
+				t.Errorf("CountPrunableStatuses(alice) = %+v, %v, want %+v", report, err, tt.report)
+			}
+
+			if uris, err := store.GetPrunableStatusURIs(ctx, bob, tt.keep, tt.cutoff); err != nil || len(uris) != 0 {
+				t.Errorf("GetPrunableStatusURIs(bob) = %v, %v, want none", uris, err)
+			}
+			if report, err := store.CountPrunableStatuses(ctx, bob, tt.keep, tt.cutoff); err != nil || *report != (db.PruneReport{}) {
+				t.Errorf("CountPrunableStatuses(bob) = %+v, %v, want nothing", report, err)
+			}
+		})
+	}
+
+	// Authors are listed in pages, in DID order
+	if authors, err := store.GetStatusAuthors(ctx, "", 1); err != nil || !slices.Equal(authors, []syntax.DID{alice}) {
+		t.Errorf("GetStatusAuthors(first page) = %v, %v, want alice", authors, err)
+	}
+	if authors, err := store.GetStatusAuthors(ctx, alice, 10); err != nil || !slices.Equal(authors, []syntax.DID{bob}) {
+		t.Errorf("GetStatusAuthors(after alice) = %v, %v, want bob", authors, err)
+	}
+
+	// Vacuuming twice exercises both the one-off switch to incremental and an incremental pass
+	for _, mode := range []db.VacuumMode{db.VacuumNone, db.VacuumIncremental, db.VacuumIncremental, db.VacuumFull} {
+		if err := store.Vacuum(ctx, mode); err != nil {
+			t.Errorf("Vacuum(%q) error = %v", mode, err)
+		}
+	}
+}
+
+func testEmojiRollups(t *testing.T, store db.Store) {
+	// Sunday night and Monday morning, either side of a week boundary
+	mustSave(t, store,
+		status(alice, "3lbqsq6rwgc2a", "👍", "2025-01-05T23:10:00Z"),
+		status(bob, "3lbqsq6rwgc2a", "👍", "2025-01-05T23:50:00Z"),
+		status(alice, "3lbqsq6rwgc2b", "🥹", "2025-01-06T00:30:00Z"),
+	)
+	// Saving a status again, even edited, does not count it twice
+	edited := status(alice, "3lbqsq6rwgc2a", "😤", "2025-01-06T01:00:00Z")
+	edited.CreatedAt = mustTimestamp("2025-01-05T23:10:00Z")
+	mustSave(t, store, edited)
+	imported := status(bob, "3lbqsq6rwgc2b", "👍", "2025-01-06T02:00:00Z")
+	imported.CreatedAt = mustTimestamp("2025-01-06T00:45:00Z")
+	if err := store.ImportStatus(ctx, imported); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ImportStatus(ctx, imported); err != nil {
+		t.Fatal(err)
+	}
+	confirmed := status(bob, "3lbqsq6rwgc2c", "🥹", "2025-01-06T00:59:00Z")
+	if err := store.ConfirmOutboxEntry(ctx, confirmed); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting a status does not uncount it
+	if err := store.DeleteStatus(ctx, statusURI(bob, "3lbqsq6rwgc2a"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := func(g db.Granularity) []string {
+		t.Helper()
+		rows, err := store.GetEmojiCounts(ctx, g, mustTimestamp("2024-12-01T00:00:00Z"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range rows {
+			got = append(got, fmt.Sprintf("%s %s %d", c.Bucket, c.Status, c.Count))
+		}
+		return got
+	}
+
+	tests := []struct {
+		granularity db.Granularity
+		want        []string
+	}{
+		{db.Hourly, []string{
+			"2025-01-05T23:00:00.000Z 👍 2",
+			"2025-01-06T00:00:00.000Z 👍 1",
+			"2025-01-06T00:00:00.000Z 🥹 2",
+		}},
+		{db.Daily, []string{
+			"2025-01-05T00:00:00.000Z 👍 2",
+			"2025-01-06T00:00:00.000Z 👍 1",
+			"2025-01-06T00:00:00.000Z 🥹 2",
+		}},
+		{db.Weekly, []string{
+			"2024-12-30T00:00:00.000Z 👍 2",
+			"2025-01-06T00:00:00.000Z 👍 1",
+			"2025-01-06T00:00:00.000Z 🥹 2",
+		}},
+	}
+	for _, tt := range tests {
+		if got := counts(tt.granularity); !slices.Equal(got, tt.want) {
+			t.Errorf("GetEmojiCounts(%s) = %q, want %q", tt.granularity, got, tt.want)
+		}
+	}
+
+	n, err := store.PruneEmojiCounts(ctx, db.Hourly, mustTimestamp("2025-01-06T00:00:00Z"))
+	if err != nil || n != 1 {
+		t.Errorf("PruneEmojiCounts() = %d, %v, want the one earlier bucket deleted", n, err)
+	}
+	if got := counts(db.Hourly); len(got) != 2 {
+		t.Errorf("hourly counts after pruning = %q", got)
+	}
+	if got := counts(db.Daily); len(got) != 3 {
+		t.Errorf("pruning hourly counts changed daily ones: %q", got)
+	}
+}
+
+func testMigrateTwice(t *testing.T, store db.Store) {
+	if err := store.Migrate(); err != nil {
+		t.Errorf("migrating an up-to-date store: %v", err)
+	}
+}
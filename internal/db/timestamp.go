@@ -0,0 +1,79 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// timestampLayout is how timestamps are stored: UTC, millisecond precision and
+// fixed width, so comparing them as strings compares them as times
+const timestampLayout = "2006-01-02T15:04:05.000Z"
+
+// MaxClockSkew is how far past the time a status was indexed its createdAt
+// may be and still be trusted
+const MaxClockSkew = 5 * time.Minute
+
+// earliestCreatedAt is the earliest createdAt trusted; no atproto record
+// predates it
+var earliestCreatedAt = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Timestamp is a point in time as stored in the database
+type Timestamp struct {
+	time.Time
+}
+
+// NewTimestamp normalizes a time to UTC and millisecond precision
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{t.UTC().Truncate(time.Millisecond)}
+}
+
+// ParseTimestamp parses an RFC 3339 datetime in any time zone and precision
+func ParseTimestamp(s string) (Timestamp, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q: %w", s, err)
+	}
+	return NewTimestamp(t), nil
+}
+
+// String returns the timestamp in its stored form
+func (t Timestamp) String() string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// Value implements driver.Valuer
+func (t Timestamp) Value() (driver.Value, error) {
+	return t.String(), nil
+}
+
+// Scan implements sql.Scanner
+func (t *Timestamp) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		parsed, err := ParseTimestamp(v)
+		*t = parsed
+		return err
+	case []byte:
+		parsed, err := ParseTimestamp(string(v))
+		*t = parsed
+		return err
+	case time.Time:
+		*t = NewTimestamp(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+}
+
+// EffectiveTime is when a status counts as created, for ordering by creation
+// time. The author's createdAt comes from their client's clock, so it is only
+// trusted between earliestCreatedAt and MaxClockSkew past when the status was
+// indexed; otherwise the indexing time stands in for it. A status with a
+// clock far ahead therefore cannot stay pinned to the top.
+func EffectiveTime(createdAt, indexedAt Timestamp) Timestamp {
+	if createdAt.Before(earliestCreatedAt) || createdAt.After(indexedAt.Add(MaxClockSkew)) {
+		return indexedAt
+	}
+	return createdAt
+}
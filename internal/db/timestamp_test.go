@@ -0,0 +1,82 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "2025-01-02T03:04:05Z", want: "2025-01-02T03:04:05.000Z"},
+		{in: "2025-01-02T03:04:05.1Z", want: "2025-01-02T03:04:05.100Z"},
+		{in: "2025-01-02T03:04:05.123456789Z", want: "2025-01-02T03:04:05.123Z"},
+		{in: "2025-01-02T05:04:05.999+02:00", want: "2025-01-02T03:04:05.999Z"},
+		{in: "2025-01-01T23:00:00-05:00", want: "2025-01-02T04:00:00.000Z"},
+		{in: "2025-01-02 03:04:05Z", wantErr: true},
+		{in: "2025-01-02T03:04:05", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseTimestamp(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseTimestamp() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil || got.String() != tt.want {
+				t.Errorf("ParseTimestamp() = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampScan(t *testing.T) {
+	want := "2025-01-02T03:04:05.678Z"
+	for _, src := range []interface{}{
+		"2025-01-02T03:04:05.678Z",
+		[]byte("2025-01-02T04:04:05.678+01:00"),
+		time.Date(2025, 1, 2, 3, 4, 5, 678900000, time.UTC),
+	} {
+		var ts Timestamp
+		if err := ts.Scan(src); err != nil || ts.String() != want {
+			t.Errorf("Scan(%v) = %s, %v, want %s", src, ts, err, want)
+		}
+	}
+
+	var ts Timestamp
+	if err := ts.Scan(int64(0)); err == nil {
+		t.Error("Scan(int64) succeeded")
+	}
+}
+
+func TestEffectiveTime(t *testing.T) {
+	indexedAt := NewTimestamp(time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		want      time.Time
+	}{
+		{"past", indexedAt.Add(-48 * time.Hour), indexedAt.Add(-48 * time.Hour)},
+		{"small skew", indexedAt.Add(MaxClockSkew), indexedAt.Add(MaxClockSkew)},
+		{"future", indexedAt.Add(MaxClockSkew + time.Millisecond), indexedAt.Time},
+		{"far future", indexedAt.AddDate(10, 0, 0), indexedAt.Time},
+		{"before atproto", time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), indexedAt.Time},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EffectiveTime(NewTimestamp(tt.createdAt), indexedAt)
+			if !got.Equal(tt.want) {
+				t.Errorf("EffectiveTime() = %s, want %s", got, NewTimestamp(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+// Package feedcache keeps the newest statuses in memory, so the homepage's
+// feed and current-status reads do not reach the database
+package feedcache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultSize is how many statuses the cache holds
+const DefaultSize = 1000
+
+// DefaultRevalidateInterval is how often the cache checks the database for
+// statuses written by other servers
+const DefaultRevalidateInterval = 10 * time.Second
+
+// Stats counts cache reads
+type Stats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`  // Reads the cache could not answer, served by the database
+	Reloads int64 `json:"reloads"` // Times the cache found the database ahead of it and reloaded
+	Size    int   `json:"size"`
+	Warm    bool  `json:"warm"`
+}
+
+// Cache is a db.Store that answers the first pages of the feed, in the
+// default order, and users' current statuses from a ring buffer of the
+// newest statuses. Every status write goes through it and updates the buffer
+// once the database has it, so reads never see the cache behind writes
+// made through it. Writes made to the database any other way, such as by
+// other servers sharing it, are picked up by Run, which reloads the buffer
+// when the newest status in the database is not the newest one cached. Until
+// the buffer has been loaded, and for reads past its end, the database
+// answers.
+type Cache struct {
+	db.Store
+
+	// writeMu orders writes, so the buffer applies them in the order the
+	// database did, and keeps them out while the buffer loads
+	writeMu sync.Mutex
+	warming atomic.Bool
+
+	mu   sync.RWMutex
+	ring ring
+	warm bool
+	// complete is set while the buffer holds every stored status; otherwise
+	// it holds every status newer than floor
+	complete bool
+	floor    db.Status
+
+	hits    atomic.Int64
+	misses  atomic.Int64
+	reloads atomic.Int64
+}
+
+// New wraps a store with a cache of the newest size statuses
+func New(store db.Store, size int) *Cache {
+	return &Cache{
+		Store: store,
+		ring:  ring{buf: make([]db.Status, size)},
+	}
+}
+
+// Stats returns the current hit and miss counters
+func (c *Cache) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Stats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Reloads: c.reloads.Load(),
+		Size:    c.ring.n,
+		Warm:    c.warm,
+	}
+}
+
+// Warm loads the newest statuses from the database
+func (c *Cache) Warm(ctx context.Context) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	page, err := c.Store.GetRecentStatuses(ctx, db.ByIndexedAt, "", len(c.ring.buf))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ring.reset()
+	for _, s := range page.Statuses {
+		c.ring.insert(c.ring.n, s)
+	}
+	c.complete = page.Cursor == ""
+	if !c.complete {
+		c.floor = page.Statuses[len(page.Statuses)-1]
+	}
+	c.warm = true
+	return nil
+}
+
+// Run loads the buffer, then reloads it whenever the newest status in the
+// database differs from the newest one cached, until ctx is cancelled
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	if err := c.Warm(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to load feed cache")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.revalidate(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to revalidate feed cache")
+		}
+	}
+}
+
+// revalidate reloads the buffer if the newest status in the database is not
+// the newest one cached. Every write that adds or edits a status gives it a
+// new indexedAt, so this notices them however they were made.
+func (c *Cache) revalidate(ctx context.Context) error {
+	page, err := c.Store.GetRecentStatuses(ctx, db.ByIndexedAt, "", 1)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	current := false
+	switch {
+	case !c.warm:
+	case len(page.Statuses) == 0:
+		current = c.ring.n == 0
+	case c.ring.n > 0:
+		head, newest := c.ring.at(0), &page.Statuses[0]
+		current = head.URI == newest.URI && head.IndexedAt.Equal(newest.IndexedAt.Time)
+	}
+	c.mu.RUnlock()
+	if current {
+		return nil
+	}
+
+	c.reloads.Add(1)
+	return c.Warm(ctx)
+}
+
+// warmInBackground starts loading the buffer unless it is already loading
+func (c *Cache) warmInBackground() {
+	if !c.warming.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer c.warming.Store(false)
+		// Not tied to the read that found the buffer empty, which may finish first
+		if err := c.Warm(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Failed to load feed cache")
+		}
+	}()
+}
+
+// GetRecentStatuses serves a page of the feed from the buffer if it holds
+// the whole page, and from the database otherwise
+func (c *Cache) GetRecentStatuses(ctx context.Context, order db.FeedOrder, cursor string, limit int) (*db.StatusPage, error) {
+	if order != db.ByIndexedAt {
+		return c.Store.GetRecentStatuses(ctx, order, cursor, limit)
+	}
+
+	page, ok, err := c.page(cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		c.hits.Add(1)
+		return page, nil
+	}
+
+	c.misses.Add(1)
+	return c.Store.GetRecentStatuses(ctx, order, cursor, limit)
+}
+
+// page reads a page of the feed from the buffer, reporting whether it could
+func (c *Cache) page(cursor string, limit int) (*db.StatusPage, bool, error) {
+	after := db.Status{}
+	if cursor != "" {
+		at, uri, err := db.DecodeCursor(db.ByIndexedAt, cursor)
+		if err != nil {
+			return nil, false, err
+		}
+		after = db.Status{IndexedAt: at, URI: uri}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.warm {
+		c.warmInBackground()
+		return nil, false, nil
+	}
+
+	start := 0
+	if cursor != "" {
+		start = sort.Search(c.ring.n, func(i int) bool { return newer(&after, c.ring.at(i)) })
+	}
+
+	page := &db.StatusPage{}
+	switch available := c.ring.n - start; {
+	case available > limit:
+		page.Statuses = c.ring.slice(start, start+limit)
+		page.Cursor = db.EncodeCursor(db.ByIndexedAt, &page.Statuses[limit-1])
+	case c.complete:
+		page.Statuses = c.ring.slice(start, c.ring.n)
+	default:
+		return nil, false, nil
+	}
+	return page, true, nil
+}
+
+// GetUserStatus serves a user's current status from the buffer if it is
+// there, and from the database otherwise
+func (c *Cache) GetUserStatus(ctx context.Context, authorDID syntax.DID) (*db.Status, error) {
+	if status, found, ok := c.userStatus(authorDID); ok {
+		c.hits.Add(1)
+		if !found {
+			return nil, fmt.Errorf("failed to get user status: %w", sql.ErrNoRows)
+		}
+		return status, nil
+	}
+
+	c.misses.Add(1)
+	return c.Store.GetUserStatus(ctx, authorDID)
+}
+
+// userStatus finds a user's newest status in the buffer. The buffer is
+// newest first and holds every status newer than its floor, so the first one
+// found is current; ok reports whether the buffer could answer.
+func (c *Cache) userStatus(authorDID syntax.DID) (status *db.Status, found, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.warm {
+		c.warmInBackground()
+		return nil, false, false
+	}
+
+	for i := 0; i < c.ring.n; i++ {
+		if s := c.ring.at(i); s.AuthorDID == authorDID {
+			copied := *s
+			return &copied, true, true
+		}
+	}
+	return nil, false, c.complete
+}
+
+// SaveStatus stores a status and caches it as stored
+func (c *Cache) SaveStatus(ctx context.Context, status *db.Status) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.Store.SaveStatus(ctx, status)
+	c.afterWrite(err, func() error { return c.refresh(ctx, status.URI) })
+	return err
+}
+
+// ImportStatus stores a backfilled status and caches it as stored
+func (c *Cache) ImportStatus(ctx context.Context, status *db.Status) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.Store.ImportStatus(ctx, status)
+	c.afterWrite(err, func() error { return c.refresh(ctx, status.URI) })
+	return err
+}
+
+// ConfirmOutboxEntry stores a status written to its author's repo and caches it as stored
+func (c *Cache) ConfirmOutboxEntry(ctx context.Context, status *db.Status) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.Store.ConfirmOutboxEntry(ctx, status)
+	c.afterWrite(err, func() error { return c.refresh(ctx, status.URI) })
+	return err
+}
+
+// DeleteStatus deletes a status and drops it from the buffer
+func (c *Cache) DeleteStatus(ctx context.Context, uri syntax.ATURI, rev string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.Store.DeleteStatus(ctx, uri, rev)
+	c.afterWrite(err, func() error { c.remove(uri); return nil })
+	return err
+}
+
+// DeleteStatuses deletes statuses and drops them from the buffer
+func (c *Cache) DeleteStatuses(ctx context.Context, uris []syntax.ATURI) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.Store.DeleteStatuses(ctx, uris)
+	c.afterWrite(err, func() error { c.remove(uris...); return nil })
+	return err
+}
+
+// SavePurgeBatch deletes a batch of purged statuses and drops them from the buffer
+func (c *Cache) SavePurgeBatch(ctx context.Context, job *db.PurgeJob, uris []syntax.ATURI) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.Store.SavePurgeBatch(ctx, job, uris)
+	c.afterWrite(err, func() error { c.remove(uris...); return nil })
+	return err
+}
+
+// afterWrite applies a successful write to the buffer. A stale write changed
+// nothing; after any other error, or if applying fails, the database may
+// differ from the buffer, so it is reloaded.
+func (c *Cache) afterWrite(err error, apply func() error) {
+	switch {
+	case err == nil:
+		if err := apply(); err != nil {
+			log.Warn().Err(err).Msg("Failed to update feed cache; reloading it")
+			c.invalidate()
+		}
+	case errors.Is(err, db.ErrStaleStatus):
+	default:
+		c.invalidate()
+	}
+}
+
+// invalidate empties the buffer, so reads go to the database until it reloads
+func (c *Cache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warm = false
+	c.ring.reset()
+}
+
+// refresh caches a status as it is stored now
+func (c *Cache) refresh(ctx context.Context, uri syntax.ATURI) error {
+	status, err := c.Store.GetStatus(ctx, uri)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.remove(uri)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.warm {
+		return nil
+	}
+	c.ring.removeURI(uri)
+	// Older than the buffer reaches, so a read that needs it goes to the database
+	if !c.complete && !newer(status, &c.floor) {
+		return nil
+	}
+	if evicted, ok := c.ring.insertSorted(*status); ok {
+		c.floor = evicted
+		c.complete = false
+	}
+	return nil
+}
+
+// remove drops statuses from the buffer
+func (c *Cache) remove(uris ...syntax.ATURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, uri := range uris {
+		c.ring.removeURI(uri)
+	}
+}
+
+// newer reports whether a comes before b in the feed: indexed later, or at
+// the same time with a greater URI
+func newer(a, b *db.Status) bool {
+	if !a.IndexedAt.Equal(b.IndexedAt.Time) {
+		return a.IndexedAt.After(b.IndexedAt.Time)
+	}
+	return a.URI > b.URI
+}
+
+// ring is a fixed-size circular buffer of statuses, newest first. New
+// statuses go in at the head, pushing the oldest out of a full buffer.
+type ring struct {
+	buf  []db.Status
+	head int // Index in buf of the newest status
+	n    int
+}
+
+// at returns the ith newest status
+func (r *ring) at(i int) *db.Status {
+	return &r.buf[(r.head+i)%len(r.buf)]
+}
+
+// slice copies out the statuses from the ith newest up to the jth
+func (r *ring) slice(i, j int) []db.Status {
+	statuses := make([]db.Status, 0, j-i)
+	for ; i < j; i++ {
+		statuses = append(statuses, *r.at(i))
+	}
+	return statuses
+}
+
+func (r *ring) reset() {
+	r.head, r.n = 0, 0
+}
+
+// insertSorted adds a status in feed order. If the buffer was full, the
+// oldest status is pushed out and returned, which may be the one added.
+func (r *ring) insertSorted(s db.Status) (evicted db.Status, ok bool) {
+	pos := sort.Search(r.n, func(i int) bool { return newer(&s, r.at(i)) })
+	if r.n == len(r.buf) {
+		if pos == r.n {
+			return s, true
+		}
+		evicted, ok = *r.at(r.n - 1), true
+		r.n--
+	}
+	r.insert(pos, s)
+	return evicted, ok
+}
+
+// insert puts a status at position pos, which must be at most n, in a
+// buffer that is not full
+func (r *ring) insert(pos int, s db.Status) {
+	if pos == 0 {
+		r.head = (r.head - 1 + len(r.buf)) % len(r.buf)
+	} else {
+		for i := r.n; i > pos; i-- {
+			*r.at(i) = *r.at(i - 1)
+		}
+	}
+	r.n++
+	*r.at(pos) = s
+}
+
+// removeURI drops a status from the buffer if it is there
+func (r *ring) removeURI(uri syntax.ATURI) {
+	for pos := 0; pos < r.n; pos++ {
+		if r.at(pos).URI == uri {
+			for i := pos; i < r.n-1; i++ {
+				*r.at(i) = *r.at(i + 1)
+			}
+			r.n--
+			return
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package feedcache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+func openDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "statusphere.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	// The driver reads each row on a goroutine of its own under a cancellable
+	// context, which is slow under the race detector across thousands of reads
+	database.QueryTimeout = 0
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+var authors = []syntax.DID{"did:plc:alice", "did:plc:bob", "did:plc:carol", "did:plc:dave"}
+
+func testStatus(author syntax.DID, rkey int, at time.Time) *db.Status {
+	return &db.Status{
+		URI:       syntax.ATURI(fmt.Sprintf("at://%s/xyz.statusphere.status/%06d", author, rkey)),
+		AuthorDID: author,
+		Status:    "👍",
+		CreatedAt: db.NewTimestamp(at),
+		IndexedAt: db.NewTimestamp(at),
+	}
+}
+
+// feed pages through the whole feed
+func feed(t *testing.T, store db.Store, limit int) []db.Status {
+	t.Helper()
+	var all []db.Status
+	cursor := ""
+	for {
+		page, err := store.GetRecentStatuses(context.Background(), db.ByIndexedAt, cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page.Statuses...)
+		if page.Cursor == "" {
+			return all
+		}
+		cursor = page.Cursor
+	}
+}
+
+// assertConsistent checks the cache answers every read as the database does
+func assertConsistent(t *testing.T, step string, cache *Cache, database *db.DB) {
+	t.Helper()
+	for _, limit := range []int{1, 3, 10} {
+		if got, want := feed(t, cache, limit), feed(t, database, limit); !reflect.DeepEqual(got, want) {
+			t.Fatalf("after %s, feed in pages of %d = %v, want %v", step, limit, got, want)
+		}
+	}
+	for _, author := range authors {
+		got, gotErr := cache.GetUserStatus(context.Background(), author)
+		want, wantErr := database.GetUserStatus(context.Background(), author)
+		if errors.Is(wantErr, sql.ErrNoRows) {
+			if !errors.Is(gotErr, sql.ErrNoRows) {
+				t.Fatalf("after %s, GetUserStatus(%s) = %v, %v, want no rows", step, author, got, gotErr)
+			}
+			continue
+		}
+		if gotErr != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("after %s, GetUserStatus(%s) = %v, %v, want %v", step, author, got, gotErr, want)
+		}
+	}
+}
+
+func TestMatchesDatabase(t *testing.T) {
+	database := openDB(t)
+	start := time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+	// A few statuses before the cache loads, more than it holds
+	for i := 0; i < 8; i++ {
+		if err := database.SaveStatus(context.Background(), testStatus(authors[i%len(authors)], i, start.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := New(database, 5)
+	if err := cache.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertConsistent(t, "warming", cache, database)
+
+	rng := rand.New(rand.NewPCG(3, 4))
+	saved := 8
+	for step := 0; step < 300; step++ {
+		author := authors[rng.IntN(len(authors))]
+		at := start.Add(time.Duration(saved) * time.Second)
+		var desc string
+		var err error
+		switch op := rng.IntN(6); op {
+		case 0, 1:
+			desc = "saving"
+			err = cache.SaveStatus(context.Background(), testStatus(author, saved, at))
+			saved++
+		case 2:
+			// Editing moves a status to the top of the feed
+			desc = "editing"
+			s := testStatus(author, rng.IntN(saved), at)
+			s.Status = "🥹"
+			err = cache.SaveStatus(context.Background(), s)
+			saved++
+		case 3:
+			// Importing an old status slots it in below the top, or below the buffer
+			desc = "importing"
+			err = cache.ImportStatus(context.Background(), testStatus(author, 10000+step, start.Add(time.Duration(rng.IntN(saved))*time.Second-time.Millisecond)))
+		case 4:
+			desc = "deleting"
+			err = cache.DeleteStatus(context.Background(), testStatus(author, rng.IntN(saved), at).URI, "")
+		case 5:
+			desc = "deleting several"
+			uris := []syntax.ATURI{testStatus(author, rng.IntN(saved), at).URI, testStatus(author, rng.IntN(saved), at).URI}
+			err = cache.DeleteStatuses(context.Background(), uris)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertConsistent(t, fmt.Sprintf("%s (step %d)", desc, step), cache, database)
+	}
+
+	if stats := cache.Stats(); stats.Hits == 0 || stats.Misses == 0 {
+		t.Errorf("stats = %+v, want reads served by both the cache and the database", stats)
+	}
+}
+
+func TestColdStart(t *testing.T) {
+	database := openDB(t)
+	at := time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+	if err := database.SaveStatus(context.Background(), testStatus(authors[0], 0, at)); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := New(database, 5)
+	// Served by the database while the buffer loads in the background
+	if page, err := cache.GetRecentStatuses(context.Background(), db.ByIndexedAt, "", 10); err != nil || len(page.Statuses) != 1 {
+		t.Fatalf("cold GetRecentStatuses() = %+v, %v, want the stored status", page, err)
+	}
+	if stats := cache.Stats(); stats.Misses != 1 {
+		t.Errorf("cold stats = %+v, want a miss", stats)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cache.Stats().Warm {
+		if time.Now().After(deadline) {
+			t.Fatal("cache never loaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if page, err := cache.GetRecentStatuses(context.Background(), db.ByIndexedAt, "", 10); err != nil || len(page.Statuses) != 1 {
+		t.Fatalf("warm GetRecentStatuses() = %+v, %v, want the stored status", page, err)
+	}
+	if _, err := cache.GetUserStatus(context.Background(), authors[1]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserStatus(no statuses) error = %v, want sql.ErrNoRows", err)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 {
+		t.Errorf("warm stats = %+v, want both reads served from memory", stats)
+	}
+
+	if _, err := cache.GetRecentStatuses(context.Background(), db.ByIndexedAt, "not base64!", 10); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("GetRecentStatuses(bad cursor) error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	database := openDB(t)
+	ctx := context.Background()
+	at := time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+	if err := database.SaveStatus(ctx, testStatus(authors[0], 0, at)); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := New(database, 5)
+	if err := cache.Warm(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing changed, so the buffer is kept
+	if err := cache.revalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := cache.Stats(); stats.Reloads != 0 {
+		t.Errorf("stats = %+v, want no reload", stats)
+	}
+
+	// Another server writes to the database directly, and edits the status
+	// the cache holds
+	if err := database.SaveStatus(ctx, testStatus(authors[1], 1, at.Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	edited := testStatus(authors[0], 0, at)
+	edited.Status = "🎉"
+	edited.IndexedAt = db.NewTimestamp(at.Add(2 * time.Minute))
+	if err := database.SaveStatus(ctx, edited); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.revalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := cache.Stats(); stats.Reloads != 1 || !stats.Warm {
+		t.Errorf("stats = %+v, want one reload", stats)
+	}
+	assertConsistent(t, "revalidate", cache, database)
+
+	// Everything is deleted elsewhere
+	if err := database.DeleteStatuses(ctx, []syntax.ATURI{edited.URI, testStatus(authors[1], 1, at).URI}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.revalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertConsistent(t, "revalidate after delete", cache, database)
+}
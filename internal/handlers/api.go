@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/rs/zerolog/log"
+)
+
+// maxAPIPageSize bounds the limit a client may ask for
+const maxAPIPageSize = 100
+
+// apiStatus is a status as served by the JSON API
+type apiStatus struct {
+	URI       string `json:"uri"`
+	AuthorDID string `json:"authorDid"`
+	Handle    string `json:"handle"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"createdAt"`
+	IndexedAt string `json:"indexedAt"`
+	// When the status counts as created; differs from createdAt if that
+	// was implausible, which clockSkewed flags
+	EffectiveAt string `json:"effectiveAt"`
+	ClockSkewed bool   `json:"clockSkewed"`
+}
+
+// ListStatuses serves a page of the feed as JSON, ordered as ?sort= asks. The
+// cursor in the response, if any, is passed back as ?cursor= with the same
+// sort to fetch the next, older page.
+func (h *Handlers) ListStatuses(w http.ResponseWriter, r *http.Request) {
+	order, ok := feedOrder(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "sort must be indexed or created")
+		return
+	}
+
+	limit := feedPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAPIPageSize {
+			writeJSONError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAPIPageSize))
+			return
+		}
+		limit = n
+	}
+
+	page, err := h.db.GetRecentStatuses(r.Context(), order, r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		writeJSONError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get statuses")
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	dids := make([]string, 0, len(page.Statuses))
+	for _, status := range page.Statuses {
+		dids = append(dids, status.AuthorDID.String())
+	}
+	didHandleMap := h.identity.ResolveDIDsToHandles(r.Context(), dids)
+
+	statuses := make([]apiStatus, 0, len(page.Statuses))
+	for _, status := range page.Statuses {
+		statuses = append(statuses, apiStatus{
+			URI:         status.URI.String(),
+			AuthorDID:   status.AuthorDID.String(),
+			Handle:      didHandleMap[status.AuthorDID.String()],
+			Status:      status.Status,
+			CreatedAt:   status.CreatedAt.String(),
+			IndexedAt:   status.IndexedAt.String(),
+			EffectiveAt: status.EffectiveAt.String(),
+			ClockSkewed: status.ClockSkewed(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"statuses": statuses,
+		"cursor":   page.Cursor,
+	})
+}
+
+// writeJSON sends a JSON response
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeJSONError sends an error as a JSON response
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+)
+
+// decodeJSON decodes a JSON response into v
+func decodeJSON(t *testing.T, body []byte, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("invalid JSON %s: %v", body, err)
+	}
+}
+
+func TestListStatuses(t *testing.T) {
+	app := newTestApp(t)
+	app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafy1", start)
+	app.store.save(bob, "3lbqsq6rwgc2b", "💙", "bafy2", start.Add(time.Minute))
+	app.store.save(alice, "3lbqsq6rwgc2c", "🥹", "bafy3", start.Add(2*time.Minute))
+
+	rec := app.get("/api/statuses?limit=2", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("response = %d %q, want 200 with JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// Every field clients rely on, with nothing extra
+	var shape map[string]json.RawMessage
+	decodeJSON(t, rec.Body.Bytes(), &shape)
+	if keys := sortedKeys(shape); !reflect.DeepEqual(keys, []string{"cursor", "statuses"}) {
+		t.Errorf("response keys = %v, want cursor and statuses", keys)
+	}
+	var statuses []map[string]json.RawMessage
+	decodeJSON(t, shape["statuses"], &statuses)
+	want := []string{"authorDid", "clockSkewed", "createdAt", "effectiveAt", "handle", "indexedAt", "status", "uri"}
+	if len(statuses) == 0 {
+		t.Fatal("no statuses in the response")
+	}
+	if keys := sortedKeys(statuses[0]); !reflect.DeepEqual(keys, want) {
+		t.Errorf("status keys = %v, want %v", keys, want)
+	}
+
+	var first struct {
+		Statuses []apiStatus `json:"statuses"`
+		Cursor   string      `json:"cursor"`
+	}
+	decodeJSON(t, rec.Body.Bytes(), &first)
+	wantFirst := apiStatus{
+		URI:         "at://did:plc:alice/xyz.statusphere.status/3lbqsq6rwgc2c",
+		AuthorDID:   "did:plc:alice",
+		Handle:      "alice.test",
+		Status:      "🥹",
+		CreatedAt:   "2025-03-07T12:02:00.000Z",
+		IndexedAt:   "2025-03-07T12:02:00.000Z",
+		EffectiveAt: "2025-03-07T12:02:00.000Z",
+	}
+	if len(first.Statuses) != 2 || first.Statuses[0] != wantFirst || first.Statuses[1].Handle != "bob.test" {
+		t.Errorf("first page = %+v, want the newest two, starting with %+v", first.Statuses, wantFirst)
+	}
+	if first.Cursor == "" {
+		t.Fatal("no cursor on a page with older statuses")
+	}
+
+	rec = app.get("/api/statuses?limit=2&cursor="+first.Cursor, nil)
+	var second struct {
+		Statuses []apiStatus `json:"statuses"`
+		Cursor   string      `json:"cursor"`
+	}
+	decodeJSON(t, rec.Body.Bytes(), &second)
+	if len(second.Statuses) != 1 || second.Statuses[0].Status != "👍" || second.Cursor != "" {
+		t.Errorf("second page = %+v, want the oldest status and no cursor", second)
+	}
+}
+
+func TestListStatusesErrors(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"?limit=0", "limit must be between 1 and 100"},
+		{"?limit=101", "limit must be between 1 and 100"},
+		{"?limit=ten", "limit must be between 1 and 100"},
+		{"?sort=popular", "sort must be indexed or created"},
+		{"?cursor=bogus", "invalid cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := app.get("/api/statuses"+tt.query, nil)
+			var body map[string]string
+			decodeJSON(t, rec.Body.Bytes(), &body)
+			if rec.Code != http.StatusBadRequest || body["error"] != tt.want {
+				t.Errorf("response = %d %v, want 400 with %q", rec.Code, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	app := newTestApp(t)
+	// A bucket of the current hour, day and week at once
+	app.store.emoji = []db.EmojiCount{{Bucket: db.NewTimestamp(time.Now()), Status: "👍", Count: 3}}
+
+	rec := app.get("/api/stats", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var report map[string]json.RawMessage
+	decodeJSON(t, rec.Body.Bytes(), &report)
+	if keys := sortedKeys(report); !reflect.DeepEqual(keys, []string{"at", "trending", "windows"}) {
+		t.Errorf("response keys = %v, want at, trending and windows", keys)
+	}
+
+	var windows []struct {
+		Window string `json:"window"`
+		Counts []struct {
+			Status string `json:"status"`
+			Count  int    `json:"count"`
+		} `json:"counts"`
+	}
+	decodeJSON(t, report["windows"], &windows)
+	if len(windows) != 3 || len(windows[0].Counts) == 0 || windows[0].Counts[0].Status != "👍" {
+		t.Errorf("windows = %+v, want the three windows counting 👍", windows)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+// completeLogin stores a freshly granted session, signs the user in and starts
+// importing their status history and profile. The OAuth callback calls this
+// once the token exchange has succeeded.
+func (h *Handlers) completeLogin(w http.ResponseWriter, r *http.Request, sess *atproto.Session) error {
+	if _, err := atproto.ParseScopes(sess.Scope); err != nil {
+		return fmt.Errorf("invalid granted scope: %w", err)
+	}
+
+	data, err := sess.Encode()
+	if err != nil {
+		return err
+	}
+	if err := h.db.SaveAuthSession(r.Context(), sess.DID, data); err != nil {
+		return err
+	}
+
+	session, _ := h.store.Get(r, "sid")
+	session.Values["did"] = sess.DID
+	if err := session.Save(r, w); err != nil {
+		return err
+	}
+
+	h.syncer.Request(syntax.DID(sess.DID))
+	h.profiles.Invalidate(sess.DID)
+	return nil
+}
+
+// requireRepoWrite loads the user's session and checks it may perform the given write.
+// If the scope was not granted, the user is sent through the login flow again to consent
+// to it, and nil is returned.
+func (h *Handlers) requireRepoWrite(w http.ResponseWriter, r *http.Request, did, collection string, action atproto.RepoAction) *atproto.Session {
+	sess, err := h.sessions.Load(r.Context(), did)
+	if err == nil {
+		err = sess.RequireRepoWrite(collection, action)
+	}
+	if err == nil {
+		return sess
+	}
+
+	if !errors.Is(err, atproto.ErrMissingScope) {
+		log.Warn().Err(err).Str("did", did).Msg("No usable auth session")
+	}
+
+	handle := did
+	if sess != nil && sess.Handle != "" {
+		handle = sess.Handle
+	}
+
+	query := url.Values{}
+	query.Set("reconsent", atproto.RepoScope(collection, action).String())
+	query.Set("handle", handle)
+	http.Redirect(w, r, "/login?"+query.Encode(), http.StatusFound)
+	return nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/referendumApp/statusphere-example-app-go/internal/avatars"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+// Avatar serves a user's avatar thumbnail through the proxy. Only authors with
+// a status here are proxied, so requests cannot make the server fetch from,
+// or cache profiles for, arbitrary DIDs.
+func (h *Handlers) Avatar(w http.ResponseWriter, r *http.Request) {
+	parsed, err := syntax.ParseDID(mux.Vars(r)["did"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	did := parsed.String()
+
+	known, err := h.isKnownAuthor(r.Context(), parsed)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user status")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !known {
+		http.NotFound(w, r)
+		return
+	}
+
+	cid, err := h.avatars.Current(r.Context(), did)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := avatars.ETag(cid)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := h.avatars.Thumbnail(r.Context(), did, cid)
+	if errors.Is(err, avatars.ErrNoAvatar) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("did", did).Msg("Failed to fetch avatar")
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(data)
+}
+
+// isKnownAuthor reports whether a DID has a status here
+func (h *Handlers) isKnownAuthor(ctx context.Context, did syntax.DID) (bool, error) {
+	_, err := h.db.GetUserStatus(ctx, did)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
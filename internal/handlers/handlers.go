@@ -2,42 +2,82 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"html/template"
+	"math/rand/v2"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/gorilla/sessions"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/avatars"
 	"github.com/referendumApp/statusphere-example-app-go/internal/config"
 	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/identity"
+	"github.com/referendumApp/statusphere-example-app-go/internal/outbox"
+	"github.com/referendumApp/statusphere-example-app-go/internal/profiles"
+	"github.com/referendumApp/statusphere-example-app-go/internal/purge"
+	"github.com/referendumApp/statusphere-example-app-go/internal/reposync"
+	"github.com/referendumApp/statusphere-example-app-go/internal/schedule"
+	"github.com/referendumApp/statusphere-example-app-go/internal/stats"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
 	"github.com/referendumApp/statusphere-example-app-go/internal/view"
-	"github.com/gorilla/sessions"
 	"github.com/rs/zerolog/log"
 )
 
 // Handlers holds all HTTP handlers
 type Handlers struct {
-	cfg      *config.Config
-	db       *db.DB
-	store    *sessions.CookieStore
+	cfg       *config.Config
+	db        db.Store
+	oauth     *atproto.OAuthClient
+	sessions  *atproto.Sessions
+	identity  identity.Directory
+	profiles  *profiles.Service
+	avatars   *avatars.Proxy
+	outbox    *outbox.Outbox
+	scheduler *schedule.Scheduler
+	syncer    *reposync.Syncer
+	purger    *purge.Purger
+	stats     *stats.Service
+	tids      *syntax.TIDGenerator
+	store     *sessions.CookieStore
 	templates *template.Template
 }
 
 // New creates a new Handlers instance
-func New(cfg *config.Config, database *db.DB) *Handlers {
+func New(cfg *config.Config, database db.Store, oauthClient *atproto.OAuthClient, authSessions *atproto.Sessions, directory identity.Directory, profileService *profiles.Service, avatarProxy *avatars.Proxy, writes *outbox.Outbox, scheduler *schedule.Scheduler, syncer *reposync.Syncer, purger *purge.Purger, statsService *stats.Service) *Handlers {
 	// Create cookie store for sessions
 	store := sessions.NewCookieStore([]byte(cfg.CookieSecret))
 	store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 30, // 30 days
 		HttpOnly: true,
+		Secure:   cfg.Environment != "development",
+		SameSite: http.SameSiteLaxMode,
 	}
 
+	// Record keys are TIDs; a random clock ID keeps instances from colliding
+	tids, _ := syntax.NewTIDGenerator(uint16(rand.IntN(syntax.MaxClockID + 1)))
+
 	// Load templates
 	tmpl := template.Must(template.ParseGlob(filepath.Join("templates", "*.html")))
 
 	return &Handlers{
 		cfg:       cfg,
 		db:        database,
+		oauth:     oauthClient,
+		sessions:  authSessions,
+		identity:  directory,
+		profiles:  profileService,
+		avatars:   avatarProxy,
+		outbox:    writes,
+		scheduler: scheduler,
+		syncer:    syncer,
+		purger:    purger,
+		stats:     statsService,
+		tids:      tids,
 		store:     store,
 		templates: tmpl,
 	}
@@ -53,33 +93,73 @@ func (h *Handlers) ClientMetadata(w http.ResponseWriter, r *http.Request) {
 	// Create client metadata similar to the original NodeOAuthClient
 	metadata := map[string]interface{}{
 		"client_name": "AT Protocol Express App (Go)",
-		"client_id":   publicURL + "/client-metadata.json",
+		"client_id":   h.oauth.ClientID,
 		"client_uri":  publicURL,
 		"redirect_uris": []string{
-			publicURL + "/oauth/callback",
+			h.oauth.RedirectURI,
 		},
-		"scope":                     "atproto transition:generic",
-		"grant_types":               []string{"authorization_code", "refresh_token"},
-		"response_types":            []string{"code"},
-		"application_type":          "web",
+		"scope":                      h.oauth.Scopes.String(),
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"application_type":           "web",
 		"token_endpoint_auth_method": "none",
-		"dpop_bound_access_tokens":  true,
+		"dpop_bound_access_tokens":   true,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(metadata)
 }
 
-// OAuthCallback handles the OAuth callback
+// OAuthCallback completes a login when the authorization server redirects back
 func (h *Handlers) OAuthCallback(w http.ResponseWriter, r *http.Request) {
-	// To be implemented when we integrate AT Protocol client
-	http.Redirect(w, r, "/?error=not_implemented", http.StatusFound)
+	params := r.URL.Query()
+
+	// Auth requests are single-use
+	state := params.Get("state")
+	data, err := h.db.GetAuthState(r.Context(), state)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unknown OAuth state")
+		h.renderLogin(w, r, "", "Your login has expired. Please try again.")
+		return
+	}
+	if err := h.db.DeleteAuthState(r.Context(), state); err != nil {
+		log.Error().Err(err).Msg("Failed to delete OAuth state")
+	}
+
+	authReq, err := atproto.ParseAuthRequest(data)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to decode OAuth state")
+		h.renderLogin(w, r, "", "Login failed. Please try again.")
+		return
+	}
+
+	sess, err := h.oauth.Callback(r.Context(), authReq, params)
+	if errors.Is(err, atproto.ErrAuthDenied) {
+		h.renderLogin(w, r, authReq.Handle, "Login was cancelled.")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("did", authReq.DID).Msg("OAuth callback failed")
+		h.renderLogin(w, r, authReq.Handle, "Login failed. Please try again.")
+		return
+	}
+
+	if err := h.completeLogin(w, r, sess); err != nil {
+		log.Error().Err(err).Str("did", sess.DID).Msg("Failed to complete login")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 // ShowLogin displays the login page
 func (h *Handlers) ShowLogin(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
-		"Error": "",
+		"Error":     "",
+		"Handle":    r.URL.Query().Get("handle"),
+		"Reconsent": r.URL.Query().Get("reconsent"),
+		"CSRFToken": h.csrfToken(w, r),
 	}
 
 	view.RenderTemplate(w, "login", data)
@@ -87,8 +167,61 @@ func (h *Handlers) ShowLogin(w http.ResponseWriter, r *http.Request) {
 
 // HandleLogin processes login form submission
 func (h *Handlers) HandleLogin(w http.ResponseWriter, r *http.Request) {
-	// To be implemented when we integrate AT Protocol client
-	http.Redirect(w, r, "/?error=not_implemented", http.StatusFound)
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error: Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// Find the account and its PDS; a DID works as well as a handle
+	input := strings.TrimSpace(r.FormValue("handle"))
+	var ident *identity.Identity
+	var err error
+	if strings.HasPrefix(input, "did:") {
+		ident, err = h.identity.LookupDID(r.Context(), input)
+	} else {
+		ident, err = h.identity.LookupHandle(r.Context(), input)
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("handle", input).Msg("Failed to resolve login handle")
+		h.renderLogin(w, r, input, "Could not find that account.")
+		return
+	}
+	pdsHost := ident.Doc.PDSEndpoint()
+	if pdsHost == "" {
+		h.renderLogin(w, r, input, "That account has no PDS.")
+		return
+	}
+
+	authReq, redirectURL, err := h.oauth.Authorize(r.Context(), ident.DID, ident.Handle, pdsHost)
+	if err != nil {
+		log.Error().Err(err).Str("did", ident.DID).Msg("Failed to start OAuth flow")
+		h.renderLogin(w, r, input, "Could not reach your PDS to log in.")
+		return
+	}
+
+	data, err := authReq.Encode()
+	if err == nil {
+		err = h.db.SaveAuthState(r.Context(), authReq.State, data)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save OAuth state")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// renderLogin shows the login page with an error
+func (h *Handlers) renderLogin(w http.ResponseWriter, r *http.Request, handle, message string) {
+	data := map[string]interface{}{
+		"Error":     message,
+		"Handle":    handle,
+		"CSRFToken": h.csrfToken(w, r),
+	}
+
+	view.RenderTemplate(w, "login", data)
 }
 
 // HandleLogout processes logout
@@ -109,15 +242,41 @@ func (h *Handlers) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// feedPageSize is the number of statuses on each page of the feed
+const feedPageSize = 10
+
+// feedOrder reads the order the feed was asked for from ?sort=
+func feedOrder(r *http.Request) (db.FeedOrder, bool) {
+	switch r.URL.Query().Get("sort") {
+	case "", string(db.ByIndexedAt):
+		return db.ByIndexedAt, true
+	case string(db.ByCreatedAt):
+		return db.ByCreatedAt, true
+	default:
+		return "", false
+	}
+}
+
 // Home displays the homepage
 func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
-	// Get statuses from database
-	statuses, err := h.db.GetRecentStatuses(10)
+	order, ok := feedOrder(r)
+	if !ok {
+		http.Error(w, "Error: Invalid sort", http.StatusBadRequest)
+		return
+	}
+
+	// Get statuses from database, continuing from an older page's cursor
+	page, err := h.db.GetRecentStatuses(r.Context(), order, r.URL.Query().Get("cursor"), feedPageSize)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		http.Error(w, "Error: Invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get statuses")
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	statuses := page.Statuses
 
 	// Get session
 	session, _ := h.store.Get(r, "sid")
@@ -126,36 +285,68 @@ func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
 	userDID, ok := session.Values["did"].(string)
 
 	var myStatus *db.Status
-	var profile map[string]interface{}
+	var pending []db.OutboxEntry
+	var syncProgress *reposync.Progress
+	var purgeJob *db.PurgeJob
 
-	// If user is logged in, get their status
+	// If user is logged in, get their status and any writes still on their way to their PDS
 	if ok && userDID != "" {
 		var err error
-		myStatus, err = h.db.GetUserStatus(userDID)
+		myStatus, err = h.db.GetUserStatus(r.Context(), syntax.DID(userDID))
 		if err != nil {
 			log.Debug().Err(err).Msg("User has no status")
 			// This is not a critical error, user might not have a status yet
 		}
 
-		// For now, just create a minimal profile
-		// This will be replaced with actual profile data in the AT Protocol integration
-		profile = map[string]interface{}{
-			"displayName": session.Values["displayName"],
+		pending, err = h.outbox.Pending(r.Context(), syntax.DID(userDID))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get pending writes")
+		}
+
+		syncProgress = h.syncer.Progress(syntax.DID(userDID))
+
+		// Only unfinished or failed jobs are worth showing
+		if job, err := h.purger.Job(r.Context(), syntax.DID(userDID)); err == nil && job.State != db.PurgeDone {
+			purgeJob = job
 		}
 	}
 
-	// For now, just use a simple map for the DID to handle mapping
-	// This will be replaced with actual handle resolution in the AT Protocol integration
-	didHandleMap := make(map[string]string)
+	// Map author DIDs to their verified handles and profiles
+	dids := make([]string, 0, len(statuses)+1)
 	for _, status := range statuses {
-		didHandleMap[status.AuthorDID] = status.AuthorDID
+		dids = append(dids, status.AuthorDID.String())
+	}
+	didHandleMap := h.identity.ResolveDIDsToHandles(r.Context(), dids)
+	if ok && userDID != "" {
+		dids = append(dids, userDID)
+	}
+	authorProfiles := h.profiles.GetMany(r.Context(), dids)
+
+	// The viewer's profile doubles as the logged-in marker, so it must exist
+	// even if their profile record could not be fetched
+	var profile *profiles.Profile
+	if ok && userDID != "" {
+		profile = authorProfiles[userDID]
+		if profile == nil {
+			profile = &profiles.Profile{DID: userDID}
+		}
 	}
 
 	data := map[string]interface{}{
-		"Statuses":     statuses,
-		"DidHandleMap": didHandleMap,
-		"Profile":      profile,
-		"MyStatus":     myStatus,
+		"Statuses":      statuses,
+		"Cursor":        page.Cursor,
+		"Sort":          string(order),
+		"Older":         r.URL.Query().Get("cursor") != "",
+		"DidHandleMap":  didHandleMap,
+		"Profile":       profile,
+		"Profiles":      authorProfiles,
+		"MyStatus":      myStatus,
+		"Pending":       pending,
+		"Sync":          syncProgress,
+		"Purge":         purgeJob,
+		"ViewerDID":     userDID,
+		"StatusOptions": statusOptions,
+		"CSRFToken":     h.csrfToken(w, r),
 	}
 
 	view.RenderTemplate(w, "home", data)
@@ -186,23 +377,28 @@ func (h *Handlers) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create status
-	// This is a simplified implementation, will be replaced with actual AT Protocol integration
-	now := time.Now().UTC().Format(time.RFC3339)
-	status := &db.Status{
-		URI:       "at://" + userDID + "/xyz.statusphere.status/temporary",
-		AuthorDID: userDID,
-		Status:    statusText,
-		CreatedAt: now,
-		IndexedAt: now,
+	// Make sure the user granted us permission to write statuses
+	authSession := h.requireRepoWrite(w, r, userDID, atproto.StatusCollection, atproto.ActionCreate)
+	if authSession == nil {
+		return
 	}
 
-	// Save status to database
-	if err := h.db.SaveStatus(status); err != nil {
-		log.Error().Err(err).Msg("Failed to save status")
-		http.Error(w, "Error: Failed to save status", http.StatusInternalServerError)
+	// Build and validate the record against the lexicon
+	record := atproto.NewStatusRecord(statusText, time.Now())
+	if err := record.Validate(); err != nil {
+		http.Error(w, "Error: Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	// Queue the record for the user's repo. The outbox tries to write it right
+	// away and keeps retrying in the background if their PDS is unavailable;
+	// until then the author sees it as pending.
+	uri := syntax.NewRecordURI(syntax.DID(userDID), atproto.StatusCollection, syntax.RecordKey(h.tids.Next()))
+	if err := h.outbox.Enqueue(r.Context(), uri, record); err != nil {
+		log.Error().Err(err).Msg("Failed to queue record")
+		http.Error(w, "Error: Failed to write record", http.StatusInternalServerError)
 		return
 	}
 
 	http.Redirect(w, r, "/", http.StatusFound)
-}
\ No newline at end of file
+}
@@ -0,0 +1,562 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/config"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/identity"
+	"github.com/referendumApp/statusphere-example-app-go/internal/outbox"
+	"github.com/referendumApp/statusphere-example-app-go/internal/profiles"
+	"github.com/referendumApp/statusphere-example-app-go/internal/purge"
+	"github.com/referendumApp/statusphere-example-app-go/internal/reposync"
+	"github.com/referendumApp/statusphere-example-app-go/internal/stats"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+const (
+	alice     = syntax.DID("did:plc:alice")
+	bob       = syntax.DID("did:plc:bob")
+	testToken = "csrf-token"
+)
+
+// Templates are loaded relative to the repository root, as the server runs
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// memStore is an in-memory db.Store holding what the handlers under test
+// read and write. Any other method panics through the nil embedded Store.
+type memStore struct {
+	db.Store
+
+	mu       sync.Mutex
+	statuses map[syntax.ATURI]db.Status
+	sessions map[string]string
+	outbox   map[syntax.ATURI]db.OutboxEntry
+	purges   map[syntax.DID]db.PurgeJob
+	profiles map[string]db.Profile
+	emoji    []db.EmojiCount
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		statuses: map[syntax.ATURI]db.Status{},
+		sessions: map[string]string{},
+		outbox:   map[syntax.ATURI]db.OutboxEntry{},
+		purges:   map[syntax.DID]db.PurgeJob{},
+		profiles: map[string]db.Profile{},
+	}
+}
+
+// page returns the statuses matching keep, newest first, after the cursor
+func (m *memStore) page(order db.FeedOrder, cursor string, limit int, keep func(db.Status) bool) (*db.StatusPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var all []db.Status
+	for _, s := range m.statuses {
+		if keep(s) {
+			all = append(all, s)
+		}
+	}
+	at := func(s db.Status) string {
+		if order == db.ByCreatedAt {
+			return s.EffectiveAt.String()
+		}
+		return s.IndexedAt.String()
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if at(all[i]) != at(all[j]) {
+			return at(all[i]) > at(all[j])
+		}
+		return all[i].URI > all[j].URI
+	})
+
+	if cursor != "" {
+		i := 0
+		for i < len(all) && db.EncodeCursor(order, &all[i]) != cursor {
+			i++
+		}
+		if i == len(all) {
+			return nil, db.ErrInvalidCursor
+		}
+		all = all[i+1:]
+	}
+
+	page := &db.StatusPage{Statuses: all}
+	if len(all) > limit {
+		page.Statuses = all[:limit]
+		page.Cursor = db.EncodeCursor(order, &all[limit-1])
+	}
+	return page, nil
+}
+
+func (m *memStore) GetRecentStatuses(ctx context.Context, order db.FeedOrder, cursor string, limit int) (*db.StatusPage, error) {
+	return m.page(order, cursor, limit, func(db.Status) bool { return true })
+}
+
+func (m *memStore) GetUserStatuses(ctx context.Context, authorDID syntax.DID, cursor string, limit int) (*db.StatusPage, error) {
+	return m.page(db.ByIndexedAt, cursor, limit, func(s db.Status) bool { return s.AuthorDID == authorDID })
+}
+
+func (m *memStore) GetUserStatus(ctx context.Context, authorDID syntax.DID) (*db.Status, error) {
+	page, _ := m.GetUserStatuses(ctx, authorDID, "", 1)
+	if len(page.Statuses) == 0 {
+		return nil, fmt.Errorf("failed to get user status: %w", sql.ErrNoRows)
+	}
+	return &page.Statuses[0], nil
+}
+
+func (m *memStore) GetUserStatusDays(ctx context.Context, authorDID syntax.DID, since db.Timestamp) ([]db.StatusDay, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var days []db.StatusDay
+	for _, s := range m.statuses {
+		if s.AuthorDID == authorDID && !s.EffectiveAt.Before(since.Time) {
+			days = append(days, db.StatusDay{Day: s.EffectiveAt.Format(time.DateOnly), Status: s.Status, Count: 1})
+		}
+	}
+	return days, nil
+}
+
+func (m *memStore) GetStatus(ctx context.Context, uri syntax.ATURI) (*db.Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.statuses[uri]
+	if !ok {
+		return nil, fmt.Errorf("failed to get status: %w", sql.ErrNoRows)
+	}
+	return &s, nil
+}
+
+func (m *memStore) SaveStatus(ctx context.Context, status *db.Status) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status.EffectiveAt = db.EffectiveTime(status.CreatedAt, status.IndexedAt)
+	m.statuses[status.URI] = *status
+	return nil
+}
+
+func (m *memStore) DeleteStatus(ctx context.Context, uri syntax.ATURI, rev string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.statuses, uri)
+	return nil
+}
+
+func (m *memStore) CountUserStatuses(ctx context.Context, authorDID syntax.DID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, s := range m.statuses {
+		if s.AuthorDID == authorDID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memStore) GetAuthSession(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.sessions[key]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return data, nil
+}
+
+func (m *memStore) SaveAuthSession(ctx context.Context, key, sessionData string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[key] = sessionData
+	return nil
+}
+
+func (m *memStore) GetUserOutboxEntries(ctx context.Context, authorDID syntax.DID) ([]db.OutboxEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []db.OutboxEntry
+	for _, e := range m.outbox {
+		if e.AuthorDID == authorDID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (m *memStore) DeleteFailedOutboxEntry(ctx context.Context, uri syntax.ATURI) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.outbox[uri]; ok && e.State == db.OutboxFailed {
+		delete(m.outbox, uri)
+	}
+	return nil
+}
+
+func (m *memStore) GetPurgeJob(ctx context.Context, did syntax.DID) (*db.PurgeJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.purges[did]
+	if !ok {
+		return nil, fmt.Errorf("failed to get purge job: %w", sql.ErrNoRows)
+	}
+	return &job, nil
+}
+
+func (m *memStore) SavePurgeJob(ctx context.Context, job *db.PurgeJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purges[job.DID] = *job
+	return nil
+}
+
+func (m *memStore) GetProfiles(ctx context.Context, dids []string) ([]db.Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []db.Profile
+	for _, did := range dids {
+		if row, ok := m.profiles[did]; ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (m *memStore) SaveProfile(ctx context.Context, profile *db.Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[profile.DID] = *profile
+	return nil
+}
+
+func (m *memStore) GetEmojiCounts(ctx context.Context, g db.Granularity, since db.Timestamp) ([]db.EmojiCount, error) {
+	return m.emoji, nil
+}
+
+// save stores a status from one of the test users, indexed when it was created
+func (m *memStore) save(author syntax.DID, rkey, status, cid string, createdAt time.Time) *db.Status {
+	s := &db.Status{
+		URI:       syntax.NewRecordURI(author, atproto.StatusCollection, syntax.RecordKey(rkey)),
+		AuthorDID: author,
+		Status:    status,
+		CreatedAt: db.NewTimestamp(createdAt),
+		IndexedAt: db.NewTimestamp(createdAt),
+		CID:       cid,
+	}
+	m.SaveStatus(context.Background(), s)
+	return s
+}
+
+// directory knows the handles of the test users, without touching the network
+type directory map[string]string
+
+func (d directory) LookupDID(ctx context.Context, did string) (*identity.Identity, error) {
+	handle, ok := d[did]
+	if !ok {
+		return nil, errors.New("unknown DID")
+	}
+	return &identity.Identity{DID: did, Handle: handle, Doc: &identity.DIDDocument{ID: did}}, nil
+}
+
+func (d directory) LookupHandle(ctx context.Context, handle string) (*identity.Identity, error) {
+	for did, h := range d {
+		if h == handle {
+			return d.LookupDID(ctx, did)
+		}
+	}
+	return nil, errors.New("unknown handle")
+}
+
+func (d directory) ResolveDIDsToHandles(ctx context.Context, dids []string) map[string]string {
+	result := make(map[string]string, len(dids))
+	for _, did := range dids {
+		result[did] = did
+		if handle, ok := d[did]; ok {
+			result[did] = handle
+		}
+	}
+	return result
+}
+
+// pdsCall is a write received by the fake PDS
+type pdsCall struct {
+	Method     string
+	Collection string `json:"collection"`
+	Rkey       string `json:"rkey"`
+	SwapRecord string `json:"swapRecord"`
+	Record     struct {
+		Status    string `json:"status"`
+		CreatedAt string `json:"createdAt"`
+	} `json:"record"`
+}
+
+// fakePDS accepts putRecord and deleteRecord, rejecting them with InvalidSwap
+// if swapRecord is not the CID it holds for the record
+type fakePDS struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	cids  map[string]string // Current CID of each record, by rkey
+	calls []pdsCall
+}
+
+func newFakePDS(t *testing.T) *fakePDS {
+	pds := &fakePDS{cids: map[string]string{}}
+	pds.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call pdsCall
+		if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		call.Method = strings.TrimPrefix(r.URL.Path, "/xrpc/")
+
+		pds.mu.Lock()
+		defer pds.mu.Unlock()
+		pds.calls = append(pds.calls, call)
+
+		w.Header().Set("Content-Type", "application/json")
+		if call.SwapRecord != pds.cids[call.Rkey] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "InvalidSwap", "message": "Record was at " + pds.cids[call.Rkey]})
+			return
+		}
+
+		commit := atproto.CommitMeta{CID: "bafycommit", Rev: "3lrev00000002"}
+		switch call.Method {
+		case "com.atproto.repo.putRecord":
+			pds.cids[call.Rkey] = "bafyedited"
+			json.NewEncoder(w).Encode(atproto.WriteResult{
+				URI:    "at://" + alice.String() + "/" + call.Collection + "/" + call.Rkey,
+				CID:    "bafyedited",
+				Commit: &commit,
+			})
+		case "com.atproto.repo.deleteRecord":
+			delete(pds.cids, call.Rkey)
+			json.NewEncoder(w).Encode(map[string]interface{}{"commit": commit})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(pds.Close)
+	return pds
+}
+
+func (p *fakePDS) Calls() []pdsCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]pdsCall(nil), p.calls...)
+}
+
+// testApp is the handlers wired to fakes, behind the server's routes
+type testApp struct {
+	h      *Handlers
+	store  *memStore
+	pds    *fakePDS
+	syncer *reposync.Syncer
+	router *mux.Router
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	store := newMemStore()
+	pds := newFakePDS(t)
+
+	// Alice has a session allowed to write statuses on the fake PDS
+	data, err := (&atproto.Session{DID: alice.String(), Handle: "alice.test", PdsHost: pds.URL, AccessJwt: "jwt", Scope: "atproto repo:xyz.statusphere.status"}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.sessions[alice.String()] = data
+
+	dir := directory{alice.String(): "alice.test", bob.String(): "bob.test"}
+	sessions := atproto.NewSessions(store, nil)
+	profileService := profiles.NewService(store, dir)
+	syncer := reposync.New(store, sessions)
+	cfg := &config.Config{CookieSecret: "test-cookie-secret", Environment: "development"}
+
+	h := New(cfg, store, nil, sessions, dir, profileService, nil, outbox.New(store, sessions), nil, syncer, purge.New(store, sessions), stats.New(store))
+
+	// The routes under test, as server.Start sets them up
+	router := mux.NewRouter()
+	router.Use(h.VerifyCSRF)
+	router.HandleFunc("/", h.Home).Methods("GET")
+	router.HandleFunc("/status/{rkey}/edit", h.EditStatus).Methods("POST")
+	router.HandleFunc("/status/{rkey}/delete", h.DeleteStatus).Methods("POST")
+	router.HandleFunc("/status/{rkey}/dismiss", h.DismissWrite).Methods("POST")
+	router.HandleFunc("/history/clear", h.ClearHistory).Methods("POST")
+	router.HandleFunc("/history/sync", h.SyncHistory).Methods("POST")
+	router.HandleFunc("/profile/{handle}", h.Profile).Methods("GET")
+	router.HandleFunc("/api/statuses", h.ListStatuses).Methods("GET")
+	router.HandleFunc("/api/stats", h.GetStats).Methods("GET")
+
+	return &testApp{h: h, store: store, pds: pds, syncer: syncer, router: router}
+}
+
+// login returns the cookies of a session signed in as did, with testToken as its CSRF token
+func (a *testApp) login(t *testing.T, did syntax.DID) []*http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := a.h.store.Get(req, "sid")
+	session.Values["did"] = did.String()
+	session.Values[csrfSessionKey] = testToken
+	if err := session.Save(req, rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Result().Cookies()
+}
+
+// get serves a GET request
+func (a *testApp) get(target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// post serves a form post
+func (a *testApp) post(target string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// form builds a form carrying the test CSRF token
+func form(pairs ...string) url.Values {
+	v := url.Values{csrfField: {testToken}}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		v.Set(pairs[i], pairs[i+1])
+	}
+	return v
+}
+
+var start = time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+
+func TestCSRF(t *testing.T) {
+	app := newTestApp(t)
+	cookies := app.login(t, alice)
+	app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafyold", start)
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		cookies []*http.Cookie
+	}{
+		{name: "no token", form: url.Values{}, cookies: cookies},
+		{name: "wrong token", form: url.Values{csrfField: {"forged"}}, cookies: cookies},
+		{name: "no session", form: form()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := app.post("/status/3lbqsq6rwgc2a/delete", tt.form, tt.cookies)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+		})
+	}
+	if calls := app.pds.Calls(); len(calls) != 0 {
+		t.Errorf("PDS received %d writes, want none", len(calls))
+	}
+
+	// The header works in place of the form field
+	req := httptest.NewRequest(http.MethodPost, "/history/sync", nil)
+	req.Header.Set(csrfHeader, testToken)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Errorf("status with the token in %s = %d, want %d", csrfHeader, rec.Code, http.StatusFound)
+	}
+}
+
+func TestHomeShowsControlsOnlyForOwnStatuses(t *testing.T) {
+	app := newTestApp(t)
+	app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafyalice", start)
+	app.store.save(bob, "3lbqsq6rwgc2b", "💙", "bafybob", start.Add(time.Minute))
+
+	rec := app.get("/", app.login(t, alice))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `action="/status/3lbqsq6rwgc2a/edit"`) || !strings.Contains(body, `action="/status/3lbqsq6rwgc2a/delete"`) {
+		t.Error("no edit and delete controls on the viewer's own status")
+	}
+	if strings.Contains(body, "/status/3lbqsq6rwgc2b/") {
+		t.Error("edit or delete controls on another user's status")
+	}
+	if !strings.Contains(body, `value="`+testToken+`"`) {
+		t.Error("forms do not carry the CSRF token")
+	}
+}
+
+func TestClearHistory(t *testing.T) {
+	app := newTestApp(t)
+	app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafyalice", start)
+
+	rec := app.post("/history/clear", form(), app.login(t, alice))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	job, err := app.store.GetPurgeJob(context.Background(), alice)
+	if err != nil || job.State != db.PurgeRunning || job.Total != 1 {
+		t.Errorf("purge job = %+v, %v, want one running over 1 status", job, err)
+	}
+}
+
+func TestClearHistoryWithoutScope(t *testing.T) {
+	app := newTestApp(t)
+	data, _ := (&atproto.Session{DID: alice.String(), Handle: "alice.test", PdsHost: app.pds.URL, AccessJwt: "jwt", Scope: "atproto"}).Encode()
+	app.store.sessions[alice.String()] = data
+
+	rec := app.post("/history/clear", form(), app.login(t, alice))
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), "/login?") {
+		t.Errorf("response = %d to %q, want a redirect to log in again", rec.Code, rec.Header().Get("Location"))
+	}
+	if _, err := app.store.GetPurgeJob(context.Background(), alice); err == nil {
+		t.Error("purge started without the delete scope")
+	}
+}
+
+func TestSyncHistory(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := app.post("/history/sync", form(), app.login(t, alice))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	if p := app.syncer.Progress(alice); p == nil || !p.Running {
+		t.Errorf("Progress() = %+v, want a sync queued", p)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/referendumApp/statusphere-example-app-go/internal/view"
+	"github.com/rs/zerolog/log"
+)
+
+// calendarWeeks is how far back the mood calendar goes
+const calendarWeeks = 26
+
+// calendarDay is one square of the mood calendar
+type calendarDay struct {
+	Date   string // UTC, as YYYY-MM-DD
+	Emoji  string // The most used that day
+	Count  int    // Statuses that day
+	Level  int    // 0 for none, up to 4 for the busiest days
+	Title  string
+	Future bool // After today, padding out the last week
+}
+
+// Profile shows a user's current status, their status history and a
+// calendar of the emoji they used each day. Only authors with a status here
+// have a profile page, so requests cannot make the server resolve, or cache
+// profiles for, arbitrary DIDs.
+func (h *Handlers) Profile(w http.ResponseWriter, r *http.Request) {
+	ident := mux.Vars(r)["handle"]
+
+	var did syntax.DID
+	handle := ident
+	if strings.HasPrefix(ident, "did:") {
+		parsed, err := syntax.ParseDID(ident)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		did = parsed
+		handle = ""
+	} else {
+		resolved, err := h.identity.LookupHandle(r.Context(), ident)
+		if err != nil {
+			log.Debug().Err(err).Str("handle", ident).Msg("Failed to resolve profile handle")
+			http.NotFound(w, r)
+			return
+		}
+		did = syntax.DID(resolved.DID)
+		handle = resolved.Handle
+	}
+
+	current, err := h.db.GetUserStatus(r.Context(), did)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user status")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if handle == "" {
+		// The statuses are ours to show even if the DID will not resolve
+		handle = h.identity.ResolveDIDsToHandles(r.Context(), []string{ident})[ident]
+	}
+
+	page, err := h.db.GetUserStatuses(r.Context(), did, r.URL.Query().Get("cursor"), feedPageSize)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		http.Error(w, "Error: Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user statuses")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	today := time.Now().UTC()
+	start := calendarStart(today)
+	days, err := h.db.GetUserStatusDays(r.Context(), did, db.NewTimestamp(start))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user status days")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	session, _ := h.store.Get(r, "sid")
+	userDID, _ := session.Values["did"].(string)
+
+	data := map[string]interface{}{
+		"DID":       did.String(),
+		"Handle":    handle,
+		"Author":    h.profiles.Get(r.Context(), did.String()),
+		"Current":   current,
+		"Statuses":  page.Statuses,
+		"Cursor":    page.Cursor,
+		"Older":     r.URL.Query().Get("cursor") != "",
+		"Calendar":  buildCalendar(days, start, today),
+		"ViewerDID": userDID,
+	}
+
+	view.RenderTemplate(w, "profile", data)
+}
+
+// calendarStart returns the Sunday that starts the calendar ending this week
+func calendarStart(today time.Time) time.Time {
+	day := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -int(day.Weekday())-(calendarWeeks-1)*7)
+}
+
+// buildCalendar lays out a day for every square from start to the end of
+// today's week, with days ordered as GetUserStatusDays returns them
+func buildCalendar(days []db.StatusDay, start, today time.Time) []calendarDay {
+	byDate := map[string][]db.StatusDay{}
+	for _, d := range days {
+		byDate[d.Day] = append(byDate[d.Day], d)
+	}
+	totals := map[string]int{}
+	busiest := 0
+	for date, counts := range byDate {
+		for _, c := range counts {
+			totals[date] += c.Count
+		}
+		busiest = max(busiest, totals[date])
+	}
+
+	todayDate := today.Format(time.DateOnly)
+	calendar := make([]calendarDay, 0, calendarWeeks*7)
+	for i := 0; i < calendarWeeks*7; i++ {
+		date := start.AddDate(0, 0, i).Format(time.DateOnly)
+		day := calendarDay{Date: date, Future: date > todayDate, Title: date}
+		if counts := byDate[date]; len(counts) > 0 {
+			day.Emoji = counts[0].Status
+			day.Count = totals[date]
+			// Scaled to the busiest day, so one status is never invisible
+			day.Level = (day.Count*4 + busiest - 1) / busiest
+
+			parts := make([]string, 0, len(counts))
+			for _, c := range counts {
+				parts = append(parts, fmt.Sprintf("%s ×%d", c.Status, c.Count))
+			}
+			day.Title = date + ": " + strings.Join(parts, ", ")
+		}
+		calendar = append(calendar, day)
+	}
+	return calendar
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfile(t *testing.T) {
+	app := newTestApp(t)
+	app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafy1", start)
+	app.store.save(alice, "3lbqsq6rwgc2b", "🥹", "bafy2", start.Add(time.Minute))
+	app.store.save(bob, "3lbqsq6rwgc2c", "💙", "bafy3", start.Add(2*time.Minute))
+
+	for _, path := range []string{"/profile/alice.test", "/profile/did:plc:alice"} {
+		t.Run(path, func(t *testing.T) {
+			rec := app.get(path, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, "👍") || !strings.Contains(body, "🥹") {
+				t.Error("profile does not show the user's statuses")
+			}
+			if strings.Contains(body, "💙") {
+				t.Error("profile shows another user's status")
+			}
+		})
+	}
+}
+
+func TestProfileNotFound(t *testing.T) {
+	app := newTestApp(t)
+	app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafy1", start)
+
+	// Bob resolves but has no statuses here, and nobody has the last handle
+	for _, path := range []string{"/profile/bob.test", "/profile/did:plc:bob", "/profile/not-a-did:", "/profile/carol.test"} {
+		if rec := app.get(path, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestProfilePages(t *testing.T) {
+	app := newTestApp(t)
+	app.store.save(alice, "3lbqsq6rwgc00", "🐢", "bafy", start)
+	for i := 1; i <= feedPageSize; i++ {
+		app.store.save(alice, fmt.Sprintf("3lbqsq6rwgc%02d", i), "👍", "bafy", start.Add(time.Duration(i)*time.Minute))
+	}
+
+	rec := app.get("/profile/alice.test", nil)
+	if strings.Contains(rec.Body.String(), "🐢") {
+		t.Errorf("first page shows more than %d statuses", feedPageSize)
+	}
+	older := regexp.MustCompile(`href="(/profile/alice\.test\?cursor=[^"]+)"`).FindStringSubmatch(rec.Body.String())
+	if older == nil {
+		t.Fatalf("no link to older statuses with %d statuses", feedPageSize+1)
+	}
+
+	rec = app.get(strings.ReplaceAll(older[1], "&amp;", "&"), nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "🐢") {
+		t.Errorf("older page = %d, want the oldest status", rec.Code)
+	}
+
+	if rec := app.get("/profile/alice.test?cursor=bogus", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("status with an invalid cursor = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/schedule"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/referendumApp/statusphere-example-app-go/internal/view"
+	"github.com/rs/zerolog/log"
+)
+
+// scheduledView is a scheduled status as shown on the schedule page
+type scheduledView struct {
+	RecordKey syntax.RecordKey
+	Status    string
+	When      string // In the time zone it was scheduled in
+	Missed    bool
+}
+
+// ShowSchedule lists the user's scheduled statuses
+func (h *Handlers) ShowSchedule(w http.ResponseWriter, r *http.Request) {
+	h.renderSchedule(w, r, "")
+}
+
+// CreateSchedule schedules a status for a later time
+func (h *Handlers) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "sid")
+	userDID, ok := session.Values["did"].(string)
+	if !ok || userDID == "" {
+		http.Error(w, "Error: Session required", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error: Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// Check now rather than when the status is due, while the user is here to consent
+	if h.requireRepoWrite(w, r, userDID, atproto.StatusCollection, atproto.ActionCreate) == nil {
+		return
+	}
+
+	at, err := schedule.ParseLocalTime(r.FormValue("at"), r.FormValue("tz"))
+	if err != nil {
+		h.renderSchedule(w, r, "Pick a date and time")
+		return
+	}
+
+	_, err = h.scheduler.Schedule(r.Context(), syntax.DID(userDID), r.FormValue("status"), at)
+	switch {
+	case errors.Is(err, schedule.ErrInPast):
+		h.renderSchedule(w, r, "That time has already passed")
+		return
+	case errors.Is(err, schedule.ErrTooFarAhead):
+		h.renderSchedule(w, r, "Statuses can be scheduled up to a year ahead")
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("Failed to schedule status")
+		h.renderSchedule(w, r, "Could not schedule that status")
+		return
+	}
+
+	http.Redirect(w, r, "/schedule", http.StatusFound)
+}
+
+// CancelSchedule cancels one of the user's scheduled statuses
+func (h *Handlers) CancelSchedule(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "sid")
+	userDID, ok := session.Values["did"].(string)
+	if !ok || userDID == "" {
+		http.Error(w, "Error: Session required", http.StatusUnauthorized)
+		return
+	}
+
+	rkey, err := syntax.ParseRecordKey(mux.Vars(r)["rkey"])
+	if err != nil {
+		http.Error(w, "Error: Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scheduler.Cancel(r.Context(), syntax.DID(userDID), rkey); err != nil {
+		log.Error().Err(err).Msg("Failed to cancel scheduled status")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/schedule", http.StatusFound)
+}
+
+// renderSchedule renders the schedule page with an optional form error
+func (h *Handlers) renderSchedule(w http.ResponseWriter, r *http.Request, formError string) {
+	session, _ := h.store.Get(r, "sid")
+	userDID, ok := session.Values["did"].(string)
+	if !ok || userDID == "" {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	scheduled, err := h.scheduler.List(r.Context(), syntax.DID(userDID))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get scheduled statuses")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]scheduledView, 0, len(scheduled))
+	for _, s := range scheduled {
+		views = append(views, newScheduledView(s))
+	}
+
+	data := map[string]interface{}{
+		"Scheduled":     views,
+		"StatusOptions": statusOptions,
+		"Error":         formError,
+		"CSRFToken":     h.csrfToken(w, r),
+	}
+
+	view.RenderTemplate(w, "schedule", data)
+}
+
+func newScheduledView(s db.ScheduledStatus) scheduledView {
+	v := scheduledView{
+		RecordKey: s.URI.RecordKey(),
+		Status:    s.Status,
+		Missed:    s.State == db.ScheduledMissed,
+	}
+
+	at := s.ScheduledAt.Time
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		at = at.In(loc)
+	}
+	v.When = at.Format("Mon 2 Jan 2006, 15:04 MST")
+	return v
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/view"
+	"github.com/rs/zerolog/log"
+)
+
+// windowTitles names the stats windows on the stats page
+var windowTitles = map[db.Granularity]string{
+	db.Hourly: "Last hour",
+	db.Daily:  "Last 24 hours",
+	db.Weekly: "Last 7 days",
+}
+
+// ShowStats shows the most used emoji over each window and the trending ones
+func (h *Handlers) ShowStats(w http.ResponseWriter, r *http.Request) {
+	report, err := h.stats.Report(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get emoji stats")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Report":       report,
+		"WindowTitles": windowTitles,
+	}
+
+	view.RenderTemplate(w, "stats", data)
+}
+
+// GetStats serves the emoji stats as JSON. Like the stats page, it counts
+// each status under the emoji it was first posted with; edits are not counted.
+func (h *Handlers) GetStats(w http.ResponseWriter, r *http.Request) {
+	report, err := h.stats.Report(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get emoji stats")
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+// statusOptions are the statuses offered in the UI
+var statusOptions = []string{"👍", "👎", "💙", "🥹"}
+
+// DeleteStatus deletes one of the user's statuses from their repo
+func (h *Handlers) DeleteStatus(w http.ResponseWriter, r *http.Request) {
+	userDID, status, ok := h.ownStatus(w, r)
+	if !ok {
+		return
+	}
+
+	authSession := h.requireRepoWrite(w, r, userDID.String(), atproto.StatusCollection, atproto.ActionDelete)
+	if authSession == nil {
+		return
+	}
+
+	client, err := atproto.NewClientFromSession(authSession)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create PDS client")
+		http.Error(w, "Error: Failed to delete record", http.StatusInternalServerError)
+		return
+	}
+
+	// Only delete the version the user was looking at
+	commit, err := client.DeleteRecord(r.Context(), atproto.StatusCollection, status.URI.RecordKey().String(), status.CID)
+	if atproto.IsInvalidSwap(err) {
+		http.Error(w, "Error: Status was changed elsewhere; reload and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete record")
+		http.Error(w, "Error: Failed to delete record", http.StatusInternalServerError)
+		return
+	}
+
+	// A newer version written since the delete is left alone
+	err = h.db.DeleteStatus(r.Context(), status.URI, commit.Rev)
+	if err != nil && !errors.Is(err, db.ErrStaleStatus) {
+		log.Error().Err(err).Msg("Failed to update computed view; ignoring as it should be caught by the firehose")
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// EditStatus replaces one of the user's statuses with a new value
+func (h *Handlers) EditStatus(w http.ResponseWriter, r *http.Request) {
+	userDID, status, ok := h.ownStatus(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error: Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// An edit corrects the status, so it keeps its original creation time
+	record := &atproto.StatusRecord{
+		Type:      atproto.StatusCollection,
+		Status:    r.FormValue("status"),
+		CreatedAt: status.CreatedAt.String(),
+	}
+	if err := record.Validate(); err != nil {
+		http.Error(w, "Error: Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	authSession := h.requireRepoWrite(w, r, userDID.String(), atproto.StatusCollection, atproto.ActionUpdate)
+	if authSession == nil {
+		return
+	}
+
+	client, err := atproto.NewClientFromSession(authSession)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create PDS client")
+		http.Error(w, "Error: Failed to write record", http.StatusInternalServerError)
+		return
+	}
+
+	// swapRecord makes this fail instead of clobbering a concurrent edit
+	result, err := client.PutRecord(r.Context(), atproto.StatusCollection, status.URI.RecordKey().String(), record, status.CID)
+	if atproto.IsInvalidSwap(err) {
+		http.Error(w, "Error: Status was changed elsewhere; reload and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to write record")
+		http.Error(w, "Error: Failed to write record", http.StatusInternalServerError)
+		return
+	}
+
+	updated := &db.Status{
+		URI:       status.URI,
+		AuthorDID: userDID,
+		Status:    record.Status,
+		CreatedAt: status.CreatedAt,
+		IndexedAt: db.NewTimestamp(time.Now()),
+		CID:       result.CID,
+		Rev:       result.Rev(),
+	}
+	// A newer version indexed in the meantime wins
+	err = h.db.SaveStatus(r.Context(), updated)
+	if err != nil && !errors.Is(err, db.ErrStaleStatus) {
+		log.Error().Err(err).Msg("Failed to update computed view; ignoring as it should be caught by the firehose")
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// DismissWrite discards one of the user's status writes that could not be delivered
+func (h *Handlers) DismissWrite(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "sid")
+	userDID, ok := session.Values["did"].(string)
+	if !ok || userDID == "" {
+		http.Error(w, "Error: Session required", http.StatusUnauthorized)
+		return
+	}
+
+	rkey, err := syntax.ParseRecordKey(mux.Vars(r)["rkey"])
+	if err != nil {
+		http.Error(w, "Error: Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	uri := syntax.NewRecordURI(syntax.DID(userDID), atproto.StatusCollection, rkey)
+	if err := h.outbox.Dismiss(r.Context(), syntax.DID(userDID), uri); err != nil {
+		log.Error().Err(err).Msg("Failed to dismiss write")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// ClearHistory starts deleting all of the user's statuses from their repo
+func (h *Handlers) ClearHistory(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "sid")
+	userDID, ok := session.Values["did"].(string)
+	if !ok || userDID == "" {
+		http.Error(w, "Error: Session required", http.StatusUnauthorized)
+		return
+	}
+
+	if h.requireRepoWrite(w, r, userDID, atproto.StatusCollection, atproto.ActionDelete) == nil {
+		return
+	}
+
+	if err := h.purger.Start(r.Context(), syntax.DID(userDID)); err != nil {
+		log.Error().Err(err).Msg("Failed to start clearing history")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// SyncHistory re-imports the user's status history and profile from their repo
+func (h *Handlers) SyncHistory(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "sid")
+	userDID, ok := session.Values["did"].(string)
+	if !ok || userDID == "" {
+		http.Error(w, "Error: Session required", http.StatusUnauthorized)
+		return
+	}
+
+	h.syncer.Request(syntax.DID(userDID))
+	h.profiles.Invalidate(userDID)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// ownStatus loads the status named by the {rkey} route variable from the
+// logged-in user's repo. It writes an error response and returns false if
+// there is no session or no such status.
+func (h *Handlers) ownStatus(w http.ResponseWriter, r *http.Request) (syntax.DID, *db.Status, bool) {
+	session, _ := h.store.Get(r, "sid")
+	userDID, ok := session.Values["did"].(string)
+	if !ok || userDID == "" {
+		http.Error(w, "Error: Session required", http.StatusUnauthorized)
+		return "", nil, false
+	}
+
+	rkey, err := syntax.ParseRecordKey(mux.Vars(r)["rkey"])
+	if err != nil {
+		http.Error(w, "Error: Invalid status", http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	// The URI is built from the viewer's own DID, so users can only touch their own statuses
+	uri := syntax.NewRecordURI(syntax.DID(userDID), atproto.StatusCollection, rkey)
+	status, err := h.db.GetStatus(r.Context(), uri)
+	if err != nil {
+		http.Error(w, "Error: Status not found", http.StatusNotFound)
+		return "", nil, false
+	}
+
+	return syntax.DID(userDID), status, true
+}
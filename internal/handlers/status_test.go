@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+func TestEditStatus(t *testing.T) {
+	app := newTestApp(t)
+	old := app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafyold", start)
+	app.pds.cids["3lbqsq6rwgc2a"] = "bafyold"
+
+	rec := app.post("/status/3lbqsq6rwgc2a/edit", form("status", "💙"), app.login(t, alice))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusFound, rec.Body)
+	}
+
+	calls := app.pds.Calls()
+	if len(calls) != 1 || calls[0].Method != "com.atproto.repo.putRecord" || calls[0].SwapRecord != "bafyold" {
+		t.Fatalf("PDS calls = %+v, want one putRecord swapping bafyold", calls)
+	}
+	if calls[0].Record.Status != "💙" || calls[0].Record.CreatedAt != old.CreatedAt.String() {
+		t.Errorf("record = %+v, want the new status with the original createdAt", calls[0].Record)
+	}
+
+	edited, err := app.store.GetStatus(context.Background(), old.URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Status != "💙" || edited.CID != "bafyedited" || edited.Rev != "3lrev00000002" || edited.CreatedAt != old.CreatedAt {
+		t.Errorf("stored status = %+v, want the edit with its new CID and rev", edited)
+	}
+}
+
+func TestDeleteStatus(t *testing.T) {
+	app := newTestApp(t)
+	old := app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafyold", start)
+	app.pds.cids["3lbqsq6rwgc2a"] = "bafyold"
+
+	rec := app.post("/status/3lbqsq6rwgc2a/delete", form(), app.login(t, alice))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusFound, rec.Body)
+	}
+
+	calls := app.pds.Calls()
+	if len(calls) != 1 || calls[0].Method != "com.atproto.repo.deleteRecord" || calls[0].SwapRecord != "bafyold" {
+		t.Errorf("PDS calls = %+v, want one deleteRecord swapping bafyold", calls)
+	}
+	if _, err := app.store.GetStatus(context.Background(), old.URI); err == nil {
+		t.Error("status still stored after deleting it")
+	}
+}
+
+// A status changed elsewhere since the page was loaded has a new CID, which
+// the PDS refuses to swap, so the stale edit or delete is not applied
+func TestStatusChangedElsewhere(t *testing.T) {
+	for _, action := range []string{"edit", "delete"} {
+		t.Run(action, func(t *testing.T) {
+			app := newTestApp(t)
+			old := app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafyold", start)
+			app.pds.cids["3lbqsq6rwgc2a"] = "bafynewer"
+
+			rec := app.post("/status/3lbqsq6rwgc2a/"+action, form("status", "💙"), app.login(t, alice))
+			if rec.Code != http.StatusConflict {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+			}
+			if s, err := app.store.GetStatus(context.Background(), old.URI); err != nil || *s != *old {
+				t.Errorf("stored status = %+v, %v, want it unchanged", s, err)
+			}
+		})
+	}
+}
+
+// The status URI is built from the viewer's DID, so another user's rkey
+// names a status the viewer does not have
+func TestOtherUsersStatus(t *testing.T) {
+	for _, action := range []string{"edit", "delete"} {
+		t.Run(action, func(t *testing.T) {
+			app := newTestApp(t)
+			theirs := app.store.save(bob, "3lbqsq6rwgc2b", "👍", "bafybob", start)
+
+			rec := app.post("/status/3lbqsq6rwgc2b/"+action, form("status", "💙"), app.login(t, alice))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+			}
+			if calls := app.pds.Calls(); len(calls) != 0 {
+				t.Errorf("PDS calls = %+v, want none", calls)
+			}
+			if s, err := app.store.GetStatus(context.Background(), theirs.URI); err != nil || *s != *theirs {
+				t.Errorf("their status = %+v, %v, want it unchanged", s, err)
+			}
+		})
+	}
+}
+
+func TestEditStatusInvalid(t *testing.T) {
+	app := newTestApp(t)
+	app.store.save(alice, "3lbqsq6rwgc2a", "👍", "bafyold", start)
+
+	rec := app.post("/status/3lbqsq6rwgc2a/edit", form("status", "👍👎"), app.login(t, alice))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if calls := app.pds.Calls(); len(calls) != 0 {
+		t.Errorf("PDS calls = %+v, want none", calls)
+	}
+}
+
+func TestDismissWrite(t *testing.T) {
+	app := newTestApp(t)
+	failed := syntax.NewRecordURI(alice, atproto.StatusCollection, "3lbqsq6rwgc2a")
+	pending := syntax.NewRecordURI(alice, atproto.StatusCollection, "3lbqsq6rwgc2b")
+	app.store.outbox[failed] = db.OutboxEntry{URI: failed, AuthorDID: alice, Status: "👍", State: db.OutboxFailed}
+	app.store.outbox[pending] = db.OutboxEntry{URI: pending, AuthorDID: alice, Status: "👎", State: db.OutboxPending}
+	cookies := app.login(t, alice)
+
+	for _, rkey := range []string{"3lbqsq6rwgc2a", "3lbqsq6rwgc2b"} {
+		if rec := app.post("/status/"+rkey+"/dismiss", form(), cookies); rec.Code != http.StatusFound {
+			t.Errorf("dismissing %s: status = %d, want %d", rkey, rec.Code, http.StatusFound)
+		}
+	}
+
+	if _, ok := app.store.outbox[failed]; ok {
+		t.Error("failed write was not dismissed")
+	}
+	if _, ok := app.store.outbox[pending]; !ok {
+		t.Error("pending write was dismissed while it may be in flight")
+	}
+}
@@ -0,0 +1,280 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// Default cache lifetimes, matching the MemoryCache used by the TypeScript app
+const (
+	DefaultFreshTTL = time.Hour
+	DefaultMaxTTL   = 24 * time.Hour
+)
+
+// lookupTimeout bounds a single network resolution, independent of the caller's context
+const lookupTimeout = 10 * time.Second
+
+// Store persists cached identities; *db.DB implements it
+type Store interface {
+	GetDidCache(ctx context.Context, did string) (*db.DidCache, error)
+	SaveDidCache(ctx context.Context, entry *db.DidCache) error
+	DeleteDidCache(ctx context.Context, did string) error
+	GetHandleCache(ctx context.Context, handle string) (*db.HandleCache, error)
+	SaveHandleCache(ctx context.Context, entry *db.HandleCache) error
+}
+
+// CacheStats counts cache lookups
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	StaleHits int64 `json:"staleHits"` // Hits served stale while a refresh runs in the background
+	Misses    int64 `json:"misses"`
+}
+
+// Cache is a persistent, stale-while-revalidate cache in front of a Resolver.
+// Entries younger than FreshTTL are served as is; entries up to MaxTTL old are
+// served while being refreshed in the background; older entries are resolved again.
+type Cache struct {
+	resolver *Resolver
+	store    Store
+	FreshTTL time.Duration
+	MaxTTL   time.Duration
+
+	group      singleflight.Group
+	refreshing sync.Map
+	now        func() time.Time
+
+	hits      atomic.Int64
+	staleHits atomic.Int64
+	misses    atomic.Int64
+}
+
+// NewCache creates a cache with the default lifetimes
+func NewCache(resolver *Resolver, store Store) *Cache {
+	return &Cache{
+		resolver: resolver,
+		store:    store,
+		FreshTTL: DefaultFreshTTL,
+		MaxTTL:   DefaultMaxTTL,
+		now:      time.Now,
+	}
+}
+
+// Stats returns the current hit and miss counters
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		StaleHits: c.staleHits.Load(),
+		Misses:    c.misses.Load(),
+	}
+}
+
+// errNotCached is returned by lookupCached for a DID with no usable cache entry
+var errNotCached = errors.New("identity not cached")
+
+// LookupDID returns the identity for a DID, from the cache where possible
+func (c *Cache) LookupDID(ctx context.Context, did string) (*Identity, error) {
+	if ident, ok := c.cached(ctx, did); ok {
+		return ident, nil
+	}
+
+	c.misses.Add(1)
+	return c.refreshDID(ctx, did)
+}
+
+// lookupCached returns the identity for a DID from the cache only. A DID that
+// is not cached, or cached too long ago, is resolved in the background instead.
+func (c *Cache) lookupCached(ctx context.Context, did string) (*Identity, error) {
+	if ident, ok := c.cached(ctx, did); ok {
+		return ident, nil
+	}
+
+	c.misses.Add(1)
+	c.refreshInBackground(did)
+	return nil, errNotCached
+}
+
+// cached returns the cached identity for a DID if it is younger than MaxTTL,
+// refreshing it in the background once it is older than FreshTTL
+func (c *Cache) cached(ctx context.Context, did string) (*Identity, bool) {
+	entry, err := c.store.GetDidCache(ctx, did)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Err(err).Str("did", did).Msg("Failed to read identity cache")
+	}
+	if entry == nil {
+		return nil, false
+	}
+
+	ident, age, err := c.decodeDidCache(entry)
+	if err != nil || age >= c.MaxTTL {
+		return nil, false
+	}
+	if age >= c.FreshTTL {
+		c.staleHits.Add(1)
+		c.refreshInBackground(did)
+	} else {
+		c.hits.Add(1)
+	}
+	return ident, true
+}
+
+// LookupHandle resolves a handle through the cache and verifies the DID claims it
+func (c *Cache) LookupHandle(ctx context.Context, handle string) (*Identity, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+
+	did, err := c.lookupHandleDID(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	ident, err := c.LookupDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if ident.Doc.Handle() != handle {
+		// A cached document that does not claim the handle may predate a
+		// handle change, so check the current one before giving up
+		if err := c.Invalidate(ctx, did); err != nil {
+			log.Warn().Err(err).Str("did", did).Msg("Failed to invalidate identity cache")
+		}
+		if ident, err = c.refreshDID(ctx, did); err != nil {
+			return nil, err
+		}
+	}
+	if ident.Doc.Handle() != handle {
+		return nil, fmt.Errorf("handle %q does not match DID document for %s", handle, did)
+	}
+
+	return &Identity{DID: did, Handle: handle, Doc: ident.Doc}, nil
+}
+
+// ResolveDIDsToHandles maps each DID to its verified handle for rendering.
+// Only the cache is consulted, so a page never waits on the network: DIDs not
+// cached map to themselves while they are resolved in the background, and
+// show their handle on a later render. DIDs that fail to resolve also map to
+// themselves.
+func (c *Cache) ResolveDIDsToHandles(ctx context.Context, dids []string) map[string]string {
+	return resolveDIDsToHandles(ctx, c.lookupCached, dids)
+}
+
+// Invalidate drops everything cached about a DID, so the next lookup resolves
+// it again. It is the entry point for identity changes seen on the network:
+// a firehose ingester should call it for each #identity event, and renders show
+// the new handle once the background resolution that follows completes.
+// LookupHandle also calls it when a handle resolves to a DID whose cached
+// document does not claim it, which is how a handle change shows up without
+// an ingester.
+func (c *Cache) Invalidate(ctx context.Context, did string) error {
+	c.group.Forget("did:" + did)
+	return c.store.DeleteDidCache(ctx, did)
+}
+
+// lookupHandleDID returns the DID a handle resolves to, from the cache where possible
+func (c *Cache) lookupHandleDID(ctx context.Context, handle string) (string, error) {
+	entry, err := c.store.GetHandleCache(ctx, handle)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Err(err).Str("handle", handle).Msg("Failed to read identity cache")
+	}
+	if entry != nil {
+		if updatedAt, err := time.Parse(time.RFC3339, entry.UpdatedAt); err == nil && c.now().Sub(updatedAt) < c.FreshTTL {
+			c.hits.Add(1)
+			return entry.DID, nil
+		}
+	}
+
+	c.misses.Add(1)
+	v, err, _ := c.group.Do("handle:"+handle, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lookupTimeout)
+		defer cancel()
+
+		did, err := c.resolver.Handles.ResolveHandle(ctx, handle)
+		if err != nil {
+			return "", err
+		}
+
+		err = c.store.SaveHandleCache(ctx, &db.HandleCache{
+			Handle:    handle,
+			DID:       did,
+			UpdatedAt: c.now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("handle", handle).Msg("Failed to write identity cache")
+		}
+		return did, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// refreshDID resolves a DID and stores the result, collapsing concurrent calls
+func (c *Cache) refreshDID(ctx context.Context, did string) (*Identity, error) {
+	v, err, _ := c.group.Do("did:"+did, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lookupTimeout)
+		defer cancel()
+
+		ident, err := c.resolver.LookupDID(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := json.Marshal(ident.Doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode DID document: %w", err)
+		}
+		err = c.store.SaveDidCache(ctx, &db.DidCache{
+			DID:       did,
+			Doc:       string(doc),
+			Handle:    ident.Handle,
+			UpdatedAt: c.now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("did", did).Msg("Failed to write identity cache")
+		}
+		return ident, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Identity), nil
+}
+
+// refreshInBackground refreshes a stale entry unless a refresh is already running
+func (c *Cache) refreshInBackground(did string) {
+	if _, running := c.refreshing.LoadOrStore(did, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer c.refreshing.Delete(did)
+		if _, err := c.refreshDID(context.Background(), did); err != nil {
+			log.Debug().Err(err).Str("did", did).Msg("Background identity refresh failed")
+		}
+	}()
+}
+
+// decodeDidCache decodes a cached entry and returns its age
+func (c *Cache) decodeDidCache(entry *db.DidCache) (*Identity, time.Duration, error) {
+	updatedAt, err := time.Parse(time.RFC3339, entry.UpdatedAt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var doc DIDDocument
+	if err := json.Unmarshal([]byte(entry.Doc), &doc); err != nil {
+		return nil, 0, err
+	}
+
+	return &Identity{DID: entry.DID, Handle: entry.Handle, Doc: &doc}, c.now().Sub(updatedAt), nil
+}
@@ -0,0 +1,270 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+)
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu      sync.Mutex
+	dids    map[string]db.DidCache
+	handles map[string]db.HandleCache
+}
+
+func newMemStore() *memStore {
+	return &memStore{dids: map[string]db.DidCache{}, handles: map[string]db.HandleCache{}}
+}
+
+func (m *memStore) GetDidCache(ctx context.Context, did string) (*db.DidCache, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.dids[did]
+	if !ok {
+		return nil, fmt.Errorf("failed to get did cache: %w", sql.ErrNoRows)
+	}
+	return &entry, nil
+}
+
+func (m *memStore) SaveDidCache(ctx context.Context, entry *db.DidCache) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dids[entry.DID] = *entry
+	return nil
+}
+
+func (m *memStore) DeleteDidCache(ctx context.Context, did string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dids, did)
+	for handle, entry := range m.handles {
+		if entry.DID == did {
+			delete(m.handles, handle)
+		}
+	}
+	return nil
+}
+
+func (m *memStore) GetHandleCache(ctx context.Context, handle string) (*db.HandleCache, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.handles[handle]
+	if !ok {
+		return nil, fmt.Errorf("failed to get handle cache: %w", sql.ErrNoRows)
+	}
+	return &entry, nil
+}
+
+func (m *memStore) SaveHandleCache(ctx context.Context, entry *db.HandleCache) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handles[entry.Handle] = *entry
+	return nil
+}
+
+// countingDIDs counts resolutions and can block them until released
+type countingDIDs struct {
+	fakeDIDs
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (c *countingDIDs) ResolveDID(ctx context.Context, did string) (*DIDDocument, error) {
+	c.calls.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+	return c.fakeDIDs.ResolveDID(ctx, did)
+}
+
+// testClock is a settable clock that is safe to read from background refreshes
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestCache() (*Cache, *countingDIDs, *testClock) {
+	dids := &countingDIDs{fakeDIDs: fakeDIDs{"did:plc:alice": doc("did:plc:alice", "alice.test")}}
+	resolver := &Resolver{Handles: fakeHandles{"alice.test": "did:plc:alice"}, DIDs: dids}
+
+	clock := &testClock{now: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+	cache := NewCache(resolver, newMemStore())
+	cache.now = clock.Now
+	return cache, dids, clock
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	cache, dids, _ := newTestCache()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		ident, err := cache.LookupDID(ctx, "did:plc:alice")
+		if err != nil {
+			t.Fatalf("LookupDID() error = %v", err)
+		}
+		if ident.Handle != "alice.test" {
+			t.Errorf("LookupDID().Handle = %v, want alice.test", ident.Handle)
+		}
+	}
+
+	if got := dids.calls.Load(); got != 1 {
+		t.Errorf("resolver called %d times, want 1", got)
+	}
+	if got := cache.Stats(); got.Hits != 2 || got.Misses != 1 {
+		t.Errorf("Stats() = %+v, want 2 hits and 1 miss", got)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	cache, dids, clock := newTestCache()
+	ctx := context.Background()
+
+	if _, err := cache.LookupDID(ctx, "did:plc:alice"); err != nil {
+		t.Fatalf("LookupDID() error = %v", err)
+	}
+
+	// Stale entries are served immediately and refreshed in the background
+	clock.Advance(DefaultFreshTTL + time.Minute)
+	if _, err := cache.LookupDID(ctx, "did:plc:alice"); err != nil {
+		t.Fatalf("LookupDID() error = %v", err)
+	}
+	if got := cache.Stats().StaleHits; got != 1 {
+		t.Errorf("Stats().StaleHits = %d, want 1", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, running := cache.refreshing.Load("did:plc:alice"); !running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := dids.calls.Load(); got != 2 {
+		t.Errorf("resolver called %d times, want 2", got)
+	}
+
+	// Expired entries are resolved again synchronously
+	clock.Advance(DefaultMaxTTL)
+	if _, err := cache.LookupDID(ctx, "did:plc:alice"); err != nil {
+		t.Fatalf("LookupDID() error = %v", err)
+	}
+	if got := cache.Stats().Misses; got != 2 {
+		t.Errorf("Stats().Misses = %d, want 2", got)
+	}
+}
+
+func TestCacheCollapsesConcurrentLookups(t *testing.T) {
+	cache, dids, _ := newTestCache()
+	dids.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.LookupDID(context.Background(), "did:plc:alice"); err != nil {
+				t.Errorf("LookupDID() error = %v", err)
+			}
+		}()
+	}
+
+	// Let the lookups pile up behind the first resolution
+	time.Sleep(50 * time.Millisecond)
+	close(dids.release)
+	wg.Wait()
+
+	if got := dids.calls.Load(); got != 1 {
+		t.Errorf("resolver called %d times, want 1", got)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache, dids, _ := newTestCache()
+	ctx := context.Background()
+
+	if _, err := cache.LookupHandle(ctx, "alice.test"); err != nil {
+		t.Fatalf("LookupHandle() error = %v", err)
+	}
+	if err := cache.Invalidate(context.Background(), "did:plc:alice"); err != nil {
+		t.Fatalf("Invalidate() error = %v", err)
+	}
+	if _, err := cache.LookupDID(ctx, "did:plc:alice"); err != nil {
+		t.Fatalf("LookupDID() error = %v", err)
+	}
+
+	if got := dids.calls.Load(); got != 2 {
+		t.Errorf("resolver called %d times, want 2", got)
+	}
+}
+
+func TestCacheSeesHandleChange(t *testing.T) {
+	cache, dids, _ := newTestCache()
+	handles := cache.resolver.Handles.(fakeHandles)
+	ctx := context.Background()
+
+	if _, err := cache.LookupHandle(ctx, "alice.test"); err != nil {
+		t.Fatalf("LookupHandle() error = %v", err)
+	}
+
+	// Alice moves to a new handle while her old document is still cached
+	handles["alice.example"] = "did:plc:alice"
+	dids.fakeDIDs["did:plc:alice"] = doc("did:plc:alice", "alice.example")
+
+	ident, err := cache.LookupHandle(ctx, "alice.example")
+	if err != nil {
+		t.Fatalf("LookupHandle(new handle) error = %v", err)
+	}
+	if ident.DID != "did:plc:alice" {
+		t.Errorf("LookupHandle(new handle).DID = %v, want did:plc:alice", ident.DID)
+	}
+	if got, err := cache.LookupDID(ctx, "did:plc:alice"); err != nil || got.Handle != "alice.example" {
+		t.Errorf("LookupDID() = %+v, %v, want the new handle cached", got, err)
+	}
+}
+
+func TestCacheResolveDIDsToHandlesDoesNotWait(t *testing.T) {
+	cache, dids, _ := newTestCache()
+	dids.release = make(chan struct{})
+	ctx := context.Background()
+
+	// A miss renders as the DID while it resolves in the background
+	got := cache.ResolveDIDsToHandles(ctx, []string{"did:plc:alice"})
+	if got["did:plc:alice"] != "did:plc:alice" {
+		t.Errorf("ResolveDIDsToHandles() on a miss = %v, want the DID", got)
+	}
+	close(dids.release)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, running := cache.refreshing.Load("did:plc:alice"); !running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	got = cache.ResolveDIDsToHandles(ctx, []string{"did:plc:alice"})
+	if got["did:plc:alice"] != "alice.test" {
+		t.Errorf("ResolveDIDsToHandles() after the background lookup = %v, want the handle", got)
+	}
+	if got := dids.calls.Load(); got != 1 {
+		t.Errorf("resolver called %d times, want 1", got)
+	}
+}
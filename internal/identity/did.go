@@ -0,0 +1,127 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultPLCURL is the public did:plc directory
+const DefaultPLCURL = "https://plc.directory"
+
+// maxDocumentSize bounds how much of a DID document response is read
+const maxDocumentSize = 1 << 20
+
+// ErrDIDNotFound is returned when a DID has no document
+var ErrDIDNotFound = errors.New("DID not found")
+
+// DIDDocument is the subset of a DID document used by atproto
+type DIDDocument struct {
+	ID          string    `json:"id"`
+	AlsoKnownAs []string  `json:"alsoKnownAs,omitempty"`
+	Service     []Service `json:"service,omitempty"`
+}
+
+// Service is a service entry in a DID document
+type Service struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+// Handle returns the handle the document claims, or "" if it has none.
+// The claim must still be verified against the handle's own resolution.
+func (d *DIDDocument) Handle() string {
+	for _, aka := range d.AlsoKnownAs {
+		if handle, ok := strings.CutPrefix(aka, "at://"); ok && handle != "" {
+			return strings.ToLower(handle)
+		}
+	}
+	return ""
+}
+
+// PDSEndpoint returns the URL of the account's PDS, or "" if it has none
+func (d *DIDDocument) PDSEndpoint() string {
+	for _, svc := range d.Service {
+		if (svc.ID == "#atproto_pds" || svc.ID == d.ID+"#atproto_pds") && svc.Type == "AtprotoPersonalDataServer" {
+			return svc.ServiceEndpoint
+		}
+	}
+	return ""
+}
+
+// DIDResolver resolves DIDs to their documents
+type DIDResolver interface {
+	ResolveDID(ctx context.Context, did string) (*DIDDocument, error)
+}
+
+// DefaultDIDResolver resolves did:plc through a PLC directory and did:web over HTTPS
+type DefaultDIDResolver struct {
+	PLCURL     string       // PLC directory URL; defaults to DefaultPLCURL
+	HTTPClient *http.Client // Defaults to http.DefaultClient
+}
+
+// ResolveDID fetches and checks the document for a did:plc or did:web DID
+func (r *DefaultDIDResolver) ResolveDID(ctx context.Context, did string) (*DIDDocument, error) {
+	var docURL string
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		plcURL := r.PLCURL
+		if plcURL == "" {
+			plcURL = DefaultPLCURL
+		}
+		docURL = strings.TrimSuffix(plcURL, "/") + "/" + did
+	case strings.HasPrefix(did, "did:web:"):
+		// atproto only allows hostname did:web DIDs, without paths
+		raw := strings.TrimPrefix(did, "did:web:")
+		host, err := url.PathUnescape(raw)
+		if err != nil || host == "" || strings.Contains(raw, ":") || strings.Contains(host, "/") {
+			return nil, fmt.Errorf("unsupported did:web %q", did)
+		}
+		docURL = "https://" + host + "/.well-known/did.json"
+	default:
+		return nil, fmt.Errorf("unsupported DID method: %q", did)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, docURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DID request: %w", err)
+	}
+	req.Header.Set("Accept", "application/did+ld+json, application/json")
+
+	resp, err := httpClient(r.HTTPClient).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch DID document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("%w: %s", ErrDIDNotFound, did)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch DID document: status %d", resp.StatusCode)
+	}
+
+	var doc DIDDocument
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode DID document: %w", err)
+	}
+	if doc.ID != did {
+		return nil, fmt.Errorf("DID document id %q does not match %q", doc.ID, did)
+	}
+
+	return &doc, nil
+}
+
+// httpClient returns c, or the default client if c is nil
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
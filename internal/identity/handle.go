@@ -0,0 +1,129 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrHandleNotFound is returned when a handle does not resolve to any DID
+var ErrHandleNotFound = errors.New("handle not found")
+
+// HandleResolver resolves handles to DIDs
+type HandleResolver interface {
+	ResolveHandle(ctx context.Context, handle string) (string, error)
+}
+
+// TXTResolver looks up DNS TXT records; *net.Resolver satisfies it
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DefaultHandleResolver resolves handles through DNS TXT records, falling back to HTTPS
+type DefaultHandleResolver struct {
+	TXT        TXTResolver  // Defaults to net.DefaultResolver
+	HTTPClient *http.Client // Defaults to http.DefaultClient
+}
+
+// ResolveHandle returns the DID a handle claims, via _atproto TXT or /.well-known/atproto-did
+func (r *DefaultHandleResolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimSpace(handle))
+	if !looksLikeHandle(handle) {
+		return "", fmt.Errorf("invalid handle %q", handle)
+	}
+
+	did, dnsErr := r.resolveDNS(ctx, handle)
+	if dnsErr == nil {
+		return did, nil
+	}
+
+	did, httpErr := r.resolveHTTPS(ctx, handle)
+	if httpErr == nil {
+		return did, nil
+	}
+
+	return "", fmt.Errorf("%w: %s (dns: %v, https: %v)", ErrHandleNotFound, handle, dnsErr, httpErr)
+}
+
+// resolveDNS reads the did= value from the handle's _atproto TXT record
+func (r *DefaultHandleResolver) resolveDNS(ctx context.Context, handle string) (string, error) {
+	var txt TXTResolver = net.DefaultResolver
+	if r.TXT != nil {
+		txt = r.TXT
+	}
+
+	records, err := txt.LookupTXT(ctx, "_atproto."+handle)
+	if err != nil {
+		return "", err
+	}
+
+	var found string
+	for _, record := range records {
+		did, ok := strings.CutPrefix(strings.TrimSpace(record), "did=")
+		if !ok {
+			continue
+		}
+		if found != "" && found != did {
+			return "", errors.New("conflicting _atproto TXT records")
+		}
+		found = did
+	}
+	if !strings.HasPrefix(found, "did:") {
+		return "", errors.New("no _atproto TXT record")
+	}
+
+	return found, nil
+}
+
+// resolveHTTPS reads the DID served at https://<handle>/.well-known/atproto-did
+func (r *DefaultHandleResolver) resolveHTTPS(ctx context.Context, handle string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+handle+"/.well-known/atproto-did", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient(r.HTTPClient).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	// A DID is short; anything much longer is not a valid response
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if err != nil {
+		return "", err
+	}
+
+	did := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(did, "did:") || strings.ContainsAny(did, " \n") {
+		return "", errors.New("invalid atproto-did response")
+	}
+
+	return did, nil
+}
+
+// looksLikeHandle does a cheap syntax check before any network lookups
+func looksLikeHandle(handle string) bool {
+	if len(handle) > 253 || !strings.Contains(handle, ".") {
+		return false
+	}
+	for _, label := range strings.Split(handle, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeHandles resolves handles from a map
+type fakeHandles map[string]string
+
+func (f fakeHandles) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	if did, ok := f[handle]; ok {
+		return did, nil
+	}
+	return "", ErrHandleNotFound
+}
+
+// fakeDIDs resolves DID documents from a map
+type fakeDIDs map[string]*DIDDocument
+
+func (f fakeDIDs) ResolveDID(ctx context.Context, did string) (*DIDDocument, error) {
+	if doc, ok := f[did]; ok {
+		return doc, nil
+	}
+	return nil, ErrDIDNotFound
+}
+
+// fakeTXT serves TXT records from a map
+type fakeTXT map[string][]string
+
+func (f fakeTXT) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := f[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func doc(did, handle string) *DIDDocument {
+	return &DIDDocument{ID: did, AlsoKnownAs: []string{"at://" + handle}}
+}
+
+func testResolver() *Resolver {
+	return &Resolver{
+		Handles: fakeHandles{
+			"alice.test": "did:plc:alice",
+			"bob.test":   "did:plc:someone-else",
+		},
+		DIDs: fakeDIDs{
+			"did:plc:alice": doc("did:plc:alice", "alice.test"),
+			"did:plc:bob":   doc("did:plc:bob", "bob.test"),
+			"did:plc:carol": {ID: "did:plc:carol"},
+		},
+	}
+}
+
+func TestResolveDIDToHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		did     string
+		want    string
+		wantErr bool
+	}{
+		{name: "verified", did: "did:plc:alice", want: "alice.test"},
+		{name: "handle points elsewhere", did: "did:plc:bob", want: "did:plc:bob"},
+		{name: "no handle claimed", did: "did:plc:carol", want: "did:plc:carol"},
+		{name: "unknown DID", did: "did:plc:nobody", want: "did:plc:nobody", wantErr: true},
+	}
+
+	r := testResolver()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ResolveDIDToHandle(context.Background(), tt.did)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveDIDToHandle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveDIDToHandle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDIDsToHandles(t *testing.T) {
+	r := testResolver()
+	got := r.ResolveDIDsToHandles(context.Background(), []string{
+		"did:plc:alice", "did:plc:bob", "did:plc:alice", "did:plc:nobody",
+	})
+
+	want := map[string]string{
+		"did:plc:alice":  "alice.test",
+		"did:plc:bob":    "did:plc:bob",
+		"did:plc:nobody": "did:plc:nobody",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ResolveDIDsToHandles() = %v, want %v", got, want)
+	}
+	for did, handle := range want {
+		if got[did] != handle {
+			t.Errorf("ResolveDIDsToHandles()[%s] = %v, want %v", did, got[did], handle)
+		}
+	}
+}
+
+func TestLookupHandle(t *testing.T) {
+	r := testResolver()
+
+	ident, err := r.LookupHandle(context.Background(), "@Alice.test")
+	if err != nil {
+		t.Fatalf("LookupHandle() error = %v", err)
+	}
+	if ident.DID != "did:plc:alice" || ident.Handle != "alice.test" {
+		t.Errorf("LookupHandle() = %+v", ident)
+	}
+
+	if _, err := r.LookupHandle(context.Background(), "bob.test"); err == nil {
+		t.Errorf("LookupHandle() accepted a handle whose DID does not claim it")
+	}
+}
+
+func TestDefaultHandleResolver(t *testing.T) {
+	// Every HTTPS request is routed to this server, whatever the host
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "web.test" && r.URL.Path == "/.well-known/atproto-did" {
+			w.Write([]byte("did:plc:web\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return net.Dial(network, srv.Listener.Addr().String())
+	}
+
+	r := &DefaultHandleResolver{
+		TXT: fakeTXT{
+			"_atproto.dns.test":      {"did=did:plc:dns"},
+			"_atproto.conflict.test": {"did=did:plc:a", "did=did:plc:b"},
+		},
+		HTTPClient: client,
+	}
+
+	tests := []struct {
+		name    string
+		handle  string
+		want    string
+		wantErr bool
+	}{
+		{name: "dns", handle: "dns.test", want: "did:plc:dns"},
+		{name: "https fallback", handle: "web.test", want: "did:plc:web"},
+		{name: "conflicting records", handle: "conflict.test", wantErr: true},
+		{name: "not found", handle: "missing.test", wantErr: true},
+		{name: "invalid syntax", handle: "not_a_handle", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ResolveHandle(context.Background(), tt.handle)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveHandle() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveHandle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultDIDResolver(t *testing.T) {
+	plc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/did:plc:alice":
+			json.NewEncoder(w).Encode(&DIDDocument{
+				ID:          "did:plc:alice",
+				AlsoKnownAs: []string{"at://alice.test"},
+				Service: []Service{{
+					ID:              "#atproto_pds",
+					Type:            "AtprotoPersonalDataServer",
+					ServiceEndpoint: "https://pds.test",
+				}},
+			})
+		case "/did:plc:mismatch":
+			json.NewEncoder(w).Encode(&DIDDocument{ID: "did:plc:other"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer plc.Close()
+
+	r := &DefaultDIDResolver{PLCURL: plc.URL, HTTPClient: plc.Client()}
+
+	doc, err := r.ResolveDID(context.Background(), "did:plc:alice")
+	if err != nil {
+		t.Fatalf("ResolveDID() error = %v", err)
+	}
+	if doc.Handle() != "alice.test" || doc.PDSEndpoint() != "https://pds.test" {
+		t.Errorf("ResolveDID() = %+v", doc)
+	}
+
+	if _, err := r.ResolveDID(context.Background(), "did:plc:missing"); !errors.Is(err, ErrDIDNotFound) {
+		t.Errorf("ResolveDID() error = %v, want ErrDIDNotFound", err)
+	}
+	if _, err := r.ResolveDID(context.Background(), "did:plc:mismatch"); err == nil {
+		t.Errorf("ResolveDID() accepted a document for a different DID")
+	}
+	if _, err := r.ResolveDID(context.Background(), "did:web:example.com:user"); err == nil {
+		t.Errorf("ResolveDID() accepted a did:web with a path")
+	}
+	if _, err := r.ResolveDID(context.Background(), "did:key:z6Mk"); err == nil {
+		t.Errorf("ResolveDID() accepted an unsupported method")
+	}
+}
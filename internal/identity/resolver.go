@@ -0,0 +1,141 @@
+// Package identity resolves atproto handles and DIDs, verifying that each points at the other
+package identity
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchConcurrency bounds the number of lookups a batch runs at once
+const batchConcurrency = 8
+
+// Identity is a DID together with its verified handle
+type Identity struct {
+	DID    string
+	Handle string // Empty if the document's handle claim did not verify
+	Doc    *DIDDocument
+}
+
+// Directory looks up verified identities; implemented by Resolver and Cache
+type Directory interface {
+	LookupDID(ctx context.Context, did string) (*Identity, error)
+	LookupHandle(ctx context.Context, handle string) (*Identity, error)
+	ResolveDIDsToHandles(ctx context.Context, dids []string) map[string]string
+}
+
+// Resolver performs bidirectional identity resolution
+type Resolver struct {
+	Handles HandleResolver
+	DIDs    DIDResolver
+}
+
+// NewResolver creates a resolver using DNS, HTTPS and the given PLC directory
+func NewResolver(plcURL string) *Resolver {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &Resolver{
+		Handles: &DefaultHandleResolver{HTTPClient: client},
+		DIDs:    &DefaultDIDResolver{PLCURL: plcURL, HTTPClient: client},
+	}
+}
+
+// LookupDID resolves a DID document and verifies the handle it claims
+func (r *Resolver) LookupDID(ctx context.Context, did string) (*Identity, error) {
+	doc, err := r.DIDs.ResolveDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+
+	ident := &Identity{DID: did, Doc: doc}
+	if handle := doc.Handle(); handle != "" {
+		resolved, err := r.Handles.ResolveHandle(ctx, handle)
+		if err == nil && resolved == did {
+			ident.Handle = handle
+		}
+	}
+
+	return ident, nil
+}
+
+// LookupHandle resolves a handle to a DID and verifies the DID document claims the handle
+func (r *Resolver) LookupHandle(ctx context.Context, handle string) (*Identity, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+
+	did, err := r.Handles.ResolveHandle(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := r.DIDs.ResolveDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Handle() != handle {
+		return nil, fmt.Errorf("handle %q does not match DID document for %s", handle, did)
+	}
+
+	return &Identity{DID: did, Handle: handle, Doc: doc}, nil
+}
+
+// ResolveDIDToHandle returns the verified handle for a DID, or the DID itself if there is none
+func (r *Resolver) ResolveDIDToHandle(ctx context.Context, did string) (string, error) {
+	return resolveDIDToHandle(ctx, r.LookupDID, did)
+}
+
+// ResolveDIDsToHandles maps each DID to its verified handle for rendering.
+// DIDs that fail to resolve map to themselves.
+func (r *Resolver) ResolveDIDsToHandles(ctx context.Context, dids []string) map[string]string {
+	return resolveDIDsToHandles(ctx, r.LookupDID, dids)
+}
+
+// lookupFunc resolves a DID to an identity
+type lookupFunc func(ctx context.Context, did string) (*Identity, error)
+
+// resolveDIDToHandle returns the verified handle found by lookup, falling back to the DID
+func resolveDIDToHandle(ctx context.Context, lookup lookupFunc, did string) (string, error) {
+	ident, err := lookup(ctx, did)
+	if err != nil {
+		return did, err
+	}
+	if ident.Handle == "" {
+		return did, nil
+	}
+	return ident.Handle, nil
+}
+
+// resolveDIDsToHandles resolves a batch of DIDs concurrently
+func resolveDIDsToHandles(ctx context.Context, lookup lookupFunc, dids []string) map[string]string {
+	result := make(map[string]string, len(dids))
+	var unique []string
+	for _, did := range dids {
+		if _, seen := result[did]; !seen {
+			result[did] = did
+			unique = append(unique, did)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchConcurrency)
+
+	for _, did := range unique {
+		wg.Add(1)
+		go func(did string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			handle, _ := resolveDIDToHandle(ctx, lookup, did)
+
+			mu.Lock()
+			result[did] = handle
+			mu.Unlock()
+		}(did)
+	}
+
+	wg.Wait()
+	return result
+}
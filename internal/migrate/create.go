@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// versioned matches any file in a migrations directory that carries a version
+var versioned = regexp.MustCompile(`^(\d+)_`)
+
+// separators are runs of characters not allowed in migration names
+var separators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// goTemplate is the skeleton of a new Go migration. Go migrations register
+// themselves with the package that embeds the SQL ones.
+const goTemplate = `package %s
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/referendumApp/statusphere-example-app-go/internal/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version:  %d,
+		Name:     %q,
+		Revision: 1, // Bump whenever UpFunc changes
+		UpFunc: func(tx *sqlx.Tx) error {
+			return nil
+		},
+		DownFunc: func(tx *sqlx.Tx) error {
+			return nil
+		},
+	})
+}
+`
+
+// NextVersion returns the version after the highest one used in any of the
+// given migration directories, so a change made to several schemas at once
+// gets the same number in each
+func NextVersion(dirs ...string) (int, error) {
+	latest := 0
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		for _, entry := range entries {
+			if match := versioned.FindStringSubmatch(entry.Name()); match != nil {
+				version, _ := strconv.Atoi(match[1])
+				latest = max(latest, version)
+			}
+		}
+	}
+	return latest + 1, nil
+}
+
+// Create writes empty files for a new migration in dir and returns their paths
+func Create(dir string, version int, name string, goMigration bool) ([]string, error) {
+	name = strings.Trim(separators.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, fmt.Errorf("migration name is required")
+	}
+	prefix := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+
+	files := map[string]string{
+		prefix + ".up.sql":   "",
+		prefix + ".down.sql": "",
+	}
+	if goMigration {
+		files = map[string]string{
+			prefix + ".go": fmt.Sprintf(goTemplate, filepath.Base(dir), version, name),
+		}
+	}
+
+	var paths []string
+	for path, content := range files {
+		// O_EXCL so a concurrent create never overwrites a migration
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return paths, fmt.Errorf("failed to create migration: %w", err)
+		}
+		_, err = f.WriteString(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, fmt.Errorf("failed to write migration: %w", err)
+		}
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
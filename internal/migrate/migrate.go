@@ -0,0 +1,357 @@
+// Package migrate applies numbered schema migrations and records them in a
+// schema_migrations table. Migrations are SQL files named
+// NNNN_name.up.sql and NNNN_name.down.sql, or Go functions for changes SQL
+// alone cannot express. Each one runs in its own transaction.
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrDrift is returned when an applied migration no longer matches its source
+	ErrDrift = errors.New("applied migration has changed since it was run")
+
+	// ErrUnknownVersion is returned when the database has a migration this build does not know
+	ErrUnknownVersion = errors.New("database has migrations this build does not know about")
+
+	// ErrIrreversible is returned when rolling back a migration without a down step
+	ErrIrreversible = errors.New("migration has no down step")
+)
+
+// Migration is one step in the schema's history. Either the SQL or the func
+// form of each direction is set; a migration without a down step cannot be
+// rolled back.
+type Migration struct {
+	Version  int
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	UpFunc   func(tx *sqlx.Tx) error
+	DownFunc func(tx *sqlx.Tx) error
+
+	// Revision stands in for a checksum of UpFunc, which has no source to
+	// fingerprint. Bump it by hand whenever UpFunc changes.
+	Revision int
+}
+
+// Checksum fingerprints the up step, so edits to an applied migration are
+// noticed. Go migrations are fingerprinted by their Revision; revision 0
+// checksums as "", as Go migrations did before revisions were recorded.
+func (m *Migration) Checksum() string {
+	if m.UpFunc != nil {
+		if m.Revision == 0 {
+			return ""
+		}
+		return "revision:" + strconv.Itoa(m.Revision)
+	}
+	// Line endings depend on the checkout, not on the migration
+	sum := sha256.Sum256([]byte(strings.ReplaceAll(m.UpSQL, "\r\n", "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+func (m *Migration) up(tx *sqlx.Tx) error {
+	if m.UpFunc != nil {
+		return m.UpFunc(tx)
+	}
+	_, err := tx.Exec(m.UpSQL)
+	return err
+}
+
+func (m *Migration) down(tx *sqlx.Tx) error {
+	if m.DownFunc != nil {
+		return m.DownFunc(tx)
+	}
+	if strings.TrimSpace(m.DownSQL) == "" {
+		return ErrIrreversible
+	}
+	_, err := tx.Exec(m.DownSQL)
+	return err
+}
+
+// fileName matches migration files, capturing the version, name and direction
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Load reads the SQL migrations in the root of fsys, adds the given Go
+// migrations and returns them all in version order
+func Load(fsys fs.FS, goMigrations ...Migration) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	hasUp := make(map[int]bool)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+		if match[3] == "up" {
+			m.UpSQL = string(data)
+			hasUp[version] = true
+		} else {
+			m.DownSQL = string(data)
+		}
+	}
+
+	for _, m := range byVersion {
+		if !hasUp[m.Version] {
+			return nil, fmt.Errorf("migration %s has no up file", m)
+		}
+	}
+
+	for _, g := range goMigrations {
+		if g.Version <= 0 || g.UpFunc == nil {
+			return nil, fmt.Errorf("invalid Go migration %s", &g)
+		}
+		if _, ok := byVersion[g.Version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d", g.Version)
+		}
+		byVersion[g.Version] = &g
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// State describes one migration as seen from the database
+type State struct {
+	Version   int
+	Name      string
+	AppliedAt string // Empty if pending
+	Drifted   bool   // Applied, but its source has changed since
+	ByHand    bool   // A Go migration, whose changes are only noticed if its Revision is bumped
+	Unknown   bool   // Applied, but not part of this build
+}
+
+// applied is a row of schema_migrations
+type applied struct {
+	Version   int    `db:"version"`
+	Name      string `db:"name"`
+	Checksum  string `db:"checksum"`
+	AppliedAt string `db:"appliedAt"`
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+	now        func() time.Time
+}
+
+// New creates a migrator for a list of migrations in version order, as returned by Load
+func New(db *sqlx.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations, now: time.Now}
+}
+
+// init creates the table that records applied migrations
+func (m *Migrator) init() error {
+	_, err := m.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		appliedAt TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied() (map[int]applied, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	var rows []applied
+	if err := m.db.Select(&rows, `SELECT * FROM schema_migrations`); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	byVersion := make(map[int]applied, len(rows))
+	for _, row := range rows {
+		byVersion[row.Version] = row
+	}
+	return byVersion, nil
+}
+
+// Status lists every known or applied migration in version order
+func (m *Migrator) Status() ([]State, error) {
+	done, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []State
+	for _, migration := range m.migrations {
+		state := State{Version: migration.Version, Name: migration.Name, ByHand: migration.UpFunc != nil}
+		if row, ok := done[migration.Version]; ok {
+			state.AppliedAt = row.AppliedAt
+			state.Drifted = row.Checksum != migration.Checksum()
+			delete(done, migration.Version)
+		}
+		states = append(states, state)
+	}
+	for _, row := range done {
+		states = append(states, State{Version: row.Version, Name: row.Name, AppliedAt: row.AppliedAt, Unknown: true})
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// check refuses to migrate a database whose history disagrees with this build
+func check(states []State) error {
+	for _, state := range states {
+		switch {
+		case state.Drifted:
+			return fmt.Errorf("%w: %04d_%s", ErrDrift, state.Version, state.Name)
+		case state.Unknown:
+			return fmt.Errorf("%w: %04d_%s", ErrUnknownVersion, state.Version, state.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies pending migrations up to and including target, or all of them
+// if target is 0. It returns the number applied.
+func (m *Migrator) Up(target int) (int, error) {
+	states, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	if err := check(states); err != nil {
+		return 0, err
+	}
+
+	pending := make(map[int]bool)
+	for _, state := range states {
+		if state.AppliedAt == "" {
+			pending[state.Version] = true
+		}
+	}
+
+	count := 0
+	for i := range m.migrations {
+		migration := &m.migrations[i]
+		if target != 0 && migration.Version > target {
+			break
+		}
+		if !pending[migration.Version] {
+			continue
+		}
+
+		err := m.inTx(func(tx *sqlx.Tx) error {
+			if err := migration.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(
+				tx.Rebind(`INSERT INTO schema_migrations (version, name, checksum, appliedAt) VALUES (?, ?, ?, ?)`),
+				migration.Version, migration.Name, migration.Checksum(), m.now().UTC().Format(time.RFC3339),
+			)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to apply migration %s: %w", migration, err)
+		}
+
+		log.Info().Str("migration", migration.String()).Msg("Applied migration")
+		count++
+	}
+
+	return count, nil
+}
+
+// Down rolls back the given number of most recently applied migrations and
+// returns the number rolled back
+func (m *Migrator) Down(steps int) (int, error) {
+	states, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	if err := check(states); err != nil {
+		return 0, err
+	}
+
+	byVersion := make(map[int]*Migration, len(m.migrations))
+	for i := range m.migrations {
+		byVersion[m.migrations[i].Version] = &m.migrations[i]
+	}
+
+	count := 0
+	for i := len(states) - 1; i >= 0 && count < steps; i-- {
+		if states[i].AppliedAt == "" {
+			continue
+		}
+		migration := byVersion[states[i].Version]
+
+		err := m.inTx(func(tx *sqlx.Tx) error {
+			if err := migration.down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(tx.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), migration.Version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to roll back migration %s: %w", migration, err)
+		}
+
+		log.Info().Str("migration", migration.String()).Msg("Rolled back migration")
+		count++
+	}
+
+	return count, nil
+}
+
+func (m *Migrator) inTx(fn func(tx *sqlx.Tx) error) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,306 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_things.up.sql":   {Data: []byte("CREATE TABLE things (id INTEGER PRIMARY KEY);")},
+		"0001_things.down.sql": {Data: []byte("DROP TABLE things;")},
+		"0003_index.up.sql":    {Data: []byte("CREATE INDEX things_name ON things (name);")},
+		"0003_index.down.sql":  {Data: []byte("DROP INDEX things_name;")},
+		"README.md":            {Data: []byte("not a migration")},
+	}
+}
+
+// addName is a Go migration between the two SQL ones
+var addName = Migration{
+	Version: 2,
+	Name:    "add_name",
+	UpFunc: func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE things ADD COLUMN name TEXT NOT NULL DEFAULT ''`)
+		return err
+	},
+	DownFunc: func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE things DROP COLUMN name`)
+		return err
+	},
+}
+
+func load(t *testing.T, fsys fstest.MapFS) []Migration {
+	t.Helper()
+	migrations, err := Load(fsys, addName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations
+}
+
+func appliedVersions(t *testing.T, m *Migrator) []int {
+	t.Helper()
+	states, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int
+	for _, state := range states {
+		if state.AppliedAt != "" {
+			versions = append(versions, state.Version)
+		}
+	}
+	return versions
+}
+
+func TestLoad(t *testing.T) {
+	migrations := load(t, testFS())
+
+	if len(migrations) != 3 {
+		t.Fatalf("loaded %d migrations, want 3", len(migrations))
+	}
+	for i, want := range []string{"0001_things", "0002_add_name", "0003_index"} {
+		if got := migrations[i].String(); got != want {
+			t.Errorf("migration %d = %s, want %s", i, got, want)
+		}
+	}
+	if migrations[0].Checksum() == "" || migrations[1].Checksum() != "" {
+		t.Error("want checksums for SQL migrations, and none for Go migrations without a revision")
+	}
+
+	revised := migrations[1]
+	revised.Revision = 2
+	if revised.Checksum() == "" || revised.Checksum() == migrations[1].Checksum() {
+		t.Error("bumping a Go migration's revision did not change its checksum")
+	}
+
+	crlf := Migration{UpSQL: "CREATE TABLE things (id INTEGER PRIMARY KEY);\r\n"}
+	lf := Migration{UpSQL: "CREATE TABLE things (id INTEGER PRIMARY KEY);\n"}
+	if crlf.Checksum() != lf.Checksum() {
+		t.Error("line endings changed the checksum")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "missing up file",
+			fsys: fstest.MapFS{"0001_things.down.sql": {Data: []byte("DROP TABLE things;")}},
+		},
+		{
+			name: "mismatched names",
+			fsys: fstest.MapFS{
+				"0001_things.up.sql":  {Data: []byte("CREATE TABLE things (id INTEGER);")},
+				"0001_stuff.down.sql": {Data: []byte("DROP TABLE things;")},
+			},
+		},
+		{
+			name: "duplicate Go version",
+			fsys: fstest.MapFS{"0002_other.up.sql": {Data: []byte("SELECT 1;")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys, addName); err == nil {
+				t.Error("Load() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := openDB(t)
+	m := New(db, load(t, testFS()))
+
+	if n, err := m.Up(2); err != nil || n != 2 {
+		t.Fatalf("Up(2) = %d, %v, want 2 applied", n, err)
+	}
+	if n, err := m.Up(0); err != nil || n != 1 {
+		t.Fatalf("Up(0) = %d, %v, want 1 applied", n, err)
+	}
+	if n, err := m.Up(0); err != nil || n != 0 {
+		t.Fatalf("second Up(0) = %d, %v, want nothing to do", n, err)
+	}
+	if _, err := db.Exec(`INSERT INTO things (name) VALUES ('a')`); err != nil {
+		t.Fatalf("schema not migrated: %v", err)
+	}
+
+	if n, err := m.Down(2); err != nil || n != 2 {
+		t.Fatalf("Down(2) = %d, %v, want 2 rolled back", n, err)
+	}
+	if got := appliedVersions(t, m); len(got) != 1 || got[0] != 1 {
+		t.Errorf("applied = %v, want [1]", got)
+	}
+	if _, err := db.Exec(`INSERT INTO things (name) VALUES ('a')`); err == nil {
+		t.Error("name column survived rolling back")
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	fsys := testFS()
+	fsys["0004_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE more (id INTEGER); INSERT INTO nowhere VALUES (1);")}
+	db := openDB(t)
+	m := New(db, load(t, fsys))
+
+	n, err := m.Up(0)
+	if err == nil || n != 3 {
+		t.Fatalf("Up() = %d, %v, want 3 applied and an error", n, err)
+	}
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'more'`); err != nil || count != 0 {
+		t.Error("failed migration left a table behind")
+	}
+	if got := appliedVersions(t, m); len(got) != 3 {
+		t.Errorf("applied = %v, want the three good migrations", got)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	db := openDB(t)
+	if _, err := New(db, load(t, testFS())).Up(1); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := testFS()
+	edited["0001_things.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE things (id INTEGER PRIMARY KEY, extra TEXT);")}
+	m := New(db, load(t, edited))
+
+	states, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !states[0].Drifted {
+		t.Errorf("status = %+v, want drifted", states[0])
+	}
+	if _, err := m.Up(0); !errors.Is(err, ErrDrift) {
+		t.Errorf("Up() error = %v, want ErrDrift", err)
+	}
+	if _, err := m.Down(1); !errors.Is(err, ErrDrift) {
+		t.Errorf("Down() error = %v, want ErrDrift", err)
+	}
+}
+
+func TestGoMigrationDrift(t *testing.T) {
+	db := openDB(t)
+	if _, err := New(db, load(t, testFS())).Up(2); err != nil {
+		t.Fatal(err)
+	}
+
+	revised := addName
+	revised.Revision = 1
+	migrations, err := Load(testFS(), revised)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, migrations)
+
+	states, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !states[1].Drifted || !states[1].ByHand {
+		t.Errorf("status = %+v, want a drifted Go migration", states[1])
+	}
+	if _, err := m.Up(0); !errors.Is(err, ErrDrift) {
+		t.Errorf("Up() error = %v, want ErrDrift", err)
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	db := openDB(t)
+	if _, err := New(db, load(t, testFS())).Up(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// An older build that only knows the first migration
+	older := fstest.MapFS{
+		"0001_things.up.sql":   testFS()["0001_things.up.sql"],
+		"0001_things.down.sql": testFS()["0001_things.down.sql"],
+	}
+	migrations, err := Load(older)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(db, migrations).Up(0); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Up() error = %v, want ErrUnknownVersion", err)
+	}
+}
+
+func TestIrreversible(t *testing.T) {
+	db := openDB(t)
+	m := New(db, []Migration{{Version: 1, Name: "things", UpSQL: "CREATE TABLE things (id INTEGER);"}})
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(1); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Down() error = %v, want ErrIrreversible", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	root := t.TempDir()
+	sqliteDir, postgresDir := filepath.Join(root, "sqlite"), filepath.Join(root, "postgres")
+	for _, dir := range []string{sqliteDir, postgresDir} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sqliteDir, "0007_status_versions.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(postgresDir, "0005_other.up.sql"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := NextVersion(sqliteDir, postgresDir)
+	if err != nil || version != 8 {
+		t.Fatalf("NextVersion() = %d, %v, want 8", version, err)
+	}
+
+	paths, err := Create(postgresDir, version, "Add Emoji Index!", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(postgresDir, "0008_add_emoji_index.down.sql"),
+		filepath.Join(postgresDir, "0008_add_emoji_index.up.sql"),
+	}
+	if len(paths) != 2 || paths[0] != want[0] || paths[1] != want[1] {
+		t.Errorf("Create() = %v, want %v", paths, want)
+	}
+
+	paths, err = Create(sqliteDir, 9, "backfill", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "0009_backfill.go" {
+		t.Errorf("Create(go) = %v, want 0009_backfill.go", paths)
+	}
+
+	if _, err := Create(sqliteDir, 9, "backfill", true); err == nil {
+		t.Error("Create() overwrote an existing migration")
+	}
+	if _, err := Create(sqliteDir, 10, "!!!", false); err == nil {
+		t.Error("Create() accepted an empty name")
+	}
+}
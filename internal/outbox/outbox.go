@@ -0,0 +1,309 @@
+// Package outbox makes status writes to users' PDSes durable. Writes are
+// persisted before they are attempted and retried with backoff until the PDS
+// confirms them, so a slow or unavailable PDS does not lose a status.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a write is tried before it is marked failed
+	DefaultMaxAttempts = 8
+
+	// DefaultInterval is how often the worker looks for due writes
+	DefaultInterval = 5 * time.Second
+
+	// attemptTimeout bounds a single round trip to the PDS
+	attemptTimeout = 10 * time.Second
+
+	// batchSize is the number of due writes handled per tick
+	batchSize = 50
+
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+)
+
+// Store persists outbox entries; *db.DB implements it
+type Store interface {
+	SaveOutboxEntry(ctx context.Context, entry *db.OutboxEntry) error
+	GetDueOutboxEntries(ctx context.Context, now db.Timestamp, limit int) ([]db.OutboxEntry, error)
+	GetUserOutboxEntries(ctx context.Context, authorDID syntax.DID) ([]db.OutboxEntry, error)
+	DeleteOutboxEntry(ctx context.Context, uri syntax.ATURI) error
+	DeleteFailedOutboxEntry(ctx context.Context, uri syntax.ATURI) error
+	ConfirmOutboxEntry(ctx context.Context, status *db.Status) error
+	GetStatus(ctx context.Context, uri syntax.ATURI) (*db.Status, error)
+}
+
+// Sessions loads users' auth sessions with usable tokens; *atproto.Sessions implements it
+type Sessions interface {
+	Load(ctx context.Context, did string) (*atproto.Session, error)
+}
+
+// Writer is the subset of the PDS client used to write and check records
+type Writer interface {
+	CreateRecord(ctx context.Context, collection, rkey string, record interface{}) (*atproto.WriteResult, error)
+	GetRecord(ctx context.Context, repo, collection, rkey string) (*atproto.Record, error)
+	GetLatestCommit(ctx context.Context, did string) (*atproto.CommitMeta, error)
+}
+
+// ClientFunc creates a Writer authenticated as the session's user
+type ClientFunc func(sess *atproto.Session) (Writer, error)
+
+// Outbox queues status writes and delivers them to the author's PDS
+type Outbox struct {
+	store       Store
+	sessions    Sessions
+	newClient   ClientFunc
+	MaxAttempts int
+	now         func() time.Time
+
+	// inflight holds the URIs being attempted, so the worker and a request
+	// never send the same write twice. mu is never held across a PDS call.
+	mu       sync.Mutex
+	inflight map[syntax.ATURI]bool
+}
+
+// New creates an outbox that writes through the user's stored auth session
+func New(store Store, sessions Sessions) *Outbox {
+	return &Outbox{
+		store:       store,
+		sessions:    sessions,
+		newClient:   newClient,
+		MaxAttempts: DefaultMaxAttempts,
+		now:         time.Now,
+		inflight:    make(map[syntax.ATURI]bool),
+	}
+}
+
+func newClient(sess *atproto.Session) (Writer, error) {
+	return atproto.NewClientFromSession(sess)
+}
+
+// Enqueue persists a new status write and makes a first attempt at it. The
+// write stays queued for the worker if the attempt fails; the returned error
+// only reports whether it could be queued.
+func (o *Outbox) Enqueue(ctx context.Context, uri syntax.ATURI, record *atproto.StatusRecord) error {
+	entry := &db.OutboxEntry{
+		URI:       uri,
+		AuthorDID: uri.DID(),
+		Status:    record.Status,
+		CreatedAt: record.CreatedAt,
+		State:     db.OutboxPending,
+		// Keep the worker away while the first attempt is in flight
+		NextAttemptAt: db.NewTimestamp(o.now().Add(baseBackoff)),
+	}
+	if err := o.store.SaveOutboxEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	o.attempt(ctx, entry, true)
+	return nil
+}
+
+// Pending returns a user's writes that have not been confirmed yet
+func (o *Outbox) Pending(ctx context.Context, did syntax.DID) ([]db.OutboxEntry, error) {
+	return o.store.GetUserOutboxEntries(ctx, did)
+}
+
+// Dismiss removes one of a user's failed writes
+func (o *Outbox) Dismiss(ctx context.Context, did syntax.DID, uri syntax.ATURI) error {
+	if uri.DID() != did {
+		return errors.New("not the author of this write")
+	}
+	// Pending writes may be in flight, so only failed ones can be dismissed
+	return o.store.DeleteFailedOutboxEntry(ctx, uri)
+}
+
+// Run delivers due writes until the context is cancelled
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		o.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue attempts every write whose backoff has elapsed
+func (o *Outbox) deliverDue(ctx context.Context) {
+	entries, err := o.store.GetDueOutboxEntries(ctx, db.NewTimestamp(o.now()), batchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load outbox")
+		return
+	}
+
+	for i := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		o.attempt(ctx, &entries[i], false)
+	}
+}
+
+// attempt tries to deliver one write, recording the outcome in the store.
+// A fresh write has never been sent, so there is nothing to reconcile. A
+// write already being attempted is skipped; it stays queued if that fails.
+func (o *Outbox) attempt(ctx context.Context, entry *db.OutboxEntry, fresh bool) {
+	if !o.claim(entry.URI) {
+		return
+	}
+	defer o.release(entry.URI)
+
+	deliverCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	err := o.deliver(deliverCtx, entry, fresh)
+	if err == nil {
+		return
+	}
+
+	entry.Attempts++
+	entry.LastError = err.Error()
+	if errors.Is(err, atproto.ErrMissingScope) || entry.Attempts >= o.MaxAttempts {
+		entry.State = db.OutboxFailed
+	} else {
+		entry.NextAttemptAt = db.NewTimestamp(o.now().Add(backoff(entry.Attempts)))
+	}
+
+	log.Warn().Err(err).Str("uri", entry.URI.String()).Int("attempts", entry.Attempts).Str("state", entry.State).Msg("Failed to deliver status write")
+
+	if err := o.store.SaveOutboxEntry(ctx, entry); err != nil {
+		log.Error().Err(err).Msg("Failed to update outbox entry")
+	}
+}
+
+// claim marks a write as in flight, reporting false if it already was
+func (o *Outbox) claim(uri syntax.ATURI) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.inflight[uri] {
+		return false
+	}
+	o.inflight[uri] = true
+	return true
+}
+
+// release ends a claim
+func (o *Outbox) release(uri syntax.ATURI) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.inflight, uri)
+}
+
+// deliver writes the record unless it is already known to exist
+func (o *Outbox) deliver(ctx context.Context, entry *db.OutboxEntry, fresh bool) error {
+	record := &atproto.StatusRecord{
+		Type:      atproto.StatusCollection,
+		Status:    entry.Status,
+		CreatedAt: entry.CreatedAt,
+	}
+
+	// An earlier attempt may have reached the PDS even though we saw an error, or
+	// the process died before recording it. The firehose confirms such a write by
+	// indexing the record; otherwise the PDS is asked before sending again.
+	if existing, err := o.store.GetStatus(ctx, entry.URI); err == nil && existing.CID != "" {
+		return o.store.DeleteOutboxEntry(ctx, entry.URI)
+	}
+
+	// Retries may come long after the user logged in, so the tokens are refreshed as needed
+	sess, err := o.sessions.Load(ctx, entry.AuthorDID.String())
+	if err != nil {
+		return err
+	}
+	if err := sess.RequireRepoWrite(atproto.StatusCollection, atproto.ActionCreate); err != nil {
+		return err
+	}
+	client, err := o.newClient(sess)
+	if err != nil {
+		return err
+	}
+
+	rkey := entry.URI.RecordKey().String()
+	if !fresh {
+		// getRecord does not say which rev it read at, so take the rev first;
+		// the record is at least that current
+		commit, err := client.GetLatestCommit(ctx, entry.AuthorDID.String())
+		if err != nil {
+			return err
+		}
+		existing, err := client.GetRecord(ctx, entry.AuthorDID.String(), atproto.StatusCollection, rkey)
+		switch {
+		case err == nil:
+			if !sameRecord(existing, record) {
+				return errors.New("a different record already exists at this URI")
+			}
+			return o.confirm(ctx, entry, existing.CID, commit.Rev)
+		case !atproto.IsRecordNotFound(err):
+			return err
+		}
+	}
+
+	// The record key was chosen up front, so a retry can never create a second copy
+	result, err := client.CreateRecord(ctx, atproto.StatusCollection, rkey, record)
+	if err != nil {
+		return err
+	}
+	if uri, err := syntax.ParseATURI(result.URI); err != nil || uri != entry.URI {
+		return fmt.Errorf("PDS returned an unexpected record URI %q", result.URI)
+	}
+
+	return o.confirm(ctx, entry, result.CID, result.Rev())
+}
+
+// confirm indexes the written record and drops it from the outbox
+func (o *Outbox) confirm(ctx context.Context, entry *db.OutboxEntry, cid, rev string) error {
+	createdAt, err := db.ParseTimestamp(entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	status := &db.Status{
+		URI:       entry.URI,
+		AuthorDID: entry.AuthorDID,
+		Status:    entry.Status,
+		CreatedAt: createdAt,
+		IndexedAt: db.NewTimestamp(o.now()),
+		CID:       cid,
+		Rev:       rev,
+	}
+	// The record exists now, so index it even if the caller has given up
+	// waiting. If this fails the write stays queued, and the next attempt
+	// finds the record and confirms it.
+	return o.store.ConfirmOutboxEntry(context.WithoutCancel(ctx), status)
+}
+
+// sameRecord reports whether a record fetched from the PDS is the write we queued
+func sameRecord(existing *atproto.Record, record *atproto.StatusRecord) bool {
+	var got atproto.StatusRecord
+	if err := json.Unmarshal(existing.Value, &got); err != nil {
+		return false
+	}
+	return got.Status == record.Status && got.CreatedAt == record.CreatedAt
+}
+
+// backoff returns the delay before the given retry, doubling from baseBackoff
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
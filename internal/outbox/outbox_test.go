@@ -0,0 +1,390 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+const testDID = "did:plc:alice"
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu       sync.Mutex
+	entries  map[syntax.ATURI]db.OutboxEntry
+	statuses map[syntax.ATURI]db.Status
+	session  string
+}
+
+func newMemStore(t *testing.T, scope string) *memStore {
+	t.Helper()
+	data, err := (&atproto.Session{DID: testDID, PdsHost: "https://pds.test", AccessJwt: "jwt", Scope: scope}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &memStore{
+		entries:  map[syntax.ATURI]db.OutboxEntry{},
+		statuses: map[syntax.ATURI]db.Status{},
+		session:  data,
+	}
+}
+
+func (s *memStore) SaveOutboxEntry(ctx context.Context, entry *db.OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.URI] = *entry
+	return nil
+}
+
+func (s *memStore) GetDueOutboxEntries(ctx context.Context, now db.Timestamp, limit int) ([]db.OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []db.OutboxEntry
+	for _, e := range s.entries {
+		if e.State == db.OutboxPending && !e.NextAttemptAt.After(now.Time) {
+			due = append(due, e)
+		}
+	}
+	return due, nil
+}
+
+func (s *memStore) GetUserOutboxEntries(ctx context.Context, authorDID syntax.DID) ([]db.OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []db.OutboxEntry
+	for _, e := range s.entries {
+		if e.AuthorDID == authorDID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (s *memStore) DeleteOutboxEntry(ctx context.Context, uri syntax.ATURI) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, uri)
+	return nil
+}
+
+func (s *memStore) DeleteFailedOutboxEntry(ctx context.Context, uri syntax.ATURI) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[uri].State == db.OutboxFailed {
+		delete(s.entries, uri)
+	}
+	return nil
+}
+
+func (s *memStore) ConfirmOutboxEntry(ctx context.Context, status *db.Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[status.URI] = *status
+	delete(s.entries, status.URI)
+	return nil
+}
+
+func (s *memStore) GetStatus(ctx context.Context, uri syntax.ATURI) (*db.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, ok := s.statuses[uri]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &status, nil
+}
+
+func (s *memStore) GetAuthSession(ctx context.Context, key string) (string, error) {
+	return s.session, nil
+}
+
+func (s *memStore) SaveAuthSession(ctx context.Context, key, sessionData string) error {
+	s.session = sessionData
+	return nil
+}
+
+// fakePDS is a Writer backed by a map of records. While down, every call
+// fails; if lose is set, writes are stored but the caller still sees an error.
+type fakePDS struct {
+	records map[string]atproto.StatusRecord
+	creates int
+	down    bool
+	lose    bool
+}
+
+// rev returns the repo rev after the writes made so far
+func (p *fakePDS) rev() string {
+	return fmt.Sprintf("3lbqsq6rwgc%02d", p.creates)
+}
+
+func (p *fakePDS) CreateRecord(ctx context.Context, collection, rkey string, record interface{}) (*atproto.WriteResult, error) {
+	if p.down {
+		return nil, errors.New("connection refused")
+	}
+	if _, ok := p.records[rkey]; ok {
+		return nil, &xrpc.Error{StatusCode: 400, Wrapped: &xrpc.XRPCError{ErrStr: "InvalidRequest", Message: "Record already exists"}}
+	}
+	p.creates++
+	p.records[rkey] = *record.(*atproto.StatusRecord)
+	if p.lose {
+		return nil, context.DeadlineExceeded
+	}
+	return &atproto.WriteResult{
+		URI:    "at://" + testDID + "/" + collection + "/" + rkey,
+		CID:    "bafy" + rkey,
+		Commit: &atproto.CommitMeta{CID: "bafycommit", Rev: p.rev()},
+	}, nil
+}
+
+func (p *fakePDS) GetLatestCommit(ctx context.Context, did string) (*atproto.CommitMeta, error) {
+	if p.down {
+		return nil, errors.New("connection refused")
+	}
+	return &atproto.CommitMeta{CID: "bafycommit", Rev: p.rev()}, nil
+}
+
+func (p *fakePDS) GetRecord(ctx context.Context, repo, collection, rkey string) (*atproto.Record, error) {
+	if p.down {
+		return nil, errors.New("connection refused")
+	}
+	record, ok := p.records[rkey]
+	if !ok {
+		return nil, &xrpc.Error{StatusCode: 400, Wrapped: &xrpc.XRPCError{ErrStr: "RecordNotFound"}}
+	}
+	value, _ := json.Marshal(record)
+	return &atproto.Record{URI: "at://" + repo + "/" + collection + "/" + rkey, CID: "bafy" + rkey, Value: value}, nil
+}
+
+// testClock is a settable clock
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestOutbox(t *testing.T, scope string) (*Outbox, *memStore, *fakePDS, *testClock) {
+	store := newMemStore(t, scope)
+	pds := &fakePDS{records: map[string]atproto.StatusRecord{}}
+	clock := &testClock{t: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	o := New(store, atproto.NewSessions(store, nil))
+	o.newClient = func(sess *atproto.Session) (Writer, error) { return pds, nil }
+	o.now = clock.now
+	return o, store, pds, clock
+}
+
+func enqueue(t *testing.T, o *Outbox, rkey string) syntax.ATURI {
+	t.Helper()
+	uri := syntax.NewRecordURI(testDID, atproto.StatusCollection, syntax.RecordKey(rkey))
+	record := atproto.NewStatusRecord("👍", o.now())
+	if err := o.Enqueue(context.Background(), uri, record); err != nil {
+		t.Fatal(err)
+	}
+	return uri
+}
+
+func TestEnqueueDeliversImmediately(t *testing.T) {
+	o, store, pds, _ := newTestOutbox(t, "atproto repo:xyz.statusphere.status")
+
+	uri := enqueue(t, o, "3lbqsq6rwgc2a")
+
+	if len(store.entries) != 0 {
+		t.Errorf("outbox still holds %d entries", len(store.entries))
+	}
+	if status, ok := store.statuses[uri]; !ok || status.CID == "" || status.Rev == "" {
+		t.Errorf("status was not confirmed: %+v", status)
+	}
+	if pds.creates != 1 {
+		t.Errorf("creates = %d, want 1", pds.creates)
+	}
+}
+
+func TestRetryUntilPDSRecovers(t *testing.T) {
+	o, store, pds, clock := newTestOutbox(t, "atproto repo:xyz.statusphere.status")
+
+	pds.down = true
+	uri := enqueue(t, o, "3lbqsq6rwgc2a")
+
+	entry := store.entries[uri]
+	if entry.State != db.OutboxPending || entry.Attempts != 1 {
+		t.Fatalf("entry = %+v, want pending after one attempt", entry)
+	}
+
+	// Not due yet
+	o.deliverDue(context.Background())
+	if store.entries[uri].Attempts != 1 {
+		t.Fatal("entry was retried before its backoff elapsed")
+	}
+
+	pds.down = false
+	clock.advance(backoff(1))
+	o.deliverDue(context.Background())
+
+	if _, ok := store.entries[uri]; ok {
+		t.Error("entry was not removed after delivery")
+	}
+	if _, ok := store.statuses[uri]; !ok {
+		t.Error("status was not confirmed")
+	}
+}
+
+func TestLostResponseIsNotDuplicated(t *testing.T) {
+	o, store, pds, clock := newTestOutbox(t, "atproto repo:xyz.statusphere.status")
+
+	// The PDS stores the record but the response never arrives
+	pds.lose = true
+	uri := enqueue(t, o, "3lbqsq6rwgc2a")
+	if store.entries[uri].State != db.OutboxPending {
+		t.Fatalf("entry = %+v, want pending", store.entries[uri])
+	}
+
+	pds.lose = false
+	clock.advance(backoff(1))
+	o.deliverDue(context.Background())
+
+	if pds.creates != 1 {
+		t.Errorf("creates = %d, want 1", pds.creates)
+	}
+	if status, ok := store.statuses[uri]; !ok || status.CID != "bafy3lbqsq6rwgc2a" || status.Rev != "3lbqsq6rwgc01" {
+		t.Errorf("status = %+v, want confirmed from getRecord", status)
+	}
+	if len(store.entries) != 0 {
+		t.Error("entry was not removed after reconciliation")
+	}
+}
+
+// slowPDS holds up creating one record until released
+type slowPDS struct {
+	*fakePDS
+	rkey    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *slowPDS) CreateRecord(ctx context.Context, collection, rkey string, record interface{}) (*atproto.WriteResult, error) {
+	if rkey == p.rkey {
+		close(p.started)
+		<-p.release
+	}
+	return p.fakePDS.CreateRecord(ctx, collection, rkey, record)
+}
+
+func TestSlowDeliveryDoesNotBlockOthers(t *testing.T) {
+	o, store, pds, clock := newTestOutbox(t, "atproto repo:xyz.statusphere.status")
+	slow := &slowPDS{fakePDS: pds, rkey: "3lbqsq6rwgc2a", started: make(chan struct{}), release: make(chan struct{})}
+	o.newClient = func(sess *atproto.Session) (Writer, error) { return slow, nil }
+
+	// Queue a write for the worker without attempting it
+	uri := syntax.NewRecordURI(testDID, atproto.StatusCollection, "3lbqsq6rwgc2a")
+	record := atproto.NewStatusRecord("🐢", clock.now())
+	err := store.SaveOutboxEntry(context.Background(), &db.OutboxEntry{
+		URI: uri, AuthorDID: testDID, Status: record.Status, CreatedAt: record.CreatedAt,
+		State: db.OutboxPending, NextAttemptAt: db.NewTimestamp(clock.now()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		o.deliverDue(context.Background())
+	}()
+	<-slow.started
+
+	// The worker is stuck on the first write; a new one goes straight through,
+	// and the stuck one is not sent a second time
+	other := enqueue(t, o, "3lbqsq6rwgc2b")
+	if _, ok := store.statuses[other]; !ok {
+		t.Error("new write was not delivered while another was in flight")
+	}
+	o.attempt(context.Background(), &db.OutboxEntry{URI: uri, AuthorDID: testDID, Status: record.Status, CreatedAt: record.CreatedAt}, false)
+
+	close(slow.release)
+	<-done
+	if pds.creates != 2 {
+		t.Errorf("creates = %d, want 2", pds.creates)
+	}
+}
+
+func TestFirehoseConfirmsWrite(t *testing.T) {
+	o, store, pds, clock := newTestOutbox(t, "atproto repo:xyz.statusphere.status")
+
+	pds.down = true
+	uri := enqueue(t, o, "3lbqsq6rwgc2a")
+
+	// The record shows up through the firehose before the next attempt
+	store.statuses[uri] = db.Status{URI: uri, AuthorDID: testDID, Status: "👍", CID: "bafyfirehose"}
+
+	clock.advance(backoff(1))
+	o.deliverDue(context.Background())
+
+	if len(store.entries) != 0 {
+		t.Error("entry was not removed once the firehose indexed it")
+	}
+}
+
+func TestGivesUp(t *testing.T) {
+	o, store, pds, clock := newTestOutbox(t, "atproto repo:xyz.statusphere.status")
+	o.MaxAttempts = 3
+
+	pds.down = true
+	uri := enqueue(t, o, "3lbqsq6rwgc2a")
+	for i := 0; i < 5; i++ {
+		clock.advance(maxBackoff)
+		o.deliverDue(context.Background())
+	}
+
+	entry := store.entries[uri]
+	if entry.State != db.OutboxFailed || entry.Attempts != 3 {
+		t.Fatalf("entry = %+v, want failed after 3 attempts", entry)
+	}
+
+	if err := o.Dismiss(context.Background(), "did:plc:mallory", uri); err == nil {
+		t.Error("another user dismissed the write")
+	}
+	if err := o.Dismiss(context.Background(), testDID, uri); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 0 {
+		t.Error("failed entry was not dismissed")
+	}
+}
+
+func TestMissingScopeFailsImmediately(t *testing.T) {
+	o, store, pds, _ := newTestOutbox(t, "atproto")
+
+	uri := enqueue(t, o, "3lbqsq6rwgc2a")
+
+	if entry := store.entries[uri]; entry.State != db.OutboxFailed {
+		t.Errorf("entry = %+v, want failed", entry)
+	}
+	if pds.creates != 0 {
+		t.Errorf("creates = %d, want 0", pds.creates)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{4, 40 * time.Second},
+		{20, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package profiles hydrates author profiles (display names and avatars) for rendering
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/identity"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTTL is how long a cached profile is used before it is fetched again
+const DefaultTTL = 6 * time.Hour
+
+// fetchConcurrency bounds the number of profiles fetched at once
+const fetchConcurrency = 8
+
+// refreshTimeout bounds a background profile fetch
+const refreshTimeout = 10 * time.Second
+
+// Store persists cached profiles; *db.DB implements it
+type Store interface {
+	GetProfiles(ctx context.Context, dids []string) ([]db.Profile, error)
+	SaveProfile(ctx context.Context, profile *db.Profile) error
+}
+
+// FetchFunc fetches a profile record from the given PDS
+type FetchFunc func(ctx context.Context, pdsHost, did string) (*atproto.ProfileRecord, error)
+
+// Profile is an author's profile as shown in the feed
+type Profile struct {
+	DID         string
+	DisplayName string
+	AvatarCID   string
+	AvatarMime  string
+}
+
+// AvatarURL returns the proxied URL of the profile's avatar, or "" if it has none
+func (p *Profile) AvatarURL() string {
+	if p.AvatarCID == "" {
+		return ""
+	}
+	// The CID busts browser caches when the avatar changes
+	return "/avatar/" + p.DID + "?v=" + p.AvatarCID
+}
+
+// Service fetches profile records from each author's PDS and caches them
+type Service struct {
+	store    Store
+	identity identity.Directory
+	fetch    FetchFunc
+	TTL      time.Duration
+	now      func() time.Time
+
+	// refreshing holds the DIDs being fetched; fetching bounds how many
+	refreshing sync.Map
+	fetching   chan struct{}
+}
+
+// NewService creates a profile service that fetches records over XRPC
+func NewService(store Store, directory identity.Directory) *Service {
+	return &Service{
+		store:    store,
+		identity: directory,
+		fetch:    fetchProfileRecord,
+		TTL:      DefaultTTL,
+		now:      time.Now,
+		fetching: make(chan struct{}, fetchConcurrency),
+	}
+}
+
+// Get returns a single profile, or nil if it is not cached yet
+func (s *Service) Get(ctx context.Context, did string) *Profile {
+	return s.GetMany(ctx, []string{did})[did]
+}
+
+// GetMany returns the cached profiles for a set of DIDs without waiting on
+// the network. Profiles that are missing or stale are fetched in the
+// background for later renders; missing ones are left out until then.
+func (s *Service) GetMany(ctx context.Context, dids []string) map[string]*Profile {
+	result := make(map[string]*Profile, len(dids))
+
+	rows, err := s.store.GetProfiles(ctx, dids)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read cached profiles")
+	}
+
+	fresh := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		result[row.DID] = fromRow(&row)
+		updatedAt, err := time.Parse(time.RFC3339, row.UpdatedAt)
+		fresh[row.DID] = err == nil && s.now().Sub(updatedAt) < s.TTL
+	}
+
+	for _, did := range dids {
+		if !fresh[did] {
+			s.refreshInBackground(did)
+		}
+	}
+
+	return result
+}
+
+// refreshInBackground fetches a profile unless a fetch for it is already
+// running. When fetchConcurrency fetches are running it does nothing; a
+// later render asks again.
+func (s *Service) refreshInBackground(did string) {
+	if _, running := s.refreshing.LoadOrStore(did, struct{}{}); running {
+		return
+	}
+	select {
+	case s.fetching <- struct{}{}:
+	default:
+		s.refreshing.Delete(did)
+		return
+	}
+
+	go func() {
+		defer func() {
+			<-s.fetching
+			s.refreshing.Delete(did)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+
+		if _, err := s.Refresh(ctx, did); err != nil {
+			// Keep serving the stale copy, if there is one
+			log.Debug().Err(err).Str("did", did).Msg("Failed to refresh profile")
+		}
+	}()
+}
+
+// Refresh fetches a profile from the author's PDS and caches it
+func (s *Service) Refresh(ctx context.Context, did string) (*Profile, error) {
+	ident, err := s.identity.LookupDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+
+	pds := ident.Doc.PDSEndpoint()
+	if pds == "" {
+		return nil, fmt.Errorf("no PDS for %s", did)
+	}
+
+	record, err := s.fetch(ctx, pds, did)
+	if atproto.IsRecordNotFound(err) {
+		// Cache the absence so we do not ask again on every render
+		record, err = &atproto.ProfileRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.save(ctx, did, record)
+}
+
+// Invalidate refetches a profile in the background even if the cached copy
+// is still fresh. It is for when a profile may have changed but the new record
+// is not at hand, such as when its owner logs in or syncs their repo.
+func (s *Service) Invalidate(did string) {
+	s.refreshInBackground(did)
+}
+
+// HandleUpdate caches a profile record received from the network, replacing
+// the cached display name and avatar. The ingester calls it for
+// app.bsky.actor.profile creates and updates.
+func (s *Service) HandleUpdate(ctx context.Context, did string, record *atproto.ProfileRecord) (*Profile, error) {
+	return s.save(ctx, did, record)
+}
+
+// HandleDelete clears a profile whose record was deleted
+func (s *Service) HandleDelete(ctx context.Context, did string) error {
+	_, err := s.save(ctx, did, &atproto.ProfileRecord{})
+	return err
+}
+
+// save caches a profile record
+func (s *Service) save(ctx context.Context, did string, record *atproto.ProfileRecord) (*Profile, error) {
+	row := &db.Profile{
+		DID:         did,
+		DisplayName: record.DisplayName,
+		UpdatedAt:   s.now().UTC().Format(time.RFC3339),
+	}
+	if record.Avatar != nil {
+		row.AvatarCID = record.Avatar.Ref.Link
+		row.AvatarMime = record.Avatar.MimeType
+	}
+
+	if err := s.store.SaveProfile(ctx, row); err != nil {
+		return nil, err
+	}
+
+	return fromRow(row), nil
+}
+
+// fromRow converts a cached row to a Profile
+func fromRow(row *db.Profile) *Profile {
+	return &Profile{
+		DID:         row.DID,
+		DisplayName: row.DisplayName,
+		AvatarCID:   row.AvatarCID,
+		AvatarMime:  row.AvatarMime,
+	}
+}
+
+// fetchProfileRecord fetches a profile record over XRPC
+func fetchProfileRecord(ctx context.Context, pdsHost, did string) (*atproto.ProfileRecord, error) {
+	client, err := atproto.NewClient(atproto.Config{PdsHost: pdsHost})
+	if err != nil {
+		return nil, err
+	}
+	return client.GetProfileRecord(ctx, did)
+}
@@ -0,0 +1,207 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/identity"
+)
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu   sync.Mutex
+	rows map[string]db.Profile
+}
+
+func (m *memStore) GetProfiles(ctx context.Context, dids []string) ([]db.Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []db.Profile
+	for _, did := range dids {
+		if row, ok := m.rows[did]; ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (m *memStore) SaveProfile(ctx context.Context, profile *db.Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[profile.DID] = *profile
+	return nil
+}
+
+// staticDirectory puts every DID on the same PDS
+type staticDirectory struct{}
+
+func (staticDirectory) LookupDID(ctx context.Context, did string) (*identity.Identity, error) {
+	return &identity.Identity{DID: did, Doc: &identity.DIDDocument{
+		ID: did,
+		Service: []identity.Service{{
+			ID:              "#atproto_pds",
+			Type:            "AtprotoPersonalDataServer",
+			ServiceEndpoint: "https://pds.test",
+		}},
+	}}, nil
+}
+
+func (staticDirectory) LookupHandle(ctx context.Context, handle string) (*identity.Identity, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (staticDirectory) ResolveDIDsToHandles(ctx context.Context, dids []string) map[string]string {
+	return nil
+}
+
+func TestGetMany(t *testing.T) {
+	var mu sync.Mutex
+	fetches := map[string]int{}
+	failing := false
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewService(&memStore{rows: map[string]db.Profile{}}, staticDirectory{})
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	s.fetch = func(ctx context.Context, pdsHost, did string) (*atproto.ProfileRecord, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches[did]++
+		if failing {
+			return nil, errors.New("PDS unavailable")
+		}
+		switch did {
+		case "did:plc:alice":
+			return &atproto.ProfileRecord{
+				DisplayName: "Alice",
+				Avatar:      &atproto.Blob{Ref: atproto.BlobRef{Link: "bafyavatar"}, MimeType: "image/png"},
+			}, nil
+		default:
+			return nil, &xrpc.Error{StatusCode: 400, Wrapped: &xrpc.XRPCError{ErrStr: "RecordNotFound"}}
+		}
+	}
+
+	ctx := context.Background()
+
+	// Nothing is cached yet, so the first render gets placeholders while the
+	// profiles are fetched
+	got := s.GetMany(ctx, []string{"did:plc:alice", "did:plc:bob", "did:plc:alice"})
+	if len(got) != 0 {
+		t.Errorf("GetMany() = %v, want nothing before the fetch", got)
+	}
+	waitForRefreshes(t, s)
+
+	got = s.GetMany(ctx, []string{"did:plc:alice", "did:plc:bob"})
+	if got["did:plc:alice"] == nil || got["did:plc:alice"].DisplayName != "Alice" || got["did:plc:alice"].AvatarCID != "bafyavatar" {
+		t.Errorf("GetMany()[alice] = %+v", got["did:plc:alice"])
+	}
+	if got["did:plc:bob"] == nil || got["did:plc:bob"].DisplayName != "" {
+		t.Errorf("GetMany()[bob] = %+v, want an empty profile", got["did:plc:bob"])
+	}
+
+	// Fresh profiles, including known-missing ones, come from the cache
+	waitForRefreshes(t, s)
+	mu.Lock()
+	if fetches["did:plc:alice"] != 1 || fetches["did:plc:bob"] != 1 {
+		t.Errorf("fetches = %v, want one per DID", fetches)
+	}
+	mu.Unlock()
+
+	// Stale profiles are served while they are refetched, and kept if the refetch fails
+	mu.Lock()
+	now = now.Add(DefaultTTL + time.Minute)
+	failing = true
+	mu.Unlock()
+	got = s.GetMany(ctx, []string{"did:plc:alice"})
+	if got["did:plc:alice"] == nil || got["did:plc:alice"].DisplayName != "Alice" {
+		t.Errorf("GetMany()[alice] = %+v, want the stale profile", got["did:plc:alice"])
+	}
+	waitForRefreshes(t, s)
+	mu.Lock()
+	if fetches["did:plc:alice"] != 2 {
+		t.Errorf("fetches = %v, want a refetch of alice", fetches)
+	}
+	mu.Unlock()
+	if got := s.Get(ctx, "did:plc:alice"); got == nil || got.DisplayName != "Alice" {
+		t.Errorf("Get(alice) = %+v, want the stale profile after a failed refetch", got)
+	}
+}
+
+// waitForRefreshes waits until no background fetch is running
+func waitForRefreshes(t *testing.T, s *Service) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		running := false
+		s.refreshing.Range(func(key, value any) bool {
+			running = true
+			return false
+		})
+		if !running {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("background profile fetches did not finish")
+}
+
+func TestUpdateHooks(t *testing.T) {
+	var mu sync.Mutex
+	remote := &atproto.ProfileRecord{DisplayName: "Alice"}
+
+	s := NewService(&memStore{rows: map[string]db.Profile{}}, staticDirectory{})
+	s.fetch = func(ctx context.Context, pdsHost, did string) (*atproto.ProfileRecord, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return remote, nil
+	}
+
+	ctx := context.Background()
+	const did = "did:plc:alice"
+	if _, err := s.Refresh(ctx, did); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	// An update replaces the cached display name and avatar
+	_, err := s.HandleUpdate(ctx, did, &atproto.ProfileRecord{
+		DisplayName: "Alice B.",
+		Avatar:      &atproto.Blob{Ref: atproto.BlobRef{Link: "bafynewavatar"}, MimeType: "image/jpeg"},
+	})
+	if err != nil {
+		t.Fatalf("HandleUpdate() error = %v", err)
+	}
+	got := s.Get(ctx, did)
+	if got == nil || got.DisplayName != "Alice B." || got.AvatarCID != "bafynewavatar" || got.AvatarMime != "image/jpeg" {
+		t.Errorf("Get() after update = %+v", got)
+	}
+	if got.AvatarURL() != "/avatar/did:plc:alice?v=bafynewavatar" {
+		t.Errorf("AvatarURL() = %q, want the new avatar's URL", got.AvatarURL())
+	}
+
+	// A delete clears them
+	if err := s.HandleDelete(ctx, did); err != nil {
+		t.Fatalf("HandleDelete() error = %v", err)
+	}
+	if got := s.Get(ctx, did); got == nil || got.DisplayName != "" || got.AvatarURL() != "" {
+		t.Errorf("Get() after delete = %+v, want an empty profile", got)
+	}
+
+	// Invalidate refetches a profile even though the cached copy is fresh
+	mu.Lock()
+	remote = &atproto.ProfileRecord{DisplayName: "Alice C."}
+	mu.Unlock()
+	s.Invalidate(did)
+	waitForRefreshes(t, s)
+	if got := s.Get(ctx, did); got == nil || got.DisplayName != "Alice C." {
+		t.Errorf("Get() after Invalidate = %+v, want the refetched profile", got)
+	}
+}
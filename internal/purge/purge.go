@@ -0,0 +1,334 @@
+// Package purge deletes a user's status history from their repo in batches.
+// Jobs are persisted and resumed after a restart, and local rows are only
+// removed once the PDS has deleted the records they mirror.
+package purge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pageSize is the number of records listed, and so deleted, per batch
+	pageSize = 100
+
+	// DefaultBatchPause is the pause between batches, to stay clear of the PDS's write rate limit
+	DefaultBatchPause = time.Second
+
+	// maxRateLimitWait caps how long a job waits for a rate limit to reset before retrying
+	maxRateLimitWait = time.Hour
+
+	// rateLimitBackoff is how long to wait when the PDS rate limits without saying until when
+	rateLimitBackoff = time.Minute
+
+	// maxAttempts is how many times a failing call is tried before the job fails
+	maxAttempts = 3
+
+	// queueSize is the number of jobs that may wait to start
+	queueSize = 64
+)
+
+// Store persists purge jobs; *db.DB implements it
+type Store interface {
+	SavePurgeJob(ctx context.Context, job *db.PurgeJob) error
+	GetPurgeJob(ctx context.Context, did syntax.DID) (*db.PurgeJob, error)
+	GetRunningPurgeJobs(ctx context.Context) ([]db.PurgeJob, error)
+	SavePurgeBatch(ctx context.Context, job *db.PurgeJob, uris []syntax.ATURI) error
+	CountUserStatuses(ctx context.Context, authorDID syntax.DID) (int, error)
+	GetUserStatusURIs(ctx context.Context, authorDID syntax.DID, indexedBefore db.Timestamp) ([]syntax.ATURI, error)
+}
+
+// Sessions loads users' auth sessions with usable tokens; *atproto.Sessions implements it
+type Sessions interface {
+	Load(ctx context.Context, did string) (*atproto.Session, error)
+}
+
+// Client is the subset of the PDS client used to list and delete records
+type Client interface {
+	ListRecords(ctx context.Context, repo, collection, cursor string, limit int) (*atproto.RecordPage, error)
+	ApplyWrites(ctx context.Context, writes []atproto.Write) error
+}
+
+// ClientFunc creates a Client authenticated as the session's user
+type ClientFunc func(sess *atproto.Session) (Client, error)
+
+// Purger runs purge jobs in the background
+type Purger struct {
+	store     Store
+	sessions  Sessions
+	newClient ClientFunc
+	now       func() time.Time
+	sleep     func(ctx context.Context, d time.Duration) error
+	requests  chan syntax.DID
+
+	// BatchPause is the pause between applyWrites calls
+	BatchPause time.Duration
+
+	mu      sync.Mutex
+	running map[syntax.DID]bool
+}
+
+// New creates a purger that deletes through each user's stored auth session
+func New(store Store, sessions Sessions) *Purger {
+	return &Purger{
+		store:      store,
+		sessions:   sessions,
+		newClient:  newClient,
+		now:        time.Now,
+		sleep:      sleep,
+		requests:   make(chan syntax.DID, queueSize),
+		BatchPause: DefaultBatchPause,
+		running:    make(map[syntax.DID]bool),
+	}
+}
+
+func newClient(sess *atproto.Session) (Client, error) {
+	return atproto.NewClientFromSession(sess)
+}
+
+// sleep waits for d, returning early if the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Start begins clearing a user's history. Statuses created after this call are kept.
+// If a job is already running for the user, it is left to continue.
+func (p *Purger) Start(ctx context.Context, did syntax.DID) error {
+	if job, err := p.store.GetPurgeJob(ctx, did); err == nil && job.State == db.PurgeRunning {
+		return nil
+	}
+
+	total, err := p.store.CountUserStatuses(ctx, did)
+	if err != nil {
+		return err
+	}
+
+	now := db.NewTimestamp(p.now())
+	job := &db.PurgeJob{
+		DID:       did,
+		State:     db.PurgeRunning,
+		Total:     total,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if err := p.store.SavePurgeJob(ctx, job); err != nil {
+		return err
+	}
+
+	p.enqueue(did)
+	return nil
+}
+
+// Job returns a user's most recent purge job
+func (p *Purger) Job(ctx context.Context, did syntax.DID) (*db.PurgeJob, error) {
+	return p.store.GetPurgeJob(ctx, did)
+}
+
+func (p *Purger) enqueue(did syntax.DID) {
+	select {
+	case p.requests <- did:
+	default:
+		// The job stays running in the store and is resumed on the next start
+		log.Warn().Str("did", did.String()).Msg("Purge queue is full; job will resume on restart")
+	}
+}
+
+// Run resumes jobs interrupted by a restart, then runs new jobs until the context is cancelled
+func (p *Purger) Run(ctx context.Context) {
+	jobs, err := p.store.GetRunningPurgeJobs(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load purge jobs")
+	}
+	for _, job := range jobs {
+		p.enqueue(job.DID)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case did := <-p.requests:
+			p.mu.Lock()
+			if p.running[did] {
+				p.mu.Unlock()
+				continue
+			}
+			p.running[did] = true
+			p.mu.Unlock()
+
+			go func() {
+				defer func() {
+					p.mu.Lock()
+					delete(p.running, did)
+					p.mu.Unlock()
+				}()
+				p.runJob(ctx, did)
+			}()
+		}
+	}
+}
+
+// runJob runs a user's job to completion, recording a failure in the store
+func (p *Purger) runJob(ctx context.Context, did syntax.DID) {
+	job, err := p.store.GetPurgeJob(ctx, did)
+	if err != nil {
+		log.Error().Err(err).Str("did", did.String()).Msg("Failed to load purge job")
+		return
+	}
+	if job.State != db.PurgeRunning {
+		return
+	}
+
+	err = p.purge(ctx, job)
+	if err == nil || ctx.Err() != nil {
+		// Interrupted jobs stay running and resume on the next start
+		return
+	}
+
+	log.Error().Err(err).Str("did", did.String()).Int("deleted", job.Deleted).Msg("Failed to clear history")
+	job.State = db.PurgeFailed
+	job.LastError = err.Error()
+	job.UpdatedAt = db.NewTimestamp(p.now())
+	if err := p.store.SavePurgeJob(ctx, job); err != nil {
+		log.Error().Err(err).Msg("Failed to save purge job")
+	}
+}
+
+// purge deletes the job's records page by page, then removes any local rows
+// left behind by an earlier interruption
+func (p *Purger) purge(ctx context.Context, job *db.PurgeJob) error {
+	startedAt := job.StartedAt.Time
+
+	for {
+		// Jobs can outlast an access token, so each batch loads the session afresh
+		client, err := p.client(ctx, job.DID)
+		if err != nil {
+			return err
+		}
+
+		var page *atproto.RecordPage
+		err = p.retry(ctx, func() error {
+			var err error
+			page, err = client.ListRecords(ctx, job.DID.String(), atproto.StatusCollection, job.Cursor, pageSize)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		var writes []atproto.Write
+		var uris []syntax.ATURI
+		for _, record := range page.Records {
+			uri, err := syntax.ParseATURI(record.URI)
+			if err != nil || !createdBefore(uri.RecordKey(), startedAt) {
+				continue
+			}
+			writes = append(writes, atproto.DeleteOp(atproto.StatusCollection, uri.RecordKey().String()))
+			uris = append(uris, uri)
+		}
+
+		// A page always fits in one call, and each call is a single atomic commit
+		if len(writes) > 0 {
+			if err := p.retry(ctx, func() error { return client.ApplyWrites(ctx, writes) }); err != nil {
+				return err
+			}
+		}
+
+		job.Deleted += len(writes)
+		job.Cursor = page.Cursor
+		job.UpdatedAt = db.NewTimestamp(p.now())
+		if err := p.store.SavePurgeBatch(ctx, job, uris); err != nil {
+			return err
+		}
+
+		if page.Cursor == "" || len(page.Records) == 0 {
+			break
+		}
+		if err := p.sleep(ctx, p.BatchPause); err != nil {
+			return err
+		}
+	}
+
+	// Rows whose records were deleted just before an interruption are still
+	// here; nothing older than the job remains in the repo, so drop them too
+	existing, err := p.store.GetUserStatusURIs(ctx, job.DID, job.StartedAt)
+	if err != nil {
+		return err
+	}
+	var leftover []syntax.ATURI
+	for _, uri := range existing {
+		if createdBefore(uri.RecordKey(), startedAt) {
+			leftover = append(leftover, uri)
+		}
+	}
+
+	job.State = db.PurgeDone
+	job.UpdatedAt = db.NewTimestamp(p.now())
+	return p.store.SavePurgeBatch(ctx, job, leftover)
+}
+
+// client creates a PDS client for the user, refreshing their tokens if needed
+func (p *Purger) client(ctx context.Context, did syntax.DID) (Client, error) {
+	sess, err := p.sessions.Load(ctx, did.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.RequireRepoWrite(atproto.StatusCollection, atproto.ActionDelete); err != nil {
+		return nil, err
+	}
+	return p.newClient(sess)
+}
+
+// retry calls fn until it succeeds, waiting out rate limits and retrying
+// other errors a few times
+func (p *Purger) retry(ctx context.Context, fn func() error) error {
+	failures := 0
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		wait := time.Duration(failures+1) * p.BatchPause
+		if reset, limited := atproto.RateLimitReset(err); limited {
+			wait = rateLimitBackoff
+			if !reset.IsZero() {
+				wait = min(max(reset.Sub(p.now()), 0), maxRateLimitWait)
+			}
+			log.Info().Dur("wait", wait).Msg("Rate limited while clearing history")
+		} else {
+			failures++
+			if failures >= maxAttempts {
+				return err
+			}
+		}
+
+		if err := p.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// createdBefore reports whether a record was created before t, judging by
+// its TID record key. Records with other kinds of keys are treated as old.
+func createdBefore(rkey syntax.RecordKey, t time.Time) bool {
+	tid, err := syntax.ParseTID(rkey.String())
+	if err != nil {
+		return true
+	}
+	return !tid.Time().After(t)
+}
@@ -0,0 +1,322 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+const testDID = "did:plc:alice"
+
+var start = time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu       sync.Mutex
+	jobs     map[syntax.DID]db.PurgeJob
+	statuses map[syntax.ATURI]db.Status
+	session  string
+}
+
+func (s *memStore) SavePurgeJob(ctx context.Context, job *db.PurgeJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.DID] = *job
+	return nil
+}
+
+func (s *memStore) GetPurgeJob(ctx context.Context, did syntax.DID) (*db.PurgeJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[did]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &job, nil
+}
+
+func (s *memStore) GetRunningPurgeJobs(ctx context.Context) ([]db.PurgeJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []db.PurgeJob
+	for _, job := range s.jobs {
+		if job.State == db.PurgeRunning {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *memStore) SavePurgeBatch(ctx context.Context, job *db.PurgeJob, uris []syntax.ATURI) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, uri := range uris {
+		delete(s.statuses, uri)
+	}
+	s.jobs[job.DID] = *job
+	return nil
+}
+
+func (s *memStore) CountUserStatuses(ctx context.Context, authorDID syntax.DID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.statuses), nil
+}
+
+func (s *memStore) GetUserStatusURIs(ctx context.Context, authorDID syntax.DID, indexedBefore db.Timestamp) ([]syntax.ATURI, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var uris []syntax.ATURI
+	for uri, status := range s.statuses {
+		if status.IndexedAt.Before(indexedBefore.Time) {
+			uris = append(uris, uri)
+		}
+	}
+	return uris, nil
+}
+
+// job returns a copy of a user's job, for polling while the purger runs
+func (s *memStore) job(did syntax.DID) db.PurgeJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[did]
+}
+
+func (s *memStore) GetAuthSession(ctx context.Context, key string) (string, error) {
+	return s.session, nil
+}
+
+func (s *memStore) SaveAuthSession(ctx context.Context, key, sessionData string) error {
+	s.session = sessionData
+	return nil
+}
+
+// fakePDS lists records newest first, like a PDS, and deletes them with applyWrites
+type fakePDS struct {
+	rkeys     map[string]bool
+	calls     []int // Size of each applyWrites call
+	failures  []error
+	listCalls int
+}
+
+func (p *fakePDS) ListRecords(ctx context.Context, repo, collection, cursor string, limit int) (*atproto.RecordPage, error) {
+	p.listCalls++
+	var keys []string
+	for rkey := range p.rkeys {
+		if cursor == "" || rkey < cursor {
+			keys = append(keys, rkey)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	page := &atproto.RecordPage{}
+	for _, rkey := range keys[:min(limit, len(keys))] {
+		page.Records = append(page.Records, atproto.Record{URI: uri(rkey).String()})
+	}
+	if len(keys) > limit {
+		page.Cursor = keys[limit-1]
+	}
+	return page, nil
+}
+
+func (p *fakePDS) ApplyWrites(ctx context.Context, writes []atproto.Write) error {
+	if len(p.failures) > 0 {
+		err := p.failures[0]
+		p.failures = p.failures[1:]
+		if err != nil {
+			return err
+		}
+	}
+	if len(writes) > atproto.MaxWritesPerCall {
+		return errors.New("too many writes")
+	}
+	for _, w := range writes {
+		delete(p.rkeys, w.Rkey)
+	}
+	p.calls = append(p.calls, len(writes))
+	return nil
+}
+
+func uri(rkey string) syntax.ATURI {
+	return syntax.NewRecordURI(testDID, atproto.StatusCollection, syntax.RecordKey(rkey))
+}
+
+// seed creates n records created before the job starts, plus one created after
+func seed(t *testing.T, n int) (*memStore, *fakePDS) {
+	t.Helper()
+	data, err := (&atproto.Session{DID: testDID, PdsHost: "https://pds.test", AccessJwt: "jwt", Scope: "atproto repo:xyz.statusphere.status"}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memStore{jobs: map[syntax.DID]db.PurgeJob{}, statuses: map[syntax.ATURI]db.Status{}, session: data}
+	pds := &fakePDS{rkeys: map[string]bool{}}
+	for i := 0; i < n; i++ {
+		rkey := syntax.NewTID(start.Add(-time.Duration(n-i)*time.Minute), 0).String()
+		pds.rkeys[rkey] = true
+		store.statuses[uri(rkey)] = db.Status{URI: uri(rkey), IndexedAt: mustTimestamp("2025-03-01T00:00:00Z")}
+	}
+	newer := syntax.NewTID(start.Add(time.Minute), 0).String()
+	pds.rkeys[newer] = true
+	store.statuses[uri(newer)] = db.Status{URI: uri(newer), IndexedAt: mustTimestamp("2025-03-07T12:01:00Z")}
+
+	return store, pds
+}
+
+type recordedSleeps struct {
+	waits    []time.Duration
+	shutdown int // Cancel the context during the nth sleep
+	cancel   context.CancelFunc
+}
+
+func (r *recordedSleeps) sleep(ctx context.Context, d time.Duration) error {
+	r.waits = append(r.waits, d)
+	if r.shutdown != 0 && len(r.waits) == r.shutdown {
+		r.cancel()
+	}
+	return ctx.Err()
+}
+
+func newTestPurger(store *memStore, pds *fakePDS, sleeps *recordedSleeps) *Purger {
+	p := New(store, atproto.NewSessions(store, nil))
+	p.newClient = func(sess *atproto.Session) (Client, error) { return pds, nil }
+	p.now = func() time.Time { return start }
+	p.sleep = sleeps.sleep
+	return p
+}
+
+func TestPurge(t *testing.T) {
+	store, pds := seed(t, 250)
+	p := newTestPurger(store, pds, &recordedSleeps{})
+
+	if err := p.Start(context.Background(), testDID); err != nil {
+		t.Fatal(err)
+	}
+	p.runJob(context.Background(), <-p.requests)
+
+	job := store.jobs[testDID]
+	if job.State != db.PurgeDone || job.Deleted != 250 || job.Total != 251 {
+		t.Errorf("job = %+v, want done with 250 of 251 deleted", job)
+	}
+	for _, n := range pds.calls {
+		if n > pageSize {
+			t.Errorf("applyWrites call with %d writes", n)
+		}
+	}
+	if len(pds.rkeys) != 1 || len(store.statuses) != 1 {
+		t.Errorf("%d records and %d rows left, want only the newer status", len(pds.rkeys), len(store.statuses))
+	}
+}
+
+func TestPurgeWaitsOutRateLimit(t *testing.T) {
+	store, pds := seed(t, 10)
+	sleeps := &recordedSleeps{}
+	p := newTestPurger(store, pds, sleeps)
+
+	pds.failures = []error{&xrpc.Error{
+		StatusCode: 429,
+		Wrapped:    &xrpc.XRPCError{ErrStr: "RateLimitExceeded"},
+		Ratelimit:  &xrpc.RatelimitInfo{Reset: start.Add(20 * time.Minute)},
+	}}
+
+	if err := p.Start(context.Background(), testDID); err != nil {
+		t.Fatal(err)
+	}
+	p.runJob(context.Background(), <-p.requests)
+
+	if len(sleeps.waits) == 0 || sleeps.waits[0] != 20*time.Minute {
+		t.Errorf("waits = %v, want a 20m wait for the rate limit to reset", sleeps.waits)
+	}
+	if job := store.jobs[testDID]; job.State != db.PurgeDone {
+		t.Errorf("job = %+v, want done", job)
+	}
+}
+
+func TestPurgeResumesAfterInterruption(t *testing.T) {
+	store, pds := seed(t, 250)
+
+	// Shut down after the first batch, which also listed the newer status
+	ctx, cancel := context.WithCancel(context.Background())
+	p := newTestPurger(store, pds, &recordedSleeps{shutdown: 1, cancel: cancel})
+	if err := p.Start(context.Background(), testDID); err != nil {
+		t.Fatal(err)
+	}
+	p.runJob(ctx, <-p.requests)
+
+	job := store.jobs[testDID]
+	if job.State != db.PurgeRunning || job.Deleted != pageSize-1 {
+		t.Fatalf("job = %+v, want running after one batch", job)
+	}
+	if len(store.statuses) != 251-(pageSize-1) {
+		t.Errorf("%d rows left, want %d", len(store.statuses), 251-(pageSize-1))
+	}
+
+	// The next batch is deleted on the PDS, but the process dies before the local rows are
+	for rkey := range pds.rkeys {
+		if createdBefore(syntax.RecordKey(rkey), start) {
+			delete(pds.rkeys, rkey)
+			break
+		}
+	}
+
+	// Restart
+	p = newTestPurger(store, pds, &recordedSleeps{})
+	go p.Run(context.Background())
+	deadline := time.Now().Add(5 * time.Second)
+	for store.job(testDID).State == db.PurgeRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if job := store.job(testDID); job.State != db.PurgeDone {
+		t.Fatalf("job = %+v, want done", job)
+	}
+	if n, _ := store.CountUserStatuses(context.Background(), testDID); n != 1 {
+		t.Errorf("%d rows left, want only the newer status", n)
+	}
+}
+
+func TestPurgeFails(t *testing.T) {
+	store, pds := seed(t, 10)
+	boom := errors.New("internal server error")
+	pds.failures = []error{boom, boom, boom}
+	p := newTestPurger(store, pds, &recordedSleeps{})
+
+	if err := p.Start(context.Background(), testDID); err != nil {
+		t.Fatal(err)
+	}
+	p.runJob(context.Background(), <-p.requests)
+
+	job := store.jobs[testDID]
+	if job.State != db.PurgeFailed || job.LastError == "" {
+		t.Errorf("job = %+v, want failed", job)
+	}
+	if len(store.statuses) != 11 {
+		t.Errorf("%d rows left, want all 11 kept when nothing was deleted", len(store.statuses))
+	}
+
+	// Starting again picks up where the failed job left off
+	if err := p.Start(context.Background(), testDID); err != nil {
+		t.Fatal(err)
+	}
+	p.runJob(context.Background(), <-p.requests)
+	if job := store.jobs[testDID]; job.State != db.PurgeDone {
+		t.Errorf("job = %+v, want done", job)
+	}
+}
+
+// mustTimestamp parses a timestamp in a test table
+func mustTimestamp(s string) db.Timestamp {
+	t, err := db.ParseTimestamp(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
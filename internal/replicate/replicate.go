@@ -0,0 +1,616 @@
+// Package replicate streams the SQLite WAL to a replica target as it is
+// written, in the style of Litestream, so the database can be restored to
+// any point in time the replica still covers
+package replicate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultSyncInterval is how often new WAL frames are shipped to the target
+	DefaultSyncInterval = time.Second
+
+	// DefaultSnapshotInterval is how often a new generation starts with a full snapshot
+	DefaultSnapshotInterval = 24 * time.Hour
+
+	// DefaultRetention is how far back point-in-time restores can go
+	DefaultRetention = 24 * time.Hour
+
+	// checkpointFrames is the WAL length at which the replicator checkpoints,
+	// below SQLite's automatic checkpoint at 1000 pages so it is usually first
+	checkpointFrames = 500
+
+	generationLayout = "20060102T150405.000Z"
+)
+
+// Stats describes the state of replication, for the replication expvar
+type Stats struct {
+	Generation string    `json:"generation"`
+	Segments   int       `json:"segments"` // Segments shipped in the current generation
+	Bytes      int64     `json:"bytes"`    // Bytes shipped since starting, compressed
+	LastSync   time.Time `json:"lastSync"`
+	LastError  string    `json:"lastError,omitempty"`
+
+	// LagSeconds is how long ago the replica last held every committed write
+	LagSeconds float64 `json:"lagSeconds"`
+}
+
+// Replicator ships a SQLite database's WAL to a target. Each generation
+// starts with a snapshot of the database, followed by numbered segments of
+// the WAL frames committed since; restoring replays them over the snapshot.
+//
+// Between syncs the replicator holds a read transaction open, so SQLite's
+// automatic checkpoints cannot restart the WAL and overwrite frames it has
+// not shipped yet; it checkpoints the WAL itself once everything is shipped.
+// A gap it cannot rule out, such as the WAL restarting behind its back,
+// starts a new generation.
+type Replicator struct {
+	path    string
+	walPath string
+	target  Target
+
+	// SyncInterval is how often new WAL frames are shipped
+	SyncInterval time.Duration
+
+	// SnapshotInterval is how often a new generation is started
+	SnapshotInterval time.Duration
+
+	// Retention is how long generations are kept after they are superseded
+	Retention time.Duration
+
+	// mu serializes syncs and guards the replication state
+	mu       sync.Mutex
+	db       *sql.DB
+	lockConn *sql.Conn // Holds the read lock between syncs, and the write lock while taking a snapshot
+	inTx     bool      // A transaction is open on lockConn
+	closed   bool
+
+	generation string
+	startedAt  time.Time // When the current generation started
+	index      int       // Number of the next segment
+	pos        walPosition
+	restartOK  bool // Everything committed has been shipped and checkpointed, so the WAL may restart
+
+	// statsMu guards the stats, which are read while a sync is running
+	statsMu    sync.Mutex
+	stats      Stats
+	openedAt   time.Time
+	caughtUpAt time.Time
+
+	now func() time.Time
+}
+
+// New creates a replicator for the SQLite database file at path
+func New(path string, target Target) *Replicator {
+	return &Replicator{
+		path:             path,
+		walPath:          path + "-wal",
+		target:           target,
+		SyncInterval:     DefaultSyncInterval,
+		SnapshotInterval: DefaultSnapshotInterval,
+		Retention:        DefaultRetention,
+		now:              time.Now,
+	}
+}
+
+// Run ships the WAL on every sync interval until the context is cancelled,
+// starting with a new generation. Call Close once nothing else writes to the
+// database to ship the last frames.
+func (r *Replicator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Sync(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Str("generation", r.Stats().Generation).Msg("Failed to replicate database")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close ships any frames not yet replicated and releases the database
+func (r *Replicator) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	var err error
+	if r.db != nil {
+		err = r.sync(ctx)
+		r.releaseLock()
+		r.lockConn.Close()
+		r.db.Close()
+	}
+	r.closed = true
+	return err
+}
+
+// Stats returns the state of replication
+func (r *Replicator) Stats() Stats {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	stats := r.stats
+	since := r.caughtUpAt
+	if since.IsZero() {
+		since = r.openedAt
+	}
+	if !since.IsZero() {
+		stats.LagSeconds = r.now().Sub(since).Seconds()
+	}
+	return stats
+}
+
+// Sync ships the frames committed since the last sync, starting a new
+// generation first if there is none yet or the WAL cannot be followed
+func (r *Replicator) Sync(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return errors.New("replicator is closed")
+	}
+	err := r.sync(ctx)
+
+	r.statsMu.Lock()
+	r.stats.LastSync = r.now()
+	r.stats.LastError = ""
+	if err != nil {
+		r.stats.LastError = err.Error()
+	}
+	r.statsMu.Unlock()
+
+	return err
+}
+
+// sync does the work of Sync while holding mu
+func (r *Replicator) sync(ctx context.Context) error {
+	if r.db == nil {
+		if err := r.open(ctx); err != nil {
+			return err
+		}
+	}
+	// Afterwards take a fresh read lock, so checkpoints can get as far as
+	// what has been shipped
+	defer r.refreshReadLock(ctx)
+
+	if r.generation == "" || r.now().Sub(r.startedAt) >= r.SnapshotInterval {
+		return r.startGeneration(ctx)
+	}
+
+	frames, err := r.shipFrames(ctx)
+	if errors.Is(err, errWALRestarted) {
+		log.Warn().Str("generation", r.generation).Msg("WAL restarted before it was fully replicated; starting a new generation")
+		return r.startGeneration(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if frames >= checkpointFrames {
+		return r.checkpoint(ctx)
+	}
+	return nil
+}
+
+// errWALRestarted is returned when the WAL was restarted while it may still
+// have held frames that were not shipped
+var errWALRestarted = errors.New("WAL restarted")
+
+// shipFrames uploads the frames committed since the last sync as the next
+// segment, and returns how many frames the WAL now holds
+func (r *Replicator) shipFrames(ctx context.Context) (int64, error) {
+	start := r.now()
+
+	hdr, err := readWALHeader(r.walPath)
+	if errors.Is(err, errNoWAL) {
+		r.markCaughtUp(start)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read WAL: %w", err)
+	}
+
+	if r.pos.offset != 0 && (hdr.salt1 != r.pos.salt1 || hdr.salt2 != r.pos.salt2) {
+		// Restarting after a checkpoint bumps the first salt by one; any other
+		// change means there may have been restarts in between
+		if !r.restartOK || hdr.salt1 != r.pos.salt1+1 {
+			return 0, errWALRestarted
+		}
+		r.pos = walPosition{}
+	}
+
+	frames, pos, err := readCommittedFrames(r.walPath, hdr, r.pos)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read WAL: %w", err)
+	}
+	if len(frames) > 0 {
+		if err := r.putSegment(ctx, frames, start); err != nil {
+			return 0, err
+		}
+		r.restartOK = false
+	}
+	r.pos = pos
+	r.markCaughtUp(start)
+
+	return (pos.offset - walHeaderSize) / hdr.frameSize(), nil
+}
+
+// putSegment uploads frames read at a given time as the generation's next segment
+func (r *Replicator) putSegment(ctx context.Context, frames []byte, readAt time.Time) error {
+	key := segmentKey(r.generation, r.index, readAt)
+	n, err := putCompressed(ctx, r.target, key, bytes.NewReader(frames))
+	if err != nil {
+		return err
+	}
+
+	r.index++
+	r.statsMu.Lock()
+	r.stats.Segments = r.index
+	r.stats.Bytes += n
+	r.statsMu.Unlock()
+	return nil
+}
+
+// markCaughtUp records that everything committed before t has been shipped
+func (r *Replicator) markCaughtUp(t time.Time) {
+	r.statsMu.Lock()
+	r.caughtUpAt = t
+	r.statsMu.Unlock()
+}
+
+// checkpoint copies the WAL back into the database once it is all shipped,
+// letting SQLite restart it. Writes carry on meanwhile: the fresh read lock
+// stops the checkpoint copying frames committed after it was taken, and if
+// the WAL holds more than was shipped it is left to the next checkpoint to
+// let SQLite restart it.
+func (r *Replicator) checkpoint(ctx context.Context) error {
+	r.refreshReadLock(ctx)
+
+	frames, err := r.shipFrames(ctx)
+	if err != nil {
+		return err
+	}
+
+	// PASSIVE, on the other connection: the modes that restart the WAL
+	// themselves would wait for the write lock this connection holds
+	var busy, logged, checkpointed int64
+	if err := r.db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(PASSIVE)`).Scan(&busy, &logged, &checkpointed); err != nil {
+		return fmt.Errorf("failed to checkpoint: %w", err)
+	}
+	// Readers still using older frames stop a checkpoint getting all the
+	// way; the next sync tries again
+	r.restartOK = busy == 0 && logged == frames && checkpointed == logged
+
+	return nil
+}
+
+// startGeneration starts a new generation with a snapshot of the database.
+// The write lock is held only until the snapshot is pinned to a WAL position,
+// so it lines up exactly with the WAL; it is copied and uploaded under read
+// locks, so writes carry on meanwhile but the WAL cannot restart and lose
+// frames committed after the snapshot.
+func (r *Replicator) startGeneration(ctx context.Context) error {
+	r.releaseLock()
+	if err := r.acquireWriteLock(ctx); err != nil {
+		return err
+	}
+	defer r.releaseLock()
+
+	start := r.now()
+	generation := start.UTC().Format(generationLayout)
+
+	snapshot, pos, err := r.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshot)
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	defer f.Close()
+	n, err := putCompressed(ctx, r.target, snapshotKey(generation), f)
+	if err != nil {
+		return err
+	}
+
+	r.generation = generation
+	r.startedAt = start
+	r.index = 0
+	r.pos = pos
+	// Everything committed is in the snapshot, so the WAL may restart
+	r.restartOK = true
+	r.markCaughtUp(start)
+
+	r.statsMu.Lock()
+	r.stats.Generation = generation
+	r.stats.Segments = 0
+	r.stats.Bytes += n
+	r.statsMu.Unlock()
+
+	log.Info().Str("generation", generation).Int64("bytes", n).Msg("Started replica generation")
+
+	// Ship what was committed during the copy and upload, as the first segment
+	if _, err := r.shipFrames(ctx); err != nil {
+		return err
+	}
+
+	if err := r.prune(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to prune replica generations")
+	}
+	return nil
+}
+
+// walEnd returns the position of the last commit in the WAL. The write lock
+// must be held, so no commit can follow it.
+func (r *Replicator) walEnd() (walPosition, error) {
+	hdr, err := readWALHeader(r.walPath)
+	if errors.Is(err, errNoWAL) {
+		return walPosition{}, nil
+	}
+	if err != nil {
+		return walPosition{}, fmt.Errorf("failed to read WAL: %w", err)
+	}
+
+	frames, pos, err := readCommittedFrames(r.walPath, hdr, walPosition{})
+	if err != nil {
+		return walPosition{}, fmt.Errorf("failed to read WAL: %w", err)
+	}
+	if len(frames) == 0 {
+		// Whatever is in the WAL is already in the database file
+		pos = walPosition{salt1: hdr.salt1, salt2: hdr.salt2, offset: walHeaderSize, checksum: hdr.checksum}
+	}
+	return pos, nil
+}
+
+// snapshot copies the database to a temporary file next to it, returning the
+// copy and the WAL position it is current to. The write lock must be held; it
+// is traded for a read lock once a read transaction on another connection has
+// pinned the database, and the copy is taken from that transaction with
+// SQLite's online backup API while writes carry on.
+func (r *Replicator) snapshot(ctx context.Context) (string, walPosition, error) {
+	src, err := r.beginRead(ctx)
+	if err != nil {
+		return "", walPosition{}, err
+	}
+	defer src.Close()
+	defer src.ExecContext(context.Background(), `ROLLBACK`)
+
+	pos, err := r.walEnd()
+	if err != nil {
+		return "", walPosition{}, err
+	}
+
+	// Let writers go again
+	r.refreshReadLock(ctx)
+	if !r.inTx {
+		return "", walPosition{}, errors.New("failed to take replication read lock")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".snapshot-*")
+	if err != nil {
+		return "", walPosition{}, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	tmp.Close()
+	if err := backup(ctx, src, tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return "", walPosition{}, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	return tmp.Name(), pos, nil
+}
+
+// backup copies the database src reads into the SQLite file at dest
+func backup(ctx context.Context, src *sql.Conn, dest string) error {
+	destDB, err := sql.Open("sqlite3", "file:"+dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return src.Raw(func(srcDriverConn interface{}) error {
+			b, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			// One step copies every page within src's read transaction
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// prune deletes generations superseded longer than the retention period ago,
+// which no restore within the period needs
+func (r *Replicator) prune(ctx context.Context) error {
+	generations, err := listGenerations(ctx, r.target)
+	if err != nil {
+		return err
+	}
+
+	cutoff := r.now().Add(-r.Retention)
+	for i, g := range generations {
+		if i+1 == len(generations) || g.Name == r.generation || generations[i+1].Start.After(cutoff) {
+			continue
+		}
+		for _, key := range g.keys {
+			if err := r.target.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		log.Info().Str("generation", g.Name).Msg("Pruned replica generation")
+	}
+
+	return nil
+}
+
+// open connects to the database. Replication needs the database in WAL mode.
+func (r *Replicator) open(ctx context.Context) error {
+	db, err := sql.Open("sqlite3", "file:"+r.path+"?_busy_timeout=5000")
+	if err != nil {
+		return fmt.Errorf("failed to open database for replication: %w", err)
+	}
+	// One connection holds the locks, the other checkpoints
+	db.SetMaxOpenConns(2)
+
+	var mode string
+	if err := db.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&mode); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to open database for replication: %w", err)
+	}
+	if !strings.EqualFold(mode, "wal") {
+		db.Close()
+		return fmt.Errorf("replication needs the database in WAL mode, not %s", mode)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to open database for replication: %w", err)
+	}
+
+	r.db = db
+	r.lockConn = conn
+	r.statsMu.Lock()
+	r.openedAt = r.now()
+	r.statsMu.Unlock()
+	return nil
+}
+
+// refreshReadLock ends any transaction held and opens a read transaction,
+// which stops the WAL being restarted until it ends. Failing only risks a
+// new generation, so the error is logged rather than returned.
+func (r *Replicator) refreshReadLock(ctx context.Context) {
+	r.releaseLock()
+	if r.closed || r.lockConn == nil {
+		return
+	}
+	if _, err := r.lockConn.ExecContext(ctx, `BEGIN`); err != nil {
+		log.Warn().Err(err).Msg("Failed to take replication read lock")
+		return
+	}
+	r.inTx = true
+	var n int
+	if err := r.lockConn.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master`).Scan(&n); err != nil {
+		log.Warn().Err(err).Msg("Failed to take replication read lock")
+	}
+}
+
+// beginRead opens a read transaction on another connection, which sees the
+// database as it is now for as long as the connection is held
+func (r *Replicator) beginRead(ctx context.Context) (*sql.Conn, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take replication read lock: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `BEGIN`); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to take replication read lock: %w", err)
+	}
+	var n int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master`).Scan(&n); err != nil {
+		conn.ExecContext(context.Background(), `ROLLBACK`)
+		conn.Close()
+		return nil, fmt.Errorf("failed to take replication read lock: %w", err)
+	}
+	return conn, nil
+}
+
+// acquireWriteLock waits for other writers to finish and stops new ones
+// starting, up to the busy timeout
+func (r *Replicator) acquireWriteLock(ctx context.Context) error {
+	if _, err := r.lockConn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return fmt.Errorf("failed to lock database for replication: %w", err)
+	}
+	r.inTx = true
+	return nil
+}
+
+// releaseLock ends the read or write transaction held, if any
+func (r *Replicator) releaseLock() {
+	if !r.inTx {
+		return
+	}
+	// Not the caller's context: a lock must be released even on cancellation
+	if _, err := r.lockConn.ExecContext(context.Background(), `ROLLBACK`); err != nil {
+		log.Warn().Err(err).Msg("Failed to release replication lock")
+	}
+	r.inTx = false
+}
+
+// putCompressed streams r, gzipped, into an object, returning the compressed
+// size. Snapshots are as large as the database, so they are never held in memory.
+func putCompressed(ctx context.Context, target Target, key string, r io.Reader) (int64, error) {
+	pr, pw := io.Pipe()
+	counter := &countingWriter{w: pw}
+	done := make(chan error, 1)
+	go func() {
+		zw := gzip.NewWriter(counter)
+		_, err := io.Copy(zw, r)
+		if err == nil {
+			err = zw.Close()
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to compress %s: %w", key, err)
+		}
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	if err := target.Put(ctx, key, pr, -1); err != nil {
+		// Unblock the compressor if the upload gave up partway
+		pr.CloseWithError(err)
+		<-done
+		return 0, err
+	}
+	if err := <-done; err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,259 @@
+package replicate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+type testDB struct {
+	*db.DB
+	path  string
+	saved int
+}
+
+func openDB(t *testing.T) *testDB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "statusphere.db")
+	database, err := db.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return &testDB{DB: database, path: path}
+}
+
+// save commits n statuses, one transaction each
+func (d *testDB) save(t *testing.T, n int) {
+	t.Helper()
+	at := db.NewTimestamp(time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC))
+	for i := 0; i < n; i++ {
+		err := d.SaveStatus(context.Background(), &db.Status{
+			URI:       syntax.ATURI(fmt.Sprintf("at://did:plc:alice/xyz.statusphere.status/%06d", d.saved)),
+			AuthorDID: "did:plc:alice",
+			Status:    "👍",
+			CreatedAt: at,
+			IndexedAt: at,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.saved++
+	}
+}
+
+func newTestReplicator(t *testing.T, d *testDB) *Replicator {
+	t.Helper()
+	r := New(d.path, NewDirTarget(filepath.Join(t.TempDir(), "replica")))
+	// A second per reading of the clock, so every segment has a time of its own
+	at := time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time {
+		at = at.Add(time.Second)
+		return at
+	}
+	t.Cleanup(func() { r.Close(context.Background()) })
+	return r
+}
+
+func syncNow(t *testing.T, r *Replicator) time.Time {
+	t.Helper()
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return r.now()
+}
+
+// restoredCount restores the replica as of at and counts the statuses in it
+func restoredCount(t *testing.T, r *Replicator, at time.Time) int {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "restored.db")
+	if _, err := Restore(context.Background(), r.target, at, dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckSQLiteFile(dest); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := sqlx.Connect("sqlite3", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	var count int
+	if err := restored.Get(&count, `SELECT COUNT(*) FROM status`); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func generationCount(t *testing.T, r *Replicator) int {
+	t.Helper()
+	generations, err := Generations(context.Background(), r.target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(generations)
+}
+
+// hookTarget runs a hook before storing each snapshot
+type hookTarget struct {
+	Target
+	beforeSnapshot func()
+}
+
+func (h *hookTarget) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if strings.HasSuffix(key, "/snapshot.db.gz") {
+		h.beforeSnapshot()
+	}
+	return h.Target.Put(ctx, key, r, size)
+}
+
+func TestWritesDuringSnapshotUpload(t *testing.T) {
+	d := openDB(t)
+	d.save(t, 3)
+	r := newTestReplicator(t, d)
+
+	// Writes would time out if the snapshot were uploaded under the write lock
+	r.target = &hookTarget{Target: r.target, beforeSnapshot: func() { d.save(t, 2) }}
+	at := syncNow(t, r)
+
+	if got := restoredCount(t, r, at); got != 5 {
+		t.Errorf("restored %d statuses, want 5 including those written during the upload", got)
+	}
+}
+
+func TestSnapshotNextToDatabase(t *testing.T) {
+	d := openDB(t)
+	d.save(t, 1)
+	r := newTestReplicator(t, d)
+
+	// The copy is as large as the database, so it goes where there is room for one
+	var during []string
+	r.target = &hookTarget{Target: r.target, beforeSnapshot: func() { during, _ = filepath.Glob(d.path + ".snapshot-*") }}
+	syncNow(t, r)
+
+	if len(during) != 1 {
+		t.Errorf("snapshot copies next to the database = %v, want one", during)
+	}
+	if after, _ := filepath.Glob(d.path + ".snapshot-*"); len(after) != 0 {
+		t.Errorf("snapshot copies left behind: %v", after)
+	}
+}
+
+func TestPointInTimeRestore(t *testing.T) {
+	d := openDB(t)
+	d.save(t, 3)
+	r := newTestReplicator(t, d)
+
+	snapshotted := syncNow(t, r)
+	d.save(t, 2)
+	first := syncNow(t, r)
+	d.save(t, 4)
+	second := syncNow(t, r)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{"snapshot", snapshotted, 3},
+		{"first segment", first, 5},
+		{"between segments", first.Add(500 * time.Millisecond), 5},
+		{"second segment", second, 9},
+		{"latest", time.Time{}, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restoredCount(t, r, tt.at); got != tt.want {
+				t.Errorf("restored %d statuses, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Restore(context.Background(), r.target, snapshotted.Add(-time.Hour), filepath.Join(t.TempDir(), "early.db")); err != ErrNoGeneration {
+		t.Errorf("Restore() before the first generation = %v, want ErrNoGeneration", err)
+	}
+}
+
+func TestReplicateAcrossCheckpoints(t *testing.T) {
+	d := openDB(t)
+	r := newTestReplicator(t, d)
+	d.save(t, 1)
+	syncNow(t, r)
+	salt := r.pos.salt1
+
+	// Enough transactions to pass the checkpoint threshold a few times over
+	for i := 0; i < 4; i++ {
+		d.save(t, checkpointFrames/2)
+		syncNow(t, r)
+		syncNow(t, r)
+	}
+	d.save(t, 5)
+	syncNow(t, r)
+
+	if r.pos.salt1 <= salt+1 {
+		t.Errorf("WAL salt went from %d to %d, want it restarted more than once", salt, r.pos.salt1)
+	}
+	if got := generationCount(t, r); got != 1 {
+		t.Errorf("%d generations, want the WAL followed across checkpoints in one", got)
+	}
+	if got := restoredCount(t, r, time.Time{}); got != d.saved {
+		t.Errorf("restored %d statuses, want %d", got, d.saved)
+	}
+}
+
+func TestWALRestartedBehindReplicator(t *testing.T) {
+	d := openDB(t)
+	r := newTestReplicator(t, d)
+	syncNow(t, r)
+	d.save(t, 2)
+	syncNow(t, r)
+
+	// Frames written, checkpointed and overwritten between syncs are lost to
+	// the replica, so it must start again from a snapshot
+	r.releaseLock()
+	d.save(t, 2)
+	if _, err := d.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		t.Fatal(err)
+	}
+	d.save(t, 1)
+	syncNow(t, r)
+
+	if got := generationCount(t, r); got != 2 {
+		t.Errorf("%d generations, want a new one after the restart", got)
+	}
+	if got := restoredCount(t, r, time.Time{}); got != d.saved {
+		t.Errorf("restored %d statuses, want %d", got, d.saved)
+	}
+}
+
+func TestPruneGenerations(t *testing.T) {
+	d := openDB(t)
+	r := newTestReplicator(t, d)
+	r.SnapshotInterval = time.Nanosecond
+	r.Retention = 0
+
+	for i := 0; i < 3; i++ {
+		d.save(t, 1)
+		syncNow(t, r)
+	}
+
+	generations, err := Generations(context.Background(), r.target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generations) != 1 || generations[0].Name != r.generation {
+		t.Errorf("generations = %v, want only the current one", generations)
+	}
+}
@@ -0,0 +1,228 @@
+package replicate
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoGeneration is returned when the replica has nothing to restore from
+// for the time asked for
+var ErrNoGeneration = errors.New("no replica generation covers that time")
+
+// Replica objects are laid out as
+//
+//	generations/<start>/snapshot.db.gz
+//	generations/<start>/wal/<index>-<time>.wal.gz
+//
+// where times are UTC and sort lexically, so listing a generation returns
+// its segments in order
+const generationsPrefix = "generations/"
+
+func snapshotKey(generation string) string {
+	return generationsPrefix + generation + "/snapshot.db.gz"
+}
+
+func segmentKey(generation string, index int, readAt time.Time) string {
+	return fmt.Sprintf("%s%s/wal/%08d-%s.wal.gz", generationsPrefix, generation, index, readAt.UTC().Format(generationLayout))
+}
+
+// Generation is a snapshot and the WAL segments shipped after it
+type Generation struct {
+	Name     string
+	Start    time.Time // When the snapshot was taken
+	End      time.Time // When the last segment was read, or Start if there are none
+	Segments []Segment
+
+	hasSnapshot bool
+	keys        []string
+}
+
+// Segment is a run of committed WAL frames
+type Segment struct {
+	Index  int
+	ReadAt time.Time // Every transaction committed before this is in this segment or an earlier one
+	key    string
+}
+
+// listGenerations reads the generations in a replica, oldest first
+func listGenerations(ctx context.Context, target Target) ([]*Generation, error) {
+	keys, err := target.List(ctx, generationsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var generations []*Generation
+	byName := map[string]*Generation{}
+	for _, key := range keys {
+		name, rest, ok := strings.Cut(strings.TrimPrefix(key, generationsPrefix), "/")
+		if !ok {
+			continue
+		}
+		g := byName[name]
+		if g == nil {
+			start, err := time.Parse(generationLayout, name)
+			if err != nil {
+				continue
+			}
+			g = &Generation{Name: name, Start: start, End: start}
+			byName[name] = g
+			generations = append(generations, g)
+		}
+		g.keys = append(g.keys, key)
+
+		if rest == "snapshot.db.gz" {
+			g.hasSnapshot = true
+			continue
+		}
+		index, readAt, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(rest, "wal/"), ".wal.gz"), "-")
+		if !ok {
+			continue
+		}
+		segment := Segment{key: key}
+		if segment.Index, err = strconv.Atoi(index); err != nil {
+			continue
+		}
+		if segment.ReadAt, err = time.Parse(generationLayout, readAt); err != nil {
+			continue
+		}
+		g.Segments = append(g.Segments, segment)
+		if segment.ReadAt.After(g.End) {
+			g.End = segment.ReadAt
+		}
+	}
+
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i].Start.Before(generations[j].Start)
+	})
+	return generations, nil
+}
+
+// Generations lists the generations in a replica that can be restored, oldest first
+func Generations(ctx context.Context, target Target) ([]*Generation, error) {
+	all, err := listGenerations(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var generations []*Generation
+	for _, g := range all {
+		if g.hasSnapshot {
+			generations = append(generations, g)
+		}
+	}
+	return generations, nil
+}
+
+// Restore rebuilds the database as of a point in time into a new file at
+// dest, from the newest generation started by then; the zero time restores
+// the latest state. It returns the time the restored database is current to:
+// every transaction committed before it is included.
+func Restore(ctx context.Context, target Target, at time.Time, dest string) (time.Time, error) {
+	generations, err := Generations(ctx, target)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var g *Generation
+	for _, candidate := range generations {
+		if at.IsZero() || !candidate.Start.After(at) {
+			g = candidate
+		}
+	}
+	if g == nil {
+		return time.Time{}, ErrNoGeneration
+	}
+
+	f, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create restored database: %w", err)
+	}
+	restoredTo, err := replay(ctx, target, g, at, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return time.Time{}, err
+	}
+
+	return restoredTo, nil
+}
+
+// replay writes a generation's snapshot into f and applies its segments up to at
+func replay(ctx context.Context, target Target, g *Generation, at time.Time, f *os.File) (time.Time, error) {
+	if err := getCompressed(ctx, target, snapshotKey(g.Name), func(r io.Reader) error {
+		_, err := io.Copy(f, r)
+		return err
+	}); err != nil {
+		return time.Time{}, err
+	}
+
+	pageSize, err := databasePageSize(f)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	restoredTo := g.Start
+	for i, segment := range g.Segments {
+		if !at.IsZero() && segment.ReadAt.After(at) {
+			break
+		}
+		if segment.Index != i {
+			return time.Time{}, fmt.Errorf("generation %s is missing WAL segment %d", g.Name, i)
+		}
+		err := getCompressed(ctx, target, segment.key, func(r io.Reader) error {
+			frames, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			return applyFrames(f, pageSize, frames)
+		})
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to apply WAL segment %d: %w", segment.Index, err)
+		}
+		restoredTo = segment.ReadAt
+	}
+
+	return restoredTo, f.Sync()
+}
+
+// databasePageSize reads the page size from a SQLite database file's header
+func databasePageSize(f *os.File) (uint32, error) {
+	buf := make([]byte, 2)
+	if _, err := f.ReadAt(buf, 16); err != nil {
+		return 0, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	// 1 stands for 65536, which does not fit in two bytes
+	if size := binary.BigEndian.Uint16(buf); size != 1 {
+		return uint32(size), nil
+	}
+	return 65536, nil
+}
+
+// getCompressed downloads a gzipped object and passes its contents to read
+func getCompressed(ctx context.Context, target Target, key string, read func(io.Reader) error) error {
+	obj, err := target.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	zr, err := gzip.NewReader(obj)
+	if err != nil {
+		return fmt.Errorf("failed to decompress %s: %w", key, err)
+	}
+	if err := read(zr); err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return zr.Close()
+}
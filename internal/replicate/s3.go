@@ -0,0 +1,111 @@
+package replicate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// streamPartSize is the part size of uploads whose size is not known up front
+const streamPartSize = 16 << 20
+
+// S3Target stores replicas in an S3 bucket, or a bucket on an S3-compatible
+// service such as MinIO
+type S3Target struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Target connects to the bucket in an s3://bucket/prefix URL. The
+// endpoint defaults to AWS and may be set with ?endpoint=http://host:port,
+// and the region with ?region=. Credentials come from the standard
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+func NewS3Target(u *url.URL) (*S3Target, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid replica URL: missing bucket")
+	}
+
+	endpoint := "s3.amazonaws.com"
+	secure := true
+	lookup := minio.BucketLookupAuto
+	if raw := u.Query().Get("endpoint"); raw != "" {
+		e, err := url.Parse(raw)
+		if err != nil || e.Host == "" {
+			return nil, fmt.Errorf("invalid replica endpoint %q", raw)
+		}
+		endpoint = e.Host
+		secure = e.Scheme != "http"
+		// S3-compatible services generally only support path-style requests
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewEnvAWS(),
+		Secure:       secure,
+		Region:       u.Query().Get("region"),
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Target{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+// Put uploads an object
+func (t *S3Target) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+	if size < 0 {
+		// Otherwise the client buffers parts sized for the largest possible object
+		opts.PartSize = streamPartSize
+	}
+	_, err := t.client.PutObject(ctx, t.bucket, t.prefix+key, r, size, opts)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get downloads an object
+func (t *S3Target) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := t.client.GetObject(ctx, t.bucket, t.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	// GetObject is lazy; Stat surfaces a missing object now rather than on the first read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return obj, nil
+}
+
+// List lists the objects under a prefix; S3 returns them in lexical order
+func (t *S3Target) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range t.client.ListObjects(ctx, t.bucket, minio.ListObjectsOptions{Prefix: t.prefix + prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, obj.Err)
+		}
+		keys = append(keys, strings.TrimPrefix(obj.Key, t.prefix))
+	}
+	return keys, nil
+}
+
+// Delete deletes an object
+func (t *S3Target) Delete(ctx context.Context, key string) error {
+	if err := t.client.RemoveObject(ctx, t.bucket, t.prefix+key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
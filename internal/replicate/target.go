@@ -0,0 +1,157 @@
+package replicate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Target is where replicas are stored: a flat namespace of immutable objects
+// with slash-separated keys
+type Target interface {
+	// Put stores an object, replacing any with the same key. The size is -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Get opens an object for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// List returns the keys under a prefix, in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete removes an object; deleting one that does not exist is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// OpenTarget opens the replica target a URL points at: a local directory,
+// given as a path or a file:// URL, or an S3-compatible bucket, given as
+// s3://bucket/prefix with an optional ?endpoint= for S3-compatible services
+// such as MinIO
+func OpenTarget(rawURL string) (Target, error) {
+	if !strings.Contains(rawURL, "://") {
+		return NewDirTarget(rawURL), nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replica URL: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		return NewDirTarget(u.Path), nil
+	case "s3":
+		return NewS3Target(u)
+	default:
+		return nil, fmt.Errorf("unsupported replica URL scheme %q", u.Scheme)
+	}
+}
+
+// DirTarget stores replicas in a local directory, such as a mounted network share
+type DirTarget struct {
+	dir string
+}
+
+// NewDirTarget creates a target storing objects as files under dir
+func NewDirTarget(dir string) *DirTarget {
+	return &DirTarget{dir: filepath.Clean(dir)}
+}
+
+func (t *DirTarget) path(key string) string {
+	return filepath.Join(t.dir, filepath.FromSlash(key))
+}
+
+// Put writes the object to a temporary file and renames it into place, so
+// readers never see a partial object
+func (t *DirTarget) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path := t.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := writeFile(tmp, r); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// writeFile copies r to a new file and syncs it to disk
+func writeFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Get opens the object's file
+func (t *DirTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(t.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// List walks the directory under the prefix
+func (t *DirTarget) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(t.path(prefix), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(t.dir, path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes the object's file, and its directory once empty
+func (t *DirTarget) Delete(ctx context.Context, key string) error {
+	path := t.path(key)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	// Fails harmlessly while the directory still has files
+	for dir := filepath.Dir(path); len(dir) > len(t.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package replicate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The SQLite WAL file format, from https://www.sqlite.org/fileformat.html#the_write_ahead_log
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+	walMagicLE         = 0x377f0682 // Checksums computed on little-endian words
+	walMagicBE         = 0x377f0683 // Checksums computed on big-endian words
+)
+
+// errNoWAL is returned when the WAL file is missing or has no header yet
+var errNoWAL = errors.New("no WAL header")
+
+// walHeader is the header at the start of a WAL file. The salts change every
+// time the WAL is restarted, so frames left over from a previous cycle can be
+// told apart from current ones.
+type walHeader struct {
+	order    binary.ByteOrder // Byte order of checksum words
+	pageSize uint32
+	salt1    uint32
+	salt2    uint32
+	checksum [2]uint32 // Checksum of the header, which the first frame's checksum continues
+}
+
+// readWALHeader reads and validates the header of the WAL file at path
+func readWALHeader(path string) (*walHeader, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoWAL
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(f, buf); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, errNoWAL
+	} else if err != nil {
+		return nil, err
+	}
+	return parseWALHeader(buf)
+}
+
+// parseWALHeader validates a WAL header
+func parseWALHeader(buf []byte) (*walHeader, error) {
+	hdr := &walHeader{}
+	switch binary.BigEndian.Uint32(buf[0:]) {
+	case walMagicLE:
+		hdr.order = binary.LittleEndian
+	case walMagicBE:
+		hdr.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid WAL header magic")
+	}
+
+	hdr.pageSize = binary.BigEndian.Uint32(buf[8:])
+	hdr.salt1 = binary.BigEndian.Uint32(buf[16:])
+	hdr.salt2 = binary.BigEndian.Uint32(buf[20:])
+
+	hdr.checksum = walChecksum(hdr.order, [2]uint32{}, buf[:24])
+	if hdr.checksum[0] != binary.BigEndian.Uint32(buf[24:]) || hdr.checksum[1] != binary.BigEndian.Uint32(buf[28:]) {
+		return nil, fmt.Errorf("invalid WAL header checksum")
+	}
+
+	return hdr, nil
+}
+
+// frameSize is the size of a frame, header included
+func (h *walHeader) frameSize() int64 {
+	return walFrameHeaderSize + int64(h.pageSize)
+}
+
+// walChecksum continues SQLite's WAL checksum over b, whose length is a multiple of 8
+func walChecksum(order binary.ByteOrder, s [2]uint32, b []byte) [2]uint32 {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s[0] += order.Uint32(b[i:]) + s[1]
+		s[1] += order.Uint32(b[i+4:]) + s[0]
+	}
+	return s
+}
+
+// walPosition is how far into the current WAL file frames have been read
+type walPosition struct {
+	salt1, salt2 uint32
+	offset       int64     // Byte offset just past the last committed frame read
+	checksum     [2]uint32 // Running checksum at offset
+}
+
+// readCommittedFrames reads the frames of the WAL file after pos, up to and
+// including the last commit frame, checking each against the header's salts
+// and the running checksum. Frames after the last commit belong to a
+// transaction still being written, and frames that fail the checks are left
+// over from before the WAL was restarted; neither is returned. It returns the
+// raw frames and the position after them.
+func readCommittedFrames(path string, hdr *walHeader, pos walPosition) ([]byte, walPosition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, pos, err
+	}
+	defer f.Close()
+
+	if pos.offset < walHeaderSize {
+		pos = walPosition{salt1: hdr.salt1, salt2: hdr.salt2, offset: walHeaderSize, checksum: hdr.checksum}
+	}
+	if _, err := f.Seek(pos.offset, io.SeekStart); err != nil {
+		return nil, pos, err
+	}
+
+	var frames []byte
+	committed := pos
+	next := pos
+	frame := make([]byte, hdr.frameSize())
+	for {
+		if _, err := io.ReadFull(f, frame); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return nil, pos, err
+		}
+
+		if binary.BigEndian.Uint32(frame[8:]) != hdr.salt1 || binary.BigEndian.Uint32(frame[12:]) != hdr.salt2 {
+			break
+		}
+		checksum := walChecksum(hdr.order, next.checksum, frame[:8])
+		checksum = walChecksum(hdr.order, checksum, frame[walFrameHeaderSize:])
+		if checksum[0] != binary.BigEndian.Uint32(frame[16:]) || checksum[1] != binary.BigEndian.Uint32(frame[20:]) {
+			break
+		}
+
+		frames = append(frames, frame...)
+		next.offset += int64(len(frame))
+		next.checksum = checksum
+		if binary.BigEndian.Uint32(frame[4:]) != 0 {
+			committed = next
+		}
+	}
+
+	return frames[:committed.offset-pos.offset], committed, nil
+}
+
+// applyFrames writes WAL frames' pages into a database file. Each commit
+// frame sets the size of the database, so pages freed by the transaction are
+// truncated away.
+func applyFrames(db *os.File, pageSize uint32, frames []byte) error {
+	frameSize := walFrameHeaderSize + int(pageSize)
+	if len(frames)%frameSize != 0 {
+		return fmt.Errorf("WAL segment is %d bytes, not a whole number of %d-byte frames", len(frames), frameSize)
+	}
+
+	for i := 0; i < len(frames); i += frameSize {
+		frame := frames[i : i+frameSize]
+		pgno := binary.BigEndian.Uint32(frame[0:])
+		if _, err := db.WriteAt(frame[walFrameHeaderSize:], int64(pgno-1)*int64(pageSize)); err != nil {
+			return err
+		}
+		if commit := binary.BigEndian.Uint32(frame[4:]); commit != 0 {
+			if err := db.Truncate(int64(commit) * int64(pageSize)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
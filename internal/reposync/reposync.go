@@ -0,0 +1,295 @@
+// Package reposync backfills a user's status history from their repo, so
+// statuses written through other Statusphere instances show up locally
+package reposync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pageSize is the largest page com.atproto.repo.listRecords returns
+	pageSize = 100
+
+	// syncTimeout bounds a whole sync, however large the repo
+	syncTimeout = 10 * time.Minute
+
+	// queueSize is the number of sync requests that may wait to start
+	queueSize = 64
+
+	// workers is the number of syncs run at once
+	workers = 4
+)
+
+// Store persists imported statuses; *db.DB implements it
+type Store interface {
+	ImportStatus(ctx context.Context, status *db.Status) error
+	GetUserStatusURIs(ctx context.Context, authorDID syntax.DID, indexedBefore db.Timestamp) ([]syntax.ATURI, error)
+	DeleteStatuses(ctx context.Context, uris []syntax.ATURI) error
+}
+
+// Lister is the subset of the PDS client used to read a repo
+type Lister interface {
+	ListRecords(ctx context.Context, repo, collection, cursor string, limit int) (*atproto.RecordPage, error)
+	GetLatestCommit(ctx context.Context, did string) (*atproto.CommitMeta, error)
+}
+
+// Sessions loads users' auth sessions with usable tokens; *atproto.Sessions implements it
+type Sessions interface {
+	Load(ctx context.Context, did string) (*atproto.Session, error)
+}
+
+// ClientFunc creates a Lister for the session's PDS
+type ClientFunc func(sess *atproto.Session) (Lister, error)
+
+// Progress describes a user's running or most recent failed sync
+type Progress struct {
+	Imported int
+	Removed  int
+	Running  bool
+	Err      error
+}
+
+// Syncer imports users' status histories in the background
+type Syncer struct {
+	store     Store
+	sessions  Sessions
+	newClient ClientFunc
+	now       func() time.Time
+	requests  chan syntax.DID
+
+	mu       sync.Mutex
+	progress map[syntax.DID]*Progress
+}
+
+// New creates a syncer that reads repos from each user's PDS
+func New(store Store, sessions Sessions) *Syncer {
+	return &Syncer{
+		store:     store,
+		sessions:  sessions,
+		newClient: newClient,
+		now:       time.Now,
+		requests:  make(chan syntax.DID, queueSize),
+		progress:  make(map[syntax.DID]*Progress),
+	}
+}
+
+func newClient(sess *atproto.Session) (Lister, error) {
+	return atproto.NewClientFromSession(sess)
+}
+
+// Request queues a sync of the user's history, unless one is already queued or running
+func (s *Syncer) Request(did syntax.DID) {
+	s.mu.Lock()
+	if p, ok := s.progress[did]; ok && p.Running {
+		s.mu.Unlock()
+		return
+	}
+	s.progress[did] = &Progress{Running: true}
+	s.mu.Unlock()
+
+	select {
+	case s.requests <- did:
+	default:
+		log.Warn().Str("did", did.String()).Msg("Repo sync queue is full; skipping")
+		s.finish(did, fmt.Errorf("too many syncs in progress"))
+	}
+}
+
+// Progress returns the state of a user's sync. It returns nil once a sync
+// has completed successfully, or if none was requested.
+func (s *Syncer) Progress(did syntax.DID) *Progress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.progress[did]
+	if !ok {
+		return nil
+	}
+	snapshot := *p
+	return &snapshot
+}
+
+// Run performs requested syncs, a few at a time, until the context is cancelled
+func (s *Syncer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work takes requests off the queue and syncs them one after another
+func (s *Syncer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case did := <-s.requests:
+			syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+			err := s.Sync(syncCtx, did)
+			cancel()
+			if err != nil {
+				log.Error().Err(err).Str("did", did.String()).Msg("Failed to sync repo")
+			}
+			s.finish(did, err)
+		}
+	}
+}
+
+// Sync imports every status record in the user's repo and removes local
+// statuses that are no longer in it
+func (s *Syncer) Sync(ctx context.Context, did syntax.DID) error {
+	sess, err := s.sessions.Load(ctx, did.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := s.newClient(sess)
+	if err != nil {
+		return err
+	}
+
+	// Statuses indexed from here on were written during the sync and are kept
+	startedAt := db.NewTimestamp(s.now())
+
+	// The listing is at least as new as this rev, so imported rows never
+	// replace versions written after it
+	commit, err := client.GetLatestCommit(ctx, did.String())
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[syntax.ATURI]bool)
+	cursor := ""
+	for {
+		page, err := client.ListRecords(ctx, did.String(), atproto.StatusCollection, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range page.Records {
+			status, err := s.parseRecord(did, record)
+			if err != nil {
+				log.Warn().Err(err).Str("uri", record.URI).Msg("Skipping invalid status record")
+				continue
+			}
+			seen[status.URI] = true
+
+			status.Rev = commit.Rev
+			err = s.store.ImportStatus(ctx, status)
+			if errors.Is(err, db.ErrStaleStatus) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			s.update(did, func(p *Progress) { p.Imported++ })
+		}
+
+		if page.Cursor == "" || len(page.Records) == 0 {
+			break
+		}
+		cursor = page.Cursor
+	}
+
+	// Only prune once the whole listing has been read, so an interrupted sync never deletes anything
+	existing, err := s.store.GetUserStatusURIs(ctx, did, startedAt)
+	if err != nil {
+		return err
+	}
+
+	var stale []syntax.ATURI
+	for _, uri := range existing {
+		if !seen[uri] {
+			stale = append(stale, uri)
+		}
+	}
+	if len(stale) > 0 {
+		if err := s.store.DeleteStatuses(ctx, stale); err != nil {
+			return err
+		}
+	}
+	s.update(did, func(p *Progress) { p.Removed = len(stale) })
+
+	return nil
+}
+
+// parseRecord validates a listed record and converts it to a status row
+func (s *Syncer) parseRecord(did syntax.DID, record atproto.Record) (*db.Status, error) {
+	uri, err := syntax.ParseATURI(record.URI)
+	if err != nil {
+		return nil, err
+	}
+	if uri.DID() != did || uri.Collection() != atproto.StatusCollection {
+		return nil, fmt.Errorf("record is not a status in %s's repo", did)
+	}
+
+	var value atproto.StatusRecord
+	if err := json.Unmarshal(record.Value, &value); err != nil {
+		return nil, fmt.Errorf("failed to decode status record: %w", err)
+	}
+	if err := value.Validate(); err != nil {
+		return nil, err
+	}
+
+	createdAt, err := db.ParseTimestamp(value.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// New rows are placed in the feed by when they were created, not by when
+	// we happened to import them, as long as that time is plausible
+	indexedAt := db.NewTimestamp(s.now())
+	if createdAt.Before(indexedAt.Time) && db.EffectiveTime(createdAt, indexedAt).Equal(createdAt.Time) {
+		indexedAt = createdAt
+	}
+
+	return &db.Status{
+		URI:       uri,
+		AuthorDID: did,
+		Status:    value.Status,
+		CreatedAt: createdAt,
+		IndexedAt: indexedAt,
+		CID:       record.CID,
+	}, nil
+}
+
+// update applies a change to a user's progress
+func (s *Syncer) update(did syntax.DID, change func(p *Progress)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.progress[did]; ok {
+		change(p)
+	}
+}
+
+// finish records the outcome of a sync. Successful syncs are forgotten;
+// failures are kept so they can be shown until the next attempt.
+func (s *Syncer) finish(did syntax.DID, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		delete(s.progress, did)
+		return
+	}
+	if p, ok := s.progress[did]; ok {
+		p.Running = false
+		p.Err = err
+	}
+}
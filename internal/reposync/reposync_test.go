@@ -0,0 +1,291 @@
+package reposync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+const testDID = "did:plc:alice"
+
+// memStore is an in-memory Store
+type memStore struct {
+	statuses map[syntax.ATURI]db.Status
+}
+
+func (s *memStore) ImportStatus(ctx context.Context, status *db.Status) error {
+	if existing, ok := s.statuses[status.URI]; ok {
+		if existing.Rev > status.Rev {
+			return db.ErrStaleStatus
+		}
+		status.IndexedAt = existing.IndexedAt
+	}
+	s.statuses[status.URI] = *status
+	return nil
+}
+
+func (s *memStore) GetUserStatusURIs(ctx context.Context, authorDID syntax.DID, indexedBefore db.Timestamp) ([]syntax.ATURI, error) {
+	var uris []syntax.ATURI
+	for uri, status := range s.statuses {
+		if status.AuthorDID == authorDID && status.IndexedAt.Before(indexedBefore.Time) {
+			uris = append(uris, uri)
+		}
+	}
+	return uris, nil
+}
+
+func (s *memStore) DeleteStatuses(ctx context.Context, uris []syntax.ATURI) error {
+	for _, uri := range uris {
+		delete(s.statuses, uri)
+	}
+	return nil
+}
+
+// memSessions hands out a session for any DID
+type memSessions struct{}
+
+func (memSessions) Load(ctx context.Context, did string) (*atproto.Session, error) {
+	return &atproto.Session{DID: did}, nil
+}
+
+// fakeRepo serves a list of records in pages, optionally failing on one page
+type fakeRepo struct {
+	records  []atproto.Record
+	pageSize int
+	failPage int
+	calls    int
+}
+
+func (r *fakeRepo) ListRecords(ctx context.Context, repo, collection, cursor string, limit int) (*atproto.RecordPage, error) {
+	r.calls++
+	if r.failPage != 0 && r.calls == r.failPage {
+		return nil, errors.New("connection reset")
+	}
+
+	start := 0
+	if cursor != "" {
+		start, _ = strconv.Atoi(cursor)
+	}
+	end := min(start+r.pageSize, len(r.records))
+
+	page := &atproto.RecordPage{Records: r.records[start:end]}
+	if end < len(r.records) {
+		page.Cursor = strconv.Itoa(end)
+	}
+	return page, nil
+}
+
+func (r *fakeRepo) GetLatestCommit(ctx context.Context, did string) (*atproto.CommitMeta, error) {
+	return &atproto.CommitMeta{CID: "bafycommit", Rev: "3lbqsq6rwgc3a"}, nil
+}
+
+func statusRecord(t *testing.T, rkey, status, createdAt string) atproto.Record {
+	t.Helper()
+	value, err := json.Marshal(&atproto.StatusRecord{Type: atproto.StatusCollection, Status: status, CreatedAt: createdAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return atproto.Record{
+		URI:   fmt.Sprintf("at://%s/%s/%s", testDID, atproto.StatusCollection, rkey),
+		CID:   "bafy" + rkey,
+		Value: value,
+	}
+}
+
+func uri(rkey string) syntax.ATURI {
+	return syntax.NewRecordURI(testDID, atproto.StatusCollection, syntax.RecordKey(rkey))
+}
+
+func newTestSyncer(repo *fakeRepo, store *memStore) *Syncer {
+	s := New(store, memSessions{})
+	s.newClient = func(sess *atproto.Session) (Lister, error) { return repo, nil }
+	s.now = func() time.Time { return time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC) }
+	return s
+}
+
+func TestSync(t *testing.T) {
+	repo := &fakeRepo{pageSize: 2}
+	for i := 0; i < 5; i++ {
+		rkey := fmt.Sprintf("3lbqsq6rwgc2%d", i)
+		repo.records = append(repo.records, statusRecord(t, rkey, "👍", fmt.Sprintf("2025-01-0%dT10:00:00.000Z", i+1)))
+	}
+	repo.records = append(repo.records,
+		statusRecord(t, "3lbqsq6rwgc2x", "not an emoji", "2025-01-09T10:00:00.000Z"),
+		statusRecord(t, "3lbqsq6rwgc2y", "🔮", "2099-01-01T00:00:00.000Z"),
+		statusRecord(t, "3lbqsq6rwgc2w", "🦕", "1970-01-01T00:00:00.000Z"),
+	)
+
+	store := &memStore{statuses: map[syntax.ATURI]db.Status{
+		// Indexed long ago with a stale value
+		uri("3lbqsq6rwgc20"): {URI: uri("3lbqsq6rwgc20"), AuthorDID: testDID, Status: "👎", IndexedAt: mustTimestamp("2025-01-01T10:00:05Z")},
+		// Edited after the listing's rev
+		uri("3lbqsq6rwgc21"): {URI: uri("3lbqsq6rwgc21"), AuthorDID: testDID, Status: "🎉", IndexedAt: mustTimestamp("2025-01-02T10:00:05Z"), Rev: "3lbqsq6rwgc3b"},
+		// Deleted from the repo since
+		uri("3lbqsq6rwgc2z"): {URI: uri("3lbqsq6rwgc2z"), AuthorDID: testDID, Status: "💙", IndexedAt: mustTimestamp("2025-02-01T00:00:00Z")},
+		// Written while the sync was running
+		uri("3lbqsq6rwgc3a"): {URI: uri("3lbqsq6rwgc3a"), AuthorDID: testDID, Status: "🥹", IndexedAt: mustTimestamp("2025-03-07T12:00:01Z")},
+		// Someone else's
+		"at://did:plc:bob/xyz.statusphere.status/3lbqsq6rwgc2z": {AuthorDID: "did:plc:bob", IndexedAt: mustTimestamp("2025-02-01T00:00:00Z")},
+	}}
+
+	s := newTestSyncer(repo, store)
+	s.progress[testDID] = &Progress{Running: true}
+	if err := s.Sync(context.Background(), testDID); err != nil {
+		t.Fatal(err)
+	}
+
+	if repo.calls != 4 {
+		t.Errorf("listRecords calls = %d, want 4", repo.calls)
+	}
+	if p := s.Progress(testDID); p.Imported != 6 || p.Removed != 1 {
+		t.Errorf("progress = %+v, want 6 imported and 1 removed", p)
+	}
+
+	if got := store.statuses[uri("3lbqsq6rwgc20")]; got.Status != "👍" || got.IndexedAt.String() != "2025-01-01T10:00:05.000Z" || got.CID != "bafy3lbqsq6rwgc20" || got.Rev != "3lbqsq6rwgc3a" {
+		t.Errorf("existing status = %+v, want updated in place", got)
+	}
+	if got := store.statuses[uri("3lbqsq6rwgc21")]; got.Status != "🎉" {
+		t.Errorf("newer status = %+v, want kept", got)
+	}
+	if got := store.statuses[uri("3lbqsq6rwgc23")]; got.IndexedAt.String() != "2025-01-04T10:00:00.000Z" {
+		t.Errorf("imported status indexedAt = %q, want its createdAt", got.IndexedAt)
+	}
+	if got := store.statuses[uri("3lbqsq6rwgc2y")]; got.IndexedAt.String() != "2025-03-07T12:00:00.000Z" {
+		t.Errorf("future status indexedAt = %q, want now", got.IndexedAt)
+	}
+	if got := store.statuses[uri("3lbqsq6rwgc2w")]; got.IndexedAt.String() != "2025-03-07T12:00:00.000Z" || got.CreatedAt.String() != "1970-01-01T00:00:00.000Z" {
+		t.Errorf("implausibly old status = %+v, want indexed now with its createdAt kept", got)
+	}
+	if _, ok := store.statuses[uri("3lbqsq6rwgc2x")]; ok {
+		t.Error("invalid record was imported")
+	}
+	if _, ok := store.statuses[uri("3lbqsq6rwgc2z")]; ok {
+		t.Error("status deleted from the repo was kept")
+	}
+	if _, ok := store.statuses[uri("3lbqsq6rwgc3a")]; !ok {
+		t.Error("status written during the sync was removed")
+	}
+	if len(store.statuses) != 9 {
+		t.Errorf("have %d statuses, want 9", len(store.statuses))
+	}
+}
+
+func TestInterruptedSyncKeepsRows(t *testing.T) {
+	repo := &fakeRepo{pageSize: 1, failPage: 2}
+	repo.records = []atproto.Record{
+		statusRecord(t, "3lbqsq6rwgc20", "👍", "2025-01-01T10:00:00.000Z"),
+		statusRecord(t, "3lbqsq6rwgc21", "👍", "2025-01-02T10:00:00.000Z"),
+	}
+	store := &memStore{statuses: map[syntax.ATURI]db.Status{
+		uri("3lbqsq6rwgc21"): {URI: uri("3lbqsq6rwgc21"), AuthorDID: testDID, Status: "👍", IndexedAt: mustTimestamp("2025-01-02T10:00:00Z")},
+	}}
+
+	s := newTestSyncer(repo, store)
+	if err := s.Sync(context.Background(), testDID); err == nil {
+		t.Fatal("Sync() succeeded despite a failed page")
+	}
+	if _, ok := store.statuses[uri("3lbqsq6rwgc21")]; !ok {
+		t.Error("an interrupted sync removed a status")
+	}
+}
+
+func TestRequestProgress(t *testing.T) {
+	s := newTestSyncer(&fakeRepo{pageSize: 1}, &memStore{statuses: map[syntax.ATURI]db.Status{}})
+
+	if p := s.Progress(testDID); p != nil {
+		t.Fatalf("progress before any sync = %+v, want nil", p)
+	}
+
+	s.Request(testDID)
+	s.Request(testDID)
+	if len(s.requests) != 1 {
+		t.Errorf("queued %d syncs, want 1", len(s.requests))
+	}
+	if p := s.Progress(testDID); p == nil || !p.Running {
+		t.Errorf("progress = %+v, want running", p)
+	}
+
+	s.finish(testDID, errors.New("boom"))
+	if p := s.Progress(testDID); p == nil || p.Running || p.Err == nil {
+		t.Errorf("progress = %+v, want failed", p)
+	}
+
+	// A failed sync can be retried, and success clears it
+	<-s.requests
+	s.Request(testDID)
+	s.finish(testDID, nil)
+	if p := s.Progress(testDID); p != nil {
+		t.Errorf("progress after success = %+v, want nil", p)
+	}
+}
+
+// blockingRepo is an empty repo whose listings wait to be released, and
+// which records how many were in flight at once
+type blockingRepo struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (r *blockingRepo) ListRecords(ctx context.Context, repo, collection, cursor string, limit int) (*atproto.RecordPage, error) {
+	r.mu.Lock()
+	r.active++
+	r.maxSeen = max(r.maxSeen, r.active)
+	r.mu.Unlock()
+
+	<-r.release
+
+	r.mu.Lock()
+	r.active--
+	r.mu.Unlock()
+	return &atproto.RecordPage{}, nil
+}
+
+func (r *blockingRepo) GetLatestCommit(ctx context.Context, did string) (*atproto.CommitMeta, error) {
+	return &atproto.CommitMeta{Rev: "3lbqsq6rwgc3a"}, nil
+}
+
+func TestRunBoundsConcurrentSyncs(t *testing.T) {
+	repo := &blockingRepo{release: make(chan struct{})}
+	s := New(&memStore{statuses: map[syntax.ATURI]db.Status{}}, memSessions{})
+	s.newClient = func(sess *atproto.Session) (Lister, error) { return repo, nil }
+
+	const users = workers * 3
+	for i := 0; i < users; i++ {
+		s.Request(syntax.DID(fmt.Sprintf("did:plc:user%d", i)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	for i := 0; i < users; i++ {
+		repo.release <- struct{}{}
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.maxSeen > workers {
+		t.Errorf("%d syncs ran at once, want at most %d", repo.maxSeen, workers)
+	}
+}
+
+// mustTimestamp parses a timestamp in a test table
+func mustTimestamp(s string) db.Timestamp {
+	t, err := db.ParseTimestamp(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
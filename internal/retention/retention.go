@@ -0,0 +1,240 @@
+// Package retention prunes statuses that fall outside a retention policy, in
+// batches on a schedule, so the status table does not grow forever
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultInterval is how often the policy is applied
+	DefaultInterval = time.Hour
+
+	// DefaultBatchSize is the number of statuses deleted per transaction
+	DefaultBatchSize = 500
+
+	// DefaultBatchPause is the pause between batches, so other writes are not held up
+	DefaultBatchPause = 100 * time.Millisecond
+
+	// authorPageSize is the number of authors listed per query
+	authorPageSize = 500
+)
+
+// Policy says which statuses to keep. Each author's current status is always
+// kept, whatever the policy.
+type Policy struct {
+	KeepPerAuthor int           // How many of each author's newest statuses to keep; 0 for no limit
+	MaxAge        time.Duration // Statuses indexed longer ago are deleted; 0 for no limit
+	Vacuum        db.VacuumMode // How to reclaim the space freed after deleting
+	DryRun        bool          // Only report what would be deleted
+}
+
+// Enabled reports whether the policy deletes anything at all
+func (p Policy) Enabled() bool {
+	return p.KeepPerAuthor > 0 || p.MaxAge > 0
+}
+
+// Store finds and deletes statuses; *db.DB implements it
+type Store interface {
+	GetStatusAuthors(ctx context.Context, after syntax.DID, limit int) ([]syntax.DID, error)
+	GetPrunableStatusURIs(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore db.Timestamp) ([]syntax.ATURI, error)
+	CountPrunableStatuses(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore db.Timestamp) (*db.PruneReport, error)
+	DeleteStatuses(ctx context.Context, uris []syntax.ATURI) error
+	Vacuum(ctx context.Context, mode db.VacuumMode) error
+}
+
+// Pruner applies a retention policy
+type Pruner struct {
+	store  Store
+	Policy Policy
+
+	// BatchSize is the number of statuses deleted per transaction
+	BatchSize int
+
+	// BatchPause is the pause between batches
+	BatchPause time.Duration
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New creates a pruner for a policy
+func New(store Store, policy Policy) *Pruner {
+	return &Pruner{
+		store:      store,
+		Policy:     policy,
+		BatchSize:  DefaultBatchSize,
+		BatchPause: DefaultBatchPause,
+		now:        time.Now,
+		sleep:      sleep,
+	}
+}
+
+// sleep waits for d, returning early if the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// cutoff returns the time before which statuses are too old to keep, or the
+// zero timestamp if they are kept whatever their age
+func (p *Pruner) cutoff() db.Timestamp {
+	if p.Policy.MaxAge <= 0 {
+		return db.Timestamp{}
+	}
+	return db.NewTimestamp(p.now().Add(-p.Policy.MaxAge))
+}
+
+// eachAuthor calls fn for every author with statuses, in DID order. The
+// policy ranks each author's statuses separately, so applying it one author
+// at a time reads every status once, however many batches it takes.
+func (p *Pruner) eachAuthor(ctx context.Context, fn func(author syntax.DID) error) error {
+	var after syntax.DID
+	for {
+		authors, err := p.store.GetStatusAuthors(ctx, after, authorPageSize)
+		if err != nil {
+			return err
+		}
+		for _, author := range authors {
+			if err := fn(author); err != nil {
+				return err
+			}
+		}
+		if len(authors) < authorPageSize {
+			return nil
+		}
+		after = authors[len(authors)-1]
+	}
+}
+
+// Report counts the statuses the policy would delete now
+func (p *Pruner) Report(ctx context.Context) (*db.PruneReport, error) {
+	cutoff := p.cutoff()
+
+	report := &db.PruneReport{}
+	err := p.eachAuthor(ctx, func(author syntax.DID) error {
+		counts, err := p.store.CountPrunableStatuses(ctx, author, p.Policy.KeepPerAuthor, cutoff)
+		if err != nil {
+			return err
+		}
+		report.Add(counts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Prune deletes the statuses outside the policy in batches, then vacuums if
+// the policy asks for it and anything was deleted. It returns how many
+// statuses were deleted, including on error.
+func (p *Pruner) Prune(ctx context.Context) (int, error) {
+	// One cutoff for the whole run, so it finishes even while statuses keep aging
+	cutoff := p.cutoff()
+
+	deleted := 0
+	var pending []syntax.ATURI
+	err := p.eachAuthor(ctx, func(author syntax.DID) error {
+		uris, err := p.store.GetPrunableStatusURIs(ctx, author, p.Policy.KeepPerAuthor, cutoff)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, uris...)
+
+		// Batches may span authors, so a run over many authors with a few
+		// statuses each still deletes in full batches
+		for len(pending) >= p.BatchSize {
+			if err := p.store.DeleteStatuses(ctx, pending[:p.BatchSize]); err != nil {
+				return err
+			}
+			deleted += p.BatchSize
+			pending = pending[p.BatchSize:]
+
+			if err := p.sleep(ctx, p.BatchPause); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return deleted, err
+	}
+
+	if len(pending) > 0 {
+		if err := p.store.DeleteStatuses(ctx, pending); err != nil {
+			return deleted, err
+		}
+		deleted += len(pending)
+	}
+
+	if deleted > 0 {
+		if err := p.store.Vacuum(ctx, p.Policy.Vacuum); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// Run applies the policy on every interval until the context is cancelled,
+// starting right away. In a dry run it only logs what would be deleted.
+func (p *Pruner) Run(ctx context.Context, interval time.Duration) {
+	if !p.Policy.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce applies the policy once and logs the outcome
+func (p *Pruner) runOnce(ctx context.Context) {
+	if p.Policy.DryRun {
+		report, err := p.Report(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to report prunable statuses")
+			return
+		}
+		log.Info().
+			Int("statuses", report.Statuses).
+			Int("overLimit", report.OverLimit).
+			Int("tooOld", report.TooOld).
+			Int("authors", report.Authors).
+			Msg("Retention dry run: statuses that would be pruned")
+		return
+	}
+
+	start := p.now()
+	deleted, err := p.Prune(ctx)
+	if err != nil && ctx.Err() == nil {
+		log.Error().Err(err).Int("deleted", deleted).Msg("Failed to prune statuses")
+		return
+	}
+	if deleted > 0 {
+		log.Info().Int("deleted", deleted).Dur("took", p.now().Sub(start)).Msg("Pruned statuses")
+	}
+}
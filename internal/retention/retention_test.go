@@ -0,0 +1,237 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+// memStore treats a fixed list of statuses as outside the policy
+type memStore struct {
+	prunable    []syntax.ATURI
+	cutoffs     []db.Timestamp
+	deleteCalls int
+	vacuumed    []db.VacuumMode
+}
+
+func (s *memStore) GetStatusAuthors(ctx context.Context, after syntax.DID, limit int) ([]syntax.DID, error) {
+	var authors []syntax.DID
+	for _, uri := range s.prunable {
+		if author := uri.DID(); author > after && !slices.Contains(authors, author) {
+			authors = append(authors, author)
+		}
+	}
+	slices.Sort(authors)
+	return authors[:min(limit, len(authors))], nil
+}
+
+func (s *memStore) GetPrunableStatusURIs(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore db.Timestamp) ([]syntax.ATURI, error) {
+	s.cutoffs = append(s.cutoffs, indexedBefore)
+	var uris []syntax.ATURI
+	for _, uri := range s.prunable {
+		if uri.DID() == author {
+			uris = append(uris, uri)
+		}
+	}
+	return uris, nil
+}
+
+func (s *memStore) CountPrunableStatuses(ctx context.Context, author syntax.DID, keepPerAuthor int, indexedBefore db.Timestamp) (*db.PruneReport, error) {
+	s.cutoffs = append(s.cutoffs, indexedBefore)
+	uris, _ := s.GetPrunableStatusURIs(ctx, author, keepPerAuthor, indexedBefore)
+	return &db.PruneReport{Statuses: len(uris), Authors: 1}, nil
+}
+
+func (s *memStore) DeleteStatuses(ctx context.Context, uris []syntax.ATURI) error {
+	s.deleteCalls++
+	s.prunable = slices.DeleteFunc(s.prunable, func(uri syntax.ATURI) bool { return slices.Contains(uris, uri) })
+	return nil
+}
+
+func (s *memStore) Vacuum(ctx context.Context, mode db.VacuumMode) error {
+	s.vacuumed = append(s.vacuumed, mode)
+	return nil
+}
+
+func newTestPruner(store *memStore, policy Policy) (*Pruner, *int) {
+	p := New(store, policy)
+	p.BatchSize = 2
+	p.now = func() time.Time { return time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC) }
+	pauses := 0
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		pauses++
+		return ctx.Err()
+	}
+	return p, &pauses
+}
+
+// prunable returns n statuses, spread over authors in turn
+func prunable(n int, authors ...string) []syntax.ATURI {
+	if len(authors) == 0 {
+		authors = []string{"alice"}
+	}
+	var uris []syntax.ATURI
+	for i := 0; i < n; i++ {
+		uris = append(uris, syntax.ATURI(fmt.Sprintf("at://did:plc:%s/xyz.statusphere.status/3lbqsq6rwgc2%d", authors[i%len(authors)], i)))
+	}
+	return uris
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name        string
+		prunable    int
+		authors     []string
+		wantDeletes int
+		wantPauses  int
+	}{
+		{name: "nothing to do", prunable: 0},
+		{name: "partial batch", prunable: 1, wantDeletes: 1},
+		{name: "full batches", prunable: 4, wantDeletes: 2, wantPauses: 2},
+		{name: "several batches", prunable: 5, wantDeletes: 3, wantPauses: 2},
+		{name: "batches spanning authors", prunable: 5, authors: []string{"alice", "bob", "carol"}, wantDeletes: 3, wantPauses: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memStore{prunable: prunable(tt.prunable, tt.authors...)}
+			p, pauses := newTestPruner(store, Policy{MaxAge: 24 * time.Hour, Vacuum: db.VacuumIncremental})
+
+			deleted, err := p.Prune(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != tt.prunable || len(store.prunable) != 0 {
+				t.Errorf("deleted %d, %d left, want %d and none left", deleted, len(store.prunable), tt.prunable)
+			}
+			if store.deleteCalls != tt.wantDeletes || *pauses != tt.wantPauses {
+				t.Errorf("%d batches and %d pauses, want %d and %d", store.deleteCalls, *pauses, tt.wantDeletes, tt.wantPauses)
+			}
+			for _, cutoff := range store.cutoffs {
+				if cutoff.String() != "2025-03-06T12:00:00.000Z" {
+					t.Errorf("cutoff = %s, want a day before now", cutoff)
+				}
+			}
+
+			wantVacuums := 0
+			if tt.prunable > 0 {
+				wantVacuums = 1
+			}
+			if len(store.vacuumed) != wantVacuums {
+				t.Errorf("vacuumed %d times, want %d", len(store.vacuumed), wantVacuums)
+			}
+		})
+	}
+}
+
+func TestPruneWithoutMaxAge(t *testing.T) {
+	store := &memStore{prunable: prunable(1)}
+	p, _ := newTestPruner(store, Policy{KeepPerAuthor: 10})
+
+	if _, err := p.Prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !store.cutoffs[0].IsZero() {
+		t.Errorf("cutoff = %s, want none", store.cutoffs[0])
+	}
+}
+
+func TestPruneStopsOnCancel(t *testing.T) {
+	store := &memStore{prunable: prunable(5)}
+	p, _ := newTestPruner(store, Policy{KeepPerAuthor: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deleted, err := p.Prune(ctx)
+	if err == nil || deleted != 2 {
+		t.Errorf("Prune() = %d, %v, want to stop after the first batch", deleted, err)
+	}
+	if len(store.vacuumed) != 0 {
+		t.Error("vacuumed after an interrupted run")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	store := &memStore{prunable: prunable(3)}
+	p, _ := newTestPruner(store, Policy{KeepPerAuthor: 1, DryRun: true})
+
+	p.runOnce(context.Background())
+	if store.deleteCalls != 0 || len(store.prunable) != 3 {
+		t.Errorf("dry run deleted statuses: %d batches, %d left", store.deleteCalls, len(store.prunable))
+	}
+}
+
+func TestPruneDatabase(t *testing.T) {
+	database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "statusphere.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	authors := []syntax.DID{"did:plc:alice", "did:plc:bob", "did:plc:carol"}
+	for i := 0; i < 30; i++ {
+		author := authors[i%len(authors)]
+		at := db.NewTimestamp(start.Add(time.Duration(i) * time.Hour))
+		err := database.SaveStatus(ctx, &db.Status{
+			URI:       syntax.ATURI(fmt.Sprintf("at://%s/xyz.statusphere.status/3lbqsq6rwg%03d", author, i)),
+			AuthorDID: author,
+			Status:    "👍",
+			CreatedAt: at,
+			IndexedAt: at,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := New(database, Policy{KeepPerAuthor: 4})
+	p.BatchSize = 7
+	p.BatchPause = 0
+
+	report, err := p.Report(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (db.PruneReport{Statuses: 18, OverLimit: 18, Authors: 3}); *report != want {
+		t.Errorf("Report() = %+v, want %+v", report, want)
+	}
+
+	deleted, err := p.Prune(ctx)
+	if err != nil || deleted != 18 {
+		t.Fatalf("Prune() = %d, %v, want 18 deleted", deleted, err)
+	}
+	for _, author := range authors {
+		if n, err := database.CountUserStatuses(ctx, author); err != nil || n != 4 {
+			t.Errorf("CountUserStatuses(%s) = %d, %v, want 4 left", author, n, err)
+		}
+	}
+}
+
+func TestPolicyEnabled(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		want   bool
+	}{
+		{Policy{}, false},
+		{Policy{Vacuum: db.VacuumFull, DryRun: true}, false},
+		{Policy{KeepPerAuthor: 5}, true},
+		{Policy{MaxAge: time.Hour}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Enabled(); got != tt.want {
+			t.Errorf("%+v.Enabled() = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
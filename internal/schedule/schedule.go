@@ -0,0 +1,215 @@
+// Package schedule publishes statuses that users have scheduled for a later time
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultInterval is how often the scheduler looks for due statuses
+	DefaultInterval = 15 * time.Second
+
+	// MaxAhead is how far in the future a status may be scheduled
+	MaxAhead = 365 * 24 * time.Hour
+
+	// batchSize is the number of due statuses handled per tick
+	batchSize = 50
+)
+
+var (
+	// ErrInPast is returned when scheduling a status for a time that has already passed
+	ErrInPast = errors.New("scheduled time is in the past")
+
+	// ErrTooFarAhead is returned when scheduling a status further ahead than MaxAhead
+	ErrTooFarAhead = errors.New("scheduled time is too far in the future")
+)
+
+// Store persists scheduled statuses; *db.DB implements it
+type Store interface {
+	SaveScheduledStatus(ctx context.Context, scheduled *db.ScheduledStatus) error
+	GetDueScheduledStatuses(ctx context.Context, now db.Timestamp, limit int) ([]db.ScheduledStatus, error)
+	GetUserScheduledStatuses(ctx context.Context, authorDID syntax.DID) ([]db.ScheduledStatus, error)
+	UpdateScheduledStatusState(ctx context.Context, uri syntax.ATURI, state string) error
+	DeleteScheduledStatus(ctx context.Context, uri syntax.ATURI) error
+	GetUserStatus(ctx context.Context, authorDID syntax.DID) (*db.Status, error)
+}
+
+// Publisher writes a status record to its author's repo; *outbox.Outbox implements it
+type Publisher interface {
+	Enqueue(ctx context.Context, uri syntax.ATURI, record *atproto.StatusRecord) error
+}
+
+// Scheduler stores scheduled statuses and hands them to a Publisher when they are due
+type Scheduler struct {
+	store     Store
+	publisher Publisher
+
+	// CatchUpWindow bounds how overdue a status may be and still be published,
+	// so statuses missed while the server was down do not appear days late
+	CatchUpWindow time.Duration
+
+	now func() time.Time
+}
+
+// New creates a scheduler
+func New(store Store, publisher Publisher, catchUpWindow time.Duration) *Scheduler {
+	return &Scheduler{
+		store:         store,
+		publisher:     publisher,
+		CatchUpWindow: catchUpWindow,
+		now:           time.Now,
+	}
+}
+
+// Schedule stores a status to be published for a user at the given time
+func (s *Scheduler) Schedule(ctx context.Context, did syntax.DID, status string, at time.Time) (*db.ScheduledStatus, error) {
+	now := s.now()
+	if !at.After(now) {
+		return nil, ErrInPast
+	}
+	if at.Sub(now) > MaxAhead {
+		return nil, ErrTooFarAhead
+	}
+
+	record := atproto.NewStatusRecord(status, at)
+	if err := record.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The record key is fixed now and derived from the scheduled time, so
+	// publishing is idempotent: a status handed over twice is written once
+	rkey := syntax.NewTID(at, uint16(rand.IntN(syntax.MaxClockID+1)))
+
+	scheduled := &db.ScheduledStatus{
+		URI:         syntax.NewRecordURI(did, atproto.StatusCollection, syntax.RecordKey(rkey)),
+		AuthorDID:   did,
+		Status:      status,
+		ScheduledAt: db.NewTimestamp(at),
+		Timezone:    at.Location().String(),
+		State:       db.ScheduledPending,
+		CreatedAt:   db.NewTimestamp(now),
+	}
+	if err := s.store.SaveScheduledStatus(ctx, scheduled); err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+// List returns a user's pending and missed scheduled statuses
+func (s *Scheduler) List(ctx context.Context, did syntax.DID) ([]db.ScheduledStatus, error) {
+	return s.store.GetUserScheduledStatuses(ctx, did)
+}
+
+// Cancel removes one of a user's scheduled statuses
+func (s *Scheduler) Cancel(ctx context.Context, did syntax.DID, rkey syntax.RecordKey) error {
+	// The URI is built from the user's own DID, so users can only cancel their own schedules
+	return s.store.DeleteScheduledStatus(ctx, syntax.NewRecordURI(did, atproto.StatusCollection, rkey))
+}
+
+// Run publishes due statuses until the context is cancelled. The first pass
+// runs immediately, which catches up on anything that fell due while the
+// server was down.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.publishDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDue publishes every pending status whose time has come
+func (s *Scheduler) publishDue(ctx context.Context) {
+	now := s.now()
+	due, err := s.store.GetDueScheduledStatuses(ctx, db.NewTimestamp(now), batchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load scheduled statuses")
+		return
+	}
+
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.publish(ctx, &due[i], now)
+	}
+}
+
+// publish hands a due status to the publisher, or marks it missed if it is no longer wanted
+func (s *Scheduler) publish(ctx context.Context, scheduled *db.ScheduledStatus, now time.Time) {
+	logger := log.With().Str("uri", scheduled.URI.String()).Logger()
+
+	at := scheduled.ScheduledAt.Time
+	if reason := s.missedReason(ctx, scheduled, at, now); reason != "" {
+		logger.Info().Str("reason", reason).Msg("Skipping scheduled status")
+		s.markMissed(ctx, scheduled)
+		return
+	}
+
+	record := atproto.NewStatusRecord(scheduled.Status, at)
+	if err := s.publisher.Enqueue(ctx, scheduled.URI, record); err != nil {
+		// Left pending, so the next tick tries again
+		logger.Error().Err(err).Msg("Failed to publish scheduled status")
+		return
+	}
+
+	// The outbox owns the write from here. If this delete is lost, the status
+	// is handed over again under the same URI, which does not duplicate it.
+	if err := s.store.DeleteScheduledStatus(ctx, scheduled.URI); err != nil {
+		logger.Error().Err(err).Msg("Failed to remove published scheduled status")
+	}
+}
+
+// missedReason explains why a due status should not be published, or returns ""
+func (s *Scheduler) missedReason(ctx context.Context, scheduled *db.ScheduledStatus, at, now time.Time) string {
+	if now.Sub(at) > s.CatchUpWindow {
+		return "overdue"
+	}
+
+	// A status the user set after the scheduled time takes precedence
+	latest, err := s.store.GetUserStatus(ctx, scheduled.AuthorDID)
+	if err != nil {
+		return ""
+	}
+	if latest.CreatedAt.After(at) {
+		return "superseded"
+	}
+	return ""
+}
+
+func (s *Scheduler) markMissed(ctx context.Context, scheduled *db.ScheduledStatus) {
+	if err := s.store.UpdateScheduledStatusState(ctx, scheduled.URI, db.ScheduledMissed); err != nil {
+		log.Error().Err(err).Str("uri", scheduled.URI.String()).Msg("Failed to mark scheduled status missed")
+	}
+}
+
+// ParseLocalTime parses a datetime-local form value in the named IANA time zone,
+// falling back to UTC if the zone is unknown
+func ParseLocalTime(value, zone string) (time.Time, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil || zone == "" {
+		loc = time.UTC
+	}
+
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,282 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/syntax"
+)
+
+const testDID = "did:plc:alice"
+
+// memStore is an in-memory Store
+type memStore struct {
+	scheduled map[syntax.ATURI]db.ScheduledStatus
+	latest    *db.Status
+}
+
+func (s *memStore) SaveScheduledStatus(ctx context.Context, scheduled *db.ScheduledStatus) error {
+	if _, ok := s.scheduled[scheduled.URI]; ok {
+		return errors.New("duplicate")
+	}
+	s.scheduled[scheduled.URI] = *scheduled
+	return nil
+}
+
+func (s *memStore) GetDueScheduledStatuses(ctx context.Context, now db.Timestamp, limit int) ([]db.ScheduledStatus, error) {
+	var due []db.ScheduledStatus
+	for _, sc := range s.scheduled {
+		if sc.State == db.ScheduledPending && !sc.ScheduledAt.After(now.Time) {
+			due = append(due, sc)
+		}
+	}
+	return due, nil
+}
+
+func (s *memStore) GetUserScheduledStatuses(ctx context.Context, authorDID syntax.DID) ([]db.ScheduledStatus, error) {
+	var list []db.ScheduledStatus
+	for _, sc := range s.scheduled {
+		if sc.AuthorDID == authorDID {
+			list = append(list, sc)
+		}
+	}
+	return list, nil
+}
+
+func (s *memStore) UpdateScheduledStatusState(ctx context.Context, uri syntax.ATURI, state string) error {
+	sc := s.scheduled[uri]
+	sc.State = state
+	s.scheduled[uri] = sc
+	return nil
+}
+
+func (s *memStore) DeleteScheduledStatus(ctx context.Context, uri syntax.ATURI) error {
+	delete(s.scheduled, uri)
+	return nil
+}
+
+func (s *memStore) GetUserStatus(ctx context.Context, authorDID syntax.DID) (*db.Status, error) {
+	if s.latest == nil {
+		return nil, errors.New("no status")
+	}
+	return s.latest, nil
+}
+
+// fakePublisher records the statuses handed to it
+type fakePublisher struct {
+	published map[syntax.ATURI]*atproto.StatusRecord
+	err       error
+}
+
+func (p *fakePublisher) Enqueue(ctx context.Context, uri syntax.ATURI, record *atproto.StatusRecord) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published[uri] = record
+	return nil
+}
+
+func newTestScheduler() (*Scheduler, *memStore, *fakePublisher, *time.Time) {
+	store := &memStore{scheduled: map[syntax.ATURI]db.ScheduledStatus{}}
+	publisher := &fakePublisher{published: map[syntax.ATURI]*atproto.StatusRecord{}}
+	now := time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+
+	s := New(store, publisher, time.Hour)
+	s.now = func() time.Time { return now }
+	return s, store, publisher, &now
+}
+
+func TestScheduleValidation(t *testing.T) {
+	s, _, _, now := newTestScheduler()
+
+	tests := []struct {
+		name    string
+		status  string
+		at      time.Time
+		wantErr bool
+		wantIs  error
+	}{
+		{name: "future", status: "🏖", at: now.Add(5 * time.Hour)},
+		{name: "past", status: "🏖", at: now.Add(-time.Minute), wantErr: true, wantIs: ErrInPast},
+		{name: "now", status: "🏖", at: *now, wantErr: true, wantIs: ErrInPast},
+		{name: "too far ahead", status: "🏖", at: now.Add(MaxAhead + time.Hour), wantErr: true, wantIs: ErrTooFarAhead},
+		{name: "invalid status", status: "beach", at: now.Add(time.Hour), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduled, err := s.Schedule(context.Background(), testDID, tt.status, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Schedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("Schedule() error = %v, want %v", err, tt.wantIs)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The record key carries the scheduled time
+			tid, err := syntax.ParseTID(scheduled.URI.RecordKey().String())
+			if err != nil {
+				t.Fatalf("record key is not a TID: %v", err)
+			}
+			if !tid.Time().Equal(tt.at) {
+				t.Errorf("TID time = %v, want %v", tid.Time(), tt.at)
+			}
+		})
+	}
+}
+
+func TestPublishDue(t *testing.T) {
+	s, store, publisher, now := newTestScheduler()
+
+	soon, err := s.Schedule(context.Background(), testDID, "🏖", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := s.Schedule(context.Background(), testDID, "🌙", now.Add(10*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(time.Hour + time.Second)
+	s.publishDue(context.Background())
+
+	record, ok := publisher.published[soon.URI]
+	if !ok {
+		t.Fatal("due status was not published")
+	}
+	if record.Status != "🏖" || record.CreatedAt != "2025-03-07T13:00:00.000Z" {
+		t.Errorf("record = %+v, want 🏖 created at the scheduled time", record)
+	}
+	if _, ok := store.scheduled[soon.URI]; ok {
+		t.Error("published status is still scheduled")
+	}
+	if _, ok := publisher.published[later.URI]; ok {
+		t.Error("status was published early")
+	}
+}
+
+func TestPublishFailureRetries(t *testing.T) {
+	s, store, publisher, now := newTestScheduler()
+
+	scheduled, err := s.Schedule(context.Background(), testDID, "🏖", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(time.Hour)
+	publisher.err = errors.New("database is locked")
+	s.publishDue(context.Background())
+
+	if store.scheduled[scheduled.URI].State != db.ScheduledPending {
+		t.Fatal("status is no longer pending after a failed handover")
+	}
+
+	publisher.err = nil
+	s.publishDue(context.Background())
+	if _, ok := publisher.published[scheduled.URI]; !ok {
+		t.Error("status was not published on the next tick")
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		downtime   time.Duration
+		latest     *db.Status
+		wantMissed bool
+	}{
+		{name: "within window", downtime: 30 * time.Minute},
+		{name: "overdue", downtime: 3 * time.Hour, wantMissed: true},
+		{name: "earlier status", downtime: 30 * time.Minute, latest: &db.Status{CreatedAt: mustTimestamp("2025-03-07T12:30:00.000Z")}},
+		{name: "superseded", downtime: 30 * time.Minute, latest: &db.Status{CreatedAt: mustTimestamp("2025-03-07T13:10:00.000Z")}, wantMissed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store, publisher, now := newTestScheduler()
+			store.latest = tt.latest
+
+			scheduled, err := s.Schedule(context.Background(), testDID, "🏖", now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The server comes back up after the status fell due
+			*now = now.Add(time.Hour + tt.downtime)
+			s.publishDue(context.Background())
+
+			_, published := publisher.published[scheduled.URI]
+			if published == tt.wantMissed {
+				t.Errorf("published = %v, want %v", published, !tt.wantMissed)
+			}
+			if tt.wantMissed && store.scheduled[scheduled.URI].State != db.ScheduledMissed {
+				t.Errorf("state = %q, want missed", store.scheduled[scheduled.URI].State)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s, store, _, now := newTestScheduler()
+
+	scheduled, err := s.Schedule(context.Background(), testDID, "🏖", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another user cannot cancel it
+	if err := s.Cancel(context.Background(), "did:plc:mallory", scheduled.URI.RecordKey()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.scheduled[scheduled.URI]; !ok {
+		t.Fatal("another user cancelled the schedule")
+	}
+
+	if err := s.Cancel(context.Background(), testDID, scheduled.URI.RecordKey()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.scheduled[scheduled.URI]; ok {
+		t.Error("schedule was not cancelled")
+	}
+}
+
+func TestParseLocalTime(t *testing.T) {
+	got, err := ParseLocalTime("2025-03-07T17:00", "Pacific/Auckland")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 3, 7, 4, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("ParseLocalTime() = %v, want %v", got.UTC(), want)
+	}
+	if got.Location().String() != "Pacific/Auckland" {
+		t.Errorf("location = %v, want Pacific/Auckland", got.Location())
+	}
+
+	got, err = ParseLocalTime("2025-03-07T17:00", "Not/AZone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Location() != time.UTC {
+		t.Errorf("unknown zone parsed in %v, want UTC", got.Location())
+	}
+
+	if _, err := ParseLocalTime("next friday", "UTC"); err == nil {
+		t.Error("ParseLocalTime() accepted garbage")
+	}
+}
+
+// mustTimestamp parses a timestamp in a test table
+func mustTimestamp(s string) db.Timestamp {
+	t, err := db.ParseTimestamp(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -2,33 +2,79 @@ package server
 
 import (
 	"context"
+	"expvar"
 	"fmt"
+	"net"
 	"net/http"
 	"path/filepath"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/referendumApp/statusphere-example-app-go/internal/atproto"
+	"github.com/referendumApp/statusphere-example-app-go/internal/avatars"
+	"github.com/referendumApp/statusphere-example-app-go/internal/backup"
 	"github.com/referendumApp/statusphere-example-app-go/internal/config"
 	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/referendumApp/statusphere-example-app-go/internal/feedcache"
 	"github.com/referendumApp/statusphere-example-app-go/internal/handlers"
-	"github.com/gorilla/mux"
+	"github.com/referendumApp/statusphere-example-app-go/internal/identity"
+	"github.com/referendumApp/statusphere-example-app-go/internal/outbox"
+	"github.com/referendumApp/statusphere-example-app-go/internal/profiles"
+	"github.com/referendumApp/statusphere-example-app-go/internal/purge"
+	"github.com/referendumApp/statusphere-example-app-go/internal/replicate"
+	"github.com/referendumApp/statusphere-example-app-go/internal/reposync"
+	"github.com/referendumApp/statusphere-example-app-go/internal/retention"
+	"github.com/referendumApp/statusphere-example-app-go/internal/schedule"
+	"github.com/referendumApp/statusphere-example-app-go/internal/stats"
 	"github.com/rs/zerolog/log"
 )
 
+// metrics holds the server's runtime counters, served at /debug/vars. Entries
+// are set rather than published, so creating a second server does not panic.
+var metrics = expvar.NewMap("statusphere")
+
 // Server represents the HTTP server
 type Server struct {
-	cfg        *config.Config
-	db         *db.DB
-	router     *mux.Router
-	httpServer *http.Server
+	cfg         *config.Config
+	db          db.Store
+	router      *mux.Router
+	httpServer  *http.Server
+	debugServer *http.Server // nil unless DEBUG_ADDR is set
+	outbox      *outbox.Outbox
+	scheduler   *schedule.Scheduler
+	syncer      *reposync.Syncer
+	purger      *purge.Purger
+	pruner      *retention.Pruner
+	stats       *stats.Service
+	backups     *backup.Backups
+	replicator  *replicate.Replicator // nil unless replication is configured
+	feedCache   *feedcache.Cache      // nil if disabled; s.db when enabled
+
+	// background is cancelled on shutdown to stop background workers
+	background context.Context
+	stop       context.CancelFunc
+
+	// requests is the parent of every request's context, cancelled if
+	// requests are still running when the shutdown deadline passes
+	requests       context.Context
+	cancelRequests context.CancelFunc
 }
 
 // New creates a new server instance
-func New(cfg *config.Config, database *db.DB) (*Server, error) {
+func New(cfg *config.Config, database db.Store) (*Server, error) {
 	s := &Server{
 		cfg:    cfg,
 		db:     database,
 		router: mux.NewRouter(),
 	}
+	// Every status write goes through the cache, so it sits in front of everything else
+	if cfg.FeedCacheSize > 0 {
+		s.feedCache = feedcache.New(database, cfg.FeedCacheSize)
+		metrics.Set("feed_cache", expvar.Func(func() interface{} { return s.feedCache.Stats() }))
+		s.db = s.feedCache
+	}
+	s.background, s.stop = context.WithCancel(context.Background())
+	s.requests, s.cancelRequests = context.WithCancel(context.Background())
 
 	// Initialize the server
 	if err := s.initialize(); err != nil {
@@ -41,11 +87,41 @@ func New(cfg *config.Config, database *db.DB) (*Server, error) {
 // initialize sets up the HTTP routes and middleware
 func (s *Server) initialize() error {
 	// Create the handlers with dependencies
-	h := handlers.New(s.cfg, s.db)
+	identityCache := identity.NewCache(identity.NewResolver(s.cfg.PLCURL), s.db)
+	metrics.Set("identity_cache", expvar.Func(func() interface{} { return identityCache.Stats() }))
+	profileService := profiles.NewService(s.db, identityCache)
+	avatarCache, err := avatars.NewDiskCache(s.cfg.AvatarCacheDir, s.cfg.AvatarCacheMaxBytes)
+	if err != nil {
+		return err
+	}
+	avatarProxy := avatars.NewProxy(profileService, identityCache, avatarCache)
+	// Requests and background jobs share one session loader, so a refresh
+	// token is never spent twice
+	oauthClient := s.cfg.OAuthClient()
+	sessions := atproto.NewSessions(s.db, oauthClient)
+	s.outbox = outbox.New(s.db, sessions)
+	s.scheduler = schedule.New(s.db, s.outbox, s.cfg.ScheduleCatchUpWindow)
+	s.syncer = reposync.New(s.db, sessions)
+	s.purger = purge.New(s.db, sessions)
+	s.pruner = retention.New(s.db, retention.Policy{
+		KeepPerAuthor: s.cfg.RetentionKeepPerAuthor,
+		MaxAge:        s.cfg.RetentionMaxAge,
+		Vacuum:        db.VacuumMode(s.cfg.RetentionVacuum),
+		DryRun:        s.cfg.RetentionDryRun,
+	})
+	s.stats = stats.New(s.db)
+	s.backups = backup.New(s.db, s.cfg.BackupDir, s.cfg.BackupKeep)
+	if s.cfg.ReplicaURL != "" {
+		if err := s.initReplication(); err != nil {
+			return err
+		}
+	}
+	h := handlers.New(s.cfg, s.db, oauthClient, sessions, identityCache, profileService, avatarProxy, s.outbox, s.scheduler, s.syncer, s.purger, s.stats)
 
 	// Set up middleware
 	s.router.Use(loggingMiddleware)
 	s.router.Use(recoveryMiddleware)
+	s.router.Use(h.VerifyCSRF)
 
 	// Static assets (using the existing front-end assets)
 	fs := http.FileServer(http.Dir(filepath.Join(".", "static")))
@@ -60,9 +136,28 @@ func (s *Server) initialize() error {
 	s.router.HandleFunc("/login", h.HandleLogin).Methods("POST")
 	s.router.HandleFunc("/logout", h.HandleLogout).Methods("POST")
 
+	// Avatar proxy
+	s.router.HandleFunc("/avatar/{did}", h.Avatar).Methods("GET")
+
 	// Main routes
 	s.router.HandleFunc("/", h.Home).Methods("GET")
 	s.router.HandleFunc("/status", h.UpdateStatus).Methods("POST")
+	s.router.HandleFunc("/status/{rkey}/edit", h.EditStatus).Methods("POST")
+	s.router.HandleFunc("/status/{rkey}/delete", h.DeleteStatus).Methods("POST")
+	s.router.HandleFunc("/status/{rkey}/dismiss", h.DismissWrite).Methods("POST")
+	s.router.HandleFunc("/history/clear", h.ClearHistory).Methods("POST")
+	s.router.HandleFunc("/history/sync", h.SyncHistory).Methods("POST")
+	s.router.HandleFunc("/profile/{handle}", h.Profile).Methods("GET")
+	s.router.HandleFunc("/stats", h.ShowStats).Methods("GET")
+
+	// JSON API
+	s.router.HandleFunc("/api/statuses", h.ListStatuses).Methods("GET")
+	s.router.HandleFunc("/api/stats", h.GetStats).Methods("GET")
+
+	// Scheduled statuses
+	s.router.HandleFunc("/schedule", h.ShowSchedule).Methods("GET")
+	s.router.HandleFunc("/schedule", h.CreateSchedule).Methods("POST")
+	s.router.HandleFunc("/schedule/{rkey}/cancel", h.CancelSchedule).Methods("POST")
 
 	// 404 handler
 	s.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -77,19 +172,89 @@ func (s *Server) initialize() error {
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return s.requests },
+	}
+
+	// Runtime metrics, including cache counters and the process command line,
+	// are only served on their own listener so they can be kept private
+	if s.cfg.DebugAddr != "" {
+		debug := http.NewServeMux()
+		debug.Handle("GET /debug/vars", expvar.Handler())
+		s.debugServer = &http.Server{
+			Addr:        s.cfg.DebugAddr,
+			Handler:     debug,
+			ReadTimeout: 15 * time.Second,
+		}
 	}
 
 	return nil
 }
 
-// Start starts the HTTP server
+// Start starts the background workers and the HTTP server
 func (s *Server) Start() error {
+	go s.outbox.Run(s.background, outbox.DefaultInterval)
+	go s.scheduler.Run(s.background, schedule.DefaultInterval)
+	go s.syncer.Run(s.background)
+	go s.purger.Run(s.background)
+	go s.pruner.Run(s.background, s.cfg.RetentionInterval)
+	go s.stats.Run(s.background, stats.DefaultPruneInterval)
+	go s.backups.Run(s.background, s.cfg.BackupInterval)
+	if s.replicator != nil {
+		go s.replicator.Run(s.background)
+	}
+	if s.debugServer != nil {
+		go func() {
+			log.Info().Str("addr", s.debugServer.Addr).Msg("Serving debug metrics")
+			if err := s.debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error().Err(err).Msg("Debug listener failed")
+			}
+		}()
+	}
+	if s.feedCache != nil {
+		go s.feedCache.Run(s.background, feedcache.DefaultRevalidateInterval)
+	}
+
 	return s.httpServer.ListenAndServe()
 }
 
-// Shutdown gracefully shuts down the server
+// initReplication sets up streaming the SQLite WAL to the replica target
+func (s *Server) initReplication() error {
+	path, ok := db.SQLitePath(s.cfg.DatabaseURL)
+	if !ok {
+		return fmt.Errorf("REPLICA_URL needs a SQLite database file")
+	}
+	target, err := replicate.OpenTarget(s.cfg.ReplicaURL)
+	if err != nil {
+		return err
+	}
+
+	s.replicator = replicate.New(path, target)
+	s.replicator.SyncInterval = s.cfg.ReplicaSyncInterval
+	s.replicator.SnapshotInterval = s.cfg.ReplicaSnapshotInterval
+	s.replicator.Retention = s.cfg.ReplicaRetention
+	metrics.Set("replication", expvar.Func(func() interface{} { return s.replicator.Stats() }))
+
+	return nil
+}
+
+// Shutdown gracefully shuts down the server and stops the background workers
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	s.stop()
+	if s.debugServer != nil {
+		s.debugServer.Close()
+	}
+	err := s.httpServer.Shutdown(ctx)
+	// Stop the queries of requests that did not finish in time
+	s.cancelRequests()
+
+	// Ship the last writes, now that requests have finished
+	if s.replicator != nil {
+		if rerr := s.replicator.Close(ctx); rerr != nil {
+			log.Error().Err(rerr).Msg("Failed to replicate final writes")
+		}
+	}
+
+	return err
 }
 
 // Middleware functions
@@ -129,4 +294,4 @@ func recoveryMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
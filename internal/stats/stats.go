@@ -0,0 +1,217 @@
+// Package stats reports how often each emoji is used over rolling windows and
+// which are trending, from the rollups counted as statuses are stored
+package stats
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultPruneInterval is how often hourly counts too old to need are deleted
+	DefaultPruneInterval = time.Hour
+
+	// BaselineSpan is how far back the baseline emoji are compared with reaches
+	BaselineSpan = 7 * 24 * time.Hour
+
+	// DefaultMinCount is how many statuses in the last hour an emoji needs to trend
+	DefaultMinCount = 3
+
+	// DefaultMinSurge is how many times its baseline rate an emoji needs to trend
+	DefaultMinSurge = 2.0
+)
+
+// Windows are the rolling windows counts are reported over, each as long as
+// one bucket of its rollup
+var Windows = []db.Granularity{db.Hourly, db.Daily, db.Weekly}
+
+// Store reads and prunes the emoji rollups; *db.DB implements it
+type Store interface {
+	GetEmojiCounts(ctx context.Context, g db.Granularity, since db.Timestamp) ([]db.EmojiCount, error)
+	PruneEmojiCounts(ctx context.Context, g db.Granularity, before db.Timestamp) (int64, error)
+}
+
+// EmojiCount is how many statuses used an emoji in a window
+type EmojiCount struct {
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
+
+// WindowCounts are the emoji used in a rolling window, most used first
+type WindowCounts struct {
+	Window db.Granularity `json:"window"`
+	Counts []EmojiCount   `json:"counts"`
+}
+
+// Trend is an emoji used far more in the last hour than usual
+type Trend struct {
+	Status   string  `json:"status"`
+	LastHour float64 `json:"lastHour"` // Statuses in the last hour
+	Baseline float64 `json:"baseline"` // Statuses per hour over the baseline span before it
+	Surge    float64 `json:"surge"`    // How many times the baseline the last hour is, smoothed
+}
+
+// Report is the emoji statistics at a point in time
+type Report struct {
+	At       time.Time      `json:"at"`
+	Windows  []WindowCounts `json:"windows"`
+	Trending []Trend        `json:"trending"` // Biggest surge first
+}
+
+// Service computes emoji statistics
+type Service struct {
+	store Store
+
+	// MinCount is how many statuses in the last hour an emoji needs to trend
+	MinCount float64
+
+	// MinSurge is how many times its baseline rate an emoji needs to trend
+	MinSurge float64
+
+	now func() time.Time
+}
+
+// New creates a statistics service
+func New(store Store) *Service {
+	return &Service{
+		store:    store,
+		MinCount: DefaultMinCount,
+		MinSurge: DefaultMinSurge,
+		now:      time.Now,
+	}
+}
+
+// Report computes the counts for every window and the trending emoji
+func (s *Service) Report(ctx context.Context) (*Report, error) {
+	now := s.now().UTC()
+	report := &Report{At: now, Trending: []Trend{}}
+
+	for _, g := range Windows {
+		rows, err := s.store.GetEmojiCounts(ctx, g, db.NewTimestamp(g.Truncate(now).Add(-g.Length())))
+		if err != nil {
+			return nil, err
+		}
+		counts := []EmojiCount{}
+		for emoji, n := range windowEstimate(g, now, rows) {
+			if n := int(math.Round(n)); n > 0 {
+				counts = append(counts, EmojiCount{Status: emoji, Count: n})
+			}
+		}
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Status < counts[j].Status
+		})
+		report.Windows = append(report.Windows, WindowCounts{Window: g, Counts: counts})
+	}
+
+	trending, err := s.trending(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	report.Trending = trending
+
+	return report, nil
+}
+
+// windowEstimate estimates each emoji's count over the window of one bucket's
+// length ending now. The current bucket is partly over, so it counts in full
+// along with the share of the previous bucket still inside the window, as if
+// that bucket's statuses were spread evenly across it.
+func windowEstimate(g db.Granularity, now time.Time, rows []db.EmojiCount) map[string]float64 {
+	current := g.Truncate(now)
+	previous := current.Add(-g.Length())
+	weight := 1 - float64(now.Sub(current))/float64(g.Length())
+
+	estimates := map[string]float64{}
+	for _, row := range rows {
+		switch {
+		case !row.Bucket.Before(current):
+			// Includes buckets a little ahead, from clocks running fast
+			estimates[row.Status] += float64(row.Count)
+		case row.Bucket.Equal(previous):
+			estimates[row.Status] += float64(row.Count) * weight
+		}
+	}
+	return estimates
+}
+
+// trending compares each emoji's count over the last hour with its hourly
+// rate over the baseline span before that
+func (s *Service) trending(ctx context.Context, now time.Time) ([]Trend, error) {
+	// The last hour reaches into the previous hourly bucket, so the baseline
+	// ends where that bucket starts
+	baselineEnd := db.Hourly.Truncate(now).Add(-time.Hour)
+	rows, err := s.store.GetEmojiCounts(ctx, db.Hourly, db.NewTimestamp(baselineEnd.Add(-BaselineSpan)))
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[string]int{}
+	earliest := baselineEnd
+	for _, row := range rows {
+		if row.Bucket.Before(baselineEnd) {
+			totals[row.Status] += row.Count
+			if row.Bucket.Before(earliest) {
+				earliest = row.Bucket.Time
+			}
+		}
+	}
+	// A database younger than the span has a baseline only as long as its history
+	hours := baselineEnd.Sub(earliest).Hours()
+	if hours < 1 {
+		return []Trend{}, nil
+	}
+
+	trends := []Trend{}
+	for emoji, lastHour := range windowEstimate(db.Hourly, now, rows) {
+		baseline := float64(totals[emoji]) / hours
+		// Adding one to both keeps an emoji with no baseline from surging
+		// infinitely on a single status
+		surge := (lastHour + 1) / (baseline + 1)
+		if lastHour >= s.MinCount && surge >= s.MinSurge {
+			trends = append(trends, Trend{Status: emoji, LastHour: lastHour, Baseline: baseline, Surge: surge})
+		}
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Surge != trends[j].Surge {
+			return trends[i].Surge > trends[j].Surge
+		}
+		return trends[i].Status < trends[j].Status
+	})
+
+	return trends, nil
+}
+
+// Prune deletes the hourly counts older than the baseline needs. Daily and
+// weekly counts are small enough to keep.
+func (s *Service) Prune(ctx context.Context) (int64, error) {
+	cutoff := db.Hourly.Truncate(s.now()).Add(-time.Hour - BaselineSpan)
+	return s.store.PruneEmojiCounts(ctx, db.Hourly, db.NewTimestamp(cutoff))
+}
+
+// Run prunes on every interval until the context is cancelled, starting right away
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.Prune(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to prune emoji counts")
+		} else if n > 0 {
+			log.Debug().Int64("rows", n).Msg("Pruned hourly emoji counts")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
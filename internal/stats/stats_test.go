@@ -0,0 +1,166 @@
+package stats
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/referendumApp/statusphere-example-app-go/internal/db"
+)
+
+// memStore holds rollup rows in memory
+type memStore struct {
+	rows   map[db.Granularity][]db.EmojiCount
+	pruned []db.Timestamp
+}
+
+func (s *memStore) GetEmojiCounts(ctx context.Context, g db.Granularity, since db.Timestamp) ([]db.EmojiCount, error) {
+	var rows []db.EmojiCount
+	for _, row := range s.rows[g] {
+		if !row.Bucket.Before(since.Time) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (s *memStore) PruneEmojiCounts(ctx context.Context, g db.Granularity, before db.Timestamp) (int64, error) {
+	s.pruned = append(s.pruned, before)
+	return 0, nil
+}
+
+// add counts n statuses using an emoji at a time in every rollup
+func (s *memStore) add(at time.Time, emoji string, n int) {
+	for _, g := range Windows {
+		bucket := db.NewTimestamp(g.Truncate(at))
+		found := false
+		for i, row := range s.rows[g] {
+			if row.Bucket.Equal(bucket.Time) && row.Status == emoji {
+				s.rows[g][i].Count += n
+				found = true
+			}
+		}
+		if !found {
+			s.rows[g] = append(s.rows[g], db.EmojiCount{Bucket: bucket, Status: emoji, Count: n})
+		}
+	}
+}
+
+// A quarter past noon on a Wednesday
+var testNow = time.Date(2025, 3, 5, 12, 15, 0, 0, time.UTC)
+
+func newTestService(store *memStore) *Service {
+	s := New(store)
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+func TestWindows(t *testing.T) {
+	store := &memStore{rows: map[db.Granularity][]db.EmojiCount{}}
+	store.add(testNow.Add(-5*time.Minute), "👍", 2)
+	store.add(testNow.Add(-45*time.Minute), "👍", 4) // Previous hour, three quarters of it in the window
+	store.add(testNow.Add(-30*time.Hour), "🥹", 10)  // Yesterday
+	store.add(testNow.Add(-8*24*time.Hour), "😤", 7) // Last week
+
+	report, err := newTestService(store).Report(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[db.Granularity][]EmojiCount{
+		db.Hourly: {{"👍", 5}},
+		// Yesterday is half over by 12:15, so 🥹 counts for a little under half
+		db.Daily: {{"👍", 6}, {"🥹", 5}},
+		// Wednesday lunchtime is over a third into the week, so 😤 counts for under two thirds
+		db.Weekly: {{"🥹", 10}, {"👍", 6}, {"😤", 4}},
+	}
+	for _, w := range report.Windows {
+		got := w.Counts
+		if len(got) != len(want[w.Window]) {
+			t.Errorf("%s window = %v, want %v", w.Window, got, want[w.Window])
+			continue
+		}
+		for i := range got {
+			if got[i] != want[w.Window][i] {
+				t.Errorf("%s window = %v, want %v", w.Window, got, want[w.Window])
+				break
+			}
+		}
+	}
+}
+
+func TestTrending(t *testing.T) {
+	tests := []struct {
+		name string
+		// Statuses per hour over the baseline, and in the current hour
+		baseline, current int
+		want              bool
+	}{
+		{name: "surging", baseline: 1, current: 6, want: true},
+		{name: "busy as usual", baseline: 10, current: 12},
+		{name: "new but rare", baseline: 0, current: 2},
+		{name: "new and popular", baseline: 0, current: 3, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memStore{rows: map[db.Granularity][]db.EmojiCount{}}
+			current := db.Hourly.Truncate(testNow)
+			// A week of history for some emoji, so there is a baseline to compare with
+			for h := 2; h <= 24*7; h++ {
+				store.add(current.Add(-time.Duration(h)*time.Hour), "🙂", 1)
+				if tt.baseline > 0 {
+					store.add(current.Add(-time.Duration(h)*time.Hour), "🎉", tt.baseline)
+				}
+			}
+			store.add(current, "🎉", tt.current)
+
+			report, err := newTestService(store).Report(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var found *Trend
+			for i := range report.Trending {
+				if report.Trending[i].Status == "🎉" {
+					found = &report.Trending[i]
+				}
+				if report.Trending[i].Status == "🙂" {
+					t.Errorf("steady emoji is trending: %+v", report.Trending[i])
+				}
+			}
+			if (found != nil) != tt.want {
+				t.Fatalf("trending = %+v, want 🎉 trending %v", report.Trending, tt.want)
+			}
+			if found != nil && math.Abs(found.Baseline-float64(tt.baseline)) > 0.01 {
+				t.Errorf("baseline = %v, want %d per hour", found.Baseline, tt.baseline)
+			}
+		})
+	}
+}
+
+func TestTrendingNeedsHistory(t *testing.T) {
+	store := &memStore{rows: map[db.Granularity][]db.EmojiCount{}}
+	store.add(testNow, "🎉", 50)
+
+	report, err := newTestService(store).Report(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Trending) != 0 {
+		t.Errorf("trending = %+v with no baseline, want none", report.Trending)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store := &memStore{}
+	if _, err := newTestService(store).Prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The baseline ends where the previous hour starts and reaches a week before that
+	want := "2025-02-26T11:00:00.000Z"
+	if len(store.pruned) != 1 || store.pruned[0].String() != want {
+		t.Errorf("pruned before %v, want %s", store.pruned, want)
+	}
+}
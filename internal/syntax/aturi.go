@@ -0,0 +1,97 @@
+// Package syntax provides typed atproto identifiers (DIDs, handles, NSIDs,
+// record keys, TIDs and AT-URIs) with validating parsers
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxATURILength bounds AT-URIs, as in the atproto specification
+const maxATURILength = 8 * 1024
+
+// ATURI is a URI for a repo, collection or record, e.g.
+// at://did:plc:ewvi7nxzyoun6zhxrhs64oiz/xyz.statusphere.status/3jzfcijpj2z2a
+type ATURI string
+
+// ParseATURI validates an AT-URI. The authority must be a DID or a handle,
+// and any path must be a collection NSID optionally followed by a record key.
+func ParseATURI(raw string) (ATURI, error) {
+	if len(raw) > maxATURILength {
+		return "", fmt.Errorf("invalid AT-URI: too long")
+	}
+
+	rest, ok := strings.CutPrefix(raw, "at://")
+	if !ok {
+		return "", fmt.Errorf("invalid AT-URI %q: must start with at://", raw)
+	}
+	if strings.ContainsAny(rest, "?#") {
+		return "", fmt.Errorf("invalid AT-URI %q: query and fragment are not supported", raw)
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) > 3 {
+		return "", fmt.Errorf("invalid AT-URI %q: too many path segments", raw)
+	}
+
+	if _, err := ParseDID(parts[0]); err != nil {
+		if _, err := ParseHandle(parts[0]); err != nil {
+			return "", fmt.Errorf("invalid AT-URI %q: authority must be a DID or handle", raw)
+		}
+	}
+	if len(parts) > 1 {
+		if _, err := ParseNSID(parts[1]); err != nil {
+			return "", fmt.Errorf("invalid AT-URI %q: %w", raw, err)
+		}
+	}
+	if len(parts) > 2 {
+		if _, err := ParseRecordKey(parts[2]); err != nil {
+			return "", fmt.Errorf("invalid AT-URI %q: %w", raw, err)
+		}
+	}
+
+	return ATURI(raw), nil
+}
+
+// NewRecordURI builds the AT-URI of a record
+func NewRecordURI(did DID, collection NSID, rkey RecordKey) ATURI {
+	return ATURI("at://" + string(did) + "/" + string(collection) + "/" + string(rkey))
+}
+
+// segment returns the i-th segment after the at:// prefix, or ""
+func (u ATURI) segment(i int) string {
+	parts := strings.SplitN(strings.TrimPrefix(string(u), "at://"), "/", 3)
+	if i < len(parts) {
+		return parts[i]
+	}
+	return ""
+}
+
+// Authority returns the DID or handle the URI refers to
+func (u ATURI) Authority() string {
+	return u.segment(0)
+}
+
+// DID returns the authority as a DID, or "" if the authority is a handle
+func (u ATURI) DID() DID {
+	did, err := ParseDID(u.Authority())
+	if err != nil {
+		return ""
+	}
+	return did
+}
+
+// Collection returns the collection NSID, or "" if the URI has none
+func (u ATURI) Collection() NSID {
+	return NSID(u.segment(1))
+}
+
+// RecordKey returns the record key, or "" if the URI has none
+func (u ATURI) RecordKey() RecordKey {
+	return RecordKey(u.segment(2))
+}
+
+// String returns the AT-URI as a string
+func (u ATURI) String() string {
+	return string(u)
+}
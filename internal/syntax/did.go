@@ -0,0 +1,31 @@
+package syntax
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var didRegex = regexp.MustCompile(`^did:[a-z]+:[a-zA-Z0-9._:%-]*[a-zA-Z0-9._-]$`)
+
+// DID is a decentralized identifier, e.g. did:plc:ewvi7nxzyoun6zhxrhs64oiz
+type DID string
+
+// ParseDID validates a DID string
+func ParseDID(raw string) (DID, error) {
+	if len(raw) > 2048 || !didRegex.MatchString(raw) {
+		return "", fmt.Errorf("invalid DID %q", raw)
+	}
+	return DID(raw), nil
+}
+
+// Method returns the DID method, e.g. "plc" or "web"
+func (d DID) Method() string {
+	method, _, _ := strings.Cut(strings.TrimPrefix(string(d), "did:"), ":")
+	return method
+}
+
+// String returns the DID as a string
+func (d DID) String() string {
+	return string(d)
+}
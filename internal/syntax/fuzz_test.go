@@ -0,0 +1,125 @@
+package syntax
+
+import (
+	"testing"
+	"time"
+)
+
+// Each parser must be idempotent: anything it accepts, it accepts again unchanged
+
+func FuzzParseDID(f *testing.F) {
+	for _, seed := range []string{"did:plc:ewvi7nxzyoun6zhxrhs64oiz", "did:web:localhost%3A8080", "did:plc:", "did:a:b:"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		did, err := ParseDID(raw)
+		if err != nil {
+			return
+		}
+		if again, err := ParseDID(did.String()); err != nil || again != did {
+			t.Errorf("ParseDID(%q) not idempotent: %v, %v", raw, again, err)
+		}
+		if did.Method() == "" {
+			t.Errorf("ParseDID(%q) accepted a DID without a method", raw)
+		}
+	})
+}
+
+func FuzzParseHandle(f *testing.F) {
+	for _, seed := range []string{"alice.bsky.social", "Alice.Test", "a.b", "-a.b", "a.1"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		handle, err := ParseHandle(raw)
+		if err != nil {
+			return
+		}
+		if again, err := ParseHandle(handle.String()); err != nil || again != handle {
+			t.Errorf("ParseHandle(%q) not idempotent: %v, %v", raw, again, err)
+		}
+	})
+}
+
+func FuzzParseNSID(f *testing.F) {
+	for _, seed := range []string{"xyz.statusphere.status", "com.example", "a.b.c", "a.b.3"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		nsid, err := ParseNSID(raw)
+		if err != nil {
+			return
+		}
+		if again, err := ParseNSID(nsid.String()); err != nil || again != nsid {
+			t.Errorf("ParseNSID(%q) not idempotent: %v, %v", raw, again, err)
+		}
+		if nsid.Authority()+"."+nsid.Name() != raw {
+			t.Errorf("ParseNSID(%q) split into %q and %q", raw, nsid.Authority(), nsid.Name())
+		}
+	})
+}
+
+func FuzzParseRecordKey(f *testing.F) {
+	for _, seed := range []string{"self", "3jzfcijpj2z2a", ".", "..", "a/b"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		rkey, err := ParseRecordKey(raw)
+		if err != nil {
+			return
+		}
+		if again, err := ParseRecordKey(rkey.String()); err != nil || again != rkey {
+			t.Errorf("ParseRecordKey(%q) not idempotent: %v, %v", raw, again, err)
+		}
+	})
+}
+
+func FuzzParseATURI(f *testing.F) {
+	for _, seed := range []string{
+		"at://did:plc:abc/xyz.statusphere.status/3jzfcijpj2z2a",
+		"at://alice.test/app.bsky.actor.profile/self",
+		"at://did:plc:abc",
+		"at://did:plc:abc/",
+		"at://a/b/c/d",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		uri, err := ParseATURI(raw)
+		if err != nil {
+			return
+		}
+		if again, err := ParseATURI(uri.String()); err != nil || again != uri {
+			t.Errorf("ParseATURI(%q) not idempotent: %v, %v", raw, again, err)
+		}
+
+		// The parts must reassemble into the original URI
+		rebuilt := "at://" + uri.Authority()
+		if uri.Collection() != "" {
+			rebuilt += "/" + uri.Collection().String()
+		}
+		if uri.RecordKey() != "" {
+			rebuilt += "/" + uri.RecordKey().String()
+		}
+		if rebuilt != raw {
+			t.Errorf("ParseATURI(%q) parts reassemble to %q", raw, rebuilt)
+		}
+	})
+}
+
+func FuzzTIDRoundTrip(f *testing.F) {
+	f.Add(int64(0), uint16(0))
+	f.Add(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).UnixMicro(), uint16(1023))
+	f.Fuzz(func(t *testing.T, micros int64, clockID uint16) {
+		if micros < 0 || micros >= 1<<53 {
+			return
+		}
+		clockID &= MaxClockID
+		tid := NewTID(time.UnixMicro(micros), clockID)
+		if _, err := ParseTID(tid.String()); err != nil {
+			t.Fatalf("NewTID(%d, %d) = %q is invalid: %v", micros, clockID, tid, err)
+		}
+		if tid.Time().UnixMicro() != micros || tid.ClockID() != clockID {
+			t.Errorf("NewTID(%d, %d) decoded as (%d, %d)", micros, clockID, tid.Time().UnixMicro(), tid.ClockID())
+		}
+	})
+}
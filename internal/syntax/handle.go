@@ -0,0 +1,38 @@
+package syntax
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var handleRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// disallowedTLDs may be syntactically valid but are never resolvable handles
+var disallowedTLDs = []string{".alt", ".arpa", ".example", ".internal", ".invalid", ".local", ".localhost", ".onion"}
+
+// Handle is a DNS name identifying an account, e.g. alice.bsky.social
+type Handle string
+
+// ParseHandle validates a handle and normalizes it to lower case
+func ParseHandle(raw string) (Handle, error) {
+	if len(raw) > 253 || !handleRegex.MatchString(raw) {
+		return "", fmt.Errorf("invalid handle %q", raw)
+	}
+	return Handle(strings.ToLower(raw)), nil
+}
+
+// AllowedTLD reports whether the handle's top-level domain may be used for an account
+func (h Handle) AllowedTLD() bool {
+	for _, tld := range disallowedTLDs {
+		if strings.HasSuffix(string(h), tld) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the handle as a string
+func (h Handle) String() string {
+	return string(h)
+}
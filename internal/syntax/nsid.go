@@ -0,0 +1,35 @@
+package syntax
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var nsidRegex = regexp.MustCompile(`^[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+\.[a-zA-Z][a-zA-Z0-9]{0,62}$`)
+
+// NSID is a namespaced identifier for a lexicon, e.g. xyz.statusphere.status
+type NSID string
+
+// ParseNSID validates an NSID string
+func ParseNSID(raw string) (NSID, error) {
+	if len(raw) > 317 || !nsidRegex.MatchString(raw) {
+		return "", fmt.Errorf("invalid NSID %q", raw)
+	}
+	return NSID(raw), nil
+}
+
+// Authority returns the reversed domain part of the NSID, e.g. xyz.statusphere
+func (n NSID) Authority() string {
+	return string(n[:strings.LastIndex(string(n), ".")])
+}
+
+// Name returns the final segment of the NSID, e.g. status
+func (n NSID) Name() string {
+	return string(n[strings.LastIndex(string(n), ".")+1:])
+}
+
+// String returns the NSID as a string
+func (n NSID) String() string {
+	return string(n)
+}
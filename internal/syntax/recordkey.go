@@ -0,0 +1,24 @@
+package syntax
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var recordKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_~.:-]{1,512}$`)
+
+// RecordKey names a record within a collection, e.g. a TID or "self"
+type RecordKey string
+
+// ParseRecordKey validates a record key
+func ParseRecordKey(raw string) (RecordKey, error) {
+	if raw == "." || raw == ".." || !recordKeyRegex.MatchString(raw) {
+		return "", fmt.Errorf("invalid record key %q", raw)
+	}
+	return RecordKey(raw), nil
+}
+
+// String returns the record key as a string
+func (k RecordKey) String() string {
+	return string(k)
+}
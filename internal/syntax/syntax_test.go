@@ -0,0 +1,215 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDID(t *testing.T) {
+	tests := []struct {
+		raw    string
+		valid  bool
+		method string
+	}{
+		{raw: "did:plc:ewvi7nxzyoun6zhxrhs64oiz", valid: true, method: "plc"},
+		{raw: "did:web:example.com", valid: true, method: "web"},
+		{raw: "did:web:localhost%3A8080", valid: true, method: "web"},
+		{raw: "did:method:val:two", valid: true, method: "method"},
+		{raw: "did:plc:", valid: false},
+		{raw: "did:PLC:abc", valid: false},
+		{raw: "did:plc:abc:", valid: false},
+		{raw: "did:plc:abc%", valid: false},
+		{raw: "DID:plc:abc", valid: false},
+		{raw: "did:plc:abc def", valid: false},
+		{raw: "did:plc:" + strings.Repeat("a", 2048), valid: false},
+		{raw: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			did, err := ParseDID(tt.raw)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseDID(%q) error = %v, valid %v", tt.raw, err, tt.valid)
+			}
+			if tt.valid && did.Method() != tt.method {
+				t.Errorf("Method() = %v, want %v", did.Method(), tt.method)
+			}
+		})
+	}
+}
+
+func TestParseHandle(t *testing.T) {
+	tests := []struct {
+		raw        string
+		want       Handle
+		valid      bool
+		allowedTLD bool
+	}{
+		{raw: "alice.bsky.social", want: "alice.bsky.social", valid: true, allowedTLD: true},
+		{raw: "Alice.Bsky.Social", want: "alice.bsky.social", valid: true, allowedTLD: true},
+		{raw: "xn--ls8h.test", want: "xn--ls8h.test", valid: true, allowedTLD: true},
+		{raw: "a-b.c-d.io", want: "a-b.c-d.io", valid: true, allowedTLD: true},
+		{raw: "printer.local", want: "printer.local", valid: true, allowedTLD: false},
+		{raw: "single", valid: false},
+		{raw: "-alice.test", valid: false},
+		{raw: "alice-.test", valid: false},
+		{raw: "alice.123", valid: false},
+		{raw: "alice..test", valid: false},
+		{raw: "alice_bob.test", valid: false},
+		{raw: "alice.test.", valid: false},
+		{raw: strings.Repeat("a", 64) + ".test", valid: false},
+		{raw: strings.Repeat("abcdefghi.", 26) + "test", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			handle, err := ParseHandle(tt.raw)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseHandle(%q) error = %v, valid %v", tt.raw, err, tt.valid)
+			}
+			if !tt.valid {
+				return
+			}
+			if handle != tt.want {
+				t.Errorf("ParseHandle(%q) = %v, want %v", tt.raw, handle, tt.want)
+			}
+			if handle.AllowedTLD() != tt.allowedTLD {
+				t.Errorf("AllowedTLD() = %v, want %v", handle.AllowedTLD(), tt.allowedTLD)
+			}
+		})
+	}
+}
+
+func TestParseNSID(t *testing.T) {
+	tests := []struct {
+		raw       string
+		valid     bool
+		authority string
+		name      string
+	}{
+		{raw: "xyz.statusphere.status", valid: true, authority: "xyz.statusphere", name: "status"},
+		{raw: "app.bsky.actor.profile", valid: true, authority: "app.bsky.actor", name: "profile"},
+		{raw: "com.example.fooBar", valid: true, authority: "com.example", name: "fooBar"},
+		{raw: "com.example", valid: false},
+		{raw: "com.example.foo-bar", valid: false},
+		{raw: "com.example.3foo", valid: false},
+		{raw: "1com.example.foo", valid: false},
+		{raw: "com..example.foo", valid: false},
+		{raw: "com.example.foo.", valid: false},
+		{raw: "com.example.*", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			nsid, err := ParseNSID(tt.raw)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseNSID(%q) error = %v, valid %v", tt.raw, err, tt.valid)
+			}
+			if !tt.valid {
+				return
+			}
+			if nsid.Authority() != tt.authority || nsid.Name() != tt.name {
+				t.Errorf("ParseNSID(%q) = (%v, %v), want (%v, %v)", tt.raw, nsid.Authority(), nsid.Name(), tt.authority, tt.name)
+			}
+		})
+	}
+}
+
+func TestParseRecordKey(t *testing.T) {
+	tests := []struct {
+		raw   string
+		valid bool
+	}{
+		{raw: "3jzfcijpj2z2a", valid: true},
+		{raw: "self", valid: true},
+		{raw: "example.com", valid: true},
+		{raw: "~1.2-3_", valid: true},
+		{raw: "dHJ1ZQ:", valid: true},
+		{raw: strings.Repeat("a", 512), valid: true},
+		{raw: "", valid: false},
+		{raw: ".", valid: false},
+		{raw: "..", valid: false},
+		{raw: "a/b", valid: false},
+		{raw: "a b", valid: false},
+		{raw: "#extra", valid: false},
+		{raw: strings.Repeat("a", 513), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			_, err := ParseRecordKey(tt.raw)
+			if (err == nil) != tt.valid {
+				t.Errorf("ParseRecordKey(%q) error = %v, valid %v", tt.raw, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParseATURI(t *testing.T) {
+	tests := []struct {
+		raw        string
+		valid      bool
+		authority  string
+		did        DID
+		collection NSID
+		rkey       RecordKey
+	}{
+		{
+			raw:        "at://did:plc:ewvi7nxzyoun6zhxrhs64oiz/xyz.statusphere.status/3jzfcijpj2z2a",
+			valid:      true,
+			authority:  "did:plc:ewvi7nxzyoun6zhxrhs64oiz",
+			did:        "did:plc:ewvi7nxzyoun6zhxrhs64oiz",
+			collection: "xyz.statusphere.status",
+			rkey:       "3jzfcijpj2z2a",
+		},
+		{
+			raw:        "at://alice.bsky.social/app.bsky.actor.profile",
+			valid:      true,
+			authority:  "alice.bsky.social",
+			collection: "app.bsky.actor.profile",
+		},
+		{raw: "at://did:web:example.com", valid: true, authority: "did:web:example.com", did: "did:web:example.com"},
+		{raw: "https://example.com", valid: false},
+		{raw: "at://", valid: false},
+		{raw: "at://did:plc:abc/", valid: false},
+		{raw: "at://did:plc:abc/not-an-nsid", valid: false},
+		{raw: "at://did:plc:abc/xyz.statusphere.status/", valid: false},
+		{raw: "at://did:plc:abc/xyz.statusphere.status/a/b", valid: false},
+		{raw: "at://did:plc:abc/xyz.statusphere.status/a?x=1", valid: false},
+		{raw: "at://not_a_handle/xyz.statusphere.status", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			uri, err := ParseATURI(tt.raw)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseATURI(%q) error = %v, valid %v", tt.raw, err, tt.valid)
+			}
+			if !tt.valid {
+				return
+			}
+			if uri.Authority() != tt.authority {
+				t.Errorf("Authority() = %v, want %v", uri.Authority(), tt.authority)
+			}
+			if uri.DID() != tt.did {
+				t.Errorf("DID() = %v, want %v", uri.DID(), tt.did)
+			}
+			if uri.Collection() != tt.collection {
+				t.Errorf("Collection() = %v, want %v", uri.Collection(), tt.collection)
+			}
+			if uri.RecordKey() != tt.rkey {
+				t.Errorf("RecordKey() = %v, want %v", uri.RecordKey(), tt.rkey)
+			}
+		})
+	}
+}
+
+func TestNewRecordURI(t *testing.T) {
+	uri := NewRecordURI("did:plc:abc", "xyz.statusphere.status", "3jzfcijpj2z2a")
+	if _, err := ParseATURI(uri.String()); err != nil {
+		t.Errorf("NewRecordURI() built an invalid URI: %v", err)
+	}
+	if uri != "at://did:plc:abc/xyz.statusphere.status/3jzfcijpj2z2a" {
+		t.Errorf("NewRecordURI() = %v", uri)
+	}
+}
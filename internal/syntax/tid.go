@@ -0,0 +1,107 @@
+package syntax
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// base32SortAlphabet is the sortable base32 alphabet used by TIDs
+const base32SortAlphabet = "234567abcdefghijklmnopqrstuvwxyz"
+
+// MaxClockID is the largest clock identifier that fits in a TID
+const MaxClockID = 1<<10 - 1
+
+var tidRegex = regexp.MustCompile(`^[234567abcdefghij][234567abcdefghijklmnopqrstuvwxyz]{12}$`)
+
+// TID is a timestamp identifier: 53 bits of microseconds since the UNIX
+// epoch and a 10 bit clock identifier, encoded as 13 sortable base32 characters
+type TID string
+
+// ParseTID validates a TID string
+func ParseTID(raw string) (TID, error) {
+	if !tidRegex.MatchString(raw) {
+		return "", fmt.Errorf("invalid TID %q", raw)
+	}
+	return TID(raw), nil
+}
+
+// NewTID encodes a TID from a time and clock identifier
+func NewTID(t time.Time, clockID uint16) TID {
+	return newTIDFromInt(uint64(t.UnixMicro())<<10 | uint64(clockID&MaxClockID))
+}
+
+// newTIDFromInt encodes the integer form of a TID
+func newTIDFromInt(v uint64) TID {
+	v &= 1<<63 - 1
+	var buf [13]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = base32SortAlphabet[v&31]
+		v >>= 5
+	}
+	return TID(buf[:])
+}
+
+// Integer returns the integer form of the TID
+func (t TID) Integer() uint64 {
+	var v uint64
+	for i := 0; i < len(t); i++ {
+		for j := 0; j < len(base32SortAlphabet); j++ {
+			if base32SortAlphabet[j] == t[i] {
+				v = v<<5 | uint64(j)
+				break
+			}
+		}
+	}
+	return v
+}
+
+// Time returns the timestamp encoded in the TID
+func (t TID) Time() time.Time {
+	return time.UnixMicro(int64(t.Integer() >> 10)).UTC()
+}
+
+// ClockID returns the clock identifier encoded in the TID
+func (t TID) ClockID() uint16 {
+	return uint16(t.Integer() & MaxClockID)
+}
+
+// String returns the TID as a string
+func (t TID) String() string {
+	return string(t)
+}
+
+// TIDGenerator produces strictly increasing TIDs, even when called
+// concurrently or when the wall clock stalls or steps backwards
+type TIDGenerator struct {
+	clockID uint16
+	now     func() time.Time
+
+	mu   sync.Mutex
+	last uint64 // Microseconds used for the previous TID
+}
+
+// NewTIDGenerator creates a generator using the given clock identifier.
+// Processes writing to the same repo should use distinct clock identifiers.
+func NewTIDGenerator(clockID uint16) (*TIDGenerator, error) {
+	if clockID > MaxClockID {
+		return nil, errors.New("clock ID must be at most 1023")
+	}
+	return &TIDGenerator{clockID: clockID, now: time.Now}, nil
+}
+
+// Next returns a TID greater than every TID previously returned by the generator
+func (g *TIDGenerator) Next() TID {
+	micros := uint64(g.now().UnixMicro())
+
+	g.mu.Lock()
+	if micros <= g.last {
+		micros = g.last + 1
+	}
+	g.last = micros
+	g.mu.Unlock()
+
+	return newTIDFromInt(micros<<10 | uint64(g.clockID))
+}
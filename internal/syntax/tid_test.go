@@ -0,0 +1,115 @@
+package syntax
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTID(t *testing.T) {
+	tests := []struct {
+		raw   string
+		valid bool
+	}{
+		{raw: "3jzfcijpj2z2a", valid: true},
+		{raw: "2222222222222", valid: true},
+		{raw: "jzzzzzzzzzzzz", valid: true},
+		{raw: "kzzzzzzzzzzzz", valid: false}, // High bit set
+		{raw: "3jzfcijpj2z2", valid: false},
+		{raw: "3jzfcijpj2z2aa", valid: false},
+		{raw: "3jzfcijpj2z21", valid: false},
+		{raw: "3JZFCIJPJ2Z2A", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			_, err := ParseTID(tt.raw)
+			if (err == nil) != tt.valid {
+				t.Errorf("ParseTID(%q) error = %v, valid %v", tt.raw, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNewTID(t *testing.T) {
+	ts := time.Date(2025, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	tid := NewTID(ts, 42)
+
+	if _, err := ParseTID(tid.String()); err != nil {
+		t.Fatalf("NewTID() built an invalid TID: %v", err)
+	}
+	if !tid.Time().Equal(ts) {
+		t.Errorf("Time() = %v, want %v", tid.Time(), ts)
+	}
+	if tid.ClockID() != 42 {
+		t.Errorf("ClockID() = %v, want 42", tid.ClockID())
+	}
+
+	// String order matches time order
+	later := NewTID(ts.Add(time.Microsecond), 0)
+	if later <= tid {
+		t.Errorf("NewTID() not sortable: %v <= %v", later, tid)
+	}
+}
+
+func TestTIDGeneratorMonotonic(t *testing.T) {
+	gen, err := NewTIDGenerator(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A clock that stalls, then steps backwards
+	fixed := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	calls := 0
+	gen.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls > 500 {
+			return fixed.Add(-time.Hour)
+		}
+		return fixed
+	}
+
+	const goroutines, perGoroutine = 8, 250
+	results := make(chan TID, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prev := TID("")
+			for j := 0; j < perGoroutine; j++ {
+				tid := gen.Next()
+				if tid <= prev {
+					t.Errorf("Next() = %v after %v", tid, prev)
+				}
+				prev = tid
+				results <- tid
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[TID]bool)
+	for tid := range results {
+		if seen[tid] {
+			t.Fatalf("duplicate TID %v", tid)
+		}
+		seen[tid] = true
+		if tid.ClockID() != 7 {
+			t.Errorf("ClockID() = %v, want 7", tid.ClockID())
+		}
+	}
+}
+
+func TestNewTIDGeneratorClockID(t *testing.T) {
+	if _, err := NewTIDGenerator(MaxClockID); err != nil {
+		t.Errorf("NewTIDGenerator(%d) error = %v", MaxClockID, err)
+	}
+	if _, err := NewTIDGenerator(MaxClockID + 1); err == nil {
+		t.Errorf("NewTIDGenerator(%d) accepted an out of range clock ID", MaxClockID+1)
+	}
+}